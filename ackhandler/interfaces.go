@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"time"
 
+	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/frames"
 	"github.com/lucas-clemente/quic-go/protocol"
 )
@@ -13,12 +14,35 @@ type SentPacketHandler interface {
 	ReceivedAck(ackFrame *frames.AckFrame, withPacketNumber protocol.PacketNumber, recvTime time.Time) error
 
 	SendingAllowed() bool
+	// OnApplicationLimited is called when sending is allowed, but there's no data to send
+	OnApplicationLimited()
+	GetPacingTimeout() time.Time
 	GetStopWaitingFrame(force bool) *frames.StopWaitingFrame
 	DequeuePacketForRetransmission() (packet *Packet)
 	GetLeastUnacked() protocol.PacketNumber
 
 	GetAlarmTimeout() time.Time
 	OnAlarm()
+
+	GetStatistics() SentPacketStatistics
+
+	SetCongestionControl(congestion.SendAlgorithm)
+}
+
+// SentPacketStatistics is a snapshot of the statistics collected by the SentPacketHandler
+type SentPacketStatistics struct {
+	PacketsSent           uint64
+	BytesSent             protocol.ByteCount
+	PacketsRetransmitted  uint64
+	BytesRetransmitted    protocol.ByteCount
+	PacketsLost           uint64
+	BytesLost             protocol.ByteCount
+	PacketsSpuriouslyLost uint64
+
+	BytesInFlight     protocol.ByteCount
+	CongestionWindow  protocol.ByteCount
+	InSlowStart       bool
+	BandwidthEstimate congestion.Bandwidth
 }
 
 // ReceivedPacketHandler handles ACKs needed to send for incoming packets
@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/congestion"
@@ -15,7 +16,13 @@ import (
 const (
 	// Maximum reordering in time space before time based loss detection considers a packet lost.
 	// In fraction of an RTT.
-	timeReorderingFraction = 1.0 / 8
+	initialTimeReorderingFraction = 1.0 / 4
+	// The reordering fraction is doubled on every spurious loss, up to this maximum.
+	maxTimeReorderingFraction = 1.0
+	// The maximum number of tail loss probes sent before an RTO fires.
+	maxTailLossProbes = 2
+	// Minimum time after the last sent packet a TLP alarm may be set for.
+	minTailLossProbeTimeout = 10 * time.Millisecond
 	// defaultRTOTimeout is the RTO time on new connections
 	defaultRTOTimeout = 500 * time.Millisecond
 	// Minimum time in the future an RTO alarm may be set for.
@@ -39,6 +46,8 @@ var errPacketNumberNotIncreasing = errors.New("Already sent a packet with a high
 type sentPacketHandler struct {
 	lastSentPacketNumber protocol.PacketNumber
 	skippedPackets       []protocol.PacketNumber
+	// Packets that were declared lost. If one of them is acked later, the loss was spurious.
+	lostPackets []protocol.PacketNumber
 
 	LargestAcked protocol.PacketNumber
 
@@ -56,32 +65,44 @@ type sentPacketHandler struct {
 
 	// The number of times an RTO has been sent without receiving an ack.
 	rtoCount uint32
+	// The number of tail loss probes that have been sent without receiving an ack.
+	tlpCount uint32
+	// Set when the TLP alarm fired. The probe may be sent even if the congestion controller doesn't allow sending.
+	tailLossProbeAllowed bool
+
+	// The time at which the last packet was sent. The TLP alarm is set relative to it.
+	lastSentTime time.Time
 
 	// The time at which the next packet will be considered lost based on early transmit or exceeding the reordering window in time.
 	lossTime time.Time
+	// The reordering window, in fraction of an RTT. It is widened when spurious losses are detected.
+	timeReorderingFraction float64
 
 	// The alarm timeout
 	alarm time.Time
+
+	// counters for GetStatistics
+	stats SentPacketStatistics
 }
 
 // NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats) SentPacketHandler {
-	congestion := congestion.NewCubicSender(
-		congestion.DefaultClock{},
-		rttStats,
-		false, /* don't use reno since chromium doesn't (why?) */
-		protocol.InitialCongestionWindow,
-		protocol.DefaultMaxCongestionWindow,
-	)
-
+// The congestion controller should use the same RTTStats.
+func NewSentPacketHandler(rttStats *congestion.RTTStats, congestion congestion.SendAlgorithm) SentPacketHandler {
 	return &sentPacketHandler{
-		packetHistory:      NewPacketList(),
-		stopWaitingManager: stopWaitingManager{},
-		rttStats:           rttStats,
-		congestion:         congestion,
+		packetHistory:          NewPacketList(),
+		stopWaitingManager:     stopWaitingManager{},
+		rttStats:               rttStats,
+		congestion:             congestion,
+		timeReorderingFraction: initialTimeReorderingFraction,
 	}
 }
 
+// SetCongestionControl replaces the congestion controller
+// It is used when the congestion controller is negotiated during the handshake.
+func (h *sentPacketHandler) SetCongestionControl(congestion congestion.SendAlgorithm) {
+	h.congestion = congestion
+}
+
 func (h *sentPacketHandler) largestInOrderAcked() protocol.PacketNumber {
 	if f := h.packetHistory.Front(); f != nil {
 		return f.Value.PacketNumber - 1
@@ -111,10 +132,6 @@ func (h *sentPacketHandler) SentPacket(packet *Packet) error {
 	if packet.Length == 0 {
 		return errors.New("SentPacketHandler: packet cannot be empty")
 	}
-	h.bytesInFlight += packet.Length
-
-	h.lastSentPacketNumber = packet.PacketNumber
-	h.packetHistory.PushBack(*packet)
 
 	h.congestion.OnPacketSent(
 		now,
@@ -124,6 +141,14 @@ func (h *sentPacketHandler) SentPacket(packet *Packet) error {
 		true, /* TODO: is retransmittable */
 	)
 
+	h.bytesInFlight += packet.Length
+	h.lastSentPacketNumber = packet.PacketNumber
+	h.lastSentTime = now
+	h.tailLossProbeAllowed = false
+	h.packetHistory.PushBack(*packet)
+	h.stats.PacketsSent++
+	h.stats.BytesSent += packet.Length
+
 	h.updateLossDetectionAlarm()
 
 	return nil
@@ -140,6 +165,9 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *frames.AckFrame, withPacketNum
 	}
 	h.largestReceivedPacketWithAck = withPacketNumber
 
+	// a repeated ACK might acknowledge packets that were declared lost in the meantime
+	h.detectSpuriousLosses(ackFrame)
+
 	// ignore repeated ACK (ACKs that don't have a higher LargestAcked than the last ACK)
 	if ackFrame.LargestAcked <= h.largestInOrderAcked() {
 		return nil
@@ -238,10 +266,12 @@ func (h *sentPacketHandler) updateLossDetectionAlarm() {
 	}
 
 	// TODO(#496): Handle handshake packets separately
-	// TODO(#497): TLP
 	if !h.lossTime.IsZero() {
 		// Early retransmit timer or time loss detection.
 		h.alarm = h.lossTime
+	} else if h.shouldSendTailLossProbe() {
+		// TLP
+		h.alarm = h.lastSentTime.Add(h.computeTLPTimeout())
 	} else {
 		// RTO
 		h.alarm = time.Now().Add(h.computeRTOTimeout())
@@ -253,7 +283,7 @@ func (h *sentPacketHandler) detectLostPackets() {
 	now := time.Now()
 
 	maxRTT := float64(utils.MaxDuration(h.rttStats.LatestRTT(), h.rttStats.SmoothedRTT()))
-	delayUntilLost := time.Duration((1.0 + timeReorderingFraction) * maxRTT)
+	delayUntilLost := time.Duration((1.0 + h.timeReorderingFraction) * maxRTT)
 
 	var lostPackets []*PacketElement
 	for el := h.packetHistory.Front(); el != nil; el = el.Next() {
@@ -275,17 +305,43 @@ func (h *sentPacketHandler) detectLostPackets() {
 	if len(lostPackets) > 0 {
 		for _, p := range lostPackets {
 			h.queuePacketForRetransmission(p)
-			h.congestion.OnPacketLost(p.Value.PacketNumber, p.Value.Length, h.bytesInFlight)
+			h.onPacketLost(&p.Value)
+			h.trackLostPacket(p.Value.PacketNumber)
+		}
+	}
+}
+
+// detectSpuriousLosses checks if the ACK acknowledges packets that were declared lost
+// This happens if packets are reordered by more than the reordering window.
+// The congestion controller is notified, and the reordering window is widened.
+func (h *sentPacketHandler) detectSpuriousLosses(ackFrame *frames.AckFrame) {
+	lostPackets := h.lostPackets[:0]
+	for _, p := range h.lostPackets {
+		// the peer doesn't acknowledge packets below the LowestAcked any more
+		if p < ackFrame.LowestAcked {
+			continue
+		}
+		if !ackFrame.AcksPacket(p) {
+			lostPackets = append(lostPackets, p)
+			continue
 		}
+		utils.Debugf("\tPacket 0x%x was declared lost, but was acked", p)
+		h.stats.PacketsSpuriouslyLost++
+		h.congestion.OnSpuriousPacketLoss(p)
+		h.timeReorderingFraction = math.Min(2*h.timeReorderingFraction, maxTimeReorderingFraction)
 	}
+	h.lostPackets = lostPackets
 }
 
 func (h *sentPacketHandler) OnAlarm() {
 	// TODO(#496): Handle handshake packets separately
-	// TODO(#497): TLP
 	if !h.lossTime.IsZero() {
 		// Early retransmit or time loss detection
 		h.detectLostPackets()
+	} else if h.shouldSendTailLossProbe() {
+		// TLP
+		h.queueTailLossProbe()
+		h.tlpCount++
 	} else {
 		// RTO
 		h.retransmitOldestTwoPackets()
@@ -302,7 +358,7 @@ func (h *sentPacketHandler) GetAlarmTimeout() time.Time {
 func (h *sentPacketHandler) onPacketAcked(packetElement *PacketElement) {
 	h.bytesInFlight -= packetElement.Value.Length
 	h.rtoCount = 0
-	// TODO(#497): h.tlpCount = 0
+	h.tlpCount = 0
 	h.packetHistory.Remove(packetElement)
 }
 
@@ -314,9 +370,25 @@ func (h *sentPacketHandler) DequeuePacketForRetransmission() *Packet {
 	// packets are usually NACKed in descending order. So use the slice as a stack
 	packet := h.retransmissionQueue[queueLen-1]
 	h.retransmissionQueue = h.retransmissionQueue[:queueLen-1]
+	// the tail loss probe may only bypass the congestion controller for the packet it is sent in
+	// If the probe doesn't produce a packet, the next packet must not be sent regardless of the congestion window.
+	if len(h.retransmissionQueue) == 0 {
+		h.tailLossProbeAllowed = false
+	}
+	h.stats.PacketsRetransmitted++
+	h.stats.BytesRetransmitted += packet.Length
 	return packet
 }
 
+func (h *sentPacketHandler) GetStatistics() SentPacketStatistics {
+	stats := h.stats
+	stats.BytesInFlight = h.bytesInFlight
+	stats.CongestionWindow = h.congestion.GetCongestionWindow()
+	stats.InSlowStart = h.congestion.InSlowStart()
+	stats.BandwidthEstimate = h.congestion.BandwidthEstimate()
+	return stats
+}
+
 func (h *sentPacketHandler) GetLeastUnacked() protocol.PacketNumber {
 	return h.largestInOrderAcked() + 1
 }
@@ -326,11 +398,30 @@ func (h *sentPacketHandler) GetStopWaitingFrame(force bool) *frames.StopWaitingF
 }
 
 func (h *sentPacketHandler) SendingAllowed() bool {
-	congestionLimited := h.bytesInFlight > h.congestion.GetCongestionWindow()
+	// the congestion controller limits sending by the congestion window as well as by pacing
+	// a tail loss probe is sent regardless
+	congestionLimited := h.congestion.TimeUntilSend(time.Now(), h.bytesInFlight) != 0 && !h.tailLossProbeAllowed
 	maxTrackedLimited := protocol.PacketNumber(len(h.retransmissionQueue)+h.packetHistory.Len()) >= protocol.MaxTrackedSentPackets
 	return !(congestionLimited || maxTrackedLimited)
 }
 
+// OnApplicationLimited tells the congestion controller that it's not limited by the congestion window
+// Otherwise, BBR would take the bandwidth samples of application limited phases as an estimate of the available bandwidth.
+func (h *sentPacketHandler) OnApplicationLimited() {
+	h.congestion.OnApplicationLimited(h.bytesInFlight)
+}
+
+// GetPacingTimeout returns the time at which the next packet may be sent
+// It returns the zero time if sending is allowed now, or if it is blocked until an ACK arrives.
+func (h *sentPacketHandler) GetPacingTimeout() time.Time {
+	now := time.Now()
+	delay := h.congestion.TimeUntilSend(now, h.bytesInFlight)
+	if delay == 0 || delay == utils.InfDuration {
+		return time.Time{}
+	}
+	return now.Add(delay)
+}
+
 func (h *sentPacketHandler) retransmitOldestTwoPackets() {
 	if p := h.packetHistory.Front(); p != nil {
 		h.queueRTO(p)
@@ -340,14 +431,43 @@ func (h *sentPacketHandler) retransmitOldestTwoPackets() {
 	}
 }
 
+// queueTailLossProbe retransmits the last sent packet
+// The packet is not declared lost, and stays in the packet history. The probe only elicits an ACK from the peer,
+// which then allows detecting the loss of the tail using time based loss detection.
+func (h *sentPacketHandler) queueTailLossProbe() {
+	el := h.packetHistory.Back()
+	if el == nil {
+		return
+	}
+	packet := el.Value
+	utils.Debugf("\tQueueing packet 0x%x for retransmission (TLP)", packet.PacketNumber)
+	h.retransmissionQueue = append(h.retransmissionQueue, &packet)
+	h.tailLossProbeAllowed = true
+}
+
 func (h *sentPacketHandler) queueRTO(el *PacketElement) {
 	packet := &el.Value
 	utils.Debugf("\tQueueing packet 0x%x for retransmission (RTO)", packet.PacketNumber)
 	h.queuePacketForRetransmission(el)
-	h.congestion.OnPacketLost(packet.PacketNumber, packet.Length, h.bytesInFlight)
+	h.onPacketLost(packet)
 	h.congestion.OnRetransmissionTimeout(true)
 }
 
+func (h *sentPacketHandler) onPacketLost(packet *Packet) {
+	h.stats.PacketsLost++
+	h.stats.BytesLost += packet.Length
+	h.congestion.OnPacketLost(packet.PacketNumber, packet.Length, h.bytesInFlight)
+}
+
+// trackLostPacket remembers a packet declared lost by the loss detection, in order to detect spurious losses
+// Packets retransmitted on an RTO are not tracked. An RTO is not caused by reordering, so a late ACK for them must not widen the reordering window.
+func (h *sentPacketHandler) trackLostPacket(pn protocol.PacketNumber) {
+	h.lostPackets = append(h.lostPackets, pn)
+	if len(h.lostPackets) > protocol.MaxTrackedLostPackets {
+		h.lostPackets = h.lostPackets[1:]
+	}
+}
+
 func (h *sentPacketHandler) queuePacketForRetransmission(packetElement *PacketElement) {
 	packet := &packetElement.Value
 	h.bytesInFlight -= packet.Length
@@ -360,6 +480,22 @@ func (h *sentPacketHandler) queuePacketForRetransmission(packetElement *PacketEl
 	h.stopWaitingManager.QueuedRetransmissionForPacketNumber(packet.PacketNumber)
 }
 
+// shouldSendTailLossProbe says if the next alarm is a TLP alarm
+// Without an RTT estimate, no TLPs are sent, and the RTO is used.
+func (h *sentPacketHandler) shouldSendTailLossProbe() bool {
+	return h.tlpCount < maxTailLossProbes && h.rttStats.SmoothedRTT() != 0
+}
+
+// computeTLPTimeout computes the time after the last sent packet at which a TLP is sent
+func (h *sentPacketHandler) computeTLPTimeout() time.Duration {
+	srtt := h.rttStats.SmoothedRTT()
+	if h.packetHistory.Len() == 1 {
+		// The peer might delay the ACK for a single packet.
+		return utils.MaxDuration(2*srtt, srtt*3/2+protocol.AckSendDelay)
+	}
+	return utils.MaxDuration(2*srtt, minTailLossProbeTimeout)
+}
+
 func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
 	rto := h.congestion.RetransmissionDelay()
 	if rto == 0 {
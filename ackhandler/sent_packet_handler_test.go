@@ -6,6 +6,7 @@ import (
 	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/frames"
 	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -15,12 +16,18 @@ type mockCongestion struct {
 	maybeExitSlowStart      bool
 	onRetransmissionTimeout bool
 	getCongestionWindow     bool
+	timeUntilSend           time.Duration
 	packetsAcked            [][]interface{}
 	packetsLost             [][]interface{}
+	spuriousLosses          []protocol.PacketNumber
+	applicationLimited      []protocol.ByteCount
 }
 
 func (m *mockCongestion) TimeUntilSend(now time.Time, bytesInFlight protocol.ByteCount) time.Duration {
-	panic("not implemented")
+	if bytesInFlight >= m.GetCongestionWindow() {
+		return utils.InfDuration
+	}
+	return m.timeUntilSend
 }
 
 func (m *mockCongestion) OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) bool {
@@ -45,6 +52,14 @@ func (m *mockCongestion) RetransmissionDelay() time.Duration {
 	return defaultRTOTimeout
 }
 
+func (m *mockCongestion) InSlowStart() bool {
+	return true
+}
+
+func (m *mockCongestion) BandwidthEstimate() congestion.Bandwidth {
+	return 1337 * congestion.BytesPerSecond
+}
+
 func (m *mockCongestion) SetNumEmulatedConnections(n int)         { panic("not implemented") }
 func (m *mockCongestion) OnConnectionMigration()                  { panic("not implemented") }
 func (m *mockCongestion) SetSlowStartLargeReduction(enabled bool) { panic("not implemented") }
@@ -57,6 +72,14 @@ func (m *mockCongestion) OnPacketLost(n protocol.PacketNumber, l protocol.ByteCo
 	m.packetsLost = append(m.packetsLost, []interface{}{n, l, bif})
 }
 
+func (m *mockCongestion) OnSpuriousPacketLoss(n protocol.PacketNumber) {
+	m.spuriousLosses = append(m.spuriousLosses, n)
+}
+
+func (m *mockCongestion) OnApplicationLimited(bif protocol.ByteCount) {
+	m.applicationLimited = append(m.applicationLimited, bif)
+}
+
 var _ = Describe("SentPacketHandler", func() {
 	var (
 		handler     *sentPacketHandler
@@ -65,7 +88,8 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats).(*sentPacketHandler)
+		cong := congestion.NewCubicSender(congestion.DefaultClock{}, rttStats, false, protocol.InitialCongestionWindow, protocol.DefaultMaxCongestionWindow)
+		handler = NewSentPacketHandler(rttStats, cong).(*sentPacketHandler)
 		streamFrame = frames.StreamFrame{
 			StreamID: 5,
 			Data:     []byte{0x13, 0x37},
@@ -627,6 +651,22 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.congestion = cong
 		})
 
+		It("replaces the congestion controller", func() {
+			newCong := &mockCongestion{}
+			handler.SetCongestionControl(newCong)
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 42})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cong.argsOnPacketSent).To(BeNil())
+			Expect(newCong.argsOnPacketSent).ToNot(BeNil())
+		})
+
+		It("tells the congestion controller when it's application limited", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 42})
+			Expect(err).ToNot(HaveOccurred())
+			handler.OnApplicationLimited()
+			Expect(cong.applicationLimited).To(Equal([]protocol.ByteCount{42}))
+		})
+
 		It("should call OnSent", func() {
 			p := &Packet{
 				PacketNumber: 1,
@@ -634,7 +674,7 @@ var _ = Describe("SentPacketHandler", func() {
 			}
 			err := handler.SentPacket(p)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(cong.argsOnPacketSent[1]).To(Equal(protocol.ByteCount(42)))
+			Expect(cong.argsOnPacketSent[1]).To(BeZero()) // bytes in flight before sending the packet
 			Expect(cong.argsOnPacketSent[2]).To(Equal(protocol.PacketNumber(1)))
 			Expect(cong.argsOnPacketSent[3]).To(Equal(protocol.ByteCount(42)))
 			Expect(cong.argsOnPacketSent[4]).To(BeTrue())
@@ -652,6 +692,17 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(cong.packetsLost).To(BeEmpty())
 		})
 
+		It("should call OnSpuriousPacketLoss", func() {
+			handler.SentPacket(&Packet{PacketNumber: 1, Frames: []frames.Frame{}, Length: 1})
+			handler.SentPacket(&Packet{PacketNumber: 2, Frames: []frames.Frame{}, Length: 1})
+			handler.packetHistory.Front().Value.SendTime = time.Now().Add(-time.Hour)
+			err := handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 2}, 1, time.Now()) // packet 1 is declared lost
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 1}, 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cong.spuriousLosses).To(Equal([]protocol.PacketNumber{1}))
+		})
+
 		It("should call MaybeExitSlowStart and OnPacketLost", func() {
 			handler.SentPacket(&Packet{PacketNumber: 1, Frames: []frames.Frame{}, Length: 1})
 			handler.SentPacket(&Packet{PacketNumber: 2, Frames: []frames.Frame{}, Length: 1})
@@ -673,11 +724,69 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.SendingAllowed()).To(BeFalse())
 		})
 
+		It("denies sending while the congestion controller paces packets", func() {
+			handler.congestion.(*mockCongestion).timeUntilSend = 5 * time.Millisecond
+			Expect(handler.SendingAllowed()).To(BeFalse())
+		})
+
 		It("allows or denies sending based on the number of tracked packets", func() {
 			Expect(handler.SendingAllowed()).To(BeTrue())
 			handler.retransmissionQueue = make([]*Packet, protocol.MaxTrackedSentPackets)
 			Expect(handler.SendingAllowed()).To(BeFalse())
 		})
+
+		Context("pacing timeout", func() {
+			It("has no pacing timeout if sending is allowed", func() {
+				Expect(handler.GetPacingTimeout().IsZero()).To(BeTrue())
+			})
+
+			It("returns the time when the next packet may be sent", func() {
+				handler.congestion.(*mockCongestion).timeUntilSend = 5 * time.Millisecond
+				Expect(handler.GetPacingTimeout()).To(BeTemporally("~", time.Now().Add(5*time.Millisecond), time.Millisecond))
+			})
+
+			It("has no pacing timeout if the congestion window is full", func() {
+				err := handler.SentPacket(&Packet{PacketNumber: 1, Frames: []frames.Frame{}, Length: protocol.DefaultTCPMSS + 1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(handler.GetPacingTimeout().IsZero()).To(BeTrue())
+			})
+		})
+	})
+
+	Context("statistics", func() {
+		It("counts sent packets", func() {
+			handler.SentPacket(&Packet{PacketNumber: 1, Frames: []frames.Frame{}, Length: 10})
+			handler.SentPacket(&Packet{PacketNumber: 2, Frames: []frames.Frame{}, Length: 20})
+			stats := handler.GetStatistics()
+			Expect(stats.PacketsSent).To(Equal(uint64(2)))
+			Expect(stats.BytesSent).To(Equal(protocol.ByteCount(30)))
+			Expect(stats.BytesInFlight).To(Equal(protocol.ByteCount(30)))
+			Expect(stats.PacketsLost).To(BeZero())
+			Expect(stats.PacketsRetransmitted).To(BeZero())
+		})
+
+		It("counts lost and retransmitted packets", func() {
+			handler.SentPacket(&Packet{PacketNumber: 1, Frames: []frames.Frame{&streamFrame}, Length: 10})
+			handler.SentPacket(&Packet{PacketNumber: 2, Frames: []frames.Frame{&streamFrame}, Length: 20})
+			handler.SentPacket(&Packet{PacketNumber: 3, Frames: []frames.Frame{&streamFrame}, Length: 30})
+			handler.OnAlarm() // RTO, meaning 2 lost packets
+			stats := handler.GetStatistics()
+			Expect(stats.PacketsLost).To(Equal(uint64(2)))
+			Expect(stats.BytesLost).To(Equal(protocol.ByteCount(30)))
+			Expect(stats.PacketsRetransmitted).To(BeZero())
+			Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
+			stats = handler.GetStatistics()
+			Expect(stats.PacketsRetransmitted).To(Equal(uint64(1)))
+			Expect(stats.BytesRetransmitted).To(BeNumerically(">", 0))
+		})
+
+		It("reports the congestion controller state", func() {
+			handler.congestion = &mockCongestion{}
+			stats := handler.GetStatistics()
+			Expect(stats.CongestionWindow).To(Equal(protocol.DefaultTCPMSS))
+			Expect(stats.InSlowStart).To(BeTrue())
+			Expect(stats.BandwidthEstimate).To(Equal(1337 * congestion.BytesPerSecond))
+		})
 	})
 
 	Context("calculating RTO", func() {
@@ -727,9 +836,9 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.lossTime.IsZero()).To(BeFalse())
 
 			// RTT is around 1h now.
-			// The formula is (1+1/8) * RTT, so this should be around that number
-			Expect(handler.lossTime.Sub(time.Now())).To(BeNumerically("~", time.Hour*9/8, time.Minute))
-			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", time.Hour*9/8, time.Minute))
+			// The formula is (1+1/4) * RTT, so this should be around that number
+			Expect(handler.lossTime.Sub(time.Now())).To(BeNumerically("~", time.Hour*5/4, time.Minute))
+			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", time.Hour*5/4, time.Minute))
 
 			handler.packetHistory.Front().Value.SendTime = time.Now().Add(-2 * time.Hour)
 			handler.OnAlarm()
@@ -748,6 +857,14 @@ var _ = Describe("SentPacketHandler", func() {
 			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, time.Now().Add(time.Hour))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(handler.lossTime.IsZero()).To(BeTrue())
+			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", handler.computeTLPTimeout(), time.Minute))
+
+			// The TLPs don't declare packets lost
+			for i := 0; i < maxTailLossProbes; i++ {
+				handler.OnAlarm()
+				Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
+			}
+			Expect(handler.packetHistory.Len()).To(Equal(2))
 			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", handler.computeRTOTimeout(), time.Minute))
 
 			// This means RTO, so both packets should be lost
@@ -757,8 +874,214 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("spurious losses", func() {
+		// loseFirstPacket sends two packets, and acks the second one a long time after the first one was sent
+		// time based loss detection then declares the first packet lost
+		loseFirstPacket := func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.packetHistory.Front().Value.SendTime = time.Now().Add(-time.Hour)
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 2}, 1, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetStatistics().PacketsLost).To(Equal(uint64(1)))
+			Expect(handler.lostPackets).To(Equal([]protocol.PacketNumber{1}))
+		}
+
+		It("detects a spurious loss when a lost packet is acked", func() {
+			loseFirstPacket()
+			err := handler.SentPacket(&Packet{PacketNumber: 3, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 3, LowestAcked: 1}, 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetStatistics().PacketsSpuriouslyLost).To(Equal(uint64(1)))
+			Expect(handler.lostPackets).To(BeEmpty())
+		})
+
+		It("detects a spurious loss in a repeated ACK", func() {
+			loseFirstPacket()
+			err := handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 1}, 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetStatistics().PacketsSpuriouslyLost).To(Equal(uint64(1)))
+		})
+
+		It("keeps track of lost packets that are not acked", func() {
+			handler.trackLostPacket(2)
+			handler.detectSpuriousLosses(&frames.AckFrame{
+				LargestAcked: 3,
+				LowestAcked:  1,
+				AckRanges: []frames.AckRange{
+					{FirstPacketNumber: 3, LastPacketNumber: 3},
+					{FirstPacketNumber: 1, LastPacketNumber: 1},
+				},
+			})
+			Expect(handler.GetStatistics().PacketsSpuriouslyLost).To(BeZero())
+			Expect(handler.lostPackets).To(Equal([]protocol.PacketNumber{2}))
+		})
+
+		It("forgets lost packets below the LowestAcked", func() {
+			loseFirstPacket()
+			err := handler.SentPacket(&Packet{PacketNumber: 3, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 3, LowestAcked: 2}, 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.lostPackets).To(BeEmpty())
+		})
+
+		It("limits the number of tracked lost packets", func() {
+			for i := 1; i <= protocol.MaxTrackedLostPackets+5; i++ {
+				handler.trackLostPacket(protocol.PacketNumber(i))
+			}
+			Expect(handler.lostPackets).To(HaveLen(protocol.MaxTrackedLostPackets))
+			Expect(handler.lostPackets[0]).To(Equal(protocol.PacketNumber(6)))
+		})
+
+		It("doesn't widen the reordering window when a packet retransmitted on an RTO is acked", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.queueRTO(handler.packetHistory.Front())
+			Expect(handler.lostPackets).To(BeEmpty())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 1}, 1, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetStatistics().PacketsSpuriouslyLost).To(BeZero())
+			Expect(handler.timeReorderingFraction).To(Equal(initialTimeReorderingFraction))
+		})
+
+		It("widens the reordering window", func() {
+			loseFirstPacket()
+			err := handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 1}, 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.timeReorderingFraction).To(Equal(2 * initialTimeReorderingFraction))
+		})
+
+		It("limits the reordering window", func() {
+			for i := 1; i <= 10; i++ {
+				handler.trackLostPacket(protocol.PacketNumber(i))
+			}
+			handler.detectSpuriousLosses(&frames.AckFrame{LargestAcked: 10, LowestAcked: 1})
+			Expect(handler.GetStatistics().PacketsSpuriouslyLost).To(Equal(uint64(10)))
+			Expect(handler.timeReorderingFraction).To(Equal(float64(maxTimeReorderingFraction)))
+		})
+	})
+
+	Context("TLP", func() {
+		BeforeEach(func() {
+			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
+		})
+
+		It("doesn't send TLPs without an RTT estimate", func() {
+			handler.rttStats = &congestion.RTTStats{}
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", handler.computeRTOTimeout(), time.Millisecond))
+		})
+
+		It("sets the TLP alarm to two RTTs after the last sent packet", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetAlarmTimeout()).To(Equal(handler.lastSentTime.Add(2 * time.Second)))
+		})
+
+		It("uses the minimum TLP timeout", func() {
+			handler.rttStats = &congestion.RTTStats{}
+			handler.rttStats.UpdateRTT(time.Millisecond, 0, time.Now())
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetAlarmTimeout()).To(Equal(handler.lastSentTime.Add(minTailLossProbeTimeout)))
+		})
+
+		It("accounts for a delayed ACK if only one packet is outstanding", func() {
+			handler.rttStats = &congestion.RTTStats{}
+			handler.rttStats.UpdateRTT(10*time.Millisecond, 0, time.Now())
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.GetAlarmTimeout()).To(Equal(handler.lastSentTime.Add(15*time.Millisecond + protocol.AckSendDelay)))
+		})
+
+		It("retransmits the last packet without declaring it lost", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.OnAlarm()
+			Expect(handler.tlpCount).To(BeEquivalentTo(1))
+			packet := handler.DequeuePacketForRetransmission()
+			Expect(packet).ToNot(BeNil())
+			Expect(packet.PacketNumber).To(Equal(protocol.PacketNumber(2)))
+			Expect(handler.packetHistory.Len()).To(Equal(2))
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(2)))
+			Expect(handler.GetStatistics().PacketsLost).To(BeZero())
+		})
+
+		It("allows sending the probe if the congestion window is full", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: handler.congestion.GetCongestionWindow()})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.SendingAllowed()).To(BeFalse())
+			handler.OnAlarm()
+			Expect(handler.SendingAllowed()).To(BeTrue())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.SendingAllowed()).To(BeFalse())
+		})
+
+		It("doesn't bypass the congestion window if the probe is dequeued, but not sent", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: handler.congestion.GetCongestionWindow()})
+			Expect(err).NotTo(HaveOccurred())
+			handler.OnAlarm()
+			Expect(handler.SendingAllowed()).To(BeTrue())
+			Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
+			Expect(handler.SendingAllowed()).To(BeFalse())
+		})
+
+		It("sends an RTO after two TLPs", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.OnAlarm()
+			handler.OnAlarm()
+			Expect(handler.tlpCount).To(BeEquivalentTo(maxTailLossProbes))
+			Expect(handler.rtoCount).To(BeZero())
+			Expect(handler.GetAlarmTimeout().Sub(time.Now())).To(BeNumerically("~", handler.computeRTOTimeout(), time.Millisecond))
+			handler.OnAlarm()
+			Expect(handler.rtoCount).To(BeEquivalentTo(1))
+		})
+
+		It("resets the TLP count when a packet is acked", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.OnAlarm()
+			Expect(handler.tlpCount).To(BeEquivalentTo(1))
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 1, LowestAcked: 1}, 1, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.tlpCount).To(BeZero())
+		})
+
+		It("detects the loss of the tail when the probe is acked", func() {
+			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.OnAlarm()
+			Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
+			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
+			Expect(err).NotTo(HaveOccurred())
+			handler.packetHistory.Front().Value.SendTime = time.Now().Add(-2 * time.Second)
+			err = handler.ReceivedAck(&frames.AckFrame{LargestAcked: 2, LowestAcked: 2}, 1, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler.packetHistory.Len()).To(BeZero())
+			Expect(handler.GetStatistics().PacketsLost).To(Equal(uint64(1)))
+		})
+	})
+
 	Context("RTO retransmission", func() {
 		It("queues two packets if RTO expires", func() {
+			handler.tlpCount = maxTailLossProbes
 			err := handler.SentPacket(&Packet{PacketNumber: 1, Length: 1})
 			Expect(err).NotTo(HaveOccurred())
 			err = handler.SentPacket(&Packet{PacketNumber: 2, Length: 1})
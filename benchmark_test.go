@@ -30,24 +30,20 @@ var _ = Describe("Benchmarks", func() {
 				// start the server
 				sconf := &Config{
 					TLSConfig: testdata.GetTLSConfig(),
-					ConnState: func(sess Session, cs ConnState) {
-						if cs != ConnStateForwardSecure {
-							return
-						}
-
-						defer GinkgoRecover()
-						str, err := sess.OpenStream()
-						Expect(err).ToNot(HaveOccurred())
-						_, err = str.Write(data)
-						Expect(err).ToNot(HaveOccurred())
-						err = str.Close()
-						Expect(err).ToNot(HaveOccurred())
-					},
 				}
 				ln, err := ListenAddr("localhost:0", sconf)
 				Expect(err).ToNot(HaveOccurred())
-				// Serve will error as soon as ln is closed. Ignore all errors here
-				go ln.Serve()
+				go func() {
+					defer GinkgoRecover()
+					sess, err := ln.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(data)
+					Expect(err).ToNot(HaveOccurred())
+					err = str.Close()
+					Expect(err).ToNot(HaveOccurred())
+				}()
 
 				// start the client
 				cconf := &Config{
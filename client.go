@@ -2,7 +2,9 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 	"sync"
@@ -37,6 +39,13 @@ var (
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
 // The host parameter is used for SNI.
 func Dial(pconn net.PacketConn, remoteAddr net.Addr, host string, config *Config) (Session, error) {
+	return DialContext(context.Background(), pconn, remoteAddr, host, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using a net.PacketConn.
+// If the context is cancelled before the connection is established, the session is closed and the context's error is returned.
+// The host parameter is used for SNI.
+func DialContext(ctx context.Context, pconn net.PacketConn, remoteAddr net.Addr, host string, config *Config) (Session, error) {
 	connID, err := utils.GenerateConnectionID()
 	if err != nil {
 		return nil, err
@@ -51,7 +60,7 @@ func Dial(pconn net.PacketConn, remoteAddr net.Addr, host string, config *Config
 		conn:         &conn{pconn: pconn, currentAddr: remoteAddr},
 		connectionID: connID,
 		hostname:     hostname,
-		config:       config,
+		config:       populateClientConfig(config),
 		version:      protocol.SupportedVersions[len(protocol.SupportedVersions)-1], // use the highest supported version by default
 	}
 
@@ -64,12 +73,19 @@ func Dial(pconn net.PacketConn, remoteAddr net.Addr, host string, config *Config
 
 	utils.Infof("Starting new connection to %s (%s), connectionID %x, version %d", hostname, c.conn.RemoteAddr().String(), c.connectionID, c.version)
 
-	return c.establishConnection()
+	return c.establishConnection(ctx)
 }
 
 // DialAddr establishes a new QUIC connection to a server.
 // The hostname for SNI is taken from the given address.
 func DialAddr(addr string, config *Config) (Session, error) {
+	return DialAddrContext(context.Background(), addr, config)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server.
+// If the context is cancelled before the connection is established, the session and its UDP socket are closed and the context's error is returned.
+// The hostname for SNI is taken from the given address.
+func DialAddrContext(ctx context.Context, addr string, config *Config) (Session, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
@@ -80,12 +96,81 @@ func DialAddr(addr string, config *Config) (Session, error) {
 		return nil, err
 	}
 
-	return Dial(udpConn, udpAddr, addr, config)
+	sess, err := DialContext(ctx, udpConn, udpAddr, addr, config)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+// populateClientConfig populates fields in the quic.Config with their default values, if none are set
+func populateClientConfig(config *Config) *Config {
+	handshakeTimeout := protocol.DefaultHandshakeTimeout
+	if config.HandshakeTimeout != 0 {
+		handshakeTimeout = config.HandshakeTimeout
+	}
+	congestionControl := config.CongestionControl
+	if congestionControl == nil {
+		congestionControl = DefaultCongestionControl
+	}
+	idleTimeout := protocol.DefaultIdleTimeout
+	if config.IdleTimeout != 0 {
+		idleTimeout = config.IdleTimeout
+	}
+
+	receiveStreamFlowControlWindow := protocol.ReceiveStreamFlowControlWindow
+	if config.ReceiveStreamFlowControlWindow != 0 {
+		receiveStreamFlowControlWindow = config.ReceiveStreamFlowControlWindow
+	}
+	maxReceiveStreamFlowControlWindow := protocol.MaxReceiveStreamFlowControlWindowClient
+	if config.MaxReceiveStreamFlowControlWindow != 0 {
+		maxReceiveStreamFlowControlWindow = config.MaxReceiveStreamFlowControlWindow
+	}
+	receiveConnectionFlowControlWindow := protocol.ReceiveConnectionFlowControlWindow
+	if config.ReceiveConnectionFlowControlWindow != 0 {
+		receiveConnectionFlowControlWindow = config.ReceiveConnectionFlowControlWindow
+	}
+	maxReceiveConnectionFlowControlWindow := protocol.MaxReceiveConnectionFlowControlWindowClient
+	if config.MaxReceiveConnectionFlowControlWindow != 0 {
+		maxReceiveConnectionFlowControlWindow = config.MaxReceiveConnectionFlowControlWindow
+	}
+
+	return &Config{
+		TLSConfig:                             config.TLSConfig,
+		ConnState:                             config.ConnState,
+		HandshakeTimeout:                      handshakeTimeout,
+		IdleTimeout:                           idleTimeout,
+		ReceiveStreamFlowControlWindow:        receiveStreamFlowControlWindow,
+		MaxReceiveStreamFlowControlWindow:     utils.MaxByteCount(maxReceiveStreamFlowControlWindow, receiveStreamFlowControlWindow),
+		ReceiveConnectionFlowControlWindow:    receiveConnectionFlowControlWindow,
+		MaxReceiveConnectionFlowControlWindow: utils.MaxByteCount(maxReceiveConnectionFlowControlWindow, receiveConnectionFlowControlWindow),
+		ClientSessionCache:                    config.ClientSessionCache,
+		KeyExchanges:                          config.KeyExchanges,
+		AEADs:                                 config.AEADs,
+		VerifyPeerCertificate:                 config.VerifyPeerCertificate,
+		SCTPolicy:                             config.SCTPolicy,
+		CongestionControl:                     congestionControl,
+		ConnectionOptions:                     config.ConnectionOptions,
+	}
 }
 
-func (c *client) establishConnection() (Session, error) {
+func (c *client) establishConnection(ctx context.Context) (Session, error) {
 	go c.listen()
 
+	// wake up the loop below when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.mutex.Lock()
+			c.connStateChangeOrErrCond.Signal()
+			c.mutex.Unlock()
+		case <-done:
+		}
+	}()
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -93,6 +178,15 @@ func (c *client) establishConnection() (Session, error) {
 		if c.listenErr != nil {
 			return nil, c.listenErr
 		}
+		if err := ctx.Err(); err != nil {
+			// closing the session also closes the connection, which stops the listen loop
+			// the run loop might need the mutex to shut down, so release it while closing
+			session := c.session
+			c.mutex.Unlock()
+			session.Close(nil)
+			c.mutex.Lock()
+			return nil, err
+		}
 		if c.config.ConnState != nil && c.connState >= ConnStateVersionNegotiated {
 			break
 		}
@@ -152,6 +246,23 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	if hdr.ResetFlag {
+		// check if the connection ID matches
+		// otherwise this might be an attacker trying to inject a Public Reset to kill the connection
+		if hdr.ConnectionID != c.connectionID {
+			utils.Infof("Received a Public Reset for an unknown connection %x. Ignoring.", hdr.ConnectionID)
+			return nil
+		}
+		pr, err := parsePublicReset(r)
+		if err != nil {
+			utils.Infof("Received a Public Reset for connection %x. An error occurred parsing the packet.", hdr.ConnectionID)
+			return nil
+		}
+		utils.Infof("Received a Public Reset for connection %x, rejected packet number: 0x%x.", hdr.ConnectionID, pr.rejectedPacketNumber)
+		c.session.closeRemote(qerr.Error(qerr.PublicReset, fmt.Sprintf("Received a Public Reset for packet number %#x", pr.rejectedPacketNumber)))
+		return nil
+	}
+
 	// ignore delayed / duplicated version negotiation packets
 	if c.connState >= ConnStateVersionNegotiated && hdr.VersionFlag {
 		return nil
@@ -243,7 +354,7 @@ func (c *client) createNewSession(negotiatedVersions []protocol.VersionNumber) e
 		c.hostname,
 		c.version,
 		c.connectionID,
-		c.config.TLSConfig,
+		c.config,
 		c.closeCallback,
 		c.cryptoChangeCallback,
 		negotiatedVersions)
@@ -0,0 +1,167 @@
+package quic
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/handshake"
+	"github.com/lucas-clemente/quic-go/utils"
+)
+
+const defaultClientSessionCacheCapacity = 64
+
+type lruClientSessionCacheEntry struct {
+	hostname string
+	state    *handshake.ClientSessionState
+}
+
+// lruClientSessionCache is a ClientSessionCache that evicts the least recently used entry once it is full
+type lruClientSessionCache struct {
+	mutex sync.Mutex
+
+	capacity int
+	entries  map[string]*list.Element
+	queue    *list.List // the front of the queue is the most recently used entry
+}
+
+var _ handshake.ClientSessionCache = &lruClientSessionCache{}
+
+// NewLRUClientSessionCache creates an in-memory ClientSessionCache that holds up to capacity entries
+// If capacity is smaller than 1, a default capacity is used.
+func NewLRUClientSessionCache(capacity int) handshake.ClientSessionCache {
+	return newLRUClientSessionCache(capacity)
+}
+
+func newLRUClientSessionCache(capacity int) *lruClientSessionCache {
+	if capacity < 1 {
+		capacity = defaultClientSessionCacheCapacity
+	}
+	return &lruClientSessionCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		queue:    list.New(),
+	}
+}
+
+func (c *lruClientSessionCache) Get(hostname string) (*handshake.ClientSessionState, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[hostname]; ok {
+		c.queue.MoveToFront(elem)
+		return elem.Value.(*lruClientSessionCacheEntry).state, true
+	}
+	return nil, false
+}
+
+func (c *lruClientSessionCache) Put(hostname string, state *handshake.ClientSessionState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.putImpl(hostname, state)
+}
+
+func (c *lruClientSessionCache) putImpl(hostname string, state *handshake.ClientSessionState) {
+	if elem, ok := c.entries[hostname]; ok {
+		elem.Value.(*lruClientSessionCacheEntry).state = state
+		c.queue.MoveToFront(elem)
+		return
+	}
+
+	if c.queue.Len() >= c.capacity {
+		oldest := c.queue.Back()
+		c.queue.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruClientSessionCacheEntry).hostname)
+	}
+	c.entries[hostname] = c.queue.PushFront(&lruClientSessionCacheEntry{hostname: hostname, state: state})
+}
+
+// fileClientSessionCacheEntry is the JSON representation of a cache entry
+type fileClientSessionCacheEntry struct {
+	Hostname string
+	State    *handshake.ClientSessionState
+}
+
+// fileClientSessionCache is a lruClientSessionCache that is persisted to a file
+type fileClientSessionCache struct {
+	*lruClientSessionCache
+
+	filename string
+}
+
+var _ handshake.ClientSessionCache = &fileClientSessionCache{}
+
+// NewFileClientSessionCache creates a ClientSessionCache that is persisted to a file
+// It loads the entries from the file, if it exists, and rewrites the file every time an entry is added.
+// If capacity is smaller than 1, a default capacity is used.
+func NewFileClientSessionCache(filename string, capacity int) (handshake.ClientSessionCache, error) {
+	c := &fileClientSessionCache{
+		lruClientSessionCache: newLRUClientSessionCache(capacity),
+		filename:              filename,
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	var entries []fileClientSessionCacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	// the file starts with the least recently used entry
+	for _, e := range entries {
+		if e.State != nil {
+			c.putImpl(e.Hostname, e.State)
+		}
+	}
+	return c, nil
+}
+
+func (c *fileClientSessionCache) Put(hostname string, state *handshake.ClientSessionState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.putImpl(hostname, state)
+	if err := c.save(); err != nil {
+		utils.Errorf("Saving the client session cache to %s failed: %s", c.filename, err.Error())
+	}
+}
+
+// save writes the cache to a temporary file and renames it, such that the file is never partially written
+func (c *fileClientSessionCache) save() error {
+	entries := make([]fileClientSessionCacheEntry, 0, c.queue.Len())
+	for elem := c.queue.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*lruClientSessionCacheEntry)
+		entries = append(entries, fileClientSessionCacheEntry{Hostname: e.hostname, State: e.state})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.filename), filepath.Base(c.filename))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), c.filename); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
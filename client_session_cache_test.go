@@ -0,0 +1,145 @@
+package quic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lucas-clemente/quic-go/handshake"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client Session Cache", func() {
+	var state1, state2, state3 *handshake.ClientSessionState
+
+	BeforeEach(func() {
+		state1 = &handshake.ClientSessionState{ServerConfig: []byte("scfg1"), SourceAddressToken: []byte("stk1")}
+		state2 = &handshake.ClientSessionState{ServerConfig: []byte("scfg2"), Certificates: [][]byte{[]byte("cert")}}
+		state3 = &handshake.ClientSessionState{ServerConfig: []byte("scfg3"), ServerProof: []byte("proof")}
+	})
+
+	Context("LRU", func() {
+		var cache handshake.ClientSessionCache
+
+		BeforeEach(func() {
+			cache = NewLRUClientSessionCache(2)
+		})
+
+		It("returns false for unknown hostnames", func() {
+			_, ok := cache.Get("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("stores and returns states", func() {
+			cache.Put("host1", state1)
+			cache.Put("host2", state2)
+			state, ok := cache.Get("host1")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(state1))
+			state, ok = cache.Get("host2")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(state2))
+		})
+
+		It("replaces the state for a hostname", func() {
+			cache.Put("host1", state1)
+			cache.Put("host1", state2)
+			state, ok := cache.Get("host1")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(state2))
+			Expect(cache.(*lruClientSessionCache).queue.Len()).To(Equal(1))
+		})
+
+		It("evicts the least recently used state", func() {
+			cache.Put("host1", state1)
+			cache.Put("host2", state2)
+			_, ok := cache.Get("host1")
+			Expect(ok).To(BeTrue())
+			cache.Put("host3", state3)
+			_, ok = cache.Get("host2")
+			Expect(ok).To(BeFalse())
+			_, ok = cache.Get("host1")
+			Expect(ok).To(BeTrue())
+			_, ok = cache.Get("host3")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("uses a default capacity", func() {
+			cache = NewLRUClientSessionCache(0)
+			Expect(cache.(*lruClientSessionCache).capacity).To(Equal(defaultClientSessionCacheCapacity))
+		})
+	})
+
+	Context("file", func() {
+		var dir, filename string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "quic-go")
+			Expect(err).ToNot(HaveOccurred())
+			filename = filepath.Join(dir, "sessions.json")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("starts empty if the file doesn't exist", func() {
+			cache, err := NewFileClientSessionCache(filename, 10)
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := cache.Get("host1")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("persists states", func() {
+			cache, err := NewFileClientSessionCache(filename, 10)
+			Expect(err).ToNot(HaveOccurred())
+			cache.Put("host1", state1)
+			cache.Put("host2", state2)
+			Expect(filename).To(BeAnExistingFile())
+			cache, err = NewFileClientSessionCache(filename, 10)
+			Expect(err).ToNot(HaveOccurred())
+			state, ok := cache.Get("host1")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(state1))
+			state, ok = cache.Get("host2")
+			Expect(ok).To(BeTrue())
+			Expect(state).To(Equal(state2))
+		})
+
+		It("keeps the most recently used states when loading into a smaller cache", func() {
+			cache, err := NewFileClientSessionCache(filename, 10)
+			Expect(err).ToNot(HaveOccurred())
+			cache.Put("host1", state1)
+			cache.Put("host2", state2)
+			cache.Put("host3", state3)
+			cache, err = NewFileClientSessionCache(filename, 2)
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := cache.Get("host1")
+			Expect(ok).To(BeFalse())
+			_, ok = cache.Get("host2")
+			Expect(ok).To(BeTrue())
+			_, ok = cache.Get("host3")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("doesn't leave temporary files", func() {
+			cache, err := NewFileClientSessionCache(filename, 10)
+			Expect(err).ToNot(HaveOccurred())
+			cache.Put("host1", state1)
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Name()).To(Equal("sessions.json"))
+		})
+
+		It("errors if the file is invalid", func() {
+			err := ioutil.WriteFile(filename, []byte("foobar"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = NewFileClientSessionCache(filename, 10)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
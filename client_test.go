@@ -2,12 +2,16 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"net"
 	"reflect"
+	"time"
 	"unsafe"
 
+	"github.com/lucas-clemente/quic-go/congestion"
+	"github.com/lucas-clemente/quic-go/handshake"
 	"github.com/lucas-clemente/quic-go/protocol"
 	"github.com/lucas-clemente/quic-go/qerr"
 
@@ -39,7 +43,7 @@ var _ = Describe("Client", func() {
 		addr = &net.UDPAddr{IP: net.IPv4(192, 168, 100, 200), Port: 1337}
 		sess = &mockSession{connectionID: 0x1337}
 		cl = &client{
-			config:       config,
+			config:       populateClientConfig(config),
 			connectionID: 0x1337,
 			session:      sess,
 			version:      protocol.Version36,
@@ -96,12 +100,12 @@ var _ = Describe("Client", func() {
 
 		It("only establishes a connection once it is forward-secure if no ConnState is defined", func() {
 			config.ConnState = nil
-			client := &client{conn: &conn{pconn: packetConn, currentAddr: addr}, config: config}
+			client := &client{conn: &conn{pconn: packetConn, currentAddr: addr}, config: populateClientConfig(config)}
 			client.connStateChangeOrErrCond.L = &client.mutex
 			var returned bool
 			go func() {
 				defer GinkgoRecover()
-				_, err := client.establishConnection()
+				_, err := client.establishConnection(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				returned = true
 			}()
@@ -113,6 +117,83 @@ var _ = Describe("Client", func() {
 			client.cryptoChangeCallback(nil, true)
 			Eventually(func() bool { return returned }).Should(BeTrue())
 		})
+
+		It("returns when the context is cancelled, and closes the session", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			var dialErr error
+			var returned bool
+			go func() {
+				_, dialErr = DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", config)
+				returned = true
+			}()
+			Consistently(func() bool { return returned }).Should(BeFalse())
+			cancel()
+			Eventually(func() bool { return returned }).Should(BeTrue())
+			Expect(dialErr).To(MatchError(context.Canceled))
+			Expect(packetConn.closed).To(BeTrue())
+		})
+
+		It("returns immediately if the context deadline already expired", func() {
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			defer cancel()
+			_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", config)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(packetConn.closed).To(BeTrue())
+		})
+	})
+
+	Context("config", func() {
+		It("fills in default values if options are not set in the Config", func() {
+			c := populateClientConfig(&Config{})
+			Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
+			Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+			Expect(c.ReceiveStreamFlowControlWindow).To(Equal(protocol.ReceiveStreamFlowControlWindow))
+			Expect(c.MaxReceiveStreamFlowControlWindow).To(Equal(protocol.MaxReceiveStreamFlowControlWindowClient))
+			Expect(c.ReceiveConnectionFlowControlWindow).To(Equal(protocol.ReceiveConnectionFlowControlWindow))
+			Expect(c.MaxReceiveConnectionFlowControlWindow).To(Equal(protocol.MaxReceiveConnectionFlowControlWindowClient))
+			Expect(c.CongestionControl).ToNot(BeNil())
+		})
+
+		It("doesn't overwrite values set in the Config", func() {
+			c := populateClientConfig(&Config{
+				HandshakeTimeout:                      1337 * time.Minute,
+				IdleTimeout:                           42 * time.Hour,
+				ReceiveStreamFlowControlWindow:        1 << 20,
+				MaxReceiveStreamFlowControlWindow:     16 << 20,
+				ReceiveConnectionFlowControlWindow:    2 << 20,
+				MaxReceiveConnectionFlowControlWindow: 24 << 20,
+			})
+			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
+			Expect(c.IdleTimeout).To(Equal(42 * time.Hour))
+			Expect(c.ReceiveStreamFlowControlWindow).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(c.MaxReceiveStreamFlowControlWindow).To(Equal(protocol.ByteCount(16 << 20)))
+			Expect(c.ReceiveConnectionFlowControlWindow).To(Equal(protocol.ByteCount(2 << 20)))
+			Expect(c.MaxReceiveConnectionFlowControlWindow).To(Equal(protocol.ByteCount(24 << 20)))
+		})
+
+		It("doesn't overwrite the congestion control and the connection options", func() {
+			var called bool
+			c := populateClientConfig(&Config{
+				CongestionControl: func(*congestion.RTTStats, []handshake.Tag) congestion.SendAlgorithm {
+					called = true
+					return nil
+				},
+				ConnectionOptions: []handshake.Tag{handshake.TagTBBR},
+			})
+			c.CongestionControl(nil, nil)
+			Expect(called).To(BeTrue())
+			Expect(c.ConnectionOptions).To(Equal([]handshake.Tag{handshake.TagTBBR}))
+		})
+
+		It("doesn't use maximum flow control windows smaller than the initial windows", func() {
+			c := populateClientConfig(&Config{
+				ReceiveStreamFlowControlWindow:        32 << 20,
+				ReceiveConnectionFlowControlWindow:    48 << 20,
+				MaxReceiveConnectionFlowControlWindow: 1 << 20,
+			})
+			Expect(c.MaxReceiveStreamFlowControlWindow).To(Equal(protocol.ByteCount(32 << 20)))
+			Expect(c.MaxReceiveConnectionFlowControlWindow).To(Equal(protocol.ByteCount(48 << 20)))
+		})
 	})
 
 	It("errors on invalid public header", func() {
@@ -182,7 +263,7 @@ var _ = Describe("Client", func() {
 
 		It("closes the session when encountering an error while handling a packet", func() {
 			Expect(sess.closeReason).ToNot(HaveOccurred())
-			packetConn.dataToRead = bytes.Repeat([]byte{0xff}, 100)
+			packetConn.dataToRead = bytes.Repeat([]byte{0xfd}, 100) // don't set the ResetFlag
 			cl.listen()
 			Expect(sess.closed).To(BeTrue())
 			Expect(sess.closeReason).To(HaveOccurred())
@@ -197,6 +278,28 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Context("Public Reset handling", func() {
+		It("closes the session when receiving a Public Reset", func() {
+			err := cl.handlePacket(addr, writePublicReset(cl.connectionID, 1, 0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.closed).To(BeTrue())
+			Expect(sess.closeReason.(*qerr.QuicError).ErrorCode).To(Equal(qerr.PublicReset))
+		})
+
+		It("ignores Public Resets with the wrong connection ID", func() {
+			err := cl.handlePacket(addr, writePublicReset(cl.connectionID+1, 1, 0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.closed).To(BeFalse())
+		})
+
+		It("ignores Public Resets that can't be parsed", func() {
+			pr := writePublicReset(cl.connectionID, 1, 0)
+			err := cl.handlePacket(addr, pr[:len(pr)-5])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.closed).To(BeFalse())
+		})
+	})
+
 	Context("version negotiation", func() {
 		getVersionNegotiation := func(versions []protocol.VersionNumber) []byte {
 			oldVersionNegotiationPacket := composeVersionNegotiation(0x1337)
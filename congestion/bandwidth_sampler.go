@@ -0,0 +1,164 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+)
+
+// A bandwidthSample is the delivery rate measured when a packet is acked
+type bandwidthSample struct {
+	// The bandwidth at which data was delivered while the packet was in flight.
+	bandwidth Bandwidth
+	// The time between sending the packet and receiving the ack for it.
+	rtt time.Duration
+	// Whether the sample was taken while the sender was application limited.
+	// Such samples may underestimate the bandwidth.
+	isAppLimited bool
+}
+
+// The state of the connection at the time a packet was sent.
+type sentPacketState struct {
+	sentTime time.Time
+	size     protocol.ByteCount
+
+	totalBytesSent                  protocol.ByteCount
+	totalBytesSentAtLastAckedPacket protocol.ByteCount
+	lastAckedPacketSentTime         time.Time
+	lastAckedPacketAckTime          time.Time
+	totalBytesAcked                 protocol.ByteCount
+	isAppLimited                    bool
+}
+
+// A bandwidthSampler estimates the delivery rate of a connection.
+// For every packet that is sent, it remembers how much data had been sent and acked at that moment.
+// When the packet is acked, the amount of data delivered in the meantime gives a bandwidth sample.
+// The sample is the minimum of the send rate and the ack rate, so that ack compression doesn't inflate it.
+// See draft-cheng-iccrg-delivery-rate-estimation for details.
+type bandwidthSampler struct {
+	totalBytesSent  protocol.ByteCount
+	totalBytesAcked protocol.ByteCount
+	bytesInFlight   protocol.ByteCount
+
+	totalBytesSentAtLastAckedPacket protocol.ByteCount
+	lastAckedPacketSentTime         time.Time
+	lastAckedPacketAckTime          time.Time
+
+	lastSentPacket protocol.PacketNumber
+
+	// Whether the sender is currently application limited.
+	isAppLimited bool
+	// The app limited phase ends when this packet (or a later one) is acked.
+	endOfAppLimitedPhase protocol.PacketNumber
+
+	packets map[protocol.PacketNumber]*sentPacketState
+}
+
+func newBandwidthSampler() *bandwidthSampler {
+	return &bandwidthSampler{
+		packets: make(map[protocol.PacketNumber]*sentPacketState),
+	}
+}
+
+// OnPacketSent is called for every packet that is sent
+func (s *bandwidthSampler) OnPacketSent(sentTime time.Time, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) {
+	s.lastSentPacket = packetNumber
+	if !isRetransmittable {
+		return
+	}
+
+	s.totalBytesSent += bytes
+
+	// If there's no data in flight, the connection was quiescent.
+	// Act as if a packet had just been acked, so that the idle period isn't counted into the next sample.
+	if s.bytesInFlight == 0 {
+		s.lastAckedPacketAckTime = sentTime
+		s.totalBytesSentAtLastAckedPacket = s.totalBytesSent
+		s.lastAckedPacketSentTime = sentTime
+	}
+	s.bytesInFlight += bytes
+
+	s.packets[packetNumber] = &sentPacketState{
+		sentTime:                        sentTime,
+		size:                            bytes,
+		totalBytesSent:                  s.totalBytesSent,
+		totalBytesSentAtLastAckedPacket: s.totalBytesSentAtLastAckedPacket,
+		lastAckedPacketSentTime:         s.lastAckedPacketSentTime,
+		lastAckedPacketAckTime:          s.lastAckedPacketAckTime,
+		totalBytesAcked:                 s.totalBytesAcked,
+		isAppLimited:                    s.isAppLimited,
+	}
+}
+
+// OnPacketAcked is called when a packet is acked, and returns the bandwidth sample
+// A zero sample is returned if the packet is unknown, or no sample could be taken.
+func (s *bandwidthSampler) OnPacketAcked(ackTime time.Time, packetNumber protocol.PacketNumber) bandwidthSample {
+	state, ok := s.packets[packetNumber]
+	if !ok {
+		return bandwidthSample{}
+	}
+	delete(s.packets, packetNumber)
+
+	s.bytesInFlight -= state.size
+	s.totalBytesAcked += state.size
+	s.totalBytesSentAtLastAckedPacket = state.totalBytesSent
+	s.lastAckedPacketSentTime = state.sentTime
+	s.lastAckedPacketAckTime = ackTime
+
+	// Exit the app limited phase once a packet that was sent after it began is acked.
+	if s.isAppLimited && packetNumber > s.endOfAppLimitedPhase {
+		s.isAppLimited = false
+	}
+
+	// The send rate is infinite if the packet was sent in the same burst as the last acked packet.
+	sendRate := Bandwidth(0)
+	if state.sentTime.After(state.lastAckedPacketSentTime) {
+		sendRate = BandwidthFromDelta(
+			state.totalBytesSent-state.totalBytesSentAtLastAckedPacket,
+			state.sentTime.Sub(state.lastAckedPacketSentTime),
+		)
+	}
+
+	ackDelta := ackTime.Sub(state.lastAckedPacketAckTime)
+	if ackDelta <= 0 {
+		return bandwidthSample{}
+	}
+	ackRate := BandwidthFromDelta(s.totalBytesAcked-state.totalBytesAcked, ackDelta)
+
+	bandwidth := ackRate
+	if sendRate != 0 && sendRate < ackRate {
+		bandwidth = sendRate
+	}
+	return bandwidthSample{
+		bandwidth:    bandwidth,
+		rtt:          ackTime.Sub(state.sentTime),
+		isAppLimited: state.isAppLimited,
+	}
+}
+
+// OnPacketLost is called when a packet is declared lost
+func (s *bandwidthSampler) OnPacketLost(packetNumber protocol.PacketNumber) {
+	state, ok := s.packets[packetNumber]
+	if !ok {
+		return
+	}
+	delete(s.packets, packetNumber)
+	s.bytesInFlight -= state.size
+}
+
+// OnAppLimited is called when the sender doesn't have enough data to fill the congestion window
+// All packets sent until the next packet after the current one is acked are marked as app limited.
+func (s *bandwidthSampler) OnAppLimited() {
+	s.isAppLimited = true
+	s.endOfAppLimitedPhase = s.lastSentPacket
+}
+
+// TotalBytesAcked returns the number of bytes acked over the lifetime of the connection
+func (s *bandwidthSampler) TotalBytesAcked() protocol.ByteCount {
+	return s.totalBytesAcked
+}
+
+// IsAppLimited says if the sampler is in an app limited phase
+func (s *bandwidthSampler) IsAppLimited() bool {
+	return s.isAppLimited
+}
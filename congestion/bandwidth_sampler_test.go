@@ -0,0 +1,111 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bandwidth Sampler", func() {
+	var (
+		sampler *bandwidthSampler
+		clock   mockClock
+	)
+
+	const packetSize = protocol.DefaultTCPMSS
+
+	BeforeEach(func() {
+		sampler = newBandwidthSampler()
+		clock = mockClock{}
+	})
+
+	It("returns an empty sample for unknown packets", func() {
+		Expect(sampler.OnPacketAcked(clock.Now(), 42)).To(BeZero())
+	})
+
+	It("doesn't track non-retransmittable packets", func() {
+		sampler.OnPacketSent(clock.Now(), 1, packetSize, false)
+		clock.Advance(10 * time.Millisecond)
+		Expect(sampler.OnPacketAcked(clock.Now(), 1)).To(BeZero())
+		Expect(sampler.TotalBytesAcked()).To(BeZero())
+	})
+
+	It("measures the bandwidth when packets are acked one by one", func() {
+		// send a packet every millisecond, and receive the acks 20ms later
+		for i := 1; i <= 20; i++ {
+			sampler.OnPacketSent(clock.Now(), protocol.PacketNumber(i), packetSize, true)
+			clock.Advance(time.Millisecond)
+		}
+		for i := 1; i <= 40; i++ {
+			sample := sampler.OnPacketAcked(clock.Now(), protocol.PacketNumber(i))
+			Expect(sample.rtt).To(Equal(20 * time.Millisecond))
+			// packets sent in the first round trip can't use the ack rate of an earlier packet
+			if i > 20 {
+				Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(packetSize, time.Millisecond)))
+			}
+			sampler.OnPacketSent(clock.Now(), protocol.PacketNumber(20+i), packetSize, true)
+			clock.Advance(time.Millisecond)
+		}
+		Expect(sampler.TotalBytesAcked()).To(Equal(40 * packetSize))
+	})
+
+	It("limits the sample to the send rate", func() {
+		sampler.OnPacketSent(clock.Now(), 1, packetSize, true)
+		clock.Advance(10 * time.Millisecond)
+		sampler.OnPacketAcked(clock.Now(), 1)
+		sampler.OnPacketSent(clock.Now(), 2, packetSize, true)
+		clock.Advance(20 * time.Millisecond)
+		sampler.OnPacketSent(clock.Now(), 3, packetSize, true)
+		clock.Advance(time.Millisecond)
+		sampler.OnPacketAcked(clock.Now(), 2)
+		clock.Advance(time.Millisecond)
+		sample := sampler.OnPacketAcked(clock.Now(), 3)
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(packetSize, 20*time.Millisecond)))
+	})
+
+	It("doesn't count idle periods into the sample", func() {
+		sampler.OnPacketSent(clock.Now(), 1, packetSize, true)
+		clock.Advance(10 * time.Millisecond)
+		sampler.OnPacketAcked(clock.Now(), 1)
+		// the connection is idle for one second
+		clock.Advance(time.Second)
+		sampler.OnPacketSent(clock.Now(), 2, packetSize, true)
+		clock.Advance(10 * time.Millisecond)
+		sample := sampler.OnPacketAcked(clock.Now(), 2)
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(packetSize, 10*time.Millisecond)))
+		Expect(sample.rtt).To(Equal(10 * time.Millisecond))
+	})
+
+	It("forgets lost packets", func() {
+		sampler.OnPacketSent(clock.Now(), 1, packetSize, true)
+		sampler.OnPacketLost(1)
+		Expect(sampler.packets).To(BeEmpty())
+		Expect(sampler.bytesInFlight).To(BeZero())
+		Expect(sampler.OnPacketAcked(clock.Now(), 1)).To(BeZero())
+	})
+
+	Context("app limited", func() {
+		It("marks packets sent in the app limited phase", func() {
+			sampler.OnPacketSent(clock.Now(), 1, packetSize, true)
+			clock.Advance(time.Millisecond)
+			sampler.OnAppLimited()
+			Expect(sampler.IsAppLimited()).To(BeTrue())
+			sampler.OnPacketSent(clock.Now(), 2, packetSize, true)
+			clock.Advance(time.Millisecond)
+			sampler.OnPacketSent(clock.Now(), 3, packetSize, true)
+			clock.Advance(10 * time.Millisecond)
+			Expect(sampler.OnPacketAcked(clock.Now(), 1).isAppLimited).To(BeFalse())
+			Expect(sampler.IsAppLimited()).To(BeTrue())
+			clock.Advance(time.Millisecond)
+			Expect(sampler.OnPacketAcked(clock.Now(), 2).isAppLimited).To(BeTrue())
+			// packet 2 was sent after the app limited phase began
+			Expect(sampler.IsAppLimited()).To(BeFalse())
+			sampler.OnPacketSent(clock.Now(), 4, packetSize, true)
+			clock.Advance(10 * time.Millisecond)
+			Expect(sampler.OnPacketAcked(clock.Now(), 3).isAppLimited).To(BeTrue())
+			Expect(sampler.OnPacketAcked(clock.Now(), 4).isAppLimited).To(BeFalse())
+		})
+	})
+})
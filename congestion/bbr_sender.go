@@ -0,0 +1,456 @@
+package congestion
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/utils"
+)
+
+type bbrMode int
+
+const (
+	// Exponentially increase the sending rate until the bandwidth stops growing.
+	bbrModeStartup bbrMode = iota
+	// Drain the queue that was built during startup.
+	bbrModeDrain
+	// Cruise at the estimated bandwidth, periodically probing for more.
+	bbrModeProbeBW
+	// Reduce the amount of data in flight to measure the minimum RTT.
+	bbrModeProbeRTT
+)
+
+const (
+	// The gain used in startup, 2/ln(2). This allows the sending rate to double every round trip.
+	bbrHighGain = 2.885
+	// The gain used in drain, to drain the queue built in startup within one round trip.
+	bbrDrainGain = 1 / bbrHighGain
+	// The congestion window gain used in probe bandwidth.
+	bbrCongestionWindowGain = 2.0
+	// The number of round trips the maximum bandwidth filter covers.
+	bbrBandwidthWindowSize = bbrGainCycleLength + 2
+	// The minimum RTT sample expires after this time. A new sample is then obtained in probe RTT.
+	bbrMinRTTExpiry = 10 * time.Second
+	// The minimum time spent in probe RTT.
+	bbrProbeRTTTime = 200 * time.Millisecond
+	// The bandwidth has to grow by this factor per round trip to stay in startup.
+	bbrStartupGrowthTarget = 1.25
+	// Startup is left if the bandwidth didn't grow for this many round trips.
+	bbrRoundTripsWithoutGrowthBeforeExitingStartup = 3
+	// The minimum congestion window in packets.
+	bbrMinimumCongestionWindow protocol.PacketNumber = 4
+)
+
+// The pacing gains used in probe bandwidth.
+// The sender probes for more bandwidth for one minimum RTT, then drains the queue it might have built for another one.
+var bbrPacingGainCycle = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+const bbrGainCycleLength = len(bbrPacingGainCycle)
+
+// A bbrSender implements BBR congestion control.
+// Instead of reacting to packet loss, it builds a model of the network path from the maximum
+// delivery rate and the minimum RTT, and sends at the rate of the estimated bottleneck bandwidth.
+// See https://queue.acm.org/detail.cfm?id=3022184 for details.
+type bbrSender struct {
+	clock    Clock
+	rttStats *RTTStats
+	sampler  *bandwidthSampler
+
+	mode bbrMode
+
+	// The number of round trips since the start of the connection.
+	roundTripCount uint64
+	// The round trip ends when this packet is acked.
+	currentRoundTripEnd protocol.PacketNumber
+
+	// The maximum bandwidth over the last bbrBandwidthWindowSize round trips.
+	maxBandwidth *maxBandwidthFilter
+
+	// The minimum RTT. It expires after bbrMinRTTExpiry.
+	minRTT          time.Duration
+	minRTTTimestamp time.Time
+
+	largestSentPacketNumber  protocol.PacketNumber
+	largestAckedPacketNumber protocol.PacketNumber
+
+	congestionWindow        protocol.ByteCount
+	initialCongestionWindow protocol.ByteCount
+	maxCongestionWindow     protocol.ByteCount
+	minCongestionWindow     protocol.ByteCount
+
+	pacingRate           Bandwidth
+	pacingGain           float64
+	congestionWindowGain float64
+
+	// The index into bbrPacingGainCycle of the current probe bandwidth phase.
+	cycleCurrentOffset int
+	// The time at which the current probe bandwidth phase started.
+	lastCycleStart time.Time
+
+	// Whether the bandwidth stopped growing during startup.
+	isAtFullBandwidth          bool
+	roundsWithoutBandwidthGain int
+	bandwidthAtLastRound       Bandwidth
+
+	// The time at which probe RTT will be left. Zero if probe RTT hasn't reduced the data in flight yet.
+	exitProbeRTTAt      time.Time
+	probeRTTRoundPassed bool
+
+	// Packets up to this one belong to the current loss event.
+	endOfRecovery protocol.PacketNumber
+	// The congestion window during recovery, used for packet conservation.
+	recoveryWindow protocol.ByteCount
+	// The number of losses of the current loss event that haven't turned out to be spurious.
+	lossesToUndo int
+}
+
+var _ SendAlgorithmWithPacingRate = &bbrSender{}
+
+// NewBBRSender makes a new BBR sender
+func NewBBRSender(clock Clock, rttStats *RTTStats, initialCongestionWindow, initialMaxCongestionWindow protocol.PacketNumber) SendAlgorithm {
+	b := &bbrSender{
+		clock:                   clock,
+		rttStats:                rttStats,
+		initialCongestionWindow: protocol.ByteCount(initialCongestionWindow) * protocol.DefaultTCPMSS,
+		maxCongestionWindow:     protocol.ByteCount(initialMaxCongestionWindow) * protocol.DefaultTCPMSS,
+		minCongestionWindow:     protocol.ByteCount(bbrMinimumCongestionWindow) * protocol.DefaultTCPMSS,
+	}
+	b.reset()
+	return b
+}
+
+func (b *bbrSender) reset() {
+	b.sampler = newBandwidthSampler()
+	b.maxBandwidth = newMaxBandwidthFilter(uint64(bbrBandwidthWindowSize))
+	b.roundTripCount = 0
+	b.currentRoundTripEnd = 0
+	b.minRTT = 0
+	b.minRTTTimestamp = time.Time{}
+	b.largestSentPacketNumber = 0
+	b.largestAckedPacketNumber = 0
+	b.congestionWindow = b.initialCongestionWindow
+	b.pacingRate = 0
+	b.isAtFullBandwidth = false
+	b.roundsWithoutBandwidthGain = 0
+	b.bandwidthAtLastRound = 0
+	b.exitProbeRTTAt = time.Time{}
+	b.probeRTTRoundPassed = false
+	b.endOfRecovery = 0
+	b.recoveryWindow = 0
+	b.lossesToUndo = 0
+	b.enterStartupMode()
+}
+
+func (b *bbrSender) TimeUntilSend(now time.Time, bytesInFlight protocol.ByteCount) time.Duration {
+	if b.GetCongestionWindow() > bytesInFlight {
+		return 0
+	}
+	return utils.InfDuration
+}
+
+func (b *bbrSender) OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) bool {
+	b.largestSentPacketNumber = packetNumber
+	b.sampler.OnPacketSent(sentTime, packetNumber, bytes, isRetransmittable)
+	return isRetransmittable
+}
+
+func (b *bbrSender) GetCongestionWindow() protocol.ByteCount {
+	if b.mode == bbrModeProbeRTT {
+		return b.minCongestionWindow
+	}
+	if b.InRecovery() {
+		return utils.MinByteCount(b.congestionWindow, b.recoveryWindow)
+	}
+	return b.congestionWindow
+}
+
+// MaybeExitSlowStart does nothing, BBR leaves startup when the bandwidth stops growing
+func (b *bbrSender) MaybeExitSlowStart() {}
+
+func (b *bbrSender) OnPacketAcked(ackedPacketNumber protocol.PacketNumber, ackedBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	now := b.clock.Now()
+	priorInFlight := bytesInFlight + ackedBytes
+	b.largestAckedPacketNumber = utils.MaxPacketNumber(ackedPacketNumber, b.largestAckedPacketNumber)
+
+	isRoundStart := b.updateRoundTripCounter(ackedPacketNumber)
+	sample := b.sampler.OnPacketAcked(now, ackedPacketNumber)
+	// Samples taken while application limited underestimate the bandwidth.
+	// Only use them if they exceed the current estimate.
+	if sample.bandwidth != 0 && (!sample.isAppLimited || sample.bandwidth > b.BandwidthEstimate()) {
+		b.maxBandwidth.Update(sample.bandwidth, b.roundTripCount)
+	}
+	minRTTExpired := b.updateMinRTT(now)
+
+	if b.InRecovery() {
+		// Packet conservation: send one packet for every packet that is acked.
+		b.recoveryWindow = utils.MaxByteCount(b.recoveryWindow, bytesInFlight+ackedBytes)
+	}
+
+	if b.mode == bbrModeProbeBW {
+		b.updateGainCyclePhase(now, priorInFlight)
+	}
+	if isRoundStart && !b.isAtFullBandwidth {
+		b.checkIfFullBandwidthReached()
+	}
+	b.maybeExitStartupOrDrain(now, bytesInFlight)
+	b.maybeEnterOrExitProbeRTT(now, isRoundStart, minRTTExpired, bytesInFlight)
+
+	b.calculatePacingRate()
+	b.calculateCongestionWindow(ackedBytes)
+}
+
+func (b *bbrSender) OnPacketLost(packetNumber protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	b.sampler.OnPacketLost(packetNumber)
+
+	// All losses of packets sent before the first loss was detected belong to the same loss event.
+	if packetNumber > b.endOfRecovery {
+		b.endOfRecovery = b.largestSentPacketNumber
+		b.recoveryWindow = bytesInFlight + lostBytes
+		b.lossesToUndo = 0
+	}
+	b.lossesToUndo++
+	if b.recoveryWindow > lostBytes {
+		b.recoveryWindow -= lostBytes
+	} else {
+		b.recoveryWindow = 0
+	}
+	b.recoveryWindow = utils.MaxByteCount(b.recoveryWindow, b.minCongestionWindow)
+}
+
+// OnSpuriousPacketLoss is called when a packet that was declared lost is acked
+// BBR doesn't reduce its path model on loss. If all losses of the current loss event were spurious, it leaves recovery.
+func (b *bbrSender) OnSpuriousPacketLoss(packetNumber protocol.PacketNumber) {
+	if b.lossesToUndo == 0 || packetNumber > b.endOfRecovery {
+		return
+	}
+	b.lossesToUndo--
+	if b.lossesToUndo == 0 {
+		b.endOfRecovery = 0
+		b.recoveryWindow = 0
+	}
+}
+
+// InRecovery says if the sender is in recovery from a loss event
+func (b *bbrSender) InRecovery() bool {
+	return b.largestAckedPacketNumber <= b.endOfRecovery && b.endOfRecovery != 0
+}
+
+// InSlowStart says if the sender is in startup
+func (b *bbrSender) InSlowStart() bool {
+	return b.mode == bbrModeStartup
+}
+
+// BandwidthEstimate returns the maximum bandwidth in the bandwidth window
+func (b *bbrSender) BandwidthEstimate() Bandwidth {
+	return b.maxBandwidth.GetBest()
+}
+
+// PacingRate returns the rate at which packets should be sent
+func (b *bbrSender) PacingRate() Bandwidth {
+	if b.pacingRate == 0 {
+		// Until there's a bandwidth estimate, pace the initial congestion window over the initial RTT.
+		return Bandwidth(bbrHighGain * float64(BandwidthFromDelta(b.initialCongestionWindow, initialRTTus*time.Microsecond)))
+	}
+	return b.pacingRate
+}
+
+// OnApplicationLimited is called when the sender doesn't have enough data to fill the congestion window
+func (b *bbrSender) OnApplicationLimited(bytesInFlight protocol.ByteCount) {
+	if bytesInFlight >= b.GetCongestionWindow() {
+		return
+	}
+	b.sampler.OnAppLimited()
+}
+
+// SetNumEmulatedConnections does nothing, BBR doesn't emulate multiple connections
+func (b *bbrSender) SetNumEmulatedConnections(n int) {}
+
+// OnRetransmissionTimeout is called on an retransmission timeout
+func (b *bbrSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	b.endOfRecovery = 0
+	b.lossesToUndo = 0
+}
+
+// OnConnectionMigration is called when the connection is migrated
+// The path model is not valid for the new path, so it's discarded.
+func (b *bbrSender) OnConnectionMigration() {
+	b.reset()
+}
+
+// RetransmissionDelay gives the time to retransmission
+func (b *bbrSender) RetransmissionDelay() time.Duration {
+	if b.rttStats.SmoothedRTT() == 0 {
+		return 0
+	}
+	return b.rttStats.SmoothedRTT() + b.rttStats.MeanDeviation()*4
+}
+
+// SetSlowStartLargeReduction does nothing, BBR doesn't reduce the congestion window on loss
+func (b *bbrSender) SetSlowStartLargeReduction(enabled bool) {}
+
+func (b *bbrSender) enterStartupMode() {
+	b.mode = bbrModeStartup
+	b.pacingGain = bbrHighGain
+	b.congestionWindowGain = bbrHighGain
+}
+
+func (b *bbrSender) enterProbeBandwidthMode(now time.Time) {
+	b.mode = bbrModeProbeBW
+	b.congestionWindowGain = bbrCongestionWindowGain
+	// Start at a random phase of the cycle, to avoid synchronization between flows.
+	// The drain phase is skipped, since there's no queue to drain after startup or probe RTT.
+	b.cycleCurrentOffset = rand.Intn(bbrGainCycleLength - 1)
+	if b.cycleCurrentOffset >= 1 {
+		b.cycleCurrentOffset++
+	}
+	b.lastCycleStart = now
+	b.pacingGain = bbrPacingGainCycle[b.cycleCurrentOffset]
+}
+
+// updateRoundTripCounter returns true if the acked packet starts a new round trip
+func (b *bbrSender) updateRoundTripCounter(ackedPacketNumber protocol.PacketNumber) bool {
+	if ackedPacketNumber <= b.currentRoundTripEnd {
+		return false
+	}
+	b.roundTripCount++
+	b.currentRoundTripEnd = b.largestSentPacketNumber
+	return true
+}
+
+// updateMinRTT returns true if the minimum RTT expired
+func (b *bbrSender) updateMinRTT(now time.Time) bool {
+	sampleRTT := b.rttStats.LatestRTT()
+	if sampleRTT == 0 {
+		return false
+	}
+	expired := b.minRTT != 0 && now.After(b.minRTTTimestamp.Add(bbrMinRTTExpiry))
+	if expired || sampleRTT < b.minRTT || b.minRTT == 0 {
+		b.minRTT = sampleRTT
+		b.minRTTTimestamp = now
+	}
+	return expired
+}
+
+func (b *bbrSender) updateGainCyclePhase(now time.Time, priorInFlight protocol.ByteCount) {
+	// Each phase lasts for about one minimum RTT.
+	shouldAdvance := now.Sub(b.lastCycleStart) > b.minRTT
+	// When probing for more bandwidth, stay in the phase until enough data is in flight to fill the pipe.
+	if b.pacingGain > 1 && priorInFlight < b.targetCongestionWindow(b.pacingGain) {
+		shouldAdvance = false
+	}
+	// When draining, leave the phase as soon as the queue is drained.
+	if b.pacingGain < 1 && priorInFlight <= b.targetCongestionWindow(1) {
+		shouldAdvance = true
+	}
+	if shouldAdvance {
+		b.cycleCurrentOffset = (b.cycleCurrentOffset + 1) % bbrGainCycleLength
+		b.lastCycleStart = now
+		b.pacingGain = bbrPacingGainCycle[b.cycleCurrentOffset]
+	}
+}
+
+func (b *bbrSender) checkIfFullBandwidthReached() {
+	target := Bandwidth(float64(b.bandwidthAtLastRound) * bbrStartupGrowthTarget)
+	if b.BandwidthEstimate() >= target {
+		b.bandwidthAtLastRound = b.BandwidthEstimate()
+		b.roundsWithoutBandwidthGain = 0
+		return
+	}
+	b.roundsWithoutBandwidthGain++
+	if b.roundsWithoutBandwidthGain >= bbrRoundTripsWithoutGrowthBeforeExitingStartup {
+		b.isAtFullBandwidth = true
+	}
+}
+
+func (b *bbrSender) maybeExitStartupOrDrain(now time.Time, bytesInFlight protocol.ByteCount) {
+	if b.mode == bbrModeStartup && b.isAtFullBandwidth {
+		b.mode = bbrModeDrain
+		b.pacingGain = bbrDrainGain
+		b.congestionWindowGain = bbrHighGain
+	}
+	if b.mode == bbrModeDrain && bytesInFlight <= b.targetCongestionWindow(1) {
+		b.enterProbeBandwidthMode(now)
+	}
+}
+
+func (b *bbrSender) maybeEnterOrExitProbeRTT(now time.Time, isRoundStart, minRTTExpired bool, bytesInFlight protocol.ByteCount) {
+	if minRTTExpired && b.mode != bbrModeProbeRTT {
+		b.mode = bbrModeProbeRTT
+		b.pacingGain = 1
+		b.exitProbeRTTAt = time.Time{}
+	}
+	if b.mode != bbrModeProbeRTT {
+		return
+	}
+	// The samples taken in probe RTT don't reflect the available bandwidth.
+	b.sampler.OnAppLimited()
+
+	if b.exitProbeRTTAt.IsZero() {
+		// Wait until the data in flight dropped to the probe RTT congestion window,
+		// then stay there for at least bbrProbeRTTTime and one round trip.
+		if bytesInFlight < b.minCongestionWindow+protocol.DefaultTCPMSS {
+			b.exitProbeRTTAt = now.Add(bbrProbeRTTTime)
+			b.probeRTTRoundPassed = false
+		}
+		return
+	}
+	if isRoundStart {
+		b.probeRTTRoundPassed = true
+	}
+	if !now.Before(b.exitProbeRTTAt) && b.probeRTTRoundPassed {
+		b.minRTTTimestamp = now
+		if b.isAtFullBandwidth {
+			b.enterProbeBandwidthMode(now)
+		} else {
+			b.enterStartupMode()
+		}
+	}
+}
+
+// targetCongestionWindow returns the bandwidth-delay product multiplied by the gain
+func (b *bbrSender) targetCongestionWindow(gain float64) protocol.ByteCount {
+	bdp := protocol.ByteCount(float64(b.BandwidthEstimate()) / float64(BytesPerSecond) * b.minRTT.Seconds())
+	window := protocol.ByteCount(gain * float64(bdp))
+	// If there's no estimate of the bandwidth-delay product yet, use the initial congestion window.
+	if window == 0 {
+		window = protocol.ByteCount(gain * float64(b.initialCongestionWindow))
+	}
+	return utils.MaxByteCount(window, b.minCongestionWindow)
+}
+
+func (b *bbrSender) calculatePacingRate() {
+	if b.BandwidthEstimate() == 0 {
+		return
+	}
+	targetRate := Bandwidth(b.pacingGain * float64(b.BandwidthEstimate()))
+	if b.isAtFullBandwidth {
+		b.pacingRate = targetRate
+		return
+	}
+	// Pace the initial congestion window over the first RTT measurement.
+	if b.pacingRate == 0 && b.minRTT != 0 {
+		b.pacingRate = BandwidthFromDelta(b.initialCongestionWindow, b.minRTT)
+		return
+	}
+	// Never decrease the pacing rate in startup, the bandwidth estimate is still growing.
+	if b.pacingRate < targetRate {
+		b.pacingRate = targetRate
+	}
+}
+
+func (b *bbrSender) calculateCongestionWindow(ackedBytes protocol.ByteCount) {
+	if b.mode == bbrModeProbeRTT {
+		return
+	}
+	target := b.targetCongestionWindow(b.congestionWindowGain)
+	if b.isAtFullBandwidth {
+		// Grow towards the target, but never exceed it.
+		b.congestionWindow = utils.MinByteCount(target, b.congestionWindow+ackedBytes)
+	} else if b.congestionWindow < target || b.sampler.TotalBytesAcked() < b.initialCongestionWindow {
+		// In startup, only grow the window, even if the target is lower.
+		b.congestionWindow += ackedBytes
+	}
+	b.congestionWindow = utils.MaxByteCount(b.congestionWindow, b.minCongestionWindow)
+	b.congestionWindow = utils.MinByteCount(b.congestionWindow, b.maxCongestionWindow)
+}
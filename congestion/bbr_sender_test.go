@@ -0,0 +1,281 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type simulatedPacket struct {
+	packetNumber protocol.PacketNumber
+	sentTime     time.Time
+	ackTime      time.Time
+	lost         bool
+}
+
+var _ = Describe("BBR Sender", func() {
+	const (
+		packetSize = protocol.DefaultTCPMSS
+		// the bottleneck delivers one packet per millisecond
+		bottleneckBandwidth = Bandwidth(packetSize) * BytesPerSecond * 1000
+		propagationDelay    = 50 * time.Millisecond
+	)
+
+	var (
+		sender        *bbrSender
+		clock         mockClock
+		rttStats      *RTTStats
+		bytesInFlight protocol.ByteCount
+		packetNumber  protocol.PacketNumber
+		inFlight      []*simulatedPacket
+		linkFreeAt    time.Time
+		// the number of the next packet that is dropped by the link
+		dropPacket protocol.PacketNumber
+	)
+
+	BeforeEach(func() {
+		clock = mockClock{}
+		clock.Advance(time.Hour)
+		rttStats = NewRTTStats()
+		sender = NewBBRSender(&clock, rttStats, initialCongestionWindowPackets, MaxCongestionWindow).(*bbrSender)
+		bytesInFlight = 0
+		packetNumber = 1
+		inFlight = nil
+		linkFreeAt = clock.Now()
+		dropPacket = 0
+	})
+
+	// sendPacket sends a packet over the bottleneck link.
+	// It is delivered after the packets queued in front of it, and acked after the propagation delay.
+	sendPacket := func() {
+		now := clock.Now()
+		sender.OnPacketSent(now, bytesInFlight, packetNumber, packetSize, true)
+		bytesInFlight += packetSize
+		deliveredAt := now
+		if linkFreeAt.After(now) {
+			deliveredAt = linkFreeAt
+		}
+		deliveredAt = deliveredAt.Add(time.Millisecond)
+		linkFreeAt = deliveredAt
+		inFlight = append(inFlight, &simulatedPacket{
+			packetNumber: packetNumber,
+			sentTime:     now,
+			ackTime:      deliveredAt.Add(propagationDelay),
+			lost:         packetNumber == dropPacket,
+		})
+		packetNumber++
+	}
+
+	// sendPackets sends packets as long as the congestion window allows it
+	sendPackets := func() {
+		for sender.TimeUntilSend(clock.Now(), bytesInFlight) == 0 {
+			sendPacket()
+		}
+	}
+
+	// receiveAck advances the clock to the next ack, and processes it
+	receiveAck := func() {
+		p := inFlight[0]
+		inFlight = inFlight[1:]
+		clock = mockClock(p.ackTime)
+		bytesInFlight -= packetSize
+		if p.lost {
+			sender.OnPacketLost(p.packetNumber, packetSize, bytesInFlight)
+			return
+		}
+		rttStats.UpdateRTT(p.ackTime.Sub(p.sentTime), 0, clock.Now())
+		sender.MaybeExitSlowStart()
+		sender.OnPacketAcked(p.packetNumber, packetSize, bytesInFlight)
+	}
+
+	// runFor sends packets at the pacing rate, as long as the congestion window allows it
+	runFor := func(d time.Duration) {
+		end := clock.Now().Add(d)
+		nextSendTime := clock.Now()
+		for clock.Now().Before(end) {
+			canSend := sender.TimeUntilSend(clock.Now(), bytesInFlight) == 0
+			if canSend && !nextSendTime.After(clock.Now()) {
+				sendPacket()
+				nextSendTime = clock.Now().Add(time.Duration(float64(packetSize*8) / float64(sender.PacingRate()) * float64(time.Second)))
+				continue
+			}
+			if canSend && (len(inFlight) == 0 || nextSendTime.Before(inFlight[0].ackTime)) {
+				clock = mockClock(nextSendTime)
+				continue
+			}
+			receiveAck()
+		}
+	}
+
+	bdp := func() protocol.ByteCount {
+		return protocol.ByteCount(float64(bottleneckBandwidth) / float64(BytesPerSecond) * (propagationDelay + time.Millisecond).Seconds())
+	}
+
+	It("starts in startup", func() {
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.InRecovery()).To(BeFalse())
+		Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+	})
+
+	It("has an initial pacing rate", func() {
+		initialRTT := time.Duration(rttStats.InitialRTTus()) * time.Microsecond
+		Expect(sender.PacingRate()).To(BeNumerically(">", BandwidthFromDelta(defaultWindowTCP, initialRTT)))
+	})
+
+	It("grows the congestion window in startup", func() {
+		sendPackets()
+		for i := 0; i < 10; i++ {
+			receiveAck()
+		}
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP + 10*packetSize))
+	})
+
+	It("estimates the bottleneck bandwidth", func() {
+		runFor(2 * time.Second)
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", bottleneckBandwidth, bottleneckBandwidth/10))
+		Expect(sender.minRTT).To(BeNumerically(">=", propagationDelay))
+	})
+
+	It("leaves startup and drain, and enters probe bandwidth", func() {
+		runFor(2 * time.Second)
+		Expect(sender.isAtFullBandwidth).To(BeTrue())
+		Expect(sender.InSlowStart()).To(BeFalse())
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+	})
+
+	It("sets the congestion window to twice the bandwidth-delay product in probe bandwidth", func() {
+		runFor(5 * time.Second)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically("~", 2*bdp(), bdp()/5))
+	})
+
+	It("paces at the estimated bandwidth in probe bandwidth", func() {
+		runFor(5 * time.Second)
+		Expect(sender.PacingRate()).To(BeNumerically(">=", 3*sender.BandwidthEstimate()/4))
+		Expect(sender.PacingRate()).To(BeNumerically("<=", 5*sender.BandwidthEstimate()/4))
+	})
+
+	It("cycles through the pacing gains in probe bandwidth", func() {
+		runFor(3 * time.Second)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		gains := make(map[float64]bool)
+		for i := 0; i < 20; i++ {
+			runFor(propagationDelay)
+			gains[sender.pacingGain] = true
+		}
+		Expect(gains).To(HaveKey(1.25))
+		Expect(gains).To(HaveKey(0.75))
+		Expect(gains).To(HaveKey(1.0))
+	})
+
+	It("enters probe RTT when the minimum RTT expires", func() {
+		runFor(5 * time.Second)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		var enteredProbeRTT bool
+		for i := 0; i < 1000 && !enteredProbeRTT; i++ {
+			runFor(10 * time.Millisecond)
+			if sender.mode == bbrModeProbeRTT {
+				enteredProbeRTT = true
+				Expect(sender.GetCongestionWindow()).To(Equal(sender.minCongestionWindow))
+			}
+		}
+		Expect(enteredProbeRTT).To(BeTrue())
+		// leave probe RTT after 200ms and one round trip
+		runFor(500 * time.Millisecond)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.minRTT).To(Equal(propagationDelay + time.Millisecond))
+	})
+
+	It("doesn't reduce the bandwidth estimate on a loss", func() {
+		runFor(5 * time.Second)
+		bandwidth := sender.BandwidthEstimate()
+		dropPacket = packetNumber
+		runFor(time.Second)
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", bandwidth, bandwidth/10))
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+	})
+
+	Context("recovery", func() {
+		It("enters recovery on a loss", func() {
+			sendPackets()
+			receiveAck()
+			sender.OnPacketLost(2, packetSize, bytesInFlight-packetSize)
+			Expect(sender.InRecovery()).To(BeTrue())
+			Expect(sender.GetCongestionWindow()).To(Equal(bytesInFlight - packetSize))
+		})
+
+		It("treats losses of packets sent before the loss as one loss event", func() {
+			sendPackets()
+			sender.OnPacketLost(1, packetSize, bytesInFlight-packetSize)
+			window := sender.GetCongestionWindow()
+			sender.OnPacketLost(2, packetSize, bytesInFlight-2*packetSize)
+			Expect(sender.GetCongestionWindow()).To(Equal(window - packetSize))
+		})
+
+		It("doesn't reduce the window below the minimum", func() {
+			sendPackets()
+			for i := 1; i < 10; i++ {
+				sender.OnPacketLost(protocol.PacketNumber(i), packetSize, bytesInFlight-protocol.ByteCount(i)*packetSize)
+			}
+			Expect(sender.GetCongestionWindow()).To(Equal(sender.minCongestionWindow))
+		})
+
+		It("leaves recovery when a packet sent after the loss is acked", func() {
+			sendPackets()
+			sender.OnPacketLost(1, packetSize, bytesInFlight-packetSize)
+			Expect(sender.InRecovery()).To(BeTrue())
+			sender.OnPacketAcked(packetNumber-1, packetSize, bytesInFlight-2*packetSize)
+			Expect(sender.InRecovery()).To(BeTrue())
+			sender.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, packetSize, true)
+			sender.OnPacketAcked(packetNumber, packetSize, bytesInFlight-2*packetSize)
+			Expect(sender.InRecovery()).To(BeFalse())
+		})
+
+		It("leaves recovery if all losses of the loss event were spurious", func() {
+			sendPackets()
+			receiveAck()
+			sender.OnPacketLost(2, packetSize, bytesInFlight-packetSize)
+			sender.OnPacketLost(3, packetSize, bytesInFlight-2*packetSize)
+			sender.OnSpuriousPacketLoss(2)
+			Expect(sender.InRecovery()).To(BeTrue())
+			sender.OnSpuriousPacketLoss(3)
+			Expect(sender.InRecovery()).To(BeFalse())
+			Expect(sender.GetCongestionWindow()).To(Equal(sender.congestionWindow))
+		})
+
+		It("leaves recovery on a retransmission timeout", func() {
+			sendPackets()
+			sender.OnPacketLost(1, packetSize, bytesInFlight-packetSize)
+			sender.OnRetransmissionTimeout(true)
+			Expect(sender.InRecovery()).To(BeFalse())
+		})
+	})
+
+	It("resets the path model on connection migration", func() {
+		runFor(2 * time.Second)
+		sender.OnConnectionMigration()
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+		Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
+	})
+
+	It("marks samples as app limited", func() {
+		sender.OnApplicationLimited(0)
+		Expect(sender.sampler.IsAppLimited()).To(BeTrue())
+	})
+
+	It("doesn't mark samples as app limited when the congestion window is full", func() {
+		sender.OnApplicationLimited(sender.GetCongestionWindow())
+		Expect(sender.sampler.IsAppLimited()).To(BeFalse())
+	})
+
+	It("has the retransmission delay of the RTT stats", func() {
+		Expect(sender.RetransmissionDelay()).To(BeZero())
+		rttStats.UpdateRTT(100*time.Millisecond, 0, clock.Now())
+		Expect(sender.RetransmissionDelay()).To(Equal(rttStats.SmoothedRTT() + 4*rttStats.MeanDeviation()))
+	})
+})
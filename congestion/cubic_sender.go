@@ -37,6 +37,15 @@ type cubicSender struct {
 	// Slow start congestion window in packets, aka ssthresh.
 	slowstartThreshold protocol.PacketNumber
 
+	// The congestion window and the slow start threshold before the last cutback.
+	// They are restored if all losses of the loss event turn out to be spurious.
+	congestionWindowBeforeCutback   protocol.PacketNumber
+	slowstartThresholdBeforeCutback protocol.PacketNumber
+	// The cubic state before the last cutback, i.e. the epoch, the last max congestion window and the origin point.
+	cubicBeforeCutback Cubic
+	// The number of losses of the current loss event that haven't turned out to be spurious.
+	lossesToUndo int
+
 	// Whether the last loss event caused us to exit slowstart.
 	// Used for stats collection of slowstartPacketsLost
 	lastCutbackExitedSlowstart bool
@@ -148,6 +157,7 @@ func (c *cubicSender) OnPacketLost(packetNumber protocol.PacketNumber, lostBytes
 	// TCP NewReno (RFC6582) says that once a loss occurs, any losses in packets
 	// already sent should be treated as a single loss event, since it's expected.
 	if packetNumber <= c.largestSentAtLastCutback {
+		c.lossesToUndo++
 		if c.lastCutbackExitedSlowstart {
 			c.stats.slowstartPacketsLost++
 			c.stats.slowstartBytesLost += lostBytes
@@ -168,6 +178,11 @@ func (c *cubicSender) OnPacketLost(packetNumber protocol.PacketNumber, lostBytes
 
 	c.prr.OnPacketLost(bytesInFlight)
 
+	c.congestionWindowBeforeCutback = c.congestionWindow
+	c.slowstartThresholdBeforeCutback = c.slowstartThreshold
+	c.cubicBeforeCutback = *c.cubic
+	c.lossesToUndo = 1
+
 	// TODO(chromium): Separate out all of slow start into a separate class.
 	if c.slowStartLargeReduction && c.InSlowStart() {
 		c.congestionWindow = c.congestionWindow - 1
@@ -257,9 +272,30 @@ func (c *cubicSender) SetNumEmulatedConnections(n int) {
 	c.cubic.SetNumConnections(c.numConnections)
 }
 
+// OnSpuriousPacketLoss is called when a packet that was declared lost is acked
+// If all losses of the current loss event were spurious, the cutback is undone.
+func (c *cubicSender) OnSpuriousPacketLoss(packetNumber protocol.PacketNumber) {
+	if c.lossesToUndo == 0 || packetNumber > c.largestSentAtLastCutback {
+		return
+	}
+	c.lossesToUndo--
+	if c.lossesToUndo > 0 {
+		return
+	}
+	c.congestionWindow = utils.MaxPacketNumber(c.congestionWindow, c.congestionWindowBeforeCutback)
+	c.slowstartThreshold = utils.MaxPacketNumber(c.slowstartThreshold, c.slowstartThresholdBeforeCutback)
+	*c.cubic = c.cubicBeforeCutback
+	// the number of connections might have changed since the cutback
+	c.cubic.SetNumConnections(c.numConnections)
+	// leave recovery
+	c.largestSentAtLastCutback = 0
+}
+
 // OnRetransmissionTimeout is called on an retransmission timeout
 func (c *cubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
 	c.largestSentAtLastCutback = 0
+	// the reduction of the congestion window after an RTO can't be undone
+	c.lossesToUndo = 0
 	if !packetsRetransmitted {
 		return
 	}
@@ -269,6 +305,9 @@ func (c *cubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
 	c.congestionWindow = c.minCongestionWindow
 }
 
+// OnApplicationLimited does nothing, Cubic detects application limited phases when packets are acked
+func (c *cubicSender) OnApplicationLimited(bytesInFlight protocol.ByteCount) {}
+
 // OnConnectionMigration is called when the connection is migrated (?)
 func (c *cubicSender) OnConnectionMigration() {
 	c.hybridSlowStart.Restart()
@@ -276,6 +315,7 @@ func (c *cubicSender) OnConnectionMigration() {
 	c.largestSentPacketNumber = 0
 	c.largestAckedPacketNumber = 0
 	c.largestSentAtLastCutback = 0
+	c.lossesToUndo = 0
 	c.lastCutbackExitedSlowstart = false
 	c.cubic.Reset()
 	c.congestionWindowCount = 0
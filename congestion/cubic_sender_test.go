@@ -570,6 +570,82 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(post_loss_window).To(BeNumerically(">", sender.GetCongestionWindow()))
 	})
 
+	Context("spurious losses", func() {
+		It("undoes the cutback if the loss was spurious", func() {
+			SendAvailableSendWindow()
+			AckNPackets(2)
+			initial_window := sender.GetCongestionWindow()
+			initial_threshold := sender.SlowstartThreshold()
+			LosePacket(ackedPacketNumber + 1)
+			Expect(sender.GetCongestionWindow()).To(BeNumerically("<", initial_window))
+			Expect(sender.InRecovery()).To(BeTrue())
+			sender.OnSpuriousPacketLoss(ackedPacketNumber + 1)
+			Expect(sender.GetCongestionWindow()).To(Equal(initial_window))
+			Expect(sender.SlowstartThreshold()).To(Equal(initial_threshold))
+			Expect(sender.InRecovery()).To(BeFalse())
+		})
+
+		It("only undoes the cutback if all losses of the loss event were spurious", func() {
+			SendAvailableSendWindow()
+			AckNPackets(2)
+			initial_window := sender.GetCongestionWindow()
+			LosePacket(ackedPacketNumber + 1)
+			LosePacket(ackedPacketNumber + 2)
+			post_loss_window := sender.GetCongestionWindow()
+			sender.OnSpuriousPacketLoss(ackedPacketNumber + 2)
+			Expect(sender.GetCongestionWindow()).To(Equal(post_loss_window))
+			sender.OnSpuriousPacketLoss(ackedPacketNumber + 1)
+			Expect(sender.GetCongestionWindow()).To(Equal(initial_window))
+		})
+
+		It("restores the cubic state, such that the window grows as if the loss never happened", func() {
+			// growWindow grows the window in congestion avoidance, optionally with a spurious loss halfway through
+			growWindow := func(spuriousLoss bool) protocol.ByteCount {
+				bytesInFlight = 0
+				packetNumber = 1
+				ackedPacketNumber = 0
+				clock = mockClock{}
+				rttStats = NewRTTStats()
+				sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, MaxCongestionWindow)
+				// Make sure we fall out of slow start.
+				SendAvailableSendWindow()
+				AckNPackets(2)
+				LoseNPackets(1)
+				for i := 0; i < 50; i++ {
+					SendAvailableSendWindow()
+					AckNPackets(2)
+				}
+				if spuriousLoss {
+					cubic := sender.(*cubicSender).cubic
+					cubicState := *cubic
+					window := sender.GetCongestionWindow()
+					sender.OnPacketLost(packetNumber-1, protocol.DefaultTCPMSS, bytesInFlight)
+					Expect(sender.GetCongestionWindow()).To(BeNumerically("<", window))
+					Expect(*cubic).ToNot(Equal(cubicState))
+					sender.OnSpuriousPacketLoss(packetNumber - 1)
+					Expect(sender.GetCongestionWindow()).To(Equal(window))
+					Expect(*cubic).To(Equal(cubicState))
+				}
+				for i := 0; i < 50; i++ {
+					SendAvailableSendWindow()
+					AckNPackets(2)
+				}
+				return sender.GetCongestionWindow()
+			}
+			Expect(growWindow(true)).To(Equal(growWindow(false)))
+		})
+
+		It("doesn't undo the cutback after an RTO", func() {
+			SendAvailableSendWindow()
+			AckNPackets(2)
+			LosePacket(ackedPacketNumber + 1)
+			sender.OnRetransmissionTimeout(true)
+			window := sender.GetCongestionWindow()
+			sender.OnSpuriousPacketLoss(ackedPacketNumber + 1)
+			Expect(sender.GetCongestionWindow()).To(Equal(window))
+		})
+	})
+
 	It("don't track ack packets", func() {
 		// Send a packet with no retransmittable data, and ensure it's not tracked.
 		Expect(sender.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, protocol.DefaultTCPMSS, false)).To(BeFalse())
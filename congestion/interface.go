@@ -14,19 +14,29 @@ type SendAlgorithm interface {
 	MaybeExitSlowStart()
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, bytesInFlight protocol.ByteCount)
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount)
+	OnSpuriousPacketLoss(number protocol.PacketNumber)
+	// OnApplicationLimited is called when sending is allowed, but there's no data to send
+	OnApplicationLimited(bytesInFlight protocol.ByteCount)
 	SetNumEmulatedConnections(n int)
 	OnRetransmissionTimeout(packetsRetransmitted bool)
 	OnConnectionMigration()
 	RetransmissionDelay() time.Duration
+	InSlowStart() bool
+	BandwidthEstimate() Bandwidth
 
 	// Experiments
 	SetSlowStartLargeReduction(enabled bool)
 }
 
+// A SendAlgorithmWithPacingRate is a SendAlgorithm that calculates the rate at which packets should be sent
+type SendAlgorithmWithPacingRate interface {
+	SendAlgorithm
+	PacingRate() Bandwidth
+}
+
 // SendAlgorithmWithDebugInfo adds some debug functions to SendAlgorithm
 type SendAlgorithmWithDebugInfo interface {
 	SendAlgorithm
-	BandwidthEstimate() Bandwidth
 
 	// Stuff only used in testing
 
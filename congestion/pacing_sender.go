@@ -0,0 +1,114 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/utils"
+)
+
+const (
+	// The number of packets that may be sent without pacing when starting to send after the connection was idle.
+	initialUnpacedBurst = 10
+	// Packets that are due within this time are sent immediately, since the timer can't wake up the sender more precisely.
+	pacingAlarmGranularity = time.Millisecond
+)
+
+// A pacingSender wraps a SendAlgorithm and spaces out the packets sent within a congestion window.
+// This avoids bursts that overflow the buffers of routers along the path.
+type pacingSender struct {
+	SendAlgorithm
+
+	rttStats *RTTStats
+
+	// The number of packets that may still be sent without pacing.
+	burstTokens int
+	// The time at which the next packet should be sent.
+	idealNextPacketSendTime time.Time
+}
+
+var _ SendAlgorithm = &pacingSender{}
+
+// NewPacingSender makes a new pacing sender
+// If the sender implements SendAlgorithmWithPacingRate, its pacing rate is used.
+// Otherwise, the pacing rate is derived from the congestion window and the smoothed RTT.
+func NewPacingSender(sender SendAlgorithm, rttStats *RTTStats) SendAlgorithm {
+	return &pacingSender{
+		SendAlgorithm: sender,
+		rttStats:      rttStats,
+	}
+}
+
+func (p *pacingSender) TimeUntilSend(now time.Time, bytesInFlight protocol.ByteCount) time.Duration {
+	if delay := p.SendAlgorithm.TimeUntilSend(now, bytesInFlight); delay != 0 {
+		return delay
+	}
+	// Don't pace when starting to send after the connection was idle, or while there are burst tokens left.
+	if p.burstTokens > 0 || bytesInFlight == 0 {
+		return 0
+	}
+	if p.idealNextPacketSendTime.After(now.Add(pacingAlarmGranularity)) {
+		return p.idealNextPacketSendTime.Sub(now)
+	}
+	return 0
+}
+
+func (p *pacingSender) OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) bool {
+	ret := p.SendAlgorithm.OnPacketSent(sentTime, bytesInFlight, packetNumber, bytes, isRetransmittable)
+	if !isRetransmittable {
+		return ret
+	}
+
+	// Allow an initial burst, when starting to send after the connection was idle.
+	if bytesInFlight == 0 {
+		p.burstTokens = utils.Min(initialUnpacedBurst, int(p.SendAlgorithm.GetCongestionWindow()/protocol.DefaultTCPMSS))
+	}
+	if p.burstTokens > 0 {
+		p.burstTokens--
+		p.idealNextPacketSendTime = time.Time{}
+		return ret
+	}
+
+	delay := p.transferTime(bytes)
+	// If the sender fell behind by more than the alarm granularity, it wasn't limited by pacing.
+	// Don't allow it to make up for the lost time by sending a burst.
+	if p.idealNextPacketSendTime.IsZero() || p.idealNextPacketSendTime.Add(pacingAlarmGranularity).Before(sentTime) {
+		p.idealNextPacketSendTime = sentTime.Add(delay)
+	} else {
+		p.idealNextPacketSendTime = p.idealNextPacketSendTime.Add(delay)
+	}
+	return ret
+}
+
+func (p *pacingSender) OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	// Don't send a burst while recovering from a loss.
+	p.burstTokens = 0
+	p.SendAlgorithm.OnPacketLost(number, lostBytes, bytesInFlight)
+}
+
+// PacingRate returns the rate at which packets are sent
+func (p *pacingSender) PacingRate() Bandwidth {
+	if sender, ok := p.SendAlgorithm.(SendAlgorithmWithPacingRate); ok {
+		return sender.PacingRate()
+	}
+	srtt := p.rttStats.SmoothedRTT()
+	if srtt == 0 {
+		srtt = initialRTTus * time.Microsecond
+	}
+	bandwidth := BandwidthFromDelta(p.SendAlgorithm.GetCongestionWindow(), srtt)
+	// Pace faster than the congestion window would allow, so that the window is used up before the next ACK arrives.
+	// In slow start, the congestion window doubles every RTT.
+	if p.SendAlgorithm.InSlowStart() {
+		return 2 * bandwidth
+	}
+	return bandwidth * 5 / 4
+}
+
+// transferTime is the time it takes to send the given number of bytes at the pacing rate
+func (p *pacingSender) transferTime(bytes protocol.ByteCount) time.Duration {
+	rate := p.PacingRate()
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(uint64(bytes) * uint64(BytesPerSecond) * uint64(time.Second) / uint64(rate))
+}
@@ -0,0 +1,167 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pacing Sender", func() {
+	const initialWindow protocol.PacketNumber = 20
+
+	var (
+		pacer         *pacingSender
+		sender        SendAlgorithmWithDebugInfo
+		clock         mockClock
+		rttStats      *RTTStats
+		bytesInFlight protocol.ByteCount
+		packetNumber  protocol.PacketNumber
+	)
+
+	BeforeEach(func() {
+		clock = mockClock{}
+		clock.Advance(time.Hour)
+		rttStats = NewRTTStats()
+		rttStats.UpdateRTT(100*time.Millisecond, 0, clock.Now())
+		sender = NewCubicSender(&clock, rttStats, false, initialWindow, MaxCongestionWindow)
+		pacer = NewPacingSender(sender, rttStats).(*pacingSender)
+		bytesInFlight = 0
+		packetNumber = 1
+	})
+
+	sendPacket := func() {
+		pacer.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, protocol.DefaultTCPMSS, true)
+		bytesInFlight += protocol.DefaultTCPMSS
+		packetNumber++
+	}
+
+	// sendBurst sends the packets allowed by the initial burst
+	sendBurst := func() {
+		for i := 0; i < initialUnpacedBurst; i++ {
+			Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+			sendPacket()
+		}
+	}
+
+	// in slow start, the pacing rate is twice the congestion window per RTT
+	// 20 packets per 100ms is one packet every 5ms
+	const delay = 2500 * time.Microsecond
+
+	It("delegates to the wrapped sender", func() {
+		Expect(pacer.GetCongestionWindow()).To(Equal(protocol.ByteCount(initialWindow) * protocol.DefaultTCPMSS))
+		Expect(pacer.InSlowStart()).To(BeTrue())
+	})
+
+	It("sends an initial burst without pacing", func() {
+		sendBurst()
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+		sendPacket()
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(Equal(delay))
+	})
+
+	It("limits the initial burst to the congestion window", func() {
+		sender = NewCubicSender(&clock, rttStats, false, 4, MaxCongestionWindow)
+		pacer = NewPacingSender(sender, rttStats).(*pacingSender)
+		for i := 0; i < 4; i++ {
+			Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+			sendPacket()
+		}
+		Expect(pacer.burstTokens).To(BeZero())
+	})
+
+	It("paces packets after the initial burst", func() {
+		sendBurst()
+		sendPacket()
+		for i := 0; i < 5; i++ {
+			Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(Equal(delay))
+			clock.Advance(delay)
+			Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+			sendPacket()
+		}
+	})
+
+	It("sends packets that are due within the alarm granularity", func() {
+		sendBurst()
+		sendPacket()
+		clock.Advance(delay - pacingAlarmGranularity)
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+	})
+
+	It("makes up for a late timer", func() {
+		sendBurst()
+		sendPacket()
+		clock.Advance(delay + delay/5)
+		sendPacket()
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(Equal(delay - delay/5))
+	})
+
+	It("doesn't send a burst if the application didn't send for a while", func() {
+		sendBurst()
+		sendPacket()
+		clock.Advance(10 * delay)
+		sendPacket()
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(Equal(delay))
+	})
+
+	It("allows a new burst after the connection was idle", func() {
+		sendBurst()
+		sendPacket()
+		for i := protocol.PacketNumber(1); i < packetNumber; i++ {
+			bytesInFlight -= protocol.DefaultTCPMSS
+			pacer.OnPacketAcked(i, protocol.DefaultTCPMSS, bytesInFlight)
+		}
+		Expect(bytesInFlight).To(BeZero())
+		sendBurst()
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+	})
+
+	It("stops the burst on a loss", func() {
+		sendPacket()
+		sendPacket()
+		Expect(pacer.burstTokens).ToNot(BeZero())
+		pacer.OnPacketLost(1, protocol.DefaultTCPMSS, bytesInFlight-protocol.DefaultTCPMSS)
+		Expect(pacer.burstTokens).To(BeZero())
+	})
+
+	It("doesn't pace if the congestion window is full", func() {
+		for bytesInFlight < pacer.GetCongestionWindow() {
+			sendPacket()
+			clock.Advance(delay)
+		}
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(Equal(utils.InfDuration))
+	})
+
+	It("doesn't pace non-retransmittable packets", func() {
+		sendBurst()
+		pacer.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, protocol.DefaultTCPMSS, false)
+		Expect(pacer.TimeUntilSend(clock.Now(), bytesInFlight)).To(BeZero())
+	})
+
+	Context("pacing rate", func() {
+		It("paces at twice the congestion window per RTT in slow start", func() {
+			Expect(pacer.PacingRate()).To(Equal(2 * BandwidthFromDelta(pacer.GetCongestionWindow(), 100*time.Millisecond)))
+		})
+
+		It("paces at 1.25 times the congestion window per RTT in congestion avoidance", func() {
+			sendBurst()
+			pacer.OnPacketLost(1, protocol.DefaultTCPMSS, bytesInFlight-protocol.DefaultTCPMSS)
+			Expect(pacer.InSlowStart()).To(BeFalse())
+			Expect(pacer.PacingRate()).To(Equal(BandwidthFromDelta(pacer.GetCongestionWindow(), 100*time.Millisecond) * 5 / 4))
+		})
+
+		It("uses the initial RTT if there's no RTT measurement yet", func() {
+			rttStats = &RTTStats{}
+			pacer = NewPacingSender(NewCubicSender(&clock, rttStats, false, initialWindow, MaxCongestionWindow), rttStats).(*pacingSender)
+			Expect(pacer.PacingRate()).To(Equal(2 * BandwidthFromDelta(pacer.GetCongestionWindow(), initialRTTus*time.Microsecond)))
+		})
+
+		It("uses the pacing rate of the wrapped sender", func() {
+			bbr := NewBBRSender(&clock, rttStats, initialWindow, MaxCongestionWindow)
+			pacer = NewPacingSender(bbr, rttStats).(*pacingSender)
+			Expect(pacer.PacingRate()).To(Equal(bbr.(SendAlgorithmWithPacingRate).PacingRate()))
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package congestion
+
+type bandwidthFilterSample struct {
+	bandwidth Bandwidth
+	round     uint64
+}
+
+// A maxBandwidthFilter tracks the maximum bandwidth over a window of round trips.
+// It uses Kathleen Nichols' algorithm, keeping the best, second best and third best
+// samples, so that a new maximum is available as soon as the best one expires.
+type maxBandwidthFilter struct {
+	windowLength uint64
+	estimates    [3]bandwidthFilterSample
+}
+
+func newMaxBandwidthFilter(windowLength uint64) *maxBandwidthFilter {
+	return &maxBandwidthFilter{windowLength: windowLength}
+}
+
+// Update adds a new bandwidth sample taken in the given round trip
+func (f *maxBandwidthFilter) Update(bandwidth Bandwidth, round uint64) {
+	sample := bandwidthFilterSample{bandwidth: bandwidth, round: round}
+
+	// Reset all estimates if there are none yet, if the sample is a new maximum,
+	// or if even the third best estimate has expired.
+	if f.estimates[0].bandwidth == 0 || bandwidth >= f.estimates[0].bandwidth || round-f.estimates[2].round > f.windowLength {
+		f.Reset(bandwidth, round)
+		return
+	}
+
+	if bandwidth >= f.estimates[1].bandwidth {
+		f.estimates[1] = sample
+		f.estimates[2] = sample
+	} else if bandwidth >= f.estimates[2].bandwidth {
+		f.estimates[2] = sample
+	}
+
+	// Expire and update the estimates as necessary.
+	if round-f.estimates[0].round > f.windowLength {
+		// The best estimate hasn't been updated for the whole window, so promote the second and third best.
+		f.estimates[0] = f.estimates[1]
+		f.estimates[1] = f.estimates[2]
+		f.estimates[2] = sample
+		// Need to iterate one more time. Check if the new best estimate is outside the window as well.
+		if round-f.estimates[0].round > f.windowLength {
+			f.estimates[0] = f.estimates[1]
+			f.estimates[1] = f.estimates[2]
+		}
+		return
+	}
+	if f.estimates[1] == f.estimates[0] && round-f.estimates[1].round > f.windowLength/4 {
+		// A quarter of the window has passed without a better sample, so the second best estimate
+		// is taken from the second quarter of the window.
+		f.estimates[1] = sample
+		f.estimates[2] = sample
+		return
+	}
+	if f.estimates[2] == f.estimates[1] && round-f.estimates[2].round > f.windowLength/2 {
+		// Half the window has passed without a better sample, so the third best estimate
+		// is taken from the second half of the window.
+		f.estimates[2] = sample
+	}
+}
+
+// Reset sets all estimates to the given sample
+func (f *maxBandwidthFilter) Reset(bandwidth Bandwidth, round uint64) {
+	sample := bandwidthFilterSample{bandwidth: bandwidth, round: round}
+	f.estimates[0] = sample
+	f.estimates[1] = sample
+	f.estimates[2] = sample
+}
+
+// GetBest returns the maximum bandwidth in the window
+func (f *maxBandwidthFilter) GetBest() Bandwidth {
+	return f.estimates[0].bandwidth
+}
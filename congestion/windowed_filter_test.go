@@ -0,0 +1,67 @@
+package congestion
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Max Bandwidth Filter", func() {
+	var filter *maxBandwidthFilter
+
+	BeforeEach(func() {
+		filter = newMaxBandwidthFilter(10)
+	})
+
+	It("starts without an estimate", func() {
+		Expect(filter.GetBest()).To(BeZero())
+	})
+
+	It("uses the first sample", func() {
+		filter.Update(1000, 1)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(1000)))
+	})
+
+	It("uses a new maximum immediately", func() {
+		filter.Update(1000, 1)
+		filter.Update(2000, 2)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(2000)))
+	})
+
+	It("keeps the maximum during the window", func() {
+		filter.Update(2000, 1)
+		for r := uint64(2); r <= 11; r++ {
+			filter.Update(1000, r)
+			Expect(filter.GetBest()).To(Equal(Bandwidth(2000)))
+		}
+	})
+
+	It("expires the maximum after the window", func() {
+		filter.Update(2000, 1)
+		for r := uint64(2); r <= 11; r++ {
+			filter.Update(1500, r)
+		}
+		filter.Update(1000, 12)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(1500)))
+	})
+
+	It("falls back to the second best estimate", func() {
+		filter.Update(3000, 1)
+		filter.Update(2000, 4)
+		filter.Update(1000, 7)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(3000)))
+		filter.Update(500, 12)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(2000)))
+	})
+
+	It("resets when all estimates expired", func() {
+		filter.Update(3000, 1)
+		filter.Update(500, 20)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(500)))
+	})
+
+	It("resets", func() {
+		filter.Update(3000, 1)
+		filter.Reset(100, 2)
+		Expect(filter.GetBest()).To(Equal(Bandwidth(100)))
+	})
+})
@@ -0,0 +1,36 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/congestion"
+	"github.com/lucas-clemente/quic-go/handshake"
+	"github.com/lucas-clemente/quic-go/protocol"
+)
+
+// DefaultCongestionControl is the CongestionControlFactory used if none is set in the Config
+// It uses CUBIC, unless the connection options request BBR (handshake.TagTBBR) or Reno (handshake.TagRENO).
+// The initial congestion window can be set using handshake.TagIW03, handshake.TagIW10, handshake.TagIW20 and handshake.TagIW50.
+func DefaultCongestionControl(rttStats *congestion.RTTStats, connectionOptions []handshake.Tag) congestion.SendAlgorithm {
+	var bbr, reno bool
+	initialCongestionWindow := protocol.PacketNumber(protocol.InitialCongestionWindow)
+	for _, option := range connectionOptions {
+		switch option {
+		case handshake.TagTBBR:
+			bbr = true
+		case handshake.TagRENO:
+			reno = true
+		case handshake.TagIW03:
+			initialCongestionWindow = 3
+		case handshake.TagIW10:
+			initialCongestionWindow = 10
+		case handshake.TagIW20:
+			initialCongestionWindow = 20
+		case handshake.TagIW50:
+			initialCongestionWindow = 50
+		}
+	}
+
+	if bbr {
+		return congestion.NewBBRSender(congestion.DefaultClock{}, rttStats, initialCongestionWindow, protocol.DefaultMaxCongestionWindow)
+	}
+	return congestion.NewCubicSender(congestion.DefaultClock{}, rttStats, reno, initialCongestionWindow, protocol.DefaultMaxCongestionWindow)
+}
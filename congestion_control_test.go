@@ -0,0 +1,51 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/congestion"
+	"github.com/lucas-clemente/quic-go/handshake"
+	"github.com/lucas-clemente/quic-go/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Default congestion control", func() {
+	var rttStats *congestion.RTTStats
+
+	BeforeEach(func() {
+		rttStats = congestion.NewRTTStats()
+	})
+
+	It("uses CUBIC by default", func() {
+		cc := DefaultCongestionControl(rttStats, nil)
+		Expect(cc).To(BeAssignableToTypeOf(congestion.NewCubicSender(congestion.DefaultClock{}, rttStats, false, 1, 1)))
+		Expect(cc.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow * protocol.DefaultTCPMSS))
+	})
+
+	It("uses BBR if requested", func() {
+		cc := DefaultCongestionControl(rttStats, []handshake.Tag{handshake.TagTBBR})
+		Expect(cc).To(BeAssignableToTypeOf(congestion.NewBBRSender(congestion.DefaultClock{}, rttStats, 1, 1)))
+	})
+
+	It("ignores unknown connection options", func() {
+		cc := DefaultCongestionControl(rttStats, []handshake.Tag{handshake.TagFHL2})
+		Expect(cc.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow * protocol.DefaultTCPMSS))
+	})
+
+	It("sets the initial congestion window", func() {
+		for tag, window := range map[handshake.Tag]protocol.ByteCount{
+			handshake.TagIW03: 3,
+			handshake.TagIW10: 10,
+			handshake.TagIW20: 20,
+			handshake.TagIW50: 50,
+		} {
+			cc := DefaultCongestionControl(rttStats, []handshake.Tag{tag})
+			Expect(cc.GetCongestionWindow()).To(Equal(window * protocol.DefaultTCPMSS))
+		}
+	})
+
+	It("sets the initial congestion window for BBR", func() {
+		cc := DefaultCongestionControl(rttStats, []handshake.Tag{handshake.TagIW10, handshake.TagTBBR})
+		Expect(cc.GetCongestionWindow()).To(Equal(10 * protocol.DefaultTCPMSS))
+	})
+})
@@ -0,0 +1,10 @@
+package crypto
+
+import "golang.org/x/sys/cpu"
+
+// HasAESHardwareSupport says if the CPU supports AES in hardware
+// On CPUs without hardware support, ChaCha20-Poly1305 is considerably faster than AES-GCM.
+func HasAESHardwareSupport() bool {
+	// AES-GCM is accelerated if the CPU has instructions for both AES and the carry-less multiplication
+	return (cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ) || (cpu.ARM64.HasAES && cpu.ARM64.HasPMULL)
+}
@@ -1,8 +1,9 @@
 package crypto
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
-	"hash/fnv"
 
 	"github.com/hashicorp/golang-lru"
 	"github.com/lucas-clemente/quic-go/protocol"
@@ -12,15 +13,28 @@ var (
 	compressedCertsCache *lru.Cache
 )
 
-func getCompressedCert(chain [][]byte, pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
-	// Hash all inputs
-	hasher := fnv.New64a()
+// getCompressedCertCacheKey hashes all inputs of the certificate compression
+// Every input is prefixed by its length, so that different inputs can't produce the same key, e.g. when the certificate chain changes.
+// The hash must be collision resistant, since the cached hashes are chosen by the client.
+func getCompressedCertCacheKey(chain [][]byte, pCommonSetHashes, pCachedHashes []byte) [sha256.Size]byte {
+	hasher := sha256.New()
+	write := func(data []byte) {
+		binary.Write(hasher, binary.LittleEndian, uint32(len(data)))
+		hasher.Write(data)
+	}
+	binary.Write(hasher, binary.LittleEndian, uint32(len(chain)))
 	for _, v := range chain {
-		hasher.Write(v)
+		write(v)
 	}
-	hasher.Write(pCommonSetHashes)
-	hasher.Write(pCachedHashes)
-	hash := hasher.Sum64()
+	write(pCommonSetHashes)
+	write(pCachedHashes)
+	var key [sha256.Size]byte
+	copy(key[:], hasher.Sum(nil))
+	return key
+}
+
+func getCompressedCert(chain [][]byte, pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
+	hash := getCompressedCertCacheKey(chain, pCommonSetHashes, pCachedHashes)
 
 	var result []byte
 
@@ -36,7 +36,30 @@ var _ = Describe("Certificate cache", func() {
 		_, err := getCompressedCert(chain, nil, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(compressedCertsCache.Len()).To(Equal(1))
-		Expect(compressedCertsCache.Contains(uint64(3838929964809501833))).To(BeTrue())
+		Expect(compressedCertsCache.Contains(getCompressedCertCacheKey(chain, nil, nil))).To(BeTrue())
+	})
+
+	It("uses different keys when the chain changes", func() {
+		key := getCompressedCertCacheKey([][]byte{{0xde, 0xca}, {0xfb, 0xad}}, nil, nil)
+		Expect(getCompressedCertCacheKey([][]byte{{0xde, 0xca, 0xfb, 0xad}}, nil, nil)).ToNot(Equal(key))
+		Expect(getCompressedCertCacheKey([][]byte{{0xde, 0xca}}, []byte{0xfb, 0xad}, nil)).ToNot(Equal(key))
+		Expect(getCompressedCertCacheKey([][]byte{{0xde, 0xca}, {0xfb, 0xad}}, nil, nil)).To(Equal(key))
+	})
+
+	It("uses different keys for different common set and cached hashes", func() {
+		chain := [][]byte{{0xde, 0xca, 0xfb, 0xad}}
+		Expect(getCompressedCertCacheKey(chain, []byte{1, 2}, nil)).ToNot(Equal(getCompressedCertCacheKey(chain, []byte{1}, []byte{2})))
+	})
+
+	It("compresses a new chain", func() {
+		_, err := getCompressedCert([][]byte{{0xde, 0xca, 0xfb, 0xad}}, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		newChain := [][]byte{{0xc0, 0xff, 0xee}}
+		expected, err := compressChain(newChain, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		compressed, err := getCompressedCert(newChain, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compressed).To(Equal(expected))
 	})
 
 	It("evicts old values", func() {
@@ -4,59 +4,80 @@ import (
 	"crypto/tls"
 	"errors"
 	"strings"
+	"sync"
 )
 
 // A CertChain holds a certificate and a private key
+// The certificate is selected once per handshake message using GetCertificate, and passed to all other methods.
+// This way, a handshake message never mixes two certificates, even if the TLS config is replaced in the meantime.
 type CertChain interface {
-	SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error)
-	GetCertsCompressed(sni string, commonSetHashes, cachedHashes []byte) ([]byte, error)
-	GetLeafCert(sni string) ([]byte, error)
+	GetCertificate(sni string) (*tls.Certificate, error)
+	SignServerProof(cert *tls.Certificate, chlo []byte, serverConfigData []byte) ([]byte, error)
+	GetCertsCompressed(cert *tls.Certificate, commonSetHashes, cachedHashes []byte) ([]byte, error)
+	GetLeafCert(cert *tls.Certificate) ([]byte, error)
+	GetSignedCertificateTimestamps(cert *tls.Certificate) [][]byte
+	// SetTLSConfig replaces the TLS config, e.g. to use a renewed certificate
+	SetTLSConfig(*tls.Config)
 }
 
 // proofSource stores a key and a certificate for the server proof
 type certChain struct {
+	mutex  sync.RWMutex
 	config *tls.Config
 }
 
 var _ CertChain = &certChain{}
 
-var errNoMatchingCertificate = errors.New("no matching certificate found")
+var (
+	errNoMatchingCertificate = errors.New("no matching certificate found")
+	errEmptyCertificate      = errors.New("certificate doesn't contain any data")
+)
 
 // NewCertChain loads the key and cert from files
 func NewCertChain(tlsConfig *tls.Config) CertChain {
 	return &certChain{config: tlsConfig}
 }
 
-// SignServerProof signs CHLO and server config for use in the server proof
-func (c *certChain) SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error) {
-	cert, err := c.getCertForSNI(sni)
-	if err != nil {
-		return nil, err
-	}
+// GetCertificate selects the certificate for the SNI
+func (c *certChain) GetCertificate(sni string) (*tls.Certificate, error) {
+	return c.getCertForSNI(sni)
+}
 
+// SignServerProof signs CHLO and server config for use in the server proof
+func (c *certChain) SignServerProof(cert *tls.Certificate, chlo []byte, serverConfigData []byte) ([]byte, error) {
 	return signServerProof(cert, chlo, serverConfigData)
 }
 
 // GetCertsCompressed gets the certificate in the format described by the QUIC crypto doc
-func (c *certChain) GetCertsCompressed(sni string, pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
-	cert, err := c.getCertForSNI(sni)
-	if err != nil {
-		return nil, err
-	}
+func (c *certChain) GetCertsCompressed(cert *tls.Certificate, pCommonSetHashes, pCachedHashes []byte) ([]byte, error) {
 	return getCompressedCert(cert.Certificate, pCommonSetHashes, pCachedHashes)
 }
 
 // GetLeafCert gets the leaf certificate
-func (c *certChain) GetLeafCert(sni string) ([]byte, error) {
-	cert, err := c.getCertForSNI(sni)
-	if err != nil {
-		return nil, err
+func (c *certChain) GetLeafCert(cert *tls.Certificate) ([]byte, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errEmptyCertificate
 	}
 	return cert.Certificate[0], nil
 }
 
+// GetSignedCertificateTimestamps gets the signed certificate timestamps (RFC 6962) of the leaf certificate
+func (c *certChain) GetSignedCertificateTimestamps(cert *tls.Certificate) [][]byte {
+	return cert.SignedCertificateTimestamps
+}
+
+// SetTLSConfig replaces the TLS config
+// The certificates of the new config are used for all subsequent handshakes.
+func (cc *certChain) SetTLSConfig(config *tls.Config) {
+	cc.mutex.Lock()
+	cc.config = config
+	cc.mutex.Unlock()
+}
+
 func (cc *certChain) getCertForSNI(sni string) (*tls.Certificate, error) {
+	cc.mutex.RLock()
 	c := cc.config
+	cc.mutex.RUnlock()
 	c, err := maybeGetConfigForClient(c, sni)
 	if err != nil {
 		return nil, err
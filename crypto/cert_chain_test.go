@@ -35,14 +35,7 @@ var _ = Describe("Proof", func() {
 			z.Write([]byte{0x04, 0x00, 0x00, 0x00})
 			z.Write(cert)
 			z.Close()
-			kd := &certChain{
-				config: &tls.Config{
-					Certificates: []tls.Certificate{
-						{Certificate: [][]byte{cert}},
-					},
-				},
-			}
-			certCompressed, err := kd.GetCertsCompressed("", nil, nil)
+			certCompressed, err := cc.GetCertsCompressed(&tls.Certificate{Certificate: [][]byte{cert}}, nil, nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(certCompressed).To(Equal(append([]byte{
 				0x01, 0x00,
@@ -50,21 +43,11 @@ var _ = Describe("Proof", func() {
 			}, certZlib.Bytes()...)))
 		})
 
-		It("errors when it can't retrieve a certificate", func() {
-			_, err := cc.GetCertsCompressed("invalid domain", nil, nil)
-			Expect(err).To(MatchError(errNoMatchingCertificate))
-		})
 	})
 
 	Context("signing server configs", func() {
-		It("errors when it can't retrieve a certificate for the requested SNI", func() {
-			_, err := cc.SignServerProof("invalid", []byte("chlo"), []byte("scfg"))
-			Expect(err).To(MatchError(errNoMatchingCertificate))
-		})
-
 		It("signs the server config", func() {
-			config.Certificates = []tls.Certificate{cert}
-			proof, err := cc.SignServerProof("", []byte("chlo"), []byte("scfg"))
+			proof, err := cc.SignServerProof(&cert, []byte("chlo"), []byte("scfg"))
 			Expect(err).ToNot(HaveOccurred())
 			Expect(proof).ToNot(BeEmpty())
 		})
@@ -117,16 +100,49 @@ var _ = Describe("Proof", func() {
 			Expect(cert.Certificate[0]).ToNot(BeNil())
 		})
 
+		It("errors when it can't retrieve a certificate", func() {
+			_, err := cc.GetCertificate("invalid domain")
+			Expect(err).To(MatchError(errNoMatchingCertificate))
+		})
+
 		It("gets leaf certificates", func() {
-			config.Certificates = []tls.Certificate{cert}
-			cert2, err := cc.GetLeafCert("")
+			cert2, err := cc.GetLeafCert(&cert)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(cert2).To(Equal(cert.Certificate[0]))
 		})
 
-		It("errors when it can't retrieve a leaf certificate", func() {
-			_, err := cc.GetLeafCert("invalid domain")
-			Expect(err).To(MatchError(errNoMatchingCertificate))
+		It("errors when getting the leaf of an empty certificate", func() {
+			_, err := cc.GetLeafCert(&tls.Certificate{})
+			Expect(err).To(MatchError(errEmptyCertificate))
+		})
+
+		It("gets the signed certificate timestamps", func() {
+			cert.SignedCertificateTimestamps = [][]byte{[]byte("sct1"), []byte("sct2")}
+			Expect(cc.GetSignedCertificateTimestamps(&cert)).To(Equal([][]byte{[]byte("sct1"), []byte("sct2")}))
+		})
+
+		It("uses a new TLS config", func() {
+			config.Certificates = []tls.Certificate{cert}
+			newCert := tls.Certificate{Certificate: [][]byte{[]byte("new leaf")}}
+			cc.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{newCert}})
+			c, err := cc.GetCertificate("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Certificate[0]).To(Equal([]byte("new leaf")))
+		})
+
+		It("keeps using a selected certificate when the TLS config is replaced", func() {
+			config.Certificates = []tls.Certificate{cert}
+			c, err := cc.GetCertificate("")
+			Expect(err).ToNot(HaveOccurred())
+			cc.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("new leaf")}}}})
+			leafCert, err := cc.GetLeafCert(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(leafCert).To(Equal(cert.Certificate[0]))
+			certCompressed, err := cc.GetCertsCompressed(c, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := getCompressedCert(cert.Certificate, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(certCompressed).To(Equal(expected))
 		})
 
 		It("respects GetConfigForClient", func() {
@@ -89,7 +89,9 @@ func compressChain(chain [][]byte, pCommonSetHashes, pCachedHashes []byte) ([]by
 	return res.Bytes(), nil
 }
 
-func decompressChain(data []byte) ([][]byte, error) {
+// decompressChain decompresses a certificate chain
+// cachedCerts are the certificates whose hashes were sent in the CCRT tag
+func decompressChain(data []byte, cachedCerts [][]byte) ([][]byte, error) {
 	var chain [][]byte
 	var entries []entry
 	r := bytes.NewReader(data)
@@ -111,8 +113,17 @@ func decompressChain(data []byte) ([][]byte, error) {
 
 		switch et {
 		case entryCached:
-			// we're not sending any certificate hashes in the CHLO, so there shouldn't be any cached certificates in the chain
-			return nil, errors.New("unexpected cached certificate")
+			e := entry{t: entryCached}
+			e.h, err = utils.ReadUint64(r)
+			if err != nil {
+				return nil, err
+			}
+			cert := findCachedCert(cachedCerts, e.h)
+			if cert == nil {
+				return nil, errors.New("unknown cached certificate")
+			}
+			entries = append(entries, e)
+			chain = append(chain, cert)
 		case entryCommon:
 			e := entry{t: entryCommon}
 			e.h, err = utils.ReadUint64(r)
@@ -194,6 +205,15 @@ func decompressChain(data []byte) ([][]byte, error) {
 	return chain, nil
 }
 
+func findCachedCert(cachedCerts [][]byte, hash uint64) []byte {
+	for _, cert := range cachedCerts {
+		if HashCert(cert) == hash {
+			return cert
+		}
+	}
+	return nil
+}
+
 func buildEntries(chain [][]byte, chainHashes, cachedHashes, setHashes []uint64) []entry {
 	res := make([]entry, len(chain))
 chainLoop:
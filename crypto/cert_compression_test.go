@@ -45,7 +45,7 @@ var _ = Describe("Cert compression and decompression", func() {
 	It("decompresses empty", func() {
 		compressed, err := compressChain(nil, nil, nil)
 		Expect(err).ToNot(HaveOccurred())
-		uncompressed, err := decompressChain(compressed)
+		uncompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uncompressed).To(BeEmpty())
 	})
@@ -72,7 +72,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		chain := [][]byte{cert}
 		compressed, err := compressChain(chain, nil, nil)
 		Expect(err).ToNot(HaveOccurred())
-		uncompressed, err := decompressChain(compressed)
+		uncompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uncompressed).To(Equal(chain))
 	})
@@ -103,7 +103,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		chain := [][]byte{cert1, cert2}
 		compressed, err := compressChain(chain, nil, nil)
 		Expect(err).ToNot(HaveOccurred())
-		decompressed, err := decompressChain(compressed)
+		decompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(decompressed).To(Equal(chain))
 	})
@@ -140,6 +140,25 @@ var _ = Describe("Cert compression and decompression", func() {
 		Expect(compressed).To(Equal(expected))
 	})
 
+	It("decompresses cached certificates", func() {
+		cert1 := []byte{0xde, 0xca, 0xfb, 0xad}
+		cert2 := []byte{0xde, 0xad, 0xbe, 0xef}
+		chain := [][]byte{cert1, cert2}
+		compressed, err := compressChain(chain, nil, byteHash(cert2))
+		Expect(err).ToNot(HaveOccurred())
+		decompressed, err := decompressChain(compressed, [][]byte{cert2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decompressed).To(Equal(chain))
+	})
+
+	It("errors if a cached certificate is unknown", func() {
+		cert := []byte{0xde, 0xca, 0xfb, 0xad}
+		compressed, err := compressChain([][]byte{cert}, nil, byteHash(cert))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = decompressChain(compressed, [][]byte{{0xde, 0xad, 0xbe, 0xef}})
+		Expect(err).To(MatchError("unknown cached certificate"))
+	})
+
 	It("uses common certificate sets", func() {
 		cert := certsets.CertSet3[42]
 		setHash := make([]byte, 8)
@@ -161,7 +180,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		chain := [][]byte{cert}
 		compressed, err := compressChain(chain, setHash, nil)
 		Expect(err).ToNot(HaveOccurred())
-		decompressed, err := decompressChain(compressed)
+		decompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(decompressed).To(Equal(chain))
 	})
@@ -175,7 +194,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		chain := [][]byte{cert1, cert2}
 		compressed, err := compressChain(chain, setHash, nil)
 		Expect(err).ToNot(HaveOccurred())
-		decompressed, err := decompressChain(compressed)
+		decompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(decompressed).To(Equal(chain))
 	})
@@ -207,7 +226,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		compressed, err := compressChain(chain, setHash, nil)
 		Expect(err).ToNot(HaveOccurred())
 		delete(certSets, certsets.CertSet3Hash)
-		_, err = decompressChain(compressed)
+		_, err = decompressChain(compressed, nil)
 		Expect(err).To(MatchError(errors.New("unknown certSet")))
 	})
 
@@ -224,7 +243,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		compressed, err := compressChain(chain, setHash, nil)
 		Expect(err).ToNot(HaveOccurred())
 		certSets[0x1337] = certSet[:1] // delete the last certificate from the certSet
-		_, err = decompressChain(compressed)
+		_, err = decompressChain(compressed, nil)
 		Expect(err).To(MatchError(errors.New("certificate not found in certSet")))
 	})
 
@@ -259,7 +278,7 @@ var _ = Describe("Cert compression and decompression", func() {
 		chain := [][]byte{cert1, cert2}
 		compressed, err := compressChain(chain, setHash, nil)
 		Expect(err).ToNot(HaveOccurred())
-		decompressed, err := decompressChain(compressed)
+		decompressed, err := decompressChain(compressed, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(decompressed).To(Equal(chain))
 	})
@@ -3,6 +3,7 @@ package crypto
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
 	"errors"
 	"hash/fnv"
 	"time"
@@ -13,9 +14,13 @@ import (
 // CertManager manages the certificates sent by the server
 type CertManager interface {
 	SetData([]byte) error
+	SetCachedChain([][]byte) error
 	GetCommonCertificateHashes() []byte
+	GetCachedCertificateHashes() []byte
 	GetLeafCert() []byte
 	GetLeafCertHash() (uint64, error)
+	GetChain() []*x509.Certificate
+	GetVerifiedChains() [][]*x509.Certificate
 	VerifyServerProof(proof, chlo, serverConfigData []byte) bool
 	Verify(hostname string) error
 }
@@ -23,6 +28,12 @@ type CertManager interface {
 type certManager struct {
 	chain  []*x509.Certificate
 	config *tls.Config
+
+	// verifiedChains are the chains built by Verify, they are nil if verification was skipped
+	verifiedChains [][]*x509.Certificate
+
+	// cachedChain is the certificate chain cached from a previous connection
+	cachedChain [][]byte
 }
 
 var _ CertManager = &certManager{}
@@ -36,7 +47,7 @@ func NewCertManager(tlsConfig *tls.Config) CertManager {
 
 // SetData takes the byte-slice sent in the SHLO and decompresses it into the certificate chain
 func (c *certManager) SetData(data []byte) error {
-	byteChain, err := decompressChain(data)
+	byteChain, err := decompressChain(data, c.cachedChain)
 	if err != nil {
 		return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 	}
@@ -51,6 +62,25 @@ func (c *certManager) SetData(data []byte) error {
 	}
 
 	c.chain = chain
+	c.verifiedChains = nil
+	return nil
+}
+
+// SetCachedChain sets the certificate chain cached from a previous connection
+// The server may then refer to these certificates by their hash in the compressed certificate chain.
+func (c *certManager) SetCachedChain(byteChain [][]byte) error {
+	chain := make([]*x509.Certificate, len(byteChain))
+	for i, data := range byteChain {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return err
+		}
+		chain[i] = cert
+	}
+
+	c.chain = chain
+	c.verifiedChains = nil
+	c.cachedChain = byteChain
 	return nil
 }
 
@@ -58,6 +88,15 @@ func (c *certManager) GetCommonCertificateHashes() []byte {
 	return getCommonCertificateHashes()
 }
 
+// GetCachedCertificateHashes returns the hashes of the cached certificates, as sent in the CCRT tag
+func (c *certManager) GetCachedCertificateHashes() []byte {
+	hashes := make([]byte, 8*len(c.cachedChain))
+	for i, cert := range c.cachedChain {
+		binary.LittleEndian.PutUint64(hashes[i*8:], HashCert(cert))
+	}
+	return hashes
+}
+
 // GetLeafCert returns the leaf certificate of the certificate chain
 // it returns nil if the certificate chain has not yet been set
 func (c *certManager) GetLeafCert() []byte {
@@ -67,6 +106,18 @@ func (c *certManager) GetLeafCert() []byte {
 	return c.chain[0].Raw
 }
 
+// GetChain returns the certificate chain
+// it returns nil if the certificate chain has not yet been set
+func (c *certManager) GetChain() []*x509.Certificate {
+	return c.chain
+}
+
+// GetVerifiedChains returns the chains built when verifying the certificate chain
+// it returns nil if the certificate chain has not yet been verified, or if verification was skipped
+func (c *certManager) GetVerifiedChains() [][]*x509.Certificate {
+	return c.verifiedChains
+}
+
 // GetLeafCertHash calculates the FNV1a_64 hash of the leaf certificate
 func (c *certManager) GetLeafCertHash() (uint64, error) {
 	leafCert := c.GetLeafCert()
@@ -126,6 +177,10 @@ func (c *certManager) Verify(hostname string) error {
 		opts.Intermediates = intermediates
 	}
 
-	_, err := leafCert.Verify(opts)
-	return err
+	verifiedChains, err := leafCert.Verify(opts)
+	if err != nil {
+		return err
+	}
+	c.verifiedChains = verifiedChains
+	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/binary"
 	"math/big"
 	"runtime"
 	"time"
@@ -79,6 +80,55 @@ var _ = Describe("Cert Manager", func() {
 		})
 	})
 
+	Context("using a cached chain", func() {
+		It("sets the cached chain", func() {
+			err := cm.SetCachedChain([][]byte{cert1, cert2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chain[0].Raw).To(Equal(cert1))
+			Expect(cm.chain[1].Raw).To(Equal(cert2))
+		})
+
+		It("errors if it can't parse a certificate", func() {
+			err := cm.SetCachedChain([][]byte{[]byte("cert1")})
+			_, ok := err.(asn1.StructuralError)
+			Expect(ok).To(BeTrue())
+			Expect(cm.GetCachedCertificateHashes()).To(BeEmpty())
+		})
+
+		It("gets the cached certificate hashes", func() {
+			err := cm.SetCachedChain([][]byte{cert1, cert2})
+			Expect(err).ToNot(HaveOccurred())
+			hashes := cm.GetCachedCertificateHashes()
+			Expect(hashes).To(HaveLen(16))
+			Expect(binary.LittleEndian.Uint64(hashes)).To(Equal(HashCert(cert1)))
+			Expect(binary.LittleEndian.Uint64(hashes[8:])).To(Equal(HashCert(cert2)))
+		})
+
+		It("returns no cached certificate hashes if no chain is cached", func() {
+			Expect(cm.GetCachedCertificateHashes()).To(BeEmpty())
+		})
+
+		It("clears the cached chain", func() {
+			err := cm.SetCachedChain([][]byte{cert1})
+			Expect(err).ToNot(HaveOccurred())
+			err = cm.SetCachedChain(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.GetCachedCertificateHashes()).To(BeEmpty())
+			Expect(cm.GetLeafCert()).To(BeNil())
+		})
+
+		It("decompresses a chain referencing cached certificates", func() {
+			err := cm.SetCachedChain([][]byte{cert1, cert2})
+			Expect(err).ToNot(HaveOccurred())
+			compressed, err := compressChain([][]byte{cert1, cert2}, nil, cm.GetCachedCertificateHashes())
+			Expect(err).ToNot(HaveOccurred())
+			err = cm.SetData(compressed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.chain[0].Raw).To(Equal(cert1))
+			Expect(cm.chain[1].Raw).To(Equal(cert2))
+		})
+	})
+
 	Context("getting the leaf cert", func() {
 		It("gets it", func() {
 			xcert1, err := x509.ParseCertificate(cert1)
@@ -96,6 +146,18 @@ var _ = Describe("Cert Manager", func() {
 		})
 	})
 
+	Context("getting the chain", func() {
+		It("returns the chain", func() {
+			chain := []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("intermediate")}}
+			cm.chain = chain
+			Expect(cm.GetChain()).To(Equal(chain))
+		})
+
+		It("returns nil if the chain hasn't been set yet", func() {
+			Expect(cm.GetChain()).To(BeNil())
+		})
+	})
+
 	Context("getting the leaf cert hash", func() {
 		It("calculates the FVN1a 64 hash", func() {
 			cm.chain = make([]*x509.Certificate, 1)
@@ -168,6 +230,8 @@ var _ = Describe("Cert Manager", func() {
 			}
 			err = cm.Verify("quic.clemente.io")
 			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.GetVerifiedChains()).ToNot(BeEmpty())
+			Expect(cm.GetVerifiedChains()[0][0]).To(Equal(cm.chain[0]))
 		})
 
 		It("doesn't accept an expired certificate", func() {
@@ -266,6 +330,14 @@ var _ = Describe("Cert Manager", func() {
 			cm.chain = []*x509.Certificate{leafCert}
 			err := cm.Verify("quic.clemente.io")
 			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.GetVerifiedChains()).To(BeNil())
+		})
+
+		It("resets the verified chains when a new chain is set", func() {
+			cm.verifiedChains = [][]*x509.Certificate{{}}
+			err := cm.SetCachedChain([][]byte{cert1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.GetVerifiedChains()).To(BeNil())
 		})
 
 		It("uses a different hostname from a client TLS config", func() {
@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/poly1305"
+)
+
+// chacha20Poly1305 implements the ChaCha20-Poly1305 AEAD as specified in RFC 7539, with a tag truncated to 12 bytes
+//
+// QUIC uses 12 byte tags, which is not supported by golang.org/x/crypto/chacha20poly1305.
+type chacha20Poly1305 struct {
+	key [32]byte
+}
+
+const (
+	chacha20NonceSize = 12
+	chacha20TagSize   = 12
+)
+
+var errChacha20Poly1305Open = errors.New("chacha20poly1305: message authentication failed")
+
+var _ cipher.AEAD = &chacha20Poly1305{}
+
+func newChacha20Poly1305(key *[32]byte) cipher.AEAD {
+	return &chacha20Poly1305{key: *key}
+}
+
+func (c *chacha20Poly1305) NonceSize() int {
+	return chacha20NonceSize
+}
+
+func (c *chacha20Poly1305) Overhead() int {
+	return chacha20TagSize
+}
+
+func (c *chacha20Poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != chacha20NonceSize {
+		panic("chacha20poly1305: bad nonce length passed to Seal")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+chacha20TagSize)
+	ciphertext := out[:len(plaintext)]
+	chacha20XORKeyStream(ciphertext, plaintext, &c.key, nonce, 1)
+
+	var tag [16]byte
+	c.tag(&tag, nonce, ciphertext, additionalData)
+	copy(out[len(plaintext):], tag[:chacha20TagSize])
+	return ret
+}
+
+func (c *chacha20Poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != chacha20NonceSize {
+		panic("chacha20poly1305: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < chacha20TagSize {
+		return nil, errChacha20Poly1305Open
+	}
+	tag := ciphertext[len(ciphertext)-chacha20TagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-chacha20TagSize]
+
+	var expectedTag [16]byte
+	c.tag(&expectedTag, nonce, ciphertext, additionalData)
+	if subtle.ConstantTimeCompare(expectedTag[:chacha20TagSize], tag) != 1 {
+		return nil, errChacha20Poly1305Open
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	chacha20XORKeyStream(out, ciphertext, &c.key, nonce, 1)
+	return ret, nil
+}
+
+// tag calculates the Poly1305 tag over the additional data and the ciphertext
+// The one-time Poly1305 key is the first block of the ChaCha20 key stream.
+func (c *chacha20Poly1305) tag(out *[16]byte, nonce, ciphertext, additionalData []byte) {
+	var polyKey [32]byte
+	chacha20XORKeyStream(polyKey[:], polyKey[:], &c.key, nonce, 0)
+
+	var padding [16]byte
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+
+	mac := poly1305.New(&polyKey)
+	mac.Write(additionalData)
+	mac.Write(padding[:padLen16(len(additionalData))])
+	mac.Write(ciphertext)
+	mac.Write(padding[:padLen16(len(ciphertext))])
+	mac.Write(lengths[:])
+	mac.Sum(out[:0])
+}
+
+// padLen16 returns the number of zero bytes needed to pad l bytes to a multiple of 16
+func padLen16(l int) int {
+	return (16 - l%16) % 16
+}
+
+// sliceForAppend extends in by n bytes, and returns the extended slice and the n new bytes
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// chacha20XORKeyStream XORs src with the ChaCha20 key stream, starting at the given block counter
+func chacha20XORKeyStream(dst, src []byte, key *[32]byte, nonce []byte, counter uint32) {
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce)
+	if err != nil {
+		// the key and nonce sizes are checked by the callers
+		panic(err)
+	}
+	c.SetCounter(counter)
+	c.XORKeyStream(dst, src)
+}
@@ -1,13 +1,9 @@
-// +build ignore
-
 package crypto
 
 import (
 	"crypto/cipher"
 	"errors"
 
-	"github.com/aead/chacha20"
-
 	"github.com/lucas-clemente/quic-go/protocol"
 )
 
@@ -28,19 +24,11 @@ func NewAEADChacha20Poly1305(otherKey []byte, myKey []byte, otherIV []byte, myIV
 	copy(MyKey[:], myKey)
 	copy(OtherKey[:], otherKey)
 
-	encrypter, err := chacha20.NewChaCha20Poly1305WithTagSize(&MyKey, 12)
-	if err != nil {
-		return nil, err
-	}
-	decrypter, err := chacha20.NewChaCha20Poly1305WithTagSize(&OtherKey, 12)
-	if err != nil {
-		return nil, err
-	}
 	return &aeadChacha20Poly1305{
 		otherIV:   otherIV,
 		myIV:      myIV,
-		encrypter: encrypter,
-		decrypter: decrypter,
+		encrypter: newChacha20Poly1305(&MyKey),
+		decrypter: newChacha20Poly1305(&OtherKey),
 	}, nil
 }
 
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChaCha20-Poly1305 with truncated tags", func() {
+	var (
+		key   [32]byte
+		nonce []byte
+		aad   []byte
+	)
+
+	BeforeEach(func() {
+		rand.Read(key[:])
+		nonce = make([]byte, 12)
+		rand.Read(nonce)
+		aad = []byte("additional data")
+	})
+
+	It("has the right sizes", func() {
+		aead := newChacha20Poly1305(&key)
+		Expect(aead.NonceSize()).To(Equal(12))
+		Expect(aead.Overhead()).To(Equal(12))
+	})
+
+	// test vector from RFC 7539, section 2.8.2, with the tag truncated to 12 bytes
+	Context("RFC 7539 test vector", func() {
+		var (
+			rfcKey        [32]byte
+			rfcNonce      []byte
+			rfcAAD        []byte
+			rfcPlaintext  []byte
+			rfcCiphertext []byte
+		)
+
+		BeforeEach(func() {
+			decode := func(s string) []byte {
+				b, err := hex.DecodeString(s)
+				Expect(err).ToNot(HaveOccurred())
+				return b
+			}
+			copy(rfcKey[:], decode("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f"))
+			rfcNonce = decode("070000004041424344454647")
+			rfcAAD = decode("50515253c0c1c2c3c4c5c6c7")
+			rfcPlaintext = []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+			rfcCiphertext = decode("d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6" +
+				"3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36" +
+				"92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+				"3ff4def08e4b7a9de576d26586cec64b6116" +
+				"1ae10b594f09e26a7e902ecb") // the RFC's tag is 1ae10b594f09e26a7e902ecbd0600691
+		})
+
+		It("seals", func() {
+			aead := newChacha20Poly1305(&rfcKey)
+			Expect(aead.Seal(nil, rfcNonce, rfcPlaintext, rfcAAD)).To(Equal(rfcCiphertext))
+		})
+
+		It("opens", func() {
+			aead := newChacha20Poly1305(&rfcKey)
+			opened, err := aead.Open(nil, rfcNonce, rfcCiphertext, rfcAAD)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(rfcPlaintext))
+		})
+	})
+
+	It("matches the RFC 7539 implementation, except for the tag length", func() {
+		reference, err := chacha20poly1305.New(key[:])
+		Expect(err).ToNot(HaveOccurred())
+		aead := newChacha20Poly1305(&key)
+		for _, l := range []int{0, 1, 15, 16, 63, 64, 65, 200, 1350} {
+			plaintext := make([]byte, l)
+			rand.Read(plaintext)
+			expected := reference.Seal(nil, nonce, plaintext, aad)
+			Expect(aead.Seal(nil, nonce, plaintext, aad)).To(Equal(expected[:l+12]))
+		}
+	})
+
+	It("opens sealed messages", func() {
+		aead := newChacha20Poly1305(&key)
+		sealed := aead.Seal([]byte("prefix"), nonce, []byte("foobar"), aad)
+		Expect(sealed).To(HavePrefix("prefix"))
+		opened, err := aead.Open(nil, nonce, sealed[len("prefix"):], aad)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(opened).To(Equal([]byte("foobar")))
+	})
+
+	It("opens in place", func() {
+		aead := newChacha20Poly1305(&key)
+		sealed := aead.Seal(nil, nonce, []byte("foobar"), aad)
+		opened, err := aead.Open(sealed[:0], nonce, sealed, aad)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(opened).To(Equal([]byte("foobar")))
+	})
+
+	It("rejects modified messages", func() {
+		aead := newChacha20Poly1305(&key)
+		sealed := aead.Seal(nil, nonce, []byte("foobar"), aad)
+		sealed[0] ^= 1
+		_, err := aead.Open(nil, nonce, sealed, aad)
+		Expect(err).To(MatchError(errChacha20Poly1305Open))
+	})
+
+	It("rejects messages shorter than the tag", func() {
+		aead := newChacha20Poly1305(&key)
+		_, err := aead.Open(nil, nonce, make([]byte, 11), aad)
+		Expect(err).To(MatchError(errChacha20Poly1305Open))
+	})
+})
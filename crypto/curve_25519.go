@@ -17,10 +17,20 @@ var _ KeyExchange = &curve25519KEX{}
 
 // NewCurve25519KEX creates a new KeyExchange using Curve25519, see https://cr.yp.to/ecdh.html
 func NewCurve25519KEX() (KeyExchange, error) {
-	c := &curve25519KEX{}
-	if _, err := rand.Read(c.secret[:]); err != nil {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
 		return nil, errors.New("Curve25519: could not create private key")
 	}
+	return NewCurve25519KEXFromPrivateKey(secret)
+}
+
+// NewCurve25519KEXFromPrivateKey creates a new KeyExchange using Curve25519 with a given private key
+func NewCurve25519KEXFromPrivateKey(secret []byte) (KeyExchange, error) {
+	if len(secret) != 32 {
+		return nil, errors.New("Curve25519: expected private key of 32 byte")
+	}
+	c := &curve25519KEX{}
+	copy(c.secret[:], secret)
 	// See https://cr.yp.to/ecdh.html
 	c.secret[0] &= 248
 	c.secret[31] &= 127
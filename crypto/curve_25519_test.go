@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"bytes"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -24,4 +26,25 @@ var _ = Describe("ProofRsa", func() {
 		_, err = a.CalculateSharedKey(nil)
 		Expect(err).To(MatchError("Curve25519: expected public key of 32 byte"))
 	})
+
+	It("creates the same key exchange from the same private key", func() {
+		secret := bytes.Repeat([]byte{0x42}, 32)
+		a, err := NewCurve25519KEXFromPrivateKey(secret)
+		Expect(err).ToNot(HaveOccurred())
+		b, err := NewCurve25519KEXFromPrivateKey(secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.PublicKey()).To(Equal(b.PublicKey()))
+		c, err := NewCurve25519KEX()
+		Expect(err).ToNot(HaveOccurred())
+		sA, err := a.CalculateSharedKey(c.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		sC, err := c.CalculateSharedKey(b.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sA).To(Equal(sC))
+	})
+
+	It("rejects private keys with the wrong length", func() {
+		_, err := NewCurve25519KEXFromPrivateKey(make([]byte, 31))
+		Expect(err).To(MatchError("Curve25519: expected private key of 32 byte"))
+	})
 })
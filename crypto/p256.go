@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+type p256KEX struct {
+	secret []byte
+	public []byte
+}
+
+var _ KeyExchange = &p256KEX{}
+
+// NewP256KEX creates a new KeyExchange using the NIST curve P-256
+func NewP256KEX() (KeyExchange, error) {
+	secret, err := GenerateP256PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewP256KEXFromPrivateKey(secret)
+}
+
+// GenerateP256PrivateKey generates a private key that can be used with NewP256KEXFromPrivateKey
+func GenerateP256PrivateKey() ([]byte, error) {
+	secret, _, _, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.New("P256: could not create private key")
+	}
+	return secret, nil
+}
+
+// NewP256KEXFromPrivateKey creates a new KeyExchange using the NIST curve P-256 with a given private key
+func NewP256KEXFromPrivateKey(secret []byte) (KeyExchange, error) {
+	curve := elliptic.P256()
+	if len(secret) != 32 {
+		return nil, errors.New("P256: expected private key of 32 byte")
+	}
+	if k := new(big.Int).SetBytes(secret); k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("P256: invalid private key")
+	}
+	x, y := curve.ScalarBaseMult(secret)
+	return &p256KEX{
+		secret: secret,
+		public: elliptic.Marshal(curve, x, y),
+	}, nil
+}
+
+func (p *p256KEX) PublicKey() []byte {
+	return p.public
+}
+
+func (p *p256KEX) CalculateSharedKey(otherPublic []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, otherPublic)
+	if x == nil || !curve.IsOnCurve(x, y) {
+		return nil, errors.New("P256: invalid public key")
+	}
+	x, _ = curve.ScalarMult(x, y, p.secret)
+	// the shared key is the x-coordinate, padded to 32 bytes
+	res := make([]byte, 32)
+	xBytes := x.Bytes()
+	copy(res[32-len(xBytes):], xBytes)
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("P256", func() {
+	It("works", func() {
+		a, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		b, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.PublicKey()).To(HaveLen(65))
+		sA, err := a.CalculateSharedKey(b.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		sB, err := b.CalculateSharedKey(a.PublicKey())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sA).To(HaveLen(32))
+		Expect(sA).To(Equal(sB))
+	})
+
+	It("rejects invalid public keys", func() {
+		a, err := NewP256KEX()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = a.CalculateSharedKey(nil)
+		Expect(err).To(MatchError("P256: invalid public key"))
+		pub := append([]byte{}, a.PublicKey()...)
+		pub[64] ^= 0xff // the point is not on the curve anymore
+		_, err = a.CalculateSharedKey(pub)
+		Expect(err).To(MatchError("P256: invalid public key"))
+	})
+
+	It("creates the same key exchange from the same private key", func() {
+		secret, err := GenerateP256PrivateKey()
+		Expect(err).ToNot(HaveOccurred())
+		a, err := NewP256KEXFromPrivateKey(secret)
+		Expect(err).ToNot(HaveOccurred())
+		b, err := NewP256KEXFromPrivateKey(secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.PublicKey()).To(Equal(b.PublicKey()))
+	})
+
+	It("rejects private keys with the wrong length", func() {
+		_, err := NewP256KEXFromPrivateKey(make([]byte, 31))
+		Expect(err).To(MatchError("P256: expected private key of 32 byte"))
+	})
+
+	It("rejects private keys that are out of range", func() {
+		_, err := NewP256KEXFromPrivateKey(make([]byte, 32))
+		Expect(err).To(MatchError("P256: invalid private key"))
+		_, err = NewP256KEXFromPrivateKey(bytes.Repeat([]byte{0xff}, 32))
+		Expect(err).To(MatchError("P256: invalid private key"))
+	})
+})
@@ -10,48 +10,75 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/utils"
 
 	"golang.org/x/crypto/hkdf"
 )
 
 // StkSource is used to create and verify source address tokens
 type StkSource interface {
-	// NewToken creates a new token for a given IP address
-	NewToken(sourceAddress []byte) ([]byte, error)
-	// VerifyToken verifies if a token matches a given IP address and is not outdated
-	VerifyToken(sourceAddress []byte, data []byte) error
+	// NewToken creates a new token for a given IP address, carrying the given data
+	NewToken(sourceAddress []byte, data STKData) ([]byte, error)
+	// VerifyToken verifies if a token matches a given IP address and is not outdated, and returns the data it carries
+	VerifyToken(sourceAddress []byte, token []byte) (STKData, error)
+}
+
+// STKData is the data carried in a source address token, in addition to the source address
+type STKData struct {
+	// RTT is the round trip time to the client measured by the server, or zero if unknown
+	// The server can use it as a hint for the network parameters when the client connects again.
+	RTT time.Duration
 }
 
 type sourceAddressToken struct {
 	sourceAddr []byte
 	// unix timestamp in seconds
 	timestamp uint64
+	// RTT in microseconds
+	rtt uint32
 }
 
 func (t *sourceAddressToken) serialize() []byte {
-	res := make([]byte, 8+len(t.sourceAddr))
+	res := make([]byte, 12+len(t.sourceAddr))
 	binary.LittleEndian.PutUint64(res, t.timestamp)
-	copy(res[8:], t.sourceAddr)
+	binary.LittleEndian.PutUint32(res[8:], t.rtt)
+	copy(res[12:], t.sourceAddr)
 	return res
 }
 
 func parseToken(data []byte) (*sourceAddressToken, error) {
-	if len(data) != 8+4 && len(data) != 8+16 {
+	if len(data) != 12+4 && len(data) != 12+16 {
 		return nil, fmt.Errorf("invalid STK length: %d", len(data))
 	}
 	return &sourceAddressToken{
-		sourceAddr: data[8:],
+		sourceAddr: data[12:],
 		timestamp:  binary.LittleEndian.Uint64(data),
+		rtt:        binary.LittleEndian.Uint32(data[8:]),
 	}, nil
 }
 
-type stkSource struct {
+type stkSecret struct {
 	aead cipher.AEAD
+	// the time when this secret was replaced by a newer secret
+	retired time.Time
+}
+
+// RotatingStkSource is a StkSource that uses multiple secrets
+// New tokens are created using the newest secret. Tokens created with older secrets are accepted until they expire.
+type RotatingStkSource struct {
+	mutex sync.RWMutex
+
+	secrets []*stkSecret // the last secret is the newest
+	expiry  time.Duration
 }
 
+var _ StkSource = &RotatingStkSource{}
+
 const stkKeySize = 16
 
 // Chrome currently sets this to 12, but discusses changing it to 16. We start
@@ -60,53 +87,118 @@ const stkNonceSize = 16
 
 // NewStkSource creates a source for source address tokens
 func NewStkSource(secret []byte) (StkSource, error) {
-	key, err := deriveKey(secret)
-	if err != nil {
-		return nil, err
+	return NewRotatingStkSource([][]byte{secret}, 0)
+}
+
+// NewRotatingStkSource creates a source for source address tokens using multiple secrets
+// The last secret is used to create new tokens, all secrets are accepted when verifying tokens.
+// Tokens are valid for the duration of expiry. If expiry is zero, tokens are valid for 24 hours.
+func NewRotatingStkSource(secrets [][]byte, expiry time.Duration) (*RotatingStkSource, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("STK source requires at least one secret")
 	}
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
+	if expiry == 0 {
+		expiry = protocol.STKExpiryTimeSec * time.Second
+	}
+	s := &RotatingStkSource{expiry: expiry}
+	now := time.Now()
+	for i, secret := range secrets {
+		aead, err := newStkAEAD(secret)
+		if err != nil {
+			return nil, err
+		}
+		s.secrets = append(s.secrets, &stkSecret{aead: aead})
+		if i > 0 {
+			s.secrets[i-1].retired = now
+		}
 	}
-	aead, err := cipher.NewGCMWithNonceSize(c, stkNonceSize)
+	return s, nil
+}
+
+// Rotate adds a new secret, which is used to create new tokens from now on
+// Older secrets are removed once all tokens created with them have expired.
+func (s *RotatingStkSource) Rotate(secret []byte) error {
+	aead, err := newStkAEAD(secret)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &stkSource{aead: aead}, nil
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.secrets[len(s.secrets)-1].retired = now
+	secrets := s.secrets[:0]
+	for _, sec := range s.secrets {
+		if now.Sub(sec.retired) <= s.expiry {
+			secrets = append(secrets, sec)
+		}
+	}
+	s.secrets = append(secrets, &stkSecret{aead: aead})
+	return nil
 }
 
-func (s *stkSource) NewToken(sourceAddr []byte) ([]byte, error) {
-	return encryptToken(s.aead, &sourceAddressToken{
+// NewToken creates a new token using the newest secret
+func (s *RotatingStkSource) NewToken(sourceAddr []byte, data STKData) ([]byte, error) {
+	s.mutex.RLock()
+	aead := s.secrets[len(s.secrets)-1].aead
+	s.mutex.RUnlock()
+
+	return encryptToken(aead, &sourceAddressToken{
 		sourceAddr: sourceAddr,
 		timestamp:  uint64(time.Now().Unix()),
+		rtt:        uint32(utils.MinDuration(data.RTT, math.MaxUint32*time.Microsecond) / time.Microsecond),
 	})
 }
 
-func (s *stkSource) VerifyToken(sourceAddr []byte, data []byte) error {
+// VerifyToken verifies a token created using any of the secrets
+func (s *RotatingStkSource) VerifyToken(sourceAddr []byte, data []byte) (STKData, error) {
 	if len(data) < stkNonceSize {
-		return errors.New("STK too short")
+		return STKData{}, errors.New("STK too short")
 	}
 	nonce := data[:stkNonceSize]
 
-	res, err := s.aead.Open(nil, nonce, data[stkNonceSize:], nil)
+	s.mutex.RLock()
+	var res []byte
+	var err error
+	// start with the newest secret, since most tokens were created using it
+	for i := len(s.secrets) - 1; i >= 0; i-- {
+		res, err = s.secrets[i].aead.Open(nil, nonce, data[stkNonceSize:], nil)
+		if err == nil {
+			break
+		}
+	}
+	s.mutex.RUnlock()
 	if err != nil {
-		return err
+		return STKData{}, err
 	}
 
 	token, err := parseToken(res)
 	if err != nil {
-		return err
+		return STKData{}, err
 	}
 
 	if subtle.ConstantTimeCompare(token.sourceAddr, sourceAddr) != 1 {
-		return errors.New("invalid source address in STK")
+		return STKData{}, errors.New("invalid source address in STK")
 	}
 
-	if time.Now().Unix() > int64(token.timestamp)+protocol.STKExpiryTimeSec {
-		return errors.New("STK expired")
+	if time.Now().After(time.Unix(int64(token.timestamp), 0).Add(s.expiry)) {
+		return STKData{}, errors.New("STK expired")
 	}
 
-	return nil
+	return STKData{RTT: time.Duration(token.rtt) * time.Microsecond}, nil
+}
+
+func newStkAEAD(secret []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(c, stkNonceSize)
 }
 
 func deriveKey(secret []byte) ([]byte, error) {
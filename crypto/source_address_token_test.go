@@ -17,9 +17,10 @@ var _ = Describe("Source Address Tokens", func() {
 	Context("tokens", func() {
 		It("serializes", func() {
 			ip := []byte{127, 0, 0, 1}
-			token := &sourceAddressToken{sourceAddr: ip, timestamp: 0xdeadbeef}
+			token := &sourceAddressToken{sourceAddr: ip, timestamp: 0xdeadbeef, rtt: 0x1337}
 			Expect(token.serialize()).To(Equal([]byte{
 				0xef, 0xbe, 0xad, 0xde, 0x00, 0x00, 0x00, 0x00,
+				0x37, 0x13, 0x00, 0x00,
 				127, 0, 0, 1,
 			}))
 		})
@@ -27,11 +28,13 @@ var _ = Describe("Source Address Tokens", func() {
 		It("reads", func() {
 			token, err := parseToken([]byte{
 				0xef, 0xbe, 0xad, 0xde, 0x00, 0x00, 0x00, 0x00,
+				0x37, 0x13, 0x00, 0x00,
 				127, 0, 0, 1,
 			})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(token.sourceAddr).To(Equal([]byte{127, 0, 0, 1}))
 			Expect(token.timestamp).To(Equal(uint64(0xdeadbeef)))
+			Expect(token.rtt).To(Equal(uint32(0x1337)))
 		})
 
 		It("rejects tokens of wrong size", func() {
@@ -42,7 +45,7 @@ var _ = Describe("Source Address Tokens", func() {
 
 	Context("source", func() {
 		var (
-			source *stkSource
+			source *RotatingStkSource
 			secret []byte
 			ip4    net.IP
 			ip6    net.IP
@@ -58,61 +61,143 @@ var _ = Describe("Source Address Tokens", func() {
 
 			secret = []byte("TESTING")
 			sourceI, err := NewStkSource(secret)
-			source = sourceI.(*stkSource)
+			source = sourceI.(*RotatingStkSource)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("should generate new tokens", func() {
-			token, err := source.NewToken(ip4)
+			token, err := source.NewToken(ip4, STKData{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(token).ToNot(BeEmpty())
 		})
 
 		It("should generate and verify ipv4 tokens", func() {
-			stk, err := source.NewToken(ip4)
+			stk, err := source.NewToken(ip4, STKData{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(stk).ToNot(BeEmpty())
-			err = source.VerifyToken(ip4, stk)
+			_, err = source.VerifyToken(ip4, stk)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("should generate and verify ipv6 tokens", func() {
-			stk, err := source.NewToken(ip6)
+			stk, err := source.NewToken(ip6, STKData{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(stk).ToNot(BeEmpty())
-			err = source.VerifyToken(ip6, stk)
+			_, err = source.VerifyToken(ip6, stk)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("should reject empty tokens", func() {
-			err := source.VerifyToken(ip4, nil)
+			_, err := source.VerifyToken(ip4, nil)
 			Expect(err).To(HaveOccurred())
 		})
 
 		It("should reject invalid tokens", func() {
-			err := source.VerifyToken(ip4, []byte("foobar"))
+			_, err := source.VerifyToken(ip4, []byte("foobar"))
 			Expect(err).To(HaveOccurred())
 		})
 
 		It("should reject outdated tokens", func() {
-			stk, err := encryptToken(source.aead, &sourceAddressToken{
+			stk, err := encryptToken(source.secrets[0].aead, &sourceAddressToken{
 				sourceAddr: ip4,
 				timestamp:  uint64(time.Now().Unix() - protocol.STKExpiryTimeSec - 1),
 			})
 			Expect(err).NotTo(HaveOccurred())
-			err = source.VerifyToken(ip4, stk)
+			_, err = source.VerifyToken(ip4, stk)
 			Expect(err).To(MatchError("STK expired"))
 		})
 
 		It("should reject tokens with wrong IP addresses", func() {
 			otherIP := net.ParseIP("4.3.2.1")
-			stk, err := encryptToken(source.aead, &sourceAddressToken{
+			stk, err := encryptToken(source.secrets[0].aead, &sourceAddressToken{
 				sourceAddr: otherIP,
 				timestamp:  uint64(time.Now().Unix()),
 			})
 			Expect(err).NotTo(HaveOccurred())
-			err = source.VerifyToken(ip4, stk)
+			_, err = source.VerifyToken(ip4, stk)
 			Expect(err).To(MatchError("invalid source address in STK"))
 		})
+
+		It("carries the RTT", func() {
+			stk, err := source.NewToken(ip4, STKData{RTT: 1337 * time.Microsecond})
+			Expect(err).NotTo(HaveOccurred())
+			data, err := source.VerifyToken(ip4, stk)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data.RTT).To(Equal(1337 * time.Microsecond))
+		})
+
+		It("uses a configurable expiry", func() {
+			source, err := NewRotatingStkSource([][]byte{secret}, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			stk, err := encryptToken(source.secrets[0].aead, &sourceAddressToken{
+				sourceAddr: ip4,
+				timestamp:  uint64(time.Now().Add(-time.Hour - time.Second).Unix()),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = source.VerifyToken(ip4, stk)
+			Expect(err).To(MatchError("STK expired"))
+		})
+
+		It("errors without secrets", func() {
+			_, err := NewRotatingStkSource(nil, 0)
+			Expect(err).To(HaveOccurred())
+		})
+
+		Context("multiple secrets", func() {
+			It("accepts tokens created with any of the secrets", func() {
+				source1, err := NewRotatingStkSource([][]byte{[]byte("secret1")}, 0)
+				Expect(err).NotTo(HaveOccurred())
+				source2, err := NewRotatingStkSource([][]byte{[]byte("secret2")}, 0)
+				Expect(err).NotTo(HaveOccurred())
+				source, err := NewRotatingStkSource([][]byte{[]byte("secret1"), []byte("secret2")}, 0)
+				Expect(err).NotTo(HaveOccurred())
+				stk1, err := source1.NewToken(ip4, STKData{})
+				Expect(err).NotTo(HaveOccurred())
+				stk2, err := source2.NewToken(ip4, STKData{})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = source.VerifyToken(ip4, stk1)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = source.VerifyToken(ip4, stk2)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("creates new tokens with the last secret", func() {
+				source, err := NewRotatingStkSource([][]byte{[]byte("secret1"), []byte("secret2")}, 0)
+				Expect(err).NotTo(HaveOccurred())
+				source2, err := NewRotatingStkSource([][]byte{[]byte("secret2")}, 0)
+				Expect(err).NotTo(HaveOccurred())
+				stk, err := source.NewToken(ip4, STKData{})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = source2.VerifyToken(ip4, stk)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("rotates the secret", func() {
+				stk, err := source.NewToken(ip4, STKData{})
+				Expect(err).NotTo(HaveOccurred())
+				err = source.Rotate([]byte("new secret"))
+				Expect(err).NotTo(HaveOccurred())
+				// tokens created with the old secret are still accepted
+				_, err = source.VerifyToken(ip4, stk)
+				Expect(err).NotTo(HaveOccurred())
+				// new tokens are created with the new secret
+				newSource, err := NewStkSource([]byte("new secret"))
+				Expect(err).NotTo(HaveOccurred())
+				stk, err = source.NewToken(ip4, STKData{})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = newSource.VerifyToken(ip4, stk)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes secrets once all tokens created with them have expired", func() {
+				err := source.Rotate([]byte("secret2"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(source.secrets).To(HaveLen(2))
+				source.secrets[0].retired = time.Now().Add(-protocol.STKExpiryTimeSec*time.Second - time.Second)
+				err = source.Rotate([]byte("secret3"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(source.secrets).To(HaveLen(2))
+			})
+		})
 	})
 })
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A StrikeRegister records the client nonces of CHLOs, such that replayed CHLOs can be detected
+// Implementations must be safe for concurrent use. A StrikeRegister can be shared between multiple servers.
+type StrikeRegister interface {
+	// Insert records a client nonce
+	// It returns an error if the nonce was already recorded, or if it can't be guaranteed that the nonce is unique.
+	Insert(nonce []byte, now time.Time) error
+}
+
+var (
+	errNonceInvalid       = errors.New("StrikeRegister: invalid nonce length")
+	errNonceReplayed      = errors.New("StrikeRegister: nonce was already used")
+	errNonceOutsideWindow = errors.New("StrikeRegister: nonce timestamp outside of the window")
+	errNonceBeforeHorizon = errors.New("StrikeRegister: nonce timestamp before the horizon")
+)
+
+// the length of a client nonce: 4 bytes timestamp, 8 bytes orbit, 20 bytes random data
+const clientNonceLen = 32
+
+type strikeRegister struct {
+	mutex sync.Mutex
+
+	window     time.Duration
+	maxEntries int
+	// nonces with a timestamp before the horizon are rejected, since they might have been used before the register was created,
+	// or their entry might have been evicted
+	horizon time.Time
+
+	// maps the nonce to the time when it leaves the window
+	nonces    map[string]time.Time
+	nextPurge time.Time
+}
+
+var _ StrikeRegister = &strikeRegister{}
+
+// NewStrikeRegister creates an in-memory StrikeRegister
+// It accepts nonces with a timestamp that deviates at most window from the current time, and holds up to maxEntries nonces.
+// Nonces with a timestamp before the creation of the register are rejected.
+// When the register is full, the oldest nonces are evicted, and nonces that are not newer than the evicted ones are rejected from then on.
+func NewStrikeRegister(window time.Duration, maxEntries int) StrikeRegister {
+	now := time.Now()
+	return &strikeRegister{
+		window:     window,
+		maxEntries: maxEntries,
+		horizon:    now.Truncate(time.Second),
+		nonces:     make(map[string]time.Time),
+		nextPurge:  now.Add(window),
+	}
+}
+
+func (r *strikeRegister) Insert(nonce []byte, now time.Time) error {
+	if len(nonce) != clientNonceLen {
+		return errNonceInvalid
+	}
+	timestamp := time.Unix(int64(binary.BigEndian.Uint32(nonce[:4])), 0)
+	if timestamp.Before(now.Add(-r.window)) || timestamp.After(now.Add(r.window)) {
+		return errNonceOutsideWindow
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if timestamp.Before(r.horizon) {
+		return errNonceBeforeHorizon
+	}
+	if _, ok := r.nonces[string(nonce)]; ok {
+		return errNonceReplayed
+	}
+	if !now.Before(r.nextPurge) || len(r.nonces) >= r.maxEntries {
+		r.purge(now)
+	}
+	if len(r.nonces) >= r.maxEntries {
+		r.evictOldest()
+		if timestamp.Before(r.horizon) {
+			return errNonceBeforeHorizon
+		}
+	}
+	r.nonces[string(nonce)] = timestamp.Add(r.window)
+	return nil
+}
+
+type timeSorter []time.Time
+
+func (s timeSorter) Len() int           { return len(s) }
+func (s timeSorter) Less(i, j int) bool { return s[i].Before(s[j]) }
+func (s timeSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// evictOldest deletes the oldest eighth of the nonces, but at least all nonces with the oldest timestamp
+// The horizon is moved past the timestamp of the evicted nonces, so that they can't be replayed.
+func (r *strikeRegister) evictOldest() {
+	expiries := make([]time.Time, 0, len(r.nonces))
+	for _, expiry := range r.nonces {
+		expiries = append(expiries, expiry)
+	}
+	sort.Sort(timeSorter(expiries))
+	cutoff := expiries[len(expiries)/8]
+	for nonce, expiry := range r.nonces {
+		if !expiry.After(cutoff) {
+			delete(r.nonces, nonce)
+		}
+	}
+	// timestamps have a granularity of one second
+	r.horizon = cutoff.Add(-r.window).Add(time.Second)
+}
+
+// purge deletes all nonces that are outside of the window, since they are rejected anyway
+func (r *strikeRegister) purge(now time.Time) {
+	for nonce, expiry := range r.nonces {
+		if expiry.Before(now) {
+			delete(r.nonces, nonce)
+		}
+	}
+	r.nextPurge = now.Add(r.window)
+}
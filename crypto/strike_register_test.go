@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strike register", func() {
+	var (
+		register StrikeRegister
+		now      time.Time
+	)
+
+	getNonce := func(timestamp time.Time, b byte) []byte {
+		nonce := make([]byte, 32)
+		binary.BigEndian.PutUint32(nonce, uint32(timestamp.Unix()))
+		nonce[31] = b
+		return nonce
+	}
+
+	BeforeEach(func() {
+		register = NewStrikeRegister(time.Minute, 3)
+		now = time.Now()
+	})
+
+	It("accepts new nonces", func() {
+		Expect(register.Insert(getNonce(now, 1), now)).To(Succeed())
+		Expect(register.Insert(getNonce(now, 2), now)).To(Succeed())
+	})
+
+	It("rejects replayed nonces", func() {
+		Expect(register.Insert(getNonce(now, 1), now)).To(Succeed())
+		Expect(register.Insert(getNonce(now, 1), now.Add(time.Second))).To(MatchError(errNonceReplayed))
+	})
+
+	It("rejects nonces with an invalid length", func() {
+		Expect(register.Insert(make([]byte, 31), now)).To(MatchError(errNonceInvalid))
+	})
+
+	It("rejects nonces outside of the window", func() {
+		Expect(register.Insert(getNonce(now.Add(2*time.Minute), 1), now)).To(MatchError(errNonceOutsideWindow))
+		Expect(register.Insert(getNonce(now, 1), now.Add(2*time.Minute))).To(MatchError(errNonceOutsideWindow))
+	})
+
+	It("rejects nonces created before the register", func() {
+		Expect(register.Insert(getNonce(now.Add(-10*time.Second), 1), now)).To(MatchError(errNonceBeforeHorizon))
+	})
+
+	Context("when it is full", func() {
+		It("evicts the oldest nonces, and accepts a fresh nonce", func() {
+			Expect(register.Insert(getNonce(now, 1), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now.Add(time.Second), 2), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now.Add(2*time.Second), 3), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now.Add(3*time.Second), 4), now)).To(Succeed())
+			nonces := register.(*strikeRegister).nonces
+			Expect(nonces).To(HaveLen(3))
+			Expect(nonces).ToNot(HaveKey(string(getNonce(now, 1))))
+		})
+
+		It("rejects nonces that are not newer than the evicted ones", func() {
+			Expect(register.Insert(getNonce(now, 1), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now, 2), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now, 3), now)).To(Succeed())
+			Expect(register.Insert(getNonce(now.Add(time.Second), 4), now)).To(Succeed())
+			// nonce 1 was evicted, and can't be replayed
+			Expect(register.Insert(getNonce(now, 1), now)).To(MatchError(errNonceBeforeHorizon))
+			Expect(register.Insert(getNonce(now, 5), now)).To(MatchError(errNonceBeforeHorizon))
+			Expect(register.Insert(getNonce(now.Add(time.Second), 5), now)).To(Succeed())
+		})
+
+		It("keeps accepting fresh nonces at its capacity", func() {
+			register = NewStrikeRegister(time.Minute, 1000)
+			for i := 0; i < 10000; i++ {
+				t := now.Add(time.Duration(i/100) * time.Second)
+				nonce := getNonce(t, byte(i))
+				binary.BigEndian.PutUint32(nonce[4:], uint32(i))
+				Expect(register.Insert(nonce, t)).To(Succeed())
+			}
+			Expect(len(register.(*strikeRegister).nonces)).To(BeNumerically("<=", 1000))
+		})
+	})
+
+	It("deletes nonces that left the window", func() {
+		Expect(register.Insert(getNonce(now, 1), now)).To(Succeed())
+		Expect(register.Insert(getNonce(now, 2), now)).To(Succeed())
+		Expect(register.Insert(getNonce(now, 3), now)).To(Succeed())
+		later := now.Add(90 * time.Second)
+		Expect(register.Insert(getNonce(later, 4), later)).To(Succeed())
+		Expect(register.(*strikeRegister).nonces).To(HaveLen(1))
+	})
+})
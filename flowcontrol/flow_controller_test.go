@@ -48,7 +48,13 @@ func (m *mockConnectionParametersManager) GetMaxIncomingStreams() uint32 { panic
 func (m *mockConnectionParametersManager) GetIdleConnectionStateLifetime() time.Duration {
 	panic("not implemented")
 }
+func (m *mockConnectionParametersManager) GetConnectionOptions() []handshake.Tag {
+	panic("not implemented")
+}
 func (m *mockConnectionParametersManager) TruncateConnectionID() bool { panic("not implemented") }
+func (m *mockConnectionParametersManager) ApplicationErrorCodesNegotiated() bool {
+	panic("not implemented")
+}
 
 var _ handshake.ConnectionParametersManager = &mockConnectionParametersManager{}
 
@@ -102,6 +102,10 @@ func (c *Client) versionNegotiateCallback() error {
 	if c.headerStream.StreamID() != 3 {
 		return errors.New("h2quic Client BUG: StreamID of Header Stream is not 3")
 	}
+	// the header stream is never closed, so it must not prevent the session from being closed after a GOAWAY
+	if sess, ok := c.session.(drainExcluder); ok {
+		sess.ExcludeStreamFromDraining(c.headerStream.StreamID())
+	}
 	c.requestWriter = newRequestWriter(c.headerStream)
 	go c.handleHeaderStream()
 	return nil
@@ -176,7 +180,12 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	hdrChan := make(chan *http.Response)
 	dataStream, err := c.session.OpenStreamSync()
 	if err != nil {
-		c.Close(err)
+		c.mutex.Unlock()
+		// After a GOAWAY, the session closes itself once the running requests are finished.
+		// The header stream is excluded from draining, so it doesn't keep the session open.
+		if _, ok := err.(*quic.GoAwayError); !ok {
+			c.Close(err)
+		}
 		return nil, err
 	}
 	c.responses[dataStream.StreamID()] = hdrChan
@@ -193,6 +202,12 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		c.Close(err)
 		return nil, err
 	}
+	if endStream {
+		// finish the write side of the data stream, such that it can be garbage collected once the response body was read
+		if err := dataStream.Close(); err != nil {
+			return nil, err
+		}
+	}
 
 	resc := make(chan error, 1)
 	if hasBody {
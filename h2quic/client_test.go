@@ -78,6 +78,7 @@ var _ = Describe("Client", func() {
 		client.config.ConnState(session, quic.ConnStateVersionNegotiated)
 		Expect(client.headerStream).ToNot(BeNil())
 		Expect(client.headerStream.StreamID()).To(Equal(protocol.StreamID(3)))
+		Expect(session.drainExemptStreams).To(Equal([]protocol.StreamID{3}))
 	})
 
 	It("errors if it can't open the header stream", func() {
@@ -195,6 +196,24 @@ var _ = Describe("Client", func() {
 			Expect(client.session.(*mockSession).closedWithError).To(MatchError(client.headerErr))
 		})
 
+		It("returns GOAWAY errors without closing the session", func() {
+			session.streamOpenErr = &quic.GoAwayError{ErrorCode: qerr.PeerGoingAway, Remote: true}
+			_, err := client.Do(request)
+			Expect(err).To(Equal(session.streamOpenErr))
+			Expect(session.closed).To(BeFalse())
+			// make sure the mutex was released
+			client.mutex.Lock()
+			client.mutex.Unlock()
+		})
+
+		It("closes the session when opening a stream fails", func() {
+			testErr := errors.New("stream open error")
+			session.streamOpenErr = testErr
+			_, err := client.Do(request)
+			Expect(err).To(MatchError(testErr))
+			Expect(session.closedWithError).To(MatchError(testErr))
+		})
+
 		It("blocks if no stream is available", func() {
 			session.blockOpenStreamSync = true
 			var doReturned bool
@@ -250,6 +269,7 @@ var _ = Describe("Client", func() {
 			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeNil())
 			mhf := getRequest(headerStream.dataWritten.Bytes())
 			Expect(mhf.HeadersFrame.StreamEnded()).To(BeTrue())
+			Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
 		})
 
 		It("sets the EndStream header to false for requests with a body", func() {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"sync"
+	"time"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
@@ -24,12 +25,17 @@ type mockStream struct {
 
 func (s *mockStream) Close() error                          { s.closed = true; return nil }
 func (s *mockStream) Reset(error)                           { s.reset = true }
+func (s *mockStream) ResetWithCode(uint32) error            { panic("not implemented") }
 func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true }
 func (s mockStream) StreamID() protocol.StreamID            { return s.id }
 
 func (s *mockStream) Read(p []byte) (int, error)  { return s.dataToRead.Read(p) }
 func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
 
+func (s *mockStream) SetReadDeadline(time.Time) error  { panic("not implemented") }
+func (s *mockStream) SetWriteDeadline(time.Time) error { panic("not implemented") }
+func (s *mockStream) SetDeadline(time.Time) error      { panic("not implemented") }
+
 var _ = Describe("Response Writer", func() {
 	var (
 		w            *responseWriter
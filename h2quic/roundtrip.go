@@ -9,6 +9,8 @@ import (
 	"sync"
 
 	"golang.org/x/net/lex/httplex"
+
+	quic "github.com/lucas-clemente/quic-go"
 )
 
 type h2quicClient interface {
@@ -80,7 +82,18 @@ func (r *QuicRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	if err != nil {
 		return nil, err
 	}
-	return client.Do(req)
+	rsp, err := client.Do(req)
+	if _, ok := err.(*quic.GoAwayError); ok {
+		// the server sent a GOAWAY before the request was sent, so it's safe to retry it on a new connection
+		// the session of the old client closes itself once its running requests are finished
+		r.removeClient(hostname, client)
+		client, err = r.getClient(hostname)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+	return rsp, err
 }
 
 func (r *QuicRoundTripper) getClient(hostname string) (h2quicClient, error) {
@@ -103,6 +116,16 @@ func (r *QuicRoundTripper) getClient(hostname string) (h2quicClient, error) {
 	return client, nil
 }
 
+// removeClient removes a client, if it is still used for this hostname
+func (r *QuicRoundTripper) removeClient(hostname string, client h2quicClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clients[hostname] == client {
+		delete(r.clients, hostname)
+	}
+}
+
 func (r *QuicRoundTripper) disableCompression() bool {
 	return r.DisableCompression
 }
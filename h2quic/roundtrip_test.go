@@ -66,6 +66,20 @@ var _ = Describe("RoundTripper", func() {
 		Expect(rt.clients).To(HaveLen(1))
 	})
 
+	It("removes clients", func() {
+		client := &mockQuicRoundTripper{}
+		rt.clients = map[string]h2quicClient{"www.example.org:443": client}
+		rt.removeClient("www.example.org:443", client)
+		Expect(rt.clients).To(BeEmpty())
+	})
+
+	It("doesn't remove a client that was already replaced", func() {
+		client := &mockQuicRoundTripper{}
+		rt.clients = map[string]h2quicClient{"www.example.org:443": client}
+		rt.removeClient("www.example.org:443", &mockQuicRoundTripper{})
+		Expect(rt.clients).To(HaveKeyWithValue("www.example.org:443", client))
+	})
+
 	It("disable compression", func() {
 		Expect(rt.disableCompression()).To(BeFalse())
 		rt.DisableCompression = true
@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -28,6 +29,11 @@ type remoteCloser interface {
 	CloseRemote(protocol.ByteCount)
 }
 
+// drainExcluder is implemented by quic-go's sessions
+type drainExcluder interface {
+	ExcludeStreamFromDraining(protocol.StreamID)
+}
+
 // Server is a HTTP2 server listening for QUIC connections.
 type Server struct {
 	*http.Server
@@ -80,13 +86,8 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn *net.UDPConn) error {
 		return errors.New("ListenAndServe may only be called once")
 	}
 	config := quic.Config{
-		TLSConfig: tlsConfig,
-		ConnState: func(session quic.Session, connState quic.ConnState) {
-			sess := session.(streamCreator)
-			if connState == quic.ConnStateVersionNegotiated {
-				s.handleHeaderStream(sess)
-			}
-		},
+		TLSConfig:       tlsConfig,
+		AcceptConnState: quic.ConnStateVersionNegotiated,
 	}
 	var ln quic.Listener
 	var err error
@@ -101,7 +102,14 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn *net.UDPConn) error {
 	}
 	s.listener = ln
 	s.listenerMutex.Unlock()
-	return ln.Serve()
+
+	for {
+		sess, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleHeaderStream(sess.(streamCreator))
+	}
 }
 
 func (s *Server) handleHeaderStream(session streamCreator) {
@@ -114,6 +122,10 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 		session.Close(qerr.Error(qerr.InternalError, "h2quic server BUG: header stream does not have stream ID 3"))
 		return
 	}
+	// the header stream is never closed, so it must not prevent the session from being closed after a GOAWAY
+	if sess, ok := session.(drainExcluder); ok {
+		sess.ExcludeStreamFromDraining(stream.StreamID())
+	}
 
 	hpackDecoder := hpack.NewDecoder(4096, nil)
 	h2framer := http2.NewFramer(nil, stream)
@@ -242,8 +254,16 @@ func (s *Server) Close() error {
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
-	return nil
+	s.listenerMutex.Lock()
+	ln := s.listener
+	s.listener = nil
+	s.listenerMutex.Unlock()
+	if ln == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return ln.Drain(ctx)
 }
 
 // SetQuicHeaders can be used to set the proper headers that announce that this server supports QUIC.
@@ -2,7 +2,10 @@ package h2quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -31,6 +34,7 @@ type mockSession struct {
 	streamToOpen        quic.Stream
 	blockOpenStreamSync bool
 	streamOpenErr       error
+	drainExemptStreams  []protocol.StreamID
 }
 
 func (s *mockSession) GetOrOpenStream(id protocol.StreamID) (quic.Stream, error) {
@@ -51,11 +55,32 @@ func (s *mockSession) OpenStreamSync() (quic.Stream, error) {
 	}
 	return s.OpenStream()
 }
+func (s *mockSession) AcceptStreamContext(context.Context) (quic.Stream, error) {
+	return s.AcceptStream()
+}
+func (s *mockSession) OpenStreamSyncContext(context.Context) (quic.Stream, error) {
+	return s.OpenStreamSync()
+}
 func (s *mockSession) Close(e error) error {
 	s.closed = true
 	s.closedWithError = e
 	return nil
 }
+func (s *mockSession) ConnectionState() quic.ConnectionState {
+	panic("not implemented")
+}
+func (s *mockSession) Stats() quic.SessionStats {
+	panic("not implemented")
+}
+func (s *mockSession) CloseWithError(code uint32, msg string) error {
+	panic("not implemented")
+}
+func (s *mockSession) GoAway(code qerr.ErrorCode, reason string) error {
+	panic("not implemented")
+}
+func (s *mockSession) ExcludeStreamFromDraining(id protocol.StreamID) {
+	s.drainExemptStreams = append(s.drainExemptStreams, id)
+}
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
@@ -253,6 +278,7 @@ var _ = Describe("H2 server", func() {
 		session.streamToAccept = headerStream
 		go s.handleHeaderStream(session)
 		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
+		Expect(session.drainExemptStreams).To(Equal([]protocol.StreamID{3}))
 	})
 
 	It("closes the connection if it encounters an error on the header stream", func() {
@@ -434,6 +460,43 @@ var _ = Describe("H2 server", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("waits for running requests when closing gracefully", func() {
+		requestStarted := make(chan struct{})
+		finishRequest := make(chan struct{})
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			<-finishRequest
+			w.Write([]byte("foobar"))
+		})
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		go s.Serve(udpConn)
+
+		rt := &QuicRoundTripper{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		req, err := http.NewRequest("GET", "https://"+udpConn.LocalAddr().String()+"/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rspChan := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rspChan <- rsp
+		}()
+		Eventually(requestStarted, 5*time.Second).Should(BeClosed())
+
+		closed := make(chan error, 1)
+		go func() { closed <- s.CloseGracefully(time.Minute) }()
+		Consistently(closed).ShouldNot(Receive())
+		close(finishRequest)
+		var rsp *http.Response
+		Eventually(rspChan).Should(Receive(&rsp))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("foobar")))
+		// the session closes itself after the request, long before the timeout
+		Eventually(closed, 5*time.Second).Should(Receive(BeNil()))
+	})
+
 	It("at least errors in global ListenAndServeQUIC", func() {
 		// It's quite hard to test this, since we cannot properly shutdown the server
 		// once it's started. So, we open a socket on the same port before the test,
@@ -0,0 +1,47 @@
+package handshake
+
+import (
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/crypto"
+	"github.com/lucas-clemente/quic-go/protocol"
+)
+
+// SupportedAEADs are the AEADs supported by quic-go
+var SupportedAEADs = []Tag{TagAESG, TagCC20}
+
+var errUnsupportedAEAD = errors.New("unsupported AEAD")
+
+// preferredAEADs returns the supported AEADs in the order of preference of this host
+// AES-GCM is only fast on CPUs with AES hardware support, otherwise ChaCha20-Poly1305 is preferred.
+func preferredAEADs() []Tag {
+	if crypto.HasAESHardwareSupport() {
+		return []Tag{TagAESG, TagCC20}
+	}
+	return []Tag{TagCC20, TagAESG}
+}
+
+// checkAEADs makes sure that all AEADs are supported, and returns the preferred AEADs if none are given
+func checkAEADs(aeads []Tag) ([]Tag, error) {
+	if len(aeads) == 0 {
+		return preferredAEADs(), nil
+	}
+	for _, aead := range aeads {
+		if !containsTag(SupportedAEADs, aead) {
+			return nil, errUnsupportedAEAD
+		}
+	}
+	return aeads, nil
+}
+
+// deriveKeys derives the keys for an AEAD and creates the AEAD instance
+func deriveKeys(aead Tag, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+	switch aead {
+	case TagAESG:
+		return crypto.DeriveKeysAESGCM(forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+	case TagCC20:
+		return crypto.DeriveKeysChacha20(forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+	default:
+		return nil, errUnsupportedAEAD
+	}
+}
@@ -0,0 +1,28 @@
+package handshake
+
+// ClientSessionState contains the state needed by a client to resume a session
+type ClientSessionState struct {
+	// ServerConfig is the raw SCFG message sent by the server
+	ServerConfig []byte
+	// SourceAddressToken is the STK sent by the server
+	SourceAddressToken []byte
+	// ServerNonce is the SNO sent by the server
+	ServerNonce []byte
+	// Certificates is the certificate chain sent by the server, in ASN.1 DER
+	Certificates [][]byte
+	// SCTs are the signed certificate timestamps sent by the server
+	SCTs [][]byte
+	// ServerProof is the signature of the server config
+	ServerProof []byte
+	// CHLO is the client hello that the server proof was computed over
+	CHLO []byte
+}
+
+// A ClientSessionCache caches ClientSessionState objects keyed by hostname
+// It must be safe for concurrent use by multiple goroutines.
+type ClientSessionCache interface {
+	// Get searches for a ClientSessionState associated with the given hostname
+	Get(hostname string) (*ClientSessionState, bool)
+	// Put adds the ClientSessionState to the cache with the given hostname
+	Put(hostname string, state *ClientSessionState)
+}
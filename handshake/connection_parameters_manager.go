@@ -31,7 +31,9 @@ type ConnectionParametersManager interface {
 	GetMaxOutgoingStreams() uint32
 	GetMaxIncomingStreams() uint32
 	GetIdleConnectionStateLifetime() time.Duration
+	GetConnectionOptions() []Tag
 	TruncateConnectionID() bool
+	ApplicationErrorCodesNegotiated() bool
 }
 
 type connectionParametersManager struct {
@@ -42,6 +44,8 @@ type connectionParametersManager struct {
 
 	flowControlNegotiated bool
 
+	idleTimeout time.Duration
+
 	truncateConnectionID                   bool
 	maxStreamsPerConnection                uint32
 	maxIncomingDynamicStreamsPerConnection uint32
@@ -50,6 +54,14 @@ type connectionParametersManager struct {
 	sendConnectionFlowControlWindow        protocol.ByteCount
 	receiveStreamFlowControlWindow         protocol.ByteCount
 	receiveConnectionFlowControlWindow     protocol.ByteCount
+	maxReceiveStreamFlowControlWindow      protocol.ByteCount
+	maxReceiveConnectionFlowControlWindow  protocol.ByteCount
+
+	// the connection options sent by the client
+	connectionOptions []Tag
+
+	// applicationErrorCodes is set if both endpoints sent the APEC tag
+	applicationErrorCodes bool
 }
 
 var _ ConnectionParametersManager = &connectionParametersManager{}
@@ -61,22 +73,37 @@ var (
 )
 
 // NewConnectionParamatersManager creates a new connection parameters manager
-func NewConnectionParamatersManager(pers protocol.Perspective, v protocol.VersionNumber) ConnectionParametersManager {
+// The receive flow control windows are advertised to the peer, and can be increased up to the maximum values by the auto-tuning.
+// The idleTimeout is the maximum idle timeout that will be negotiated with the peer.
+// The connectionOptions are sent to the server. They are ignored for the server.
+func NewConnectionParamatersManager(
+	pers protocol.Perspective, v protocol.VersionNumber,
+	receiveStreamFlowControlWindow protocol.ByteCount, maxReceiveStreamFlowControlWindow protocol.ByteCount,
+	receiveConnectionFlowControlWindow protocol.ByteCount, maxReceiveConnectionFlowControlWindow protocol.ByteCount,
+	idleTimeout time.Duration,
+	connectionOptions []Tag,
+) ConnectionParametersManager {
 	h := &connectionParametersManager{
-		perspective:                        pers,
-		version:                            v,
-		sendStreamFlowControlWindow:        protocol.InitialStreamFlowControlWindow,     // can only be changed by the client
-		sendConnectionFlowControlWindow:    protocol.InitialConnectionFlowControlWindow, // can only be changed by the client
-		receiveStreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		receiveConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		perspective:                           pers,
+		version:                               v,
+		idleTimeout:                           idleTimeout,
+		idleConnectionStateLifetime:           idleTimeout,
+		sendStreamFlowControlWindow:           protocol.InitialStreamFlowControlWindow,     // can only be changed by the client
+		sendConnectionFlowControlWindow:       protocol.InitialConnectionFlowControlWindow, // can only be changed by the client
+		receiveStreamFlowControlWindow:        receiveStreamFlowControlWindow,
+		receiveConnectionFlowControlWindow:    receiveConnectionFlowControlWindow,
+		maxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
+		maxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+	}
+
+	if h.perspective == protocol.PerspectiveClient {
+		h.connectionOptions = connectionOptions
 	}
 
 	if h.perspective == protocol.PerspectiveServer {
-		h.idleConnectionStateLifetime = protocol.DefaultIdleTimeout
 		h.maxStreamsPerConnection = protocol.MaxStreamsPerConnection                // this is the value negotiated based on what the client sent
 		h.maxIncomingDynamicStreamsPerConnection = protocol.MaxStreamsPerConnection // "incoming" seen from the client's perspective
 	} else {
-		h.idleConnectionStateLifetime = protocol.MaxIdleTimeoutClient
 		h.maxStreamsPerConnection = protocol.MaxStreamsPerConnection                // this is the value negotiated based on what the client sent
 		h.maxIncomingDynamicStreamsPerConnection = protocol.MaxStreamsPerConnection // "incoming" seen from the server's perspective
 	}
@@ -96,6 +123,16 @@ func (h *connectionParametersManager) SetFromMap(params map[Tag][]byte) error {
 		}
 		h.truncateConnectionID = (clientValue == 0)
 	}
+	if value, ok := params[TagCOPT]; ok && h.perspective == protocol.PerspectiveServer {
+		connectionOptions, ok := parseTagList(value)
+		if !ok {
+			return ErrMalformedTag
+		}
+		h.connectionOptions = connectionOptions
+	}
+	if _, ok := params[TagAPEC]; ok {
+		h.applicationErrorCodes = true
+	}
 	if value, ok := params[TagMSPC]; ok {
 		clientValue, err := utils.ReadUint32(bytes.NewBuffer(value))
 		if err != nil {
@@ -156,10 +193,7 @@ func (h *connectionParametersManager) negotiateMaxIncomingDynamicStreamsPerConne
 }
 
 func (h *connectionParametersManager) negotiateIdleConnectionStateLifetime(clientValue time.Duration) time.Duration {
-	if h.perspective == protocol.PerspectiveServer {
-		return utils.MinDuration(clientValue, protocol.MaxIdleTimeoutServer)
-	}
-	return utils.MinDuration(clientValue, protocol.MaxIdleTimeoutClient)
+	return utils.MinDuration(clientValue, h.idleTimeout)
 }
 
 // GetHelloMap gets all parameters needed for the Hello message
@@ -175,13 +209,21 @@ func (h *connectionParametersManager) GetHelloMap() (map[Tag][]byte, error) {
 	icsl := bytes.NewBuffer([]byte{})
 	utils.WriteUint32(icsl, uint32(h.GetIdleConnectionStateLifetime()/time.Second))
 
-	return map[Tag][]byte{
+	tags := map[Tag][]byte{
 		TagICSL: icsl.Bytes(),
 		TagMSPC: mspc.Bytes(),
 		TagMIDS: mids.Bytes(),
 		TagCFCW: cfcw.Bytes(),
 		TagSFCW: sfcw.Bytes(),
-	}, nil
+	}
+	if h.perspective == protocol.PerspectiveClient && len(h.connectionOptions) > 0 {
+		tags[TagCOPT] = writeTagList(h.connectionOptions)
+	}
+	// the client offers application error codes, the server only confirms them if the client offered them
+	if h.perspective == protocol.PerspectiveClient || h.ApplicationErrorCodesNegotiated() {
+		tags[TagAPEC] = []byte{}
+	}
+	return tags, nil
 }
 
 // GetSendStreamFlowControlWindow gets the size of the stream-level flow control window for sending data
@@ -207,10 +249,7 @@ func (h *connectionParametersManager) GetReceiveStreamFlowControlWindow() protoc
 
 // GetMaxReceiveStreamFlowControlWindow gets the maximum size of the stream-level flow control window for sending data
 func (h *connectionParametersManager) GetMaxReceiveStreamFlowControlWindow() protocol.ByteCount {
-	if h.perspective == protocol.PerspectiveServer {
-		return protocol.MaxReceiveStreamFlowControlWindowServer
-	}
-	return protocol.MaxReceiveStreamFlowControlWindowClient
+	return h.maxReceiveStreamFlowControlWindow
 }
 
 // GetReceiveConnectionFlowControlWindow gets the size of the stream-level flow control window for receiving data
@@ -222,10 +261,7 @@ func (h *connectionParametersManager) GetReceiveConnectionFlowControlWindow() pr
 
 // GetMaxReceiveConnectionFlowControlWindow gets the maximum size of the stream-level flow control window for sending data
 func (h *connectionParametersManager) GetMaxReceiveConnectionFlowControlWindow() protocol.ByteCount {
-	if h.perspective == protocol.PerspectiveServer {
-		return protocol.MaxReceiveConnectionFlowControlWindowServer
-	}
-	return protocol.MaxReceiveConnectionFlowControlWindowClient
+	return h.maxReceiveConnectionFlowControlWindow
 }
 
 // GetMaxOutgoingStreams gets the maximum number of outgoing streams per connection
@@ -252,6 +288,20 @@ func (h *connectionParametersManager) GetIdleConnectionStateLifetime() time.Dura
 	return h.idleConnectionStateLifetime
 }
 
+// GetConnectionOptions gets the connection options sent by the client
+func (h *connectionParametersManager) GetConnectionOptions() []Tag {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.connectionOptions
+}
+
+// ApplicationErrorCodesNegotiated says if the peer supports application error codes in CONNECTION_CLOSE and RST_STREAM frames
+func (h *connectionParametersManager) ApplicationErrorCodesNegotiated() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.applicationErrorCodes
+}
+
 // TruncateConnectionID determines if the client requests truncated ConnectionIDs
 func (h *connectionParametersManager) TruncateConnectionID() bool {
 	if h.perspective == protocol.PerspectiveClient {
@@ -14,8 +14,26 @@ var _ = Describe("ConnectionsParameterManager", func() {
 	var cpmClient *connectionParametersManager
 
 	BeforeEach(func() {
-		cpm = NewConnectionParamatersManager(protocol.PerspectiveServer, protocol.Version36).(*connectionParametersManager)
-		cpmClient = NewConnectionParamatersManager(protocol.PerspectiveClient, protocol.Version36).(*connectionParametersManager)
+		cpm = NewConnectionParamatersManager(
+			protocol.PerspectiveServer,
+			protocol.Version36,
+			protocol.ReceiveStreamFlowControlWindow,
+			protocol.MaxReceiveStreamFlowControlWindowServer,
+			protocol.ReceiveConnectionFlowControlWindow,
+			protocol.MaxReceiveConnectionFlowControlWindowServer,
+			protocol.DefaultIdleTimeout,
+			nil,
+		).(*connectionParametersManager)
+		cpmClient = NewConnectionParamatersManager(
+			protocol.PerspectiveClient,
+			protocol.Version36,
+			protocol.ReceiveStreamFlowControlWindow,
+			protocol.MaxReceiveStreamFlowControlWindowClient,
+			protocol.ReceiveConnectionFlowControlWindow,
+			protocol.MaxReceiveConnectionFlowControlWindowClient,
+			2*time.Minute,
+			nil,
+		).(*connectionParametersManager)
 	})
 
 	Context("SHLO", func() {
@@ -85,7 +103,7 @@ var _ = Describe("ConnectionsParameterManager", func() {
 			entryMap, err := cpmClient.GetHelloMap()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(entryMap).To(HaveKey(TagICSL))
-			Expect(binary.LittleEndian.Uint32(entryMap[TagICSL])).To(BeEquivalentTo(protocol.MaxIdleTimeoutClient / time.Second))
+			Expect(binary.LittleEndian.Uint32(entryMap[TagICSL])).To(BeEquivalentTo(2 * time.Minute / time.Second))
 			Expect(entryMap).To(HaveKey(TagMSPC))
 			Expect(binary.LittleEndian.Uint32(entryMap[TagMSPC])).To(BeEquivalentTo(protocol.MaxStreamsPerConnection))
 			Expect(entryMap).To(HaveKey(TagMIDS))
@@ -97,6 +115,80 @@ var _ = Describe("ConnectionsParameterManager", func() {
 		})
 	})
 
+	Context("connection options", func() {
+		It("doesn't send COPT if there are no connection options", func() {
+			entryMap, err := cpmClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).ToNot(HaveKey(TagCOPT))
+			Expect(cpm.GetConnectionOptions()).To(BeEmpty())
+		})
+
+		It("sends the connection options in the CHLO", func() {
+			cpmClient = NewConnectionParamatersManager(protocol.PerspectiveClient, protocol.Version36, 0x1000, 0x2000, 0x3000, 0x4000, protocol.DefaultIdleTimeout, []Tag{TagTBBR, TagIW20}).(*connectionParametersManager)
+			entryMap, err := cpmClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).To(HaveKeyWithValue(TagCOPT, []byte("TBBRIW20")))
+			Expect(cpmClient.GetConnectionOptions()).To(Equal([]Tag{TagTBBR, TagIW20}))
+		})
+
+		It("doesn't send COPT in the SHLO", func() {
+			cpm = NewConnectionParamatersManager(protocol.PerspectiveServer, protocol.Version36, 0x1000, 0x2000, 0x3000, 0x4000, protocol.DefaultIdleTimeout, []Tag{TagTBBR}).(*connectionParametersManager)
+			entryMap, err := cpm.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).ToNot(HaveKey(TagCOPT))
+			Expect(cpm.GetConnectionOptions()).To(BeEmpty())
+		})
+
+		It("reads the connection options sent by the client", func() {
+			err := cpm.SetFromMap(map[Tag][]byte{TagCOPT: []byte("RENOIW03")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpm.GetConnectionOptions()).To(Equal([]Tag{TagRENO, TagIW03}))
+		})
+
+		It("ignores the COPT tag, as a client", func() {
+			err := cpmClient.SetFromMap(map[Tag][]byte{TagCOPT: []byte("TBBR")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpmClient.GetConnectionOptions()).To(BeEmpty())
+		})
+
+		It("errors when given an invalid value", func() {
+			err := cpm.SetFromMap(map[Tag][]byte{TagCOPT: []byte("TBB")})
+			Expect(err).To(MatchError(ErrMalformedTag))
+		})
+	})
+
+	Context("application error codes", func() {
+		It("offers application error codes in the CHLO", func() {
+			entryMap, err := cpmClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).To(HaveKey(TagAPEC))
+			Expect(cpmClient.ApplicationErrorCodesNegotiated()).To(BeFalse())
+		})
+
+		It("doesn't use application error codes if the client didn't offer them", func() {
+			err := cpm.SetFromMap(map[Tag][]byte{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpm.ApplicationErrorCodesNegotiated()).To(BeFalse())
+			entryMap, err := cpm.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryMap).ToNot(HaveKey(TagAPEC))
+		})
+
+		It("confirms application error codes in the SHLO, if the client offered them", func() {
+			chlo, err := cpmClient.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			err = cpm.SetFromMap(chlo)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpm.ApplicationErrorCodesNegotiated()).To(BeTrue())
+			shlo, err := cpm.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(shlo).To(HaveKey(TagAPEC))
+			err = cpmClient.SetFromMap(shlo)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpmClient.ApplicationErrorCodesNegotiated()).To(BeTrue())
+		})
+	})
+
 	Context("Truncated connection IDs", func() {
 		It("does not send truncated connection IDs if the TCID tag is missing", func() {
 			Expect(cpm.TruncateConnectionID()).To(BeFalse())
@@ -136,6 +228,18 @@ var _ = Describe("ConnectionsParameterManager", func() {
 			Expect(cpmClient.GetReceiveConnectionFlowControlWindow()).To(Equal(protocol.ReceiveConnectionFlowControlWindow))
 		})
 
+		It("uses the receive flow control windows it was created with", func() {
+			cpm = NewConnectionParamatersManager(protocol.PerspectiveServer, protocol.Version36, 0x1000, 0x2000, 0x3000, 0x4000, protocol.DefaultIdleTimeout, nil).(*connectionParametersManager)
+			Expect(cpm.GetReceiveStreamFlowControlWindow()).To(Equal(protocol.ByteCount(0x1000)))
+			Expect(cpm.GetMaxReceiveStreamFlowControlWindow()).To(Equal(protocol.ByteCount(0x2000)))
+			Expect(cpm.GetReceiveConnectionFlowControlWindow()).To(Equal(protocol.ByteCount(0x3000)))
+			Expect(cpm.GetMaxReceiveConnectionFlowControlWindow()).To(Equal(protocol.ByteCount(0x4000)))
+			entryMap, err := cpm.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(binary.LittleEndian.Uint32(entryMap[TagSFCW])).To(BeEquivalentTo(0x1000))
+			Expect(binary.LittleEndian.Uint32(entryMap[TagCFCW])).To(BeEquivalentTo(0x3000))
+		})
+
 		It("has the correct maximum flow control windows", func() {
 			Expect(cpm.GetMaxReceiveStreamFlowControlWindow()).To(Equal(protocol.MaxReceiveStreamFlowControlWindowServer))
 			Expect(cpm.GetMaxReceiveConnectionFlowControlWindow()).To(Equal(protocol.MaxReceiveConnectionFlowControlWindowServer))
@@ -194,18 +298,22 @@ var _ = Describe("ConnectionsParameterManager", func() {
 			Expect(cpm.GetIdleConnectionStateLifetime()).To(Equal(protocol.DefaultIdleTimeout))
 		})
 
+		It("uses the configured idle timeout as the initial lifetime", func() {
+			Expect(cpmClient.GetIdleConnectionStateLifetime()).To(Equal(2 * time.Minute))
+		})
+
 		It("negotiates correctly when the peer wants a longer lifetime", func() {
-			Expect(cpm.negotiateIdleConnectionStateLifetime(protocol.MaxIdleTimeoutServer + 10*time.Second)).To(Equal(protocol.MaxIdleTimeoutServer))
-			Expect(cpmClient.negotiateIdleConnectionStateLifetime(protocol.MaxIdleTimeoutClient + 10*time.Second)).To(Equal(protocol.MaxIdleTimeoutClient))
+			Expect(cpm.negotiateIdleConnectionStateLifetime(protocol.DefaultIdleTimeout + 10*time.Second)).To(Equal(protocol.DefaultIdleTimeout))
+			Expect(cpmClient.negotiateIdleConnectionStateLifetime(2*time.Minute + 10*time.Second)).To(Equal(2 * time.Minute))
 		})
 
 		It("negotiates correctly when the peer wants a shorter lifetime", func() {
-			Expect(cpm.negotiateIdleConnectionStateLifetime(protocol.MaxIdleTimeoutServer - 1*time.Second)).To(Equal(protocol.MaxIdleTimeoutServer - 1*time.Second))
-			Expect(cpmClient.negotiateIdleConnectionStateLifetime(protocol.MaxIdleTimeoutClient - 1*time.Second)).To(Equal(protocol.MaxIdleTimeoutClient - 1*time.Second))
+			Expect(cpm.negotiateIdleConnectionStateLifetime(protocol.DefaultIdleTimeout - 1*time.Second)).To(Equal(protocol.DefaultIdleTimeout - 1*time.Second))
+			Expect(cpmClient.negotiateIdleConnectionStateLifetime(2*time.Minute - 1*time.Second)).To(Equal(2*time.Minute - 1*time.Second))
 		})
 
 		It("sets the negotiated lifetime", func() {
-			// this test only works if the value given here is smaller than protocol.MaxIdleConnectionStateLifetime
+			// this test only works if the value given here is smaller than protocol.DefaultIdleTimeout
 			values := map[Tag][]byte{
 				TagICSL: {10, 0, 0, 0},
 			}
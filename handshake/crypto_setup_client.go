@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -37,18 +38,37 @@ type cryptoSetupClient struct {
 	chloForSignature     []byte
 	lastSentCHLO         []byte
 	certManager          crypto.CertManager
+	scts                 [][]byte // the signed certificate timestamps sent with the certificate chain
 
+	verifyPeerCertificate VerifyPeerCertificateFunc
+	sctPolicy             SCTPolicy
+
+	keyExchanges       []Tag // the key exchange algorithms, in order of preference
+	aeads              []Tag // the AEADs that may be used
 	clientHelloCounter int
+	sentClientNonce    bool // was the client nonce sent in the last CHLO
 	serverVerified     bool // has the certificate chain and the proof already been verified
 	keyDerivation      KeyDerivationFunction
 	keyExchange        KeyExchangeFunction
 
 	receivedSecurePacket bool
 	secureAEAD           crypto.AEAD
-	forwardSecureAEAD    crypto.AEAD
-	aeadChanged          chan protocol.EncryptionLevel
+	// is the secureAEAD derived for the last full CHLO sent, i.e. the server didn't reject it
+	secureAEADForLastCHLO bool
+	// is the secureAEAD derived using the diversification nonce, i.e. can it open packets sent by the server
+	secureAEADCanOpen bool
+	forwardSecureAEAD crypto.AEAD
+	aeadChanged       chan protocol.EncryptionLevel
+
+	// negotiated parameters, exposed by ConnectionState
+	aead             string
+	kexs             string
+	peerCertificates []*x509.Certificate
+	peerSCTs         [][]byte
+	zeroRTT          bool
 
 	connectionParameters ConnectionParametersManager
+	sessionCache         ClientSessionCache
 }
 
 var _ CryptoSetup = &cryptoSetupClient{}
@@ -69,19 +89,123 @@ func NewCryptoSetupClient(
 	connectionParameters ConnectionParametersManager,
 	aeadChanged chan protocol.EncryptionLevel,
 	negotiatedVersions []protocol.VersionNumber,
+	sessionCache ClientSessionCache,
+	keyExchanges []Tag,
+	aeads []Tag,
+	verifyPeerCertificate VerifyPeerCertificateFunc,
+	sctPolicy SCTPolicy,
 ) (CryptoSetup, error) {
-	return &cryptoSetupClient{
-		hostname:             hostname,
-		connID:               connID,
-		version:              version,
-		cryptoStream:         cryptoStream,
-		certManager:          crypto.NewCertManager(tlsConfig),
-		connectionParameters: connectionParameters,
-		keyDerivation:        crypto.DeriveKeysAESGCM,
-		keyExchange:          getEphermalKEX,
-		aeadChanged:          aeadChanged,
-		negotiatedVersions:   negotiatedVersions,
-	}, nil
+	if len(keyExchanges) == 0 {
+		keyExchanges = SupportedKeyExchanges
+	}
+	if len(aeads) == 0 {
+		aeads = SupportedAEADs
+	}
+	cs := &cryptoSetupClient{
+		hostname:              hostname,
+		connID:                connID,
+		version:               version,
+		cryptoStream:          cryptoStream,
+		certManager:           crypto.NewCertManager(tlsConfig),
+		connectionParameters:  connectionParameters,
+		keyDerivation:         deriveKeys,
+		keyExchange:           getEphermalKEX,
+		aeadChanged:           aeadChanged,
+		negotiatedVersions:    negotiatedVersions,
+		sessionCache:          sessionCache,
+		keyExchanges:          keyExchanges,
+		aeads:                 aeads,
+		verifyPeerCertificate: verifyPeerCertificate,
+		sctPolicy:             sctPolicy,
+	}
+	if sessionCache != nil {
+		if state, ok := sessionCache.Get(hostname); ok {
+			cs.restoreSession(state)
+		}
+	}
+	return cs, nil
+}
+
+// restoreSession uses a cached session state, such that the first CHLO sent can be a full CHLO
+// If the cached state can't be used, the handshake starts from scratch.
+func (h *cryptoSetupClient) restoreSession(state *ClientSessionState) {
+	err := h.restoreSessionImpl(state)
+	if err != nil {
+		utils.Infof("Not using cached session state for %s: %s", h.hostname, err.Error())
+		h.dropServerConfig()
+		h.stk = nil
+		h.sno = nil
+		h.certManager.SetCachedChain(nil)
+	}
+}
+
+// dropServerConfig discards the server config and all values derived from it
+func (h *cryptoSetupClient) dropServerConfig() {
+	h.serverConfig = nil
+	h.nonc = nil
+	h.proof = nil
+	h.chloForSignature = nil
+	h.serverVerified = false
+}
+
+func (h *cryptoSetupClient) restoreSessionImpl(state *ClientSessionState) error {
+	serverConfig, err := parseServerConfig(state.ServerConfig)
+	if err != nil {
+		return err
+	}
+	if serverConfig.IsExpired() {
+		return qerr.CryptoServerConfigExpired
+	}
+	if err = serverConfig.setupKeyExchange(h.keyExchanges); err != nil {
+		return err
+	}
+	if err = serverConfig.setupAEAD(h.aeads); err != nil {
+		return err
+	}
+	h.serverConfig = serverConfig
+	h.stk = state.SourceAddressToken
+	h.sno = state.ServerNonce
+
+	err = h.certManager.SetCachedChain(state.Certificates)
+	if err != nil {
+		return err
+	}
+	h.scts = state.SCTs
+	err = h.certManager.Verify(h.hostname)
+	if err != nil {
+		return err
+	}
+	if !h.certManager.VerifyServerProof(state.ServerProof, state.CHLO, h.serverConfig.Get()) {
+		return errors.New("invalid server proof")
+	}
+	if err = h.checkPeerCertificate(); err != nil {
+		return err
+	}
+	h.proof = state.ServerProof
+	h.chloForSignature = state.CHLO
+	h.serverVerified = true
+	return h.generateClientNonce()
+}
+
+// cacheSession stores the session state in the session cache, if one is used
+func (h *cryptoSetupClient) cacheSession() {
+	if h.sessionCache == nil {
+		return
+	}
+	chain := h.certManager.GetChain()
+	certs := make([][]byte, len(chain))
+	for i, cert := range chain {
+		certs[i] = cert.Raw
+	}
+	h.sessionCache.Put(h.hostname, &ClientSessionState{
+		ServerConfig:       h.serverConfig.Get(),
+		SourceAddressToken: h.stk,
+		ServerNonce:        h.sno,
+		Certificates:       certs,
+		SCTs:               h.scts,
+		ServerProof:        h.proof,
+		CHLO:               h.chloForSignature,
+	})
 }
 
 func (h *cryptoSetupClient) HandleCryptoStream() error {
@@ -100,6 +224,11 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 			if err != nil {
 				return err
 			}
+			// after sending a full CHLO, data can be sent in 0-RTT
+			err = h.maybeUpgradeCrypto()
+			if err != nil {
+				return err
+			}
 		}
 
 		var shloData bytes.Buffer
@@ -135,6 +264,17 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 
 	var err error
 
+	// the server rejected a full CHLO, e.g. because its strike register detected a replay
+	// the next CHLO has to use a new client nonce
+	// Data sent in 0-RTT can't be decrypted by the server. The secureAEAD is replaced after sending the next full CHLO, and lost packets are retransmitted using the new keys.
+	if h.sentClientNonce {
+		h.nonc = nil
+		h.sentClientNonce = false
+		h.mutex.Lock()
+		h.secureAEADForLastCHLO = false
+		h.mutex.Unlock()
+	}
+
 	if stk, ok := cryptoData[TagSTK]; ok {
 		h.stk = stk
 	}
@@ -145,6 +285,11 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 
 	// TODO: what happens if the server sends a different server config in two packets?
 	if scfg, ok := cryptoData[TagSCFG]; ok {
+		// the cached server config was rejected, so the client nonce has to be generated using the new OBIT
+		if h.serverConfig != nil && !bytes.Equal(h.serverConfig.Get(), scfg) {
+			h.nonc = nil
+			h.serverVerified = false
+		}
 		h.serverConfig, err = parseServerConfig(scfg)
 		if err != nil {
 			return err
@@ -154,6 +299,13 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 			return qerr.CryptoServerConfigExpired
 		}
 
+		if err = h.serverConfig.setupKeyExchange(h.keyExchanges); err != nil {
+			return err
+		}
+		if err = h.serverConfig.setupAEAD(h.aeads); err != nil {
+			return err
+		}
+
 		// now that we have a server config, we can use its OBIT value to generate a client nonce
 		if len(h.nonc) == 0 {
 			err = h.generateClientNonce()
@@ -174,6 +326,14 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 			return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 		}
 
+		h.scts = nil
+		if csct, ok := cryptoData[TagCSCT]; ok {
+			h.scts, err = parseSCTList(csct)
+			if err != nil {
+				return qerr.Error(qerr.InvalidCryptoMessageParameter, "CSCT")
+			}
+		}
+
 		err = h.certManager.Verify(h.hostname)
 		if err != nil {
 			utils.Infof("Certificate validation failed: %s", err.Error())
@@ -187,6 +347,9 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 			utils.Infof("Server proof verification failed")
 			return qerr.ProofInvalid
 		}
+		if err := h.checkPeerCertificate(); err != nil {
+			return err
+		}
 
 		h.serverVerified = true
 	}
@@ -194,6 +357,44 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 	return nil
 }
 
+// checkPeerCertificate calls the VerifyPeerCertificateFunc and the SCTPolicy, if they are set
+// It must only be called after the certificate chain and the server proof were verified.
+func (h *cryptoSetupClient) checkPeerCertificate() error {
+	if h.verifyPeerCertificate != nil {
+		chain := h.certManager.GetChain()
+		rawCerts := make([][]byte, len(chain))
+		for i, cert := range chain {
+			rawCerts[i] = cert.Raw
+		}
+		if err := h.verifyPeerCertificate(rawCerts, h.certManager.GetVerifiedChains()); err != nil {
+			utils.Infof("Certificate rejected by VerifyPeerCertificate: %s", err.Error())
+			return toProofInvalidError(err)
+		}
+	}
+	if h.sctPolicy != nil {
+		var leaf, issuer *x509.Certificate
+		if chain := h.certManager.GetChain(); len(chain) > 0 {
+			leaf = chain[0]
+			if len(chain) > 1 {
+				issuer = chain[1]
+			}
+		}
+		if err := h.sctPolicy(h.scts, leaf, issuer); err != nil {
+			utils.Infof("Signed certificate timestamps rejected by SCTPolicy: %s", err.Error())
+			return toProofInvalidError(err)
+		}
+	}
+	return nil
+}
+
+// toProofInvalidError converts an error returned by a user callback to a QuicError
+func toProofInvalidError(err error) *qerr.QuicError {
+	if quicErr, ok := err.(*qerr.QuicError); ok {
+		return quicErr
+	}
+	return qerr.Error(qerr.ProofInvalid, err.Error())
+}
+
 func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -229,6 +430,7 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) error {
 	leafCert := h.certManager.GetLeafCert()
 
 	h.forwardSecureAEAD, err = h.keyDerivation(
+		h.serverConfig.aead,
 		true,
 		ephermalSharedSecret,
 		nonce,
@@ -247,6 +449,11 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) error {
 	if err != nil {
 		return qerr.InvalidCryptoMessageParameter
 	}
+	h.peerCertificates = h.certManager.GetChain()
+	h.peerSCTs = h.scts
+	// the server accepted the first CHLO we sent
+	h.zeroRTT = h.clientHelloCounter == 1
+	h.cacheSession()
 
 	h.aeadChanged <- protocol.EncryptionForwardSecure
 
@@ -290,7 +497,7 @@ func (h *cryptoSetupClient) Open(dst, src []byte, packetNumber protocol.PacketNu
 		return nil, protocol.EncryptionUnspecified, err
 	}
 
-	if h.secureAEAD != nil {
+	if h.secureAEAD != nil && h.secureAEADCanOpen {
 		data, err := h.secureAEAD.Open(dst, src, packetNumber, associatedData)
 		if err == nil {
 			h.receivedSecurePacket = true
@@ -339,6 +546,12 @@ func (h *cryptoSetupClient) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 	return nil, errors.New("CryptoSetupClient: no encryption level specified")
 }
 
+// GetSealerForCryptoStream returns the sealer used for the crypto stream
+// CHLOs are always sent unencrypted, since the server can only derive the keys after processing the CHLO.
+func (h *cryptoSetupClient) GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer) {
+	return protocol.EncryptionUnencrypted, h.sealUnencrypted
+}
+
 func (h *cryptoSetupClient) sealUnencrypted(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte {
 	return (&crypto.NullAEAD{}).Seal(dst, src, packetNumber, associatedData)
 }
@@ -373,18 +586,44 @@ func (h *cryptoSetupClient) HandshakeComplete() bool {
 	return h.forwardSecureAEAD != nil
 }
 
+// ConnectionState returns details about the handshake
+func (h *cryptoSetupClient) ConnectionState() ConnectionState {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return ConnectionState{
+		HandshakeComplete:     h.forwardSecureAEAD != nil,
+		Version:               h.version,
+		AEAD:                  h.aead,
+		KeyExchange:           h.kexs,
+		ServerName:            h.hostname,
+		PeerCertificates:      h.peerCertificates,
+		PeerSCTs:              h.peerSCTs,
+		ZeroRTT:               h.zeroRTT,
+		TruncatedConnectionID: h.connectionParameters.TruncateConnectionID(),
+	}
+}
+
 func (h *cryptoSetupClient) sendCHLO() error {
 	h.clientHelloCounter++
 	if h.clientHelloCounter > protocol.MaxClientHellos {
 		return qerr.Error(qerr.CryptoTooManyRejects, fmt.Sprintf("More than %d rejects", protocol.MaxClientHellos))
 	}
 
+	// an expired server config can't be used for a full CHLO anymore
+	// the server will send a REJ containing its current server config
+	if h.secureAEAD == nil && h.serverConfig != nil && h.serverConfig.IsExpired() {
+		utils.Infof("Server config for %s expired", h.hostname)
+		h.dropServerConfig()
+	}
+
 	b := &bytes.Buffer{}
 
 	tags, err := h.getTags()
 	if err != nil {
 		return err
 	}
+	_, h.sentClientNonce = tags[TagNONC]
 	h.addPadding(tags)
 
 	utils.Debugf("Sending CHLO:\n%s", printHandshakeMessage(tags))
@@ -407,11 +646,17 @@ func (h *cryptoSetupClient) getTags() (map[Tag][]byte, error) {
 	}
 	tags[TagSNI] = []byte(h.hostname)
 	tags[TagPDMD] = []byte("X509")
+	// an empty CSCT requests the signed certificate timestamps of the leaf certificate
+	tags[TagCSCT] = []byte{}
 
 	ccs := h.certManager.GetCommonCertificateHashes()
 	if len(ccs) > 0 {
 		tags[TagCCS] = ccs
 	}
+	ccrt := h.certManager.GetCachedCertificateHashes()
+	if len(ccrt) > 0 {
+		tags[TagCCRT] = ccrt
+	}
 
 	versionTag := make([]byte, 4)
 	binary.LittleEndian.PutUint32(versionTag, protocol.VersionNumberToTag(h.version))
@@ -436,8 +681,8 @@ func (h *cryptoSetupClient) getTags() (map[Tag][]byte, error) {
 
 			tags[TagNONC] = h.nonc
 			tags[TagXLCT] = xlct
-			tags[TagKEXS] = []byte("C255")
-			tags[TagAEAD] = []byte("AESG")
+			tags[TagKEXS] = writeTagList([]Tag{h.serverConfig.kexAlgorithm})
+			tags[TagAEAD] = writeTagList([]Tag{h.serverConfig.aead})
 			tags[TagPUBS] = h.serverConfig.kex.PublicKey() // TODO: check if 3 bytes need to be prepended
 		}
 	}
@@ -457,18 +702,24 @@ func (h *cryptoSetupClient) addPadding(tags map[Tag][]byte) {
 	}
 }
 
+// maybeUpgradeCrypto derives the secureAEAD after sending a full CHLO
+// The client's keys don't depend on the diversification nonce, so data can be sent in 0-RTT right away.
+// The server's keys are derived once the diversification nonce was received with the first packet the server sent encrypted.
 func (h *cryptoSetupClient) maybeUpgradeCrypto() error {
-	if !h.serverVerified {
+	if !h.serverVerified || !h.sentClientNonce {
 		return nil
 	}
 
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
+	if h.secureAEADForLastCHLO && (h.secureAEADCanOpen || len(h.diversificationNonce) == 0) {
+		return nil
+	}
+
 	leafCert := h.certManager.GetLeafCert()
 
-	if h.secureAEAD == nil && (h.serverConfig != nil && len(h.serverConfig.sharedSecret) > 0 && len(h.nonc) > 0 && len(leafCert) > 0 && len(h.diversificationNonce) > 0 && len(h.lastSentCHLO) > 0) {
-		var err error
+	if h.serverConfig != nil && len(h.serverConfig.sharedSecret) > 0 && len(h.nonc) > 0 && len(leafCert) > 0 && len(h.lastSentCHLO) > 0 {
 		var nonce []byte
 		if h.sno == nil {
 			nonce = h.nonc
@@ -476,7 +727,8 @@ func (h *cryptoSetupClient) maybeUpgradeCrypto() error {
 			nonce = append(h.nonc, h.sno...)
 		}
 
-		h.secureAEAD, err = h.keyDerivation(
+		secureAEAD, err := h.keyDerivation(
+			h.serverConfig.aead,
 			false,
 			h.serverConfig.sharedSecret,
 			nonce,
@@ -490,8 +742,17 @@ func (h *cryptoSetupClient) maybeUpgradeCrypto() error {
 		if err != nil {
 			return err
 		}
-
-		h.aeadChanged <- protocol.EncryptionSecure
+		isFirstUpgrade := h.secureAEAD == nil
+		h.secureAEAD = secureAEAD
+		h.secureAEADForLastCHLO = true
+		h.secureAEADCanOpen = len(h.diversificationNonce) > 0
+		// these are the algorithms offered in the CHLO
+		h.aead = tagToString(h.serverConfig.aead)
+		h.kexs = tagToString(h.serverConfig.kexAlgorithm)
+
+		if isFirstUpgrade {
+			h.aeadChanged <- protocol.EncryptionSecure
+		}
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package handshake
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 )
 
 type keyDerivationValues struct {
+	aead          Tag
 	forwardSecure bool
 	sharedSecret  []byte
 	nonces        []byte
@@ -32,10 +34,16 @@ type mockCertManager struct {
 	setDataError      error
 
 	commonCertificateHashes []byte
+	cachedCertificateHashes []byte
+
+	setCachedChainCalledWith [][]byte
+	setCachedChainError      error
 
 	leafCert          []byte
 	leafCertHash      uint64
 	leafCertHashError error
+	chain             []*x509.Certificate
+	verifiedChains    [][]*x509.Certificate
 
 	verifyServerProofResult bool
 	verifyServerProofCalled bool
@@ -49,10 +57,19 @@ func (m *mockCertManager) SetData(data []byte) error {
 	return m.setDataError
 }
 
+func (m *mockCertManager) SetCachedChain(chain [][]byte) error {
+	m.setCachedChainCalledWith = chain
+	return m.setCachedChainError
+}
+
 func (m *mockCertManager) GetCommonCertificateHashes() []byte {
 	return m.commonCertificateHashes
 }
 
+func (m *mockCertManager) GetCachedCertificateHashes() []byte {
+	return m.cachedCertificateHashes
+}
+
 func (m *mockCertManager) GetLeafCert() []byte {
 	return m.leafCert
 }
@@ -61,6 +78,14 @@ func (m *mockCertManager) GetLeafCertHash() (uint64, error) {
 	return m.leafCertHash, m.leafCertHashError
 }
 
+func (m *mockCertManager) GetChain() []*x509.Certificate {
+	return m.chain
+}
+
+func (m *mockCertManager) GetVerifiedChains() [][]*x509.Certificate {
+	return m.verifiedChains
+}
+
 func (m *mockCertManager) VerifyServerProof(proof, chlo, serverConfigData []byte) bool {
 	m.verifyServerProofCalled = true
 	return m.verifyServerProofResult
@@ -71,6 +96,19 @@ func (m *mockCertManager) Verify(hostname string) error {
 	return m.verifyError
 }
 
+type mockClientSessionCache struct {
+	states map[string]*ClientSessionState
+}
+
+func (m *mockClientSessionCache) Get(hostname string) (*ClientSessionState, bool) {
+	state, ok := m.states[hostname]
+	return state, ok
+}
+
+func (m *mockClientSessionCache) Put(hostname string, state *ClientSessionState) {
+	m.states[hostname] = state
+}
+
 var _ = Describe("Crypto setup", func() {
 	var cs *cryptoSetupClient
 	var certManager *mockCertManager
@@ -83,8 +121,9 @@ var _ = Describe("Crypto setup", func() {
 			TagPUBS: []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f},
 			TagVER:  protocol.SupportedVersionsAsTags,
 		}
-		keyDerivation := func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+		keyDerivation := func(aead Tag, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
 			keyDerivationCalledWith = &keyDerivationValues{
+				aead:          aead,
 				forwardSecure: forwardSecure,
 				sharedSecret:  sharedSecret,
 				nonces:        nonces,
@@ -101,12 +140,22 @@ var _ = Describe("Crypto setup", func() {
 		stream = &mockStream{}
 		certManager = &mockCertManager{}
 		version := protocol.Version36
-		csInt, err := NewCryptoSetupClient("hostname", 0, version, stream, nil, NewConnectionParamatersManager(protocol.PerspectiveClient, version), make(chan protocol.EncryptionLevel, 2), nil)
+		cpm := NewConnectionParamatersManager(
+			protocol.PerspectiveClient,
+			version,
+			protocol.ReceiveStreamFlowControlWindow,
+			protocol.MaxReceiveStreamFlowControlWindowClient,
+			protocol.ReceiveConnectionFlowControlWindow,
+			protocol.MaxReceiveConnectionFlowControlWindowClient,
+			protocol.DefaultIdleTimeout,
+			nil,
+		)
+		csInt, err := NewCryptoSetupClient("hostname", 0, version, stream, nil, cpm, make(chan protocol.EncryptionLevel, 2), nil, nil, nil, nil, nil, nil)
 		Expect(err).ToNot(HaveOccurred())
 		cs = csInt.(*cryptoSetupClient)
 		cs.certManager = certManager
 		cs.keyDerivation = keyDerivation
-		cs.keyExchange = func() crypto.KeyExchange { return &mockKEX{ephermal: true} }
+		cs.keyExchange = func(Tag) crypto.KeyExchange { return &mockKEX{ephermal: true} }
 	})
 
 	Context("Reading REJ", func() {
@@ -269,6 +318,96 @@ var _ = Describe("Crypto setup", func() {
 					Expect(certManager.verifyServerProofCalled).To(BeTrue())
 				})
 
+				Context("calling VerifyPeerCertificate", func() {
+					var leafCert, intermediateCert *x509.Certificate
+
+					BeforeEach(func() {
+						leafCert = &x509.Certificate{Raw: []byte("leaf")}
+						intermediateCert = &x509.Certificate{Raw: []byte("intermediate")}
+						certManager.chain = []*x509.Certificate{leafCert, intermediateCert}
+						certManager.verifiedChains = [][]*x509.Certificate{{leafCert, intermediateCert}}
+						certManager.verifyServerProofResult = true
+					})
+
+					It("passes the raw and the verified chains after verifying the proof", func() {
+						var rawCerts [][]byte
+						var verifiedChains [][]*x509.Certificate
+						cs.verifyPeerCertificate = func(r [][]byte, v [][]*x509.Certificate) error {
+							Expect(certManager.verifyServerProofCalled).To(BeTrue())
+							rawCerts = r
+							verifiedChains = v
+							return nil
+						}
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(rawCerts).To(Equal([][]byte{[]byte("leaf"), []byte("intermediate")}))
+						Expect(verifiedChains).To(Equal(certManager.verifiedChains))
+						Expect(cs.serverVerified).To(BeTrue())
+					})
+
+					It("isn't called if the proof is invalid", func() {
+						certManager.verifyServerProofResult = false
+						var called bool
+						cs.verifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+							called = true
+							return nil
+						}
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).To(MatchError(qerr.ProofInvalid))
+						Expect(called).To(BeFalse())
+					})
+
+					It("aborts the handshake with a ProofInvalid error", func() {
+						cs.verifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+							return errors.New("SPKI not pinned")
+						}
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).To(MatchError(qerr.Error(qerr.ProofInvalid, "SPKI not pinned")))
+						Expect(cs.serverVerified).To(BeFalse())
+					})
+
+					It("checks the SCTs using the SCTPolicy", func() {
+						tagMap[TagCSCT] = writeSCTList([][]byte{[]byte("sct")})
+						var scts [][]byte
+						var leaf, issuer *x509.Certificate
+						cs.sctPolicy = func(s [][]byte, l, i *x509.Certificate) error {
+							scts = s
+							leaf = l
+							issuer = i
+							return nil
+						}
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(scts).To(Equal([][]byte{[]byte("sct")}))
+						Expect(cs.scts).To(Equal(scts))
+						Expect(leaf).To(Equal(leafCert))
+						Expect(issuer).To(Equal(intermediateCert))
+					})
+
+					It("aborts the handshake if the SCTPolicy rejects the SCTs", func() {
+						var err error
+						cs.sctPolicy, err = VerifiedSCTs(1, nil)
+						Expect(err).ToNot(HaveOccurred())
+						err = cs.handleREJMessage(tagMap)
+						Expect(err).To(MatchError(qerr.Error(qerr.ProofInvalid, "expected valid signed certificate timestamps from at least 1 logs, got 0")))
+						Expect(cs.serverVerified).To(BeFalse())
+					})
+
+					It("errors on an invalid SCT list", func() {
+						tagMap[TagCSCT] = []byte("invalid")
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "CSCT")))
+					})
+
+					It("aborts the handshake with the QuicError returned", func() {
+						cs.verifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+							return qerr.Error(qerr.CryptoTooManyRejects, "go away")
+						}
+						err := cs.handleREJMessage(tagMap)
+						Expect(err).To(MatchError(qerr.Error(qerr.CryptoTooManyRejects, "go away")))
+					})
+				})
+
 				It("doesn't try to verify the signature if the certificate is missing", func() {
 					delete(tagMap, TagCERT)
 					certManager.leafCert = nil
@@ -342,6 +481,54 @@ var _ = Describe("Crypto setup", func() {
 				Expect(cs.nonc).To(Equal(nonc))
 			})
 
+			It("generates a new client nonce when receiving a different server config", func() {
+				b := &bytes.Buffer{}
+				WriteHandshakeMessage(b, TagSCFG, getDefaultServerConfigClient())
+				tagMap[TagSCFG] = b.Bytes()
+				err := cs.handleREJMessage(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				nonc := cs.nonc
+				cs.serverVerified = true
+				scfg := getDefaultServerConfigClient()
+				scfg[TagSCID] = bytes.Repeat([]byte{'E'}, 16)
+				b = &bytes.Buffer{}
+				WriteHandshakeMessage(b, TagSCFG, scfg)
+				tagMap[TagSCFG] = b.Bytes()
+				err = cs.handleREJMessage(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.nonc).To(HaveLen(32))
+				Expect(cs.nonc).ToNot(Equal(nonc))
+				Expect(cs.serverVerified).To(BeFalse())
+			})
+
+			It("uses the preferred key exchange algorithm offered by the server", func() {
+				keys, err := GenerateServerConfigKeys()
+				Expect(err).ToNot(HaveOccurred())
+				scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				tagMap[TagSCFG] = scfg.Get()
+				cs.keyExchanges = []Tag{TagP256, TagC255}
+				err = cs.handleREJMessage(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.serverConfig.kexAlgorithm).To(Equal(TagP256))
+				Expect(cs.serverConfig.sharedSecret).To(HaveLen(32))
+			})
+
+			It("generates a new client nonce when a full CHLO was rejected", func() {
+				b := &bytes.Buffer{}
+				WriteHandshakeMessage(b, TagSCFG, getDefaultServerConfigClient())
+				tagMap[TagSCFG] = b.Bytes()
+				err := cs.handleREJMessage(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				nonc := cs.nonc
+				cs.sentClientNonce = true
+				err = cs.handleREJMessage(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.nonc).To(HaveLen(32))
+				Expect(cs.nonc).ToNot(Equal(nonc))
+				Expect(cs.sentClientNonce).To(BeFalse())
+			})
+
 			It("passes on errors from reading the server config", func() {
 				b := &bytes.Buffer{}
 				WriteHandshakeMessage(b, TagSHLO, make(map[Tag][]byte))
@@ -425,6 +612,196 @@ var _ = Describe("Crypto setup", func() {
 			err := cs.handleSHLOMessage(shloMap)
 			Expect(err).To(MatchError(qerr.InvalidCryptoMessageParameter))
 		})
+
+		It("saves the certificate chain for the ConnectionState", func() {
+			chain := []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("intermediate")}}
+			certManager.chain = chain
+			Expect(cs.ConnectionState().PeerCertificates).To(BeNil())
+			err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			state := cs.ConnectionState()
+			Expect(state.HandshakeComplete).To(BeTrue())
+			Expect(state.PeerCertificates).To(Equal(chain))
+			Expect(state.PeerSCTs).To(BeNil())
+			Expect(state.ServerName).To(Equal(cs.hostname))
+			Expect(state.Version).To(Equal(cs.version))
+		})
+
+		It("saves the SCTs for the ConnectionState", func() {
+			cs.scts = [][]byte{[]byte("sct1"), []byte("sct2")}
+			err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().PeerSCTs).To(Equal(cs.scts))
+		})
+
+		It("reports a 0-RTT handshake if the first CHLO was accepted", func() {
+			cs.clientHelloCounter = 1
+			err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().ZeroRTT).To(BeTrue())
+		})
+
+		It("doesn't report a 0-RTT handshake if the server rejected a CHLO", func() {
+			cs.clientHelloCounter = 2
+			err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().ZeroRTT).To(BeFalse())
+		})
+
+		It("caches the session", func() {
+			cache := &mockClientSessionCache{states: make(map[string]*ClientSessionState)}
+			cs.sessionCache = cache
+			cs.serverConfig.raw = []byte("server config")
+			cs.stk = []byte("stk")
+			cs.proof = []byte("proof")
+			cs.chloForSignature = []byte("chlo")
+			certManager.chain = []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("intermediate")}}
+			cs.scts = [][]byte{[]byte("sct")}
+			shloMap[TagSNO] = []byte("server nonce")
+			err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cache.states).To(HaveKey("hostname"))
+			Expect(cache.states["hostname"]).To(Equal(&ClientSessionState{
+				ServerConfig:       []byte("server config"),
+				SourceAddressToken: []byte("stk"),
+				ServerNonce:        []byte("server nonce"),
+				Certificates:       [][]byte{[]byte("leaf"), []byte("intermediate")},
+				SCTs:               [][]byte{[]byte("sct")},
+				ServerProof:        []byte("proof"),
+				CHLO:               []byte("chlo"),
+			}))
+		})
+	})
+
+	Context("restoring a cached session", func() {
+		var state *ClientSessionState
+
+		BeforeEach(func() {
+			b := &bytes.Buffer{}
+			WriteHandshakeMessage(b, TagSCFG, getDefaultServerConfigClient())
+			state = &ClientSessionState{
+				ServerConfig:       b.Bytes(),
+				SourceAddressToken: []byte("stk"),
+				ServerNonce:        []byte("server nonce"),
+				Certificates:       [][]byte{[]byte("leaf")},
+				ServerProof:        []byte("proof"),
+				CHLO:               []byte("chlo"),
+			}
+			certManager.verifyServerProofResult = true
+		})
+
+		It("restores the session", func() {
+			cs.restoreSession(state)
+			Expect(cs.serverConfig).ToNot(BeNil())
+			Expect(cs.serverConfig.Get()).To(Equal(state.ServerConfig))
+			Expect(cs.stk).To(Equal([]byte("stk")))
+			Expect(cs.sno).To(Equal([]byte("server nonce")))
+			Expect(cs.proof).To(Equal([]byte("proof")))
+			Expect(cs.chloForSignature).To(Equal([]byte("chlo")))
+			Expect(cs.nonc).To(HaveLen(32))
+			Expect(cs.serverVerified).To(BeTrue())
+			Expect(certManager.setCachedChainCalledWith).To(Equal(state.Certificates))
+			Expect(certManager.verifyCalled).To(BeTrue())
+		})
+
+		It("sends a full CHLO after restoring the session", func() {
+			certManager.leafCert = []byte("leaf")
+			certManager.cachedCertificateHashes = []byte("cached hashes")
+			cs.restoreSession(state)
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags[TagSCID]).To(Equal(cs.serverConfig.ID))
+			Expect(tags[TagSTK]).To(Equal([]byte("stk")))
+			Expect(tags[TagNONC]).To(Equal(cs.nonc))
+			Expect(tags[TagPUBS]).ToNot(BeEmpty())
+			Expect(tags[TagCCRT]).To(Equal([]byte("cached hashes")))
+		})
+
+		It("doesn't send a CCRT if no certificates are cached", func() {
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).ToNot(HaveKey(TagCCRT))
+		})
+
+		It("doesn't use an expired server config", func() {
+			scfg := getDefaultServerConfigClient()
+			scfg[TagEXPY] = []byte{0x80, 0x54, 0x72, 0x4F, 0, 0, 0, 0} // 2012-03-28
+			b := &bytes.Buffer{}
+			WriteHandshakeMessage(b, TagSCFG, scfg)
+			state.ServerConfig = b.Bytes()
+			cs.restoreSession(state)
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.stk).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+		})
+
+		It("doesn't use a certificate chain that fails verification", func() {
+			certManager.verifyError = errors.New("invalid certificate")
+			cs.restoreSession(state)
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.nonc).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(certManager.setCachedChainCalledWith).To(BeNil())
+		})
+
+		It("restores the SCTs", func() {
+			state.SCTs = [][]byte{[]byte("sct")}
+			var scts [][]byte
+			cs.sctPolicy = func(s [][]byte, _, _ *x509.Certificate) error {
+				scts = s
+				return nil
+			}
+			cs.restoreSession(state)
+			Expect(cs.serverVerified).To(BeTrue())
+			Expect(cs.scts).To(Equal(state.SCTs))
+			Expect(scts).To(Equal(state.SCTs))
+		})
+
+		It("doesn't use a certificate chain rejected by VerifyPeerCertificate", func() {
+			cs.verifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+				return errors.New("rejected")
+			}
+			cs.restoreSession(state)
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+		})
+
+		It("doesn't use an invalid server proof", func() {
+			certManager.verifyServerProofResult = false
+			cs.restoreSession(state)
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.proof).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+		})
+
+		It("reaches EncryptionSecure right after sending the first CHLO, when resuming a session", func() {
+			certManager.leafCert = []byte("leaf")
+			cs.restoreSession(state)
+			Expect(cs.serverVerified).To(BeTrue())
+			err := cs.HandleCryptoStream()
+			// the mockStream doesn't block if there's no data to read, so reading the server's response fails
+			Expect(err).To(MatchError(qerr.HandshakeFailed))
+			Expect(cs.clientHelloCounter).To(Equal(1))
+			tag, chlo, err := ParseHandshakeMessage(&stream.dataWritten)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tag).To(Equal(TagCHLO))
+			Expect(chlo[TagNONC]).To(Equal(cs.nonc))
+			Expect(cs.aeadChanged).To(Receive(Equal(protocol.EncryptionSecure)))
+			Expect(keyDerivationCalledWith.chlo).To(Equal(cs.lastSentCHLO))
+			Expect(keyDerivationCalledWith.cert).To(Equal([]byte("leaf")))
+			enc, _ := cs.GetSealer()
+			Expect(enc).To(Equal(protocol.EncryptionSecure))
+			Expect(cs.HandshakeComplete()).To(BeFalse())
+		})
+
+		It("looks up the hostname in the session cache when created", func() {
+			cache := &mockClientSessionCache{states: map[string]*ClientSessionState{"hostname": state}}
+			csInt, err := NewCryptoSetupClient("hostname", 0, protocol.Version36, stream, nil, cs.connectionParameters, make(chan protocol.EncryptionLevel, 2), nil, cache, nil, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			// the cached certificate can't be parsed, so the handshake starts from scratch
+			Expect(csInt.(*cryptoSetupClient).serverConfig).To(BeNil())
+			Expect(csInt.(*cryptoSetupClient).sessionCache).To(Equal(cache))
+		})
 	})
 
 	Context("CHLO generation", func() {
@@ -465,6 +842,7 @@ var _ = Describe("Crypto setup", func() {
 			Expect(tags[TagPDMD]).To(Equal([]byte("X509")))
 			Expect(tags[TagVER]).To(Equal([]byte("Q036")))
 			Expect(tags[TagCCS]).To(Equal(certManager.commonCertificateHashes))
+			Expect(tags).To(HaveKeyWithValue(TagCSCT, BeEmpty()))
 		})
 
 		It("adds the tags returned from the connectionParametersManager to the CHLO", func() {
@@ -527,7 +905,7 @@ var _ = Describe("Crypto setup", func() {
 			cs.nonc = []byte("client-nonce")
 			kex, err := crypto.NewCurve25519KEX()
 			Expect(err).ToNot(HaveOccurred())
-			cs.serverConfig = &serverConfigClient{kex: kex}
+			cs.serverConfig = &serverConfigClient{kex: kex, kexAlgorithm: TagC255, aead: TagAESG}
 			xlct := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8}
 			certManager.leafCertHash = binary.LittleEndian.Uint64(xlct)
 			tags, err := cs.getTags()
@@ -539,6 +917,47 @@ var _ = Describe("Crypto setup", func() {
 			Expect(tags[TagAEAD]).To(Equal([]byte("AESG")))
 		})
 
+		It("sends the key exchange algorithm chosen from the server config", func() {
+			certManager.leafCert = []byte("leafcert")
+			cs.nonc = []byte("client-nonce")
+			kex, err := crypto.NewP256KEX()
+			Expect(err).ToNot(HaveOccurred())
+			cs.serverConfig = &serverConfigClient{kex: kex, kexAlgorithm: TagP256, aead: TagAESG}
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags[TagPUBS]).To(Equal(kex.PublicKey()))
+			Expect(tags[TagKEXS]).To(Equal([]byte("P256")))
+		})
+
+		It("sends the AEAD chosen from the server config", func() {
+			certManager.leafCert = []byte("leafcert")
+			cs.nonc = []byte("client-nonce")
+			kex, err := crypto.NewCurve25519KEX()
+			Expect(err).ToNot(HaveOccurred())
+			cs.serverConfig = &serverConfigClient{kex: kex, kexAlgorithm: TagC255, aead: TagCC20}
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags[TagAEAD]).To(Equal([]byte("CC20")))
+		})
+
+		It("drops an expired server config before sending a CHLO", func() {
+			scfg := getDefaultServerConfigClient()
+			scfg[TagEXPY] = []byte{0x80, 0x54, 0x72, 0x4F, 0, 0, 0, 0} // 2012-03-28
+			b := &bytes.Buffer{}
+			WriteHandshakeMessage(b, TagSCFG, scfg)
+			var err error
+			cs.serverConfig, err = parseServerConfig(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			cs.nonc = []byte("client nonce")
+			cs.serverVerified = true
+			err = cs.sendCHLO()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.nonc).To(BeNil())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cs.lastSentCHLO).ToNot(ContainSubstring("SCID"))
+		})
+
 		It("doesn't send more than MaxClientHellos CHLOs", func() {
 			Expect(cs.clientHelloCounter).To(BeZero())
 			for i := 1; i <= protocol.MaxClientHellos; i++ {
@@ -573,12 +992,15 @@ var _ = Describe("Crypto setup", func() {
 			kex, err := crypto.NewCurve25519KEX()
 			Expect(err).ToNot(HaveOccurred())
 			cs.serverConfig = &serverConfigClient{
+				aead:         TagAESG,
+				kexAlgorithm: TagC255,
 				kex:          kex,
 				obit:         []byte("obit"),
 				sharedSecret: []byte("sharedSecret"),
 				raw:          []byte("rawserverconfig"),
 			}
 			cs.lastSentCHLO = []byte("lastSentCHLO")
+			cs.sentClientNonce = true
 			cs.nonc = []byte("nonc")
 			cs.diversificationNonce = []byte("divnonce")
 			certManager.leafCert = []byte("leafCert")
@@ -589,6 +1011,7 @@ var _ = Describe("Crypto setup", func() {
 			err := cs.maybeUpgradeCrypto()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(cs.secureAEAD).ToNot(BeNil())
+			Expect(keyDerivationCalledWith.aead).To(Equal(TagAESG))
 			Expect(keyDerivationCalledWith.forwardSecure).To(BeFalse())
 			Expect(keyDerivationCalledWith.sharedSecret).To(Equal(cs.serverConfig.sharedSecret))
 			Expect(keyDerivationCalledWith.nonces).To(Equal(cs.nonc))
@@ -600,6 +1023,17 @@ var _ = Describe("Crypto setup", func() {
 			Expect(keyDerivationCalledWith.pers).To(Equal(protocol.PerspectiveClient))
 			Expect(cs.HandshakeComplete()).To(BeFalse())
 			Expect(cs.aeadChanged).To(Receive())
+			Expect(cs.ConnectionState().AEAD).To(Equal("AESG"))
+			Expect(cs.ConnectionState().KeyExchange).To(Equal("C255"))
+		})
+
+		It("uses the AEAD chosen from the server config", func() {
+			cs.serverConfig.aead = TagCC20
+			cs.serverVerified = true
+			err := cs.maybeUpgradeCrypto()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyDerivationCalledWith.aead).To(Equal(TagCC20))
+			Expect(cs.ConnectionState().AEAD).To(Equal("CC20"))
 		})
 
 		It("uses the server nonce, if the server sent one", func() {
@@ -649,6 +1083,82 @@ var _ = Describe("Crypto setup", func() {
 			Expect(cs.HandshakeComplete()).To(BeFalse())
 		})
 
+		Context("0-RTT", func() {
+			BeforeEach(func() {
+				cs.diversificationNonce = nil
+				cs.serverVerified = true
+			})
+
+			It("derives the keys right after sending a full CHLO, without the diversification nonce", func() {
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.secureAEAD).ToNot(BeNil())
+				Expect(keyDerivationCalledWith.divNonce).To(BeEmpty())
+				Expect(cs.aeadChanged).To(Receive(Equal(protocol.EncryptionSecure)))
+				enc, seal := cs.GetSealer()
+				Expect(enc).To(Equal(protocol.EncryptionSecure))
+				Expect(seal(nil, []byte("foobar"), 0, []byte{})).To(Equal([]byte("foobar  normal sec")))
+			})
+
+			It("doesn't derive keys for an inchoate CHLO", func() {
+				cs.sentClientNonce = false
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.secureAEAD).To(BeNil())
+				Expect(cs.aeadChanged).ToNot(Receive())
+			})
+
+			It("doesn't open packets before receiving the diversification nonce", func() {
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				_, enc, err := cs.Open(nil, []byte("encrypted"), 0, []byte{})
+				Expect(err).To(HaveOccurred())
+				Expect(enc).To(Equal(protocol.EncryptionUnspecified))
+				Expect(cs.receivedSecurePacket).To(BeFalse())
+			})
+
+			It("derives the server's keys when receiving the diversification nonce", func() {
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.aeadChanged).To(Receive())
+				err = cs.SetDiversificationNonce([]byte("divnonce"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(keyDerivationCalledWith.divNonce).To(Equal([]byte("divnonce")))
+				// the crypto was already upgraded to EncryptionSecure before
+				Expect(cs.aeadChanged).ToNot(Receive())
+				d, enc, err := cs.Open(nil, []byte("encrypted"), 0, []byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(d).To(Equal([]byte("decrypted")))
+				Expect(enc).To(Equal(protocol.EncryptionSecure))
+			})
+
+			It("derives new keys after the server rejected a full CHLO", func() {
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.aeadChanged).To(Receive())
+				err = cs.handleREJMessage(map[Tag][]byte{})
+				Expect(err).ToNot(HaveOccurred())
+				// the keys for the rejected CHLO are kept until the next full CHLO is sent
+				Expect(cs.secureAEAD).ToNot(BeNil())
+				cs.lastSentCHLO = []byte("new CHLO")
+				cs.sentClientNonce = true
+				cs.nonc = []byte("new nonc")
+				err = cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(keyDerivationCalledWith.chlo).To(Equal([]byte("new CHLO")))
+				Expect(keyDerivationCalledWith.nonces).To(Equal([]byte("new nonc")))
+				Expect(cs.aeadChanged).ToNot(Receive())
+			})
+
+			It("sends the crypto stream unencrypted", func() {
+				err := cs.maybeUpgradeCrypto()
+				Expect(err).ToNot(HaveOccurred())
+				enc, seal := cs.GetSealerForCryptoStream()
+				Expect(enc).To(Equal(protocol.EncryptionUnencrypted))
+				Expect(seal(nil, []byte("foobar"), 0, []byte{})).To(Equal(foobarFNVSigned))
+			})
+		})
+
 		Context("null encryption", func() {
 			It("is used initially", func() {
 				enc, seal := cs.GetSealer()
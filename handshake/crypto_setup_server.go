@@ -3,10 +3,12 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/crypto"
 	"github.com/lucas-clemente/quic-go/protocol"
@@ -15,17 +17,19 @@ import (
 )
 
 // KeyDerivationFunction is used for key derivation
-type KeyDerivationFunction func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error)
+type KeyDerivationFunction func(aead Tag, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error)
 
-// KeyExchangeFunction is used to make a new KEX
-type KeyExchangeFunction func() crypto.KeyExchange
+// KeyExchangeFunction is used to make a new KEX for an algorithm
+type KeyExchangeFunction func(algorithm Tag) crypto.KeyExchange
 
 // The CryptoSetupServer handles all things crypto for the Session
 type cryptoSetupServer struct {
 	connID               protocol.ConnectionID
 	sourceAddr           []byte
 	version              protocol.VersionNumber
-	scfg                 *ServerConfig
+	serverConfigs        ServerConfigSource
+	scfg                 *ServerConfig // the server config used for the current CHLO
+	strikeRegister       crypto.StrikeRegister
 	diversificationNonce []byte
 
 	secureAEAD                  crypto.AEAD
@@ -33,8 +37,22 @@ type cryptoSetupServer struct {
 	receivedForwardSecurePacket bool
 	sentSHLO                    bool
 	receivedSecurePacket        bool
+	sentREJ                     bool
 	aeadChanged                 chan protocol.EncryptionLevel
 
+	// the time the last REJ was sent, used to measure the RTT when receiving the next CHLO
+	lastREJSentTime time.Time
+	// the RTT measured during this handshake, or carried in the client's STK
+	rtt time.Duration
+
+	// negotiated parameters, exposed by ConnectionState
+	sni     string
+	uaid    string
+	aead    string
+	kexs    string
+	zeroRTT bool
+	rttHint time.Duration
+
 	keyDerivation KeyDerivationFunction
 	keyExchange   KeyExchangeFunction
 
@@ -52,12 +70,17 @@ var _ CryptoSetup = &cryptoSetupServer{}
 // TODO: remove this when dropping support for QUIC 36
 var ErrHOLExperiment = qerr.Error(qerr.InvalidCryptoMessageParameter, "HOL experiment. Unsupported")
 
+// errClientNonceRejected is returned by handleCHLO if the strike register rejected the client nonce
+// This happens if the CHLO was replayed, and the server then sends a REJ.
+var errClientNonceRejected = errors.New("CryptoSetupServer: client nonce rejected")
+
 // NewCryptoSetup creates a new CryptoSetup instance for a server
 func NewCryptoSetup(
 	connID protocol.ConnectionID,
 	sourceAddr []byte,
 	version protocol.VersionNumber,
-	scfg *ServerConfig,
+	serverConfigs ServerConfigSource,
+	strikeRegister crypto.StrikeRegister,
 	cryptoStream io.ReadWriter,
 	connectionParametersManager ConnectionParametersManager,
 	aeadChanged chan protocol.EncryptionLevel,
@@ -66,8 +89,10 @@ func NewCryptoSetup(
 		connID:               connID,
 		sourceAddr:           sourceAddr,
 		version:              version,
-		scfg:                 scfg,
-		keyDerivation:        crypto.DeriveKeysAESGCM,
+		serverConfigs:        serverConfigs,
+		scfg:                 serverConfigs.GetPrimary(),
+		strikeRegister:       strikeRegister,
+		keyDerivation:        deriveKeys,
 		keyExchange:          getEphermalKEX,
 		cryptoStream:         cryptoStream,
 		connectionParameters: connectionParametersManager,
@@ -89,6 +114,11 @@ func (h *cryptoSetupServer) HandleCryptoStream() error {
 
 		utils.Debugf("Got CHLO:\n%s", printHandshakeMessage(cryptoData))
 
+		// the client sent this CHLO in response to our REJ
+		if !h.lastREJSentTime.IsZero() {
+			h.rtt = time.Since(h.lastREJSentTime)
+		}
+
 		done, err := h.handleMessage(chloData.Bytes(), cryptoData)
 		if err != nil {
 			return err
@@ -132,29 +162,50 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 	var reply []byte
 	var err error
 
-	certUncompressed, err := h.scfg.certChain.GetLeafCert(sni)
+	// use the server config referenced by the client, if it is still accepted
+	// otherwise, the client is sent the primary server config in a REJ
+	h.scfg = h.serverConfigs.GetPrimary()
+	if scid, ok := cryptoData[TagSCID]; ok {
+		if scfg := h.serverConfigs.Lookup(scid); scfg != nil {
+			h.scfg = scfg
+		}
+	}
+
+	// select the certificate once, such that all parts of the reply use the same certificate, even if the TLS config is replaced meanwhile
+	cert, err := h.scfg.GetCertificate(sni)
+	if err != nil {
+		return false, err
+	}
+	certUncompressed, err := h.scfg.GetLeafCert(cert)
 	if err != nil {
 		return false, err
 	}
 
 	if !h.isInchoateCHLO(cryptoData, certUncompressed) {
 		// We have a CHLO with a proper server config ID, do a 0-RTT handshake
-		reply, err = h.handleCHLO(sni, chloData, cryptoData)
-		if err != nil {
-			return false, err
+		reply, err = h.handleCHLO(sni, certUncompressed, chloData, cryptoData)
+		if err == nil {
+			_, err = h.cryptoStream.Write(reply)
+			if err != nil {
+				return false, err
+			}
+			return true, nil
 		}
-		_, err = h.cryptoStream.Write(reply)
-		if err != nil {
+		// if the CHLO was replayed, don't accept the 0-RTT data, but send a REJ
+		if err != errClientNonceRejected {
 			return false, err
 		}
-		return true, nil
 	}
 
 	// We have an inchoate or non-matching CHLO, we now send a rejection
-	reply, err = h.handleInchoateCHLO(sni, chloData, cryptoData)
+	// always send the primary server config, such that clients switch to the new config after a rotation
+	h.scfg = h.serverConfigs.GetPrimary()
+	reply, err = h.handleInchoateCHLO(cert, chloData, cryptoData)
 	if err != nil {
 		return false, err
 	}
+	h.sentREJ = true
+	h.lastREJSentTime = time.Now()
 	_, err = h.cryptoStream.Write(reply)
 	return false, err
 }
@@ -224,6 +275,12 @@ func (h *cryptoSetupServer) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 	return nil, errors.New("CryptoSetupServer: no encryption level specified")
 }
 
+// GetSealerForCryptoStream returns the sealer used for the crypto stream
+// The server sends the REJ unencrypted and the SHLO with initial encryption, just as the other data.
+func (h *cryptoSetupServer) GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer) {
+	return h.GetSealer()
+}
+
 func (h *cryptoSetupServer) sealUnencrypted(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte {
 	return (&crypto.NullAEAD{}).Seal(dst, src, packetNumber, associatedData)
 }
@@ -253,19 +310,26 @@ func (h *cryptoSetupServer) isInchoateCHLO(cryptoData map[Tag][]byte, cert []byt
 	if crypto.HashCert(cert) != xlct {
 		return true
 	}
-	if err := h.scfg.stkSource.VerifyToken(h.sourceAddr, cryptoData[TagSTK]); err != nil {
+	stkData, err := h.scfg.stkSource.VerifyToken(h.sourceAddr, cryptoData[TagSTK])
+	if err != nil {
 		utils.Debugf("STK invalid: %s", err.Error())
 		return true
 	}
+	h.rememberRTTHint(stkData)
 	return false
 }
 
-func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoData map[Tag][]byte) ([]byte, error) {
+func (h *cryptoSetupServer) handleInchoateCHLO(cert *tls.Certificate, chlo []byte, cryptoData map[Tag][]byte) ([]byte, error) {
 	if len(chlo) < protocol.ClientHelloMinimumSize {
 		return nil, qerr.Error(qerr.CryptoInvalidValueLength, "CHLO too small")
 	}
 
-	token, err := h.scfg.stkSource.NewToken(h.sourceAddr)
+	stkData, stkErr := h.scfg.stkSource.VerifyToken(h.sourceAddr, cryptoData[TagSTK])
+	if stkErr == nil {
+		h.rememberRTTHint(stkData)
+	}
+
+	token, err := h.scfg.stkSource.NewToken(h.sourceAddr, crypto.STKData{RTT: h.rtt})
 	if err != nil {
 		return nil, err
 	}
@@ -276,8 +340,8 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 		TagSVID: []byte("quic-go"),
 	}
 
-	if h.scfg.stkSource.VerifyToken(h.sourceAddr, cryptoData[TagSTK]) == nil {
-		proof, err := h.scfg.Sign(sni, chlo)
+	if stkErr == nil {
+		proof, err := h.scfg.Sign(cert, chlo)
 		if err != nil {
 			return nil, err
 		}
@@ -285,13 +349,20 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 		commonSetHashes := cryptoData[TagCCS]
 		cachedCertsHashes := cryptoData[TagCCRT]
 
-		certCompressed, err := h.scfg.GetCertsCompressed(sni, commonSetHashes, cachedCertsHashes)
+		certCompressed, err := h.scfg.GetCertsCompressed(cert, commonSetHashes, cachedCertsHashes)
 		if err != nil {
 			return nil, err
 		}
 		// Token was valid, send more details
 		replyMap[TagPROF] = proof
 		replyMap[TagCERT] = certCompressed
+
+		// the client indicates support for signed certificate timestamps by sending an empty CSCT
+		if _, ok := cryptoData[TagCSCT]; ok {
+			if scts := h.scfg.GetSignedCertificateTimestamps(cert); len(scts) > 0 {
+				replyMap[TagCSCT] = writeSCTList(scts)
+			}
+		}
 	}
 
 	var serverReply bytes.Buffer
@@ -300,51 +371,66 @@ func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoDa
 	return serverReply.Bytes(), nil
 }
 
-func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[Tag][]byte) ([]byte, error) {
+func (h *cryptoSetupServer) handleCHLO(sni string, certUncompressed []byte, data []byte, cryptoData map[Tag][]byte) ([]byte, error) {
 	// We have a CHLO matching our server config, we can continue with the 0-RTT handshake
-	sharedSecret, err := h.scfg.kex.CalculateSharedKey(cryptoData[TagPUBS])
-	if err != nil {
-		return nil, err
-	}
-
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	certUncompressed, err := h.scfg.certChain.GetLeafCert(sni)
-	if err != nil {
-		return nil, err
-	}
-
 	serverNonce := make([]byte, 32)
-	if _, err = rand.Read(serverNonce); err != nil {
+	if _, err := rand.Read(serverNonce); err != nil {
 		return nil, err
 	}
 
 	h.diversificationNonce = make([]byte, 32)
-	if _, err = rand.Read(h.diversificationNonce); err != nil {
+	if _, err := rand.Read(h.diversificationNonce); err != nil {
 		return nil, err
 	}
 
 	clientNonce := cryptoData[TagNONC]
-	err = h.validateClientNonce(clientNonce)
+	err := h.validateClientNonce(clientNonce)
 	if err != nil {
 		return nil, err
 	}
 
+	// the client chooses one of the AEADs offered in the server config
 	aead := cryptoData[TagAEAD]
-	if !bytes.Equal(aead, []byte("AESG")) {
+	if len(aead) != 4 {
+		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
+	}
+	aeadAlgorithm := Tag(binary.LittleEndian.Uint32(aead))
+	if !containsTag(h.scfg.aeads, aeadAlgorithm) {
 		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
 	}
 
+	// the client chooses one of the key exchange algorithms offered in the server config
 	kexs := cryptoData[TagKEXS]
-	if !bytes.Equal(kexs, []byte("C255")) {
+	if len(kexs) != 4 {
 		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
 	}
+	kexAlgorithm := Tag(binary.LittleEndian.Uint32(kexs))
+	kex, ok := h.scfg.keyExchanges[kexAlgorithm]
+	if !ok {
+		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
+	}
+	sharedSecret, err := kex.CalculateSharedKey(cryptoData[TagPUBS])
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.strikeRegister.Insert(clientNonce, time.Now()); err != nil {
+		utils.Infof("Rejecting CHLO: %s", err.Error())
+		return nil, errClientNonceRejected
+	}
 
+	// if the client sent a server nonce (e.g. when resuming a session), it is used for the initial keys as well
+	var initialNonce bytes.Buffer
+	initialNonce.Write(clientNonce)
+	initialNonce.Write(cryptoData[TagSNO])
 	h.secureAEAD, err = h.keyDerivation(
+		aeadAlgorithm,
 		false,
 		sharedSecret,
-		clientNonce,
+		initialNonce.Bytes(),
 		h.connID,
 		data,
 		h.scfg.Get(),
@@ -356,19 +442,26 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 		return nil, err
 	}
 
+	h.sni = sni
+	h.uaid = string(cryptoData[TagUAID])
+	h.aead = string(aead)
+	h.kexs = string(kexs)
+	h.zeroRTT = !h.sentREJ
+
 	h.aeadChanged <- protocol.EncryptionSecure
 
 	// Generate a new curve instance to derive the forward secure key
 	var fsNonce bytes.Buffer
 	fsNonce.Write(clientNonce)
 	fsNonce.Write(serverNonce)
-	ephermalKex := h.keyExchange()
+	ephermalKex := h.keyExchange(kexAlgorithm)
 	ephermalSharedSecret, err := ephermalKex.CalculateSharedKey(cryptoData[TagPUBS])
 	if err != nil {
 		return nil, err
 	}
 
 	h.forwardSecureAEAD, err = h.keyDerivation(
+		aeadAlgorithm,
 		true,
 		ephermalSharedSecret,
 		fsNonce.Bytes(),
@@ -421,6 +514,38 @@ func (h *cryptoSetupServer) HandshakeComplete() bool {
 	return h.receivedForwardSecurePacket
 }
 
+// ConnectionState returns details about the handshake
+func (h *cryptoSetupServer) ConnectionState() ConnectionState {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return ConnectionState{
+		HandshakeComplete:     h.forwardSecureAEAD != nil,
+		Version:               h.version,
+		AEAD:                  h.aead,
+		KeyExchange:           h.kexs,
+		ServerName:            h.sni,
+		ClientUAID:            h.uaid,
+		ZeroRTT:               h.zeroRTT,
+		TruncatedConnectionID: h.connectionParameters.TruncateConnectionID(),
+		RTTHint:               h.rttHint,
+	}
+}
+
+// rememberRTTHint saves the RTT carried in the client's STK
+// It is passed on in new STKs, unless the RTT was measured during this handshake.
+func (h *cryptoSetupServer) rememberRTTHint(data crypto.STKData) {
+	if data.RTT == 0 {
+		return
+	}
+	h.mutex.Lock()
+	h.rttHint = data.RTT
+	h.mutex.Unlock()
+	if h.rtt == 0 {
+		h.rtt = data.RTT
+	}
+}
+
 func (h *cryptoSetupServer) validateClientNonce(nonce []byte) error {
 	if len(nonce) != 32 {
 		return qerr.Error(qerr.InvalidCryptoMessageParameter, "invalid client nonce length")
@@ -2,9 +2,11 @@ package handshake
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"net"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/crypto"
 	"github.com/lucas-clemente/quic-go/protocol"
@@ -38,20 +40,37 @@ func (m *mockKEX) CalculateSharedKey(otherPublic []byte) ([]byte, error) {
 
 type mockSigner struct {
 	gotCHLO bool
+	scts    [][]byte
+	// the certificates returned by GetCertificate, and the certificates passed to the other methods
+	selectedCerts []*tls.Certificate
+	usedCerts     []*tls.Certificate
 }
 
-func (s *mockSigner) SignServerProof(sni string, chlo []byte, serverConfigData []byte) ([]byte, error) {
+func (s *mockSigner) GetCertificate(sni string) (*tls.Certificate, error) {
+	cert := &tls.Certificate{}
+	s.selectedCerts = append(s.selectedCerts, cert)
+	return cert, nil
+}
+func (s *mockSigner) SignServerProof(cert *tls.Certificate, chlo []byte, serverConfigData []byte) ([]byte, error) {
+	s.usedCerts = append(s.usedCerts, cert)
 	if len(chlo) > 0 {
 		s.gotCHLO = true
 	}
 	return []byte("proof"), nil
 }
-func (*mockSigner) GetCertsCompressed(sni string, common, cached []byte) ([]byte, error) {
+func (s *mockSigner) GetCertsCompressed(cert *tls.Certificate, common, cached []byte) ([]byte, error) {
+	s.usedCerts = append(s.usedCerts, cert)
 	return []byte("certcompressed"), nil
 }
-func (*mockSigner) GetLeafCert(sni string) ([]byte, error) {
+func (s *mockSigner) GetLeafCert(cert *tls.Certificate) ([]byte, error) {
+	s.usedCerts = append(s.usedCerts, cert)
 	return []byte("certuncompressed"), nil
 }
+func (s *mockSigner) GetSignedCertificateTimestamps(cert *tls.Certificate) [][]byte {
+	s.usedCerts = append(s.usedCerts, cert)
+	return s.scts
+}
+func (*mockSigner) SetTLSConfig(*tls.Config) {}
 
 type mockAEAD struct {
 	forwardSecure bool
@@ -84,7 +103,7 @@ func (m *mockAEAD) Open(dst, src []byte, packetNumber protocol.PacketNumber, ass
 var expectedInitialNonceLen int
 var expectedFSNonceLen int
 
-func mockKeyDerivation(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+func mockKeyDerivation(aead Tag, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
 	if forwardSecure {
 		Expect(nonces).To(HaveLen(expectedFSNonceLen))
 	} else {
@@ -117,50 +136,83 @@ func (s mockStream) StreamID() protocol.StreamID         { panic("not implemente
 
 type mockStkSource struct {
 	verifyErr error
+	data      crypto.STKData // returned when verifying a token
+
+	newTokenData crypto.STKData // the data passed when creating the last token
 }
 
-func (mockStkSource) NewToken(sourceAddr []byte) ([]byte, error) {
+func (s *mockStkSource) NewToken(sourceAddr []byte, data crypto.STKData) ([]byte, error) {
+	s.newTokenData = data
 	return append([]byte("token "), sourceAddr...), nil
 }
 
-func (s mockStkSource) VerifyToken(sourceAddr []byte, token []byte) error {
+func (s *mockStkSource) VerifyToken(sourceAddr []byte, token []byte) (crypto.STKData, error) {
 	if s.verifyErr != nil {
-		return s.verifyErr
+		return crypto.STKData{}, s.verifyErr
 	}
 	split := bytes.Split(token, []byte(" "))
 	if len(split) != 2 {
-		return errors.New("stk required")
+		return crypto.STKData{}, errors.New("stk required")
 	}
 	if !bytes.Equal(split[0], []byte("token")) {
-		return errors.New("no prefix match")
+		return crypto.STKData{}, errors.New("no prefix match")
 	}
 	if !bytes.Equal(split[1], sourceAddr) {
-		return errors.New("ip wrong")
+		return crypto.STKData{}, errors.New("ip wrong")
+	}
+	return s.data, nil
+}
+
+type mockServerConfigSource struct {
+	primary  *ServerConfig
+	accepted []*ServerConfig
+}
+
+func (m *mockServerConfigSource) GetPrimary() *ServerConfig {
+	return m.primary
+}
+
+func (m *mockServerConfigSource) Lookup(id []byte) *ServerConfig {
+	for _, scfg := range m.accepted {
+		if bytes.Equal(scfg.ID, id) {
+			return scfg
+		}
 	}
 	return nil
 }
 
+type mockStrikeRegister struct {
+	err      error
+	inserted [][]byte
+}
+
+func (r *mockStrikeRegister) Insert(nonce []byte, now time.Time) error {
+	r.inserted = append(r.inserted, nonce)
+	return r.err
+}
+
 var _ = Describe("Crypto setup", func() {
 	var (
-		kex         *mockKEX
-		signer      *mockSigner
-		scfg        *ServerConfig
-		cs          *cryptoSetupServer
-		stream      *mockStream
-		cpm         ConnectionParametersManager
-		aeadChanged chan protocol.EncryptionLevel
-		nonce32     []byte
-		versionTag  []byte
-		sourceAddr  []byte
-		validSTK    []byte
-		aead        []byte
-		kexs        []byte
+		strikeRegister *mockStrikeRegister
+		kex            *mockKEX
+		signer         *mockSigner
+		scfg           *ServerConfig
+		cs             *cryptoSetupServer
+		stream         *mockStream
+		cpm            ConnectionParametersManager
+		aeadChanged    chan protocol.EncryptionLevel
+		nonce32        []byte
+		versionTag     []byte
+		sourceAddr     []byte
+		validSTK       []byte
+		aead           []byte
+		kexs           []byte
 	)
 
 	BeforeEach(func() {
 		var err error
 		sourceAddr = net.ParseIP("1.2.3.4")
-		validSTK, err = mockStkSource{}.NewToken(sourceAddr)
+		validSTK, err = (&mockStkSource{}).NewToken(sourceAddr, crypto.STKData{})
 		Expect(err).NotTo(HaveOccurred())
 		expectedInitialNonceLen = 32
 		expectedFSNonceLen = 64
@@ -178,12 +230,22 @@ var _ = Describe("Crypto setup", func() {
 		Expect(err).NotTo(HaveOccurred())
 		scfg.stkSource = &mockStkSource{}
 		v := protocol.SupportedVersions[len(protocol.SupportedVersions)-1]
-		cpm = NewConnectionParamatersManager(protocol.PerspectiveServer, protocol.VersionWhatever)
-		csInt, err := NewCryptoSetup(protocol.ConnectionID(42), sourceAddr, v, scfg, stream, cpm, aeadChanged)
+		cpm = NewConnectionParamatersManager(
+			protocol.PerspectiveServer,
+			protocol.VersionWhatever,
+			protocol.ReceiveStreamFlowControlWindow,
+			protocol.MaxReceiveStreamFlowControlWindowServer,
+			protocol.ReceiveConnectionFlowControlWindow,
+			protocol.MaxReceiveConnectionFlowControlWindowServer,
+			protocol.DefaultIdleTimeout,
+			nil,
+		)
+		strikeRegister = &mockStrikeRegister{}
+		csInt, err := NewCryptoSetup(protocol.ConnectionID(42), sourceAddr, v, scfg, strikeRegister, stream, cpm, aeadChanged)
 		Expect(err).NotTo(HaveOccurred())
 		cs = csInt.(*cryptoSetupServer)
 		cs.keyDerivation = mockKeyDerivation
-		cs.keyExchange = func() crypto.KeyExchange { return &mockKEX{ephermal: true} }
+		cs.keyExchange = func(Tag) crypto.KeyExchange { return &mockKEX{ephermal: true} }
 	})
 
 	Context("diversification nonce", func() {
@@ -194,7 +256,7 @@ var _ = Describe("Crypto setup", func() {
 
 			Expect(cs.DiversificationNonce()).To(BeEmpty())
 			// Div nonce is created after CHLO
-			cs.handleCHLO("", nil, map[Tag][]byte{TagNONC: nonce32})
+			cs.handleCHLO("", []byte("certuncompressed"), nil, map[Tag][]byte{TagNONC: nonce32})
 		})
 
 		It("returns diversification nonces", func() {
@@ -210,7 +272,7 @@ var _ = Describe("Crypto setup", func() {
 		BeforeEach(func() {
 			xlct = make([]byte, 8)
 			var err error
-			cert, err = cs.scfg.certChain.GetLeafCert("")
+			cert, err = cs.scfg.certChain.GetLeafCert(&tls.Certificate{})
 			Expect(err).ToNot(HaveOccurred())
 			binary.LittleEndian.PutUint64(xlct, crypto.HashCert(cert))
 			fullCHLO = map[Tag][]byte{
@@ -235,7 +297,7 @@ var _ = Describe("Crypto setup", func() {
 		})
 
 		It("generates REJ messages", func() {
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), nil)
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response).To(HavePrefix("REJ"))
 			Expect(response).To(ContainSubstring("initial public"))
@@ -243,7 +305,7 @@ var _ = Describe("Crypto setup", func() {
 		})
 
 		It("REJ messages don't include cert or proof without STK", func() {
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), nil)
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), nil)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response).To(HavePrefix("REJ"))
 			Expect(response).ToNot(ContainSubstring("certcompressed"))
@@ -252,7 +314,7 @@ var _ = Describe("Crypto setup", func() {
 		})
 
 		It("REJ messages include cert and proof with valid STK", func() {
-			response, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
 				TagSTK: validSTK,
 				TagSNI: []byte("foo"),
 			})
@@ -263,8 +325,45 @@ var _ = Describe("Crypto setup", func() {
 			Expect(signer.gotCHLO).To(BeTrue())
 		})
 
+		It("REJ messages include the SCTs, if the client requests them", func() {
+			signer.scts = [][]byte{[]byte("sct1"), []byte("sct2")}
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+				TagSTK:  validSTK,
+				TagSNI:  []byte("foo"),
+				TagCSCT: {},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, msg, err := ParseHandshakeMessage(bytes.NewReader(response))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg).To(HaveKeyWithValue(TagCSCT, writeSCTList(signer.scts)))
+		})
+
+		It("REJ messages don't include SCTs, if the client doesn't request them", func() {
+			signer.scts = [][]byte{[]byte("sct1"), []byte("sct2")}
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+				TagSTK: validSTK,
+				TagSNI: []byte("foo"),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, msg, err := ParseHandshakeMessage(bytes.NewReader(response))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg).ToNot(HaveKey(TagCSCT))
+		})
+
+		It("REJ messages don't include SCTs, if the certificate doesn't have any", func() {
+			response, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+				TagSTK:  validSTK,
+				TagSNI:  []byte("foo"),
+				TagCSCT: {},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, msg, err := ParseHandshakeMessage(bytes.NewReader(response))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg).ToNot(HaveKey(TagCSCT))
+		})
+
 		It("generates SHLO messages", func() {
-			response, err := cs.handleCHLO("", []byte("chlo-data"), map[Tag][]byte{
+			response, err := cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), map[Tag][]byte{
 				TagPUBS: []byte("pubs-c"),
 				TagNONC: nonce32,
 				TagAEAD: aead,
@@ -283,6 +382,19 @@ var _ = Describe("Crypto setup", func() {
 			Expect(cs.forwardSecureAEAD.(*mockAEAD).forwardSecure).To(BeTrue())
 		})
 
+		It("uses the server nonce sent by the client for the initial keys", func() {
+			expectedInitialNonceLen = 32 + len("server nonce")
+			_, err := cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), map[Tag][]byte{
+				TagPUBS: []byte("pubs-c"),
+				TagNONC: nonce32,
+				TagSNO:  []byte("server nonce"),
+				TagAEAD: aead,
+				TagKEXS: kexs,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.secureAEAD).ToNot(BeNil())
+		})
+
 		It("handles long handshake", func() {
 			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, map[Tag][]byte{
 				TagSNI: []byte("quic.clemente.io"),
@@ -296,6 +408,41 @@ var _ = Describe("Crypto setup", func() {
 			Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
 			Expect(stream.dataWritten.Bytes()).To(ContainSubstring("SHLO"))
 			Expect(aeadChanged).To(Receive())
+			Expect(cs.ConnectionState().ZeroRTT).To(BeFalse())
+		})
+
+		Context("server config rotation", func() {
+			var primary *ServerConfig
+
+			BeforeEach(func() {
+				var err error
+				primary, err = NewServerConfig(kex, signer)
+				Expect(err).ToNot(HaveOccurred())
+				primary.stkSource = &mockStkSource{}
+				cs.serverConfigs = &mockServerConfigSource{
+					primary:  primary,
+					accepted: []*ServerConfig{primary, scfg},
+				}
+			})
+
+			It("accepts a CHLO referencing a previous server config", func() {
+				WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+				err := cs.HandleCryptoStream()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stream.dataWritten.Bytes()).To(HavePrefix("SHLO"))
+				Expect(cs.scfg).To(Equal(scfg))
+			})
+
+			It("sends the primary server config in the REJ", func() {
+				cs.serverConfigs.(*mockServerConfigSource).accepted = []*ServerConfig{primary}
+				fullCHLO[TagPAD] = bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize)
+				WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.HandshakeFailed)) // the mock stream doesn't have any more data
+				Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
+				Expect(stream.dataWritten.Bytes()).To(ContainSubstring(string(primary.ID)))
+				Expect(stream.dataWritten.Bytes()).ToNot(ContainSubstring(string(scfg.ID)))
+			})
 		})
 
 		It("rejects client nonces that have the wrong length", func() {
@@ -331,6 +478,89 @@ var _ = Describe("Crypto setup", func() {
 			Expect(encLevel).To(Equal(protocol.EncryptionSecure))
 			Expect(aeadChanged).To(Receive(&encLevel))
 			Expect(encLevel).To(Equal(protocol.EncryptionForwardSecure))
+			Expect(cs.ConnectionState().ZeroRTT).To(BeTrue())
+		})
+
+		It("records the client nonce in the strike register", func() {
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+			err := cs.HandleCryptoStream()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strikeRegister.inserted).To(Equal([][]byte{nonce32}))
+		})
+
+		It("sends a REJ if the strike register rejects the client nonce", func() {
+			strikeRegister.err = errors.New("replayed")
+			fullCHLO[TagPAD] = bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize)
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+			err := cs.HandleCryptoStream()
+			Expect(err).To(MatchError(qerr.HandshakeFailed)) // the mock stream doesn't have any more data
+			Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
+			Expect(stream.dataWritten.Bytes()).ToNot(ContainSubstring("SHLO"))
+			Expect(aeadChanged).ToNot(Receive())
+			Expect(cs.secureAEAD).To(BeNil())
+			Expect(cs.sentREJ).To(BeTrue())
+		})
+
+		It("uses the key exchange algorithm chosen by the client", func() {
+			scfg.kexs = append(scfg.kexs, TagP256)
+			scfg.keyExchanges[TagP256] = &mockKEX{sharedKeyError: errors.New("P256 error")}
+			var ephermalAlgorithm Tag
+			cs.keyExchange = func(algorithm Tag) crypto.KeyExchange {
+				ephermalAlgorithm = algorithm
+				return &mockKEX{ephermal: true}
+			}
+			_, err := cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), fullCHLO)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ephermalAlgorithm).To(Equal(TagC255))
+			fullCHLO[TagKEXS] = []byte("P256")
+			_, err = cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), fullCHLO)
+			Expect(err).To(MatchError("P256 error"))
+		})
+
+		It("errors if the client chooses a key exchange algorithm that is not offered", func() {
+			fullCHLO[TagKEXS] = []byte("P256")
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+			err := cs.HandleCryptoStream()
+			Expect(err).To(MatchError(qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")))
+		})
+
+		It("uses the AEAD chosen by the client", func() {
+			var derivedAEADs []Tag
+			cs.keyDerivation = func(aead Tag, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (crypto.AEAD, error) {
+				derivedAEADs = append(derivedAEADs, aead)
+				return mockKeyDerivation(aead, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+			}
+			scfg.aeads = []Tag{TagAESG, TagCC20}
+			fullCHLO[TagAEAD] = []byte("CC20")
+			_, err := cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), fullCHLO)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(derivedAEADs).To(Equal([]Tag{TagCC20, TagCC20}))
+			Expect(cs.ConnectionState().AEAD).To(Equal("CC20"))
+		})
+
+		It("errors if the client chooses an AEAD that is not offered", func() {
+			scfg.aeads = []Tag{TagAESG}
+			fullCHLO[TagAEAD] = []byte("CC20")
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+			err := cs.HandleCryptoStream()
+			Expect(err).To(MatchError(qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")))
+		})
+
+		It("exposes the negotiated parameters in the ConnectionState", func() {
+			Expect(cs.ConnectionState().HandshakeComplete).To(BeFalse())
+			fullCHLO[TagUAID] = []byte("Chrome/58")
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, fullCHLO)
+			err := cs.HandleCryptoStream()
+			Expect(err).NotTo(HaveOccurred())
+			state := cs.ConnectionState()
+			Expect(state.HandshakeComplete).To(BeTrue())
+			Expect(state.Version).To(Equal(cs.version))
+			Expect(state.AEAD).To(Equal("AESG"))
+			Expect(state.KeyExchange).To(Equal("C255"))
+			Expect(state.ServerName).To(Equal("quic.clemente.io"))
+			Expect(state.ClientUAID).To(Equal("Chrome/58"))
+			Expect(state.PeerCertificates).To(BeNil())
+			Expect(state.TruncatedConnectionID).To(BeFalse())
 		})
 
 		It("recognizes inchoate CHLOs missing SCID", func() {
@@ -369,7 +599,7 @@ var _ = Describe("Crypto setup", func() {
 		})
 
 		It("errors on too short inchoate CHLOs", func() {
-			_, err := cs.handleInchoateCHLO("", bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize-1), nil)
+			_, err := cs.handleInchoateCHLO(&tls.Certificate{}, bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize-1), nil)
 			Expect(err).To(MatchError("CryptoInvalidValueLength: CHLO too small"))
 		})
 
@@ -480,7 +710,7 @@ var _ = Describe("Crypto setup", func() {
 		})
 
 		doCHLO := func() {
-			_, err := cs.handleCHLO("", []byte("chlo-data"), map[Tag][]byte{
+			_, err := cs.handleCHLO("", []byte("certuncompressed"), []byte("chlo-data"), map[Tag][]byte{
 				TagPUBS: []byte("pubs-c"),
 				TagNONC: nonce32,
 				TagAEAD: aead,
@@ -658,6 +888,22 @@ var _ = Describe("Crypto setup", func() {
 			Expect(err).To(BeNil())
 		})
 
+		It("selects the certificate once, and uses it for the whole REJ", func() {
+			_, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+				TagSTK:  validSTK,
+				TagSNI:  []byte("foo"),
+				TagVER:  versionTag,
+				TagCSCT: {},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer.selectedCerts).To(HaveLen(1))
+			// GetLeafCert, SignServerProof, GetCertsCompressed and GetSignedCertificateTimestamps
+			Expect(signer.usedCerts).To(HaveLen(4))
+			for _, cert := range signer.usedCerts {
+				Expect(cert).To(BeIdenticalTo(signer.selectedCerts[0]))
+			}
+		})
+
 		It("errors if IP does not match", func() {
 			done, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
 				TagSNI: []byte("foo"),
@@ -668,5 +914,31 @@ var _ = Describe("Crypto setup", func() {
 			Expect(err).To(BeNil())
 			Expect(stream.dataWritten.Bytes()).To(ContainSubstring(string(validSTK)))
 		})
+
+		It("exposes the RTT carried in the STK, and passes it on in new STKs", func() {
+			stkSource := scfg.stkSource.(*mockStkSource)
+			stkSource.data = crypto.STKData{RTT: 42 * time.Millisecond}
+			_, err := cs.handleMessage(bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize), map[Tag][]byte{
+				TagSTK: validSTK,
+				TagSNI: []byte("foo"),
+				TagVER: versionTag,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cs.ConnectionState().RTTHint).To(Equal(42 * time.Millisecond))
+			Expect(stkSource.newTokenData.RTT).To(Equal(42 * time.Millisecond))
+		})
+
+		It("measures the RTT between sending a REJ and receiving the next CHLO", func() {
+			cs.lastREJSentTime = time.Now().Add(-50 * time.Millisecond)
+			WriteHandshakeMessage(&stream.dataToRead, TagCHLO, map[Tag][]byte{
+				TagSNI: []byte("foo"),
+				TagVER: versionTag,
+				TagPAD: bytes.Repeat([]byte{'a'}, protocol.ClientHelloMinimumSize),
+			})
+			err := cs.HandleCryptoStream()
+			Expect(err).To(MatchError(qerr.HandshakeFailed)) // the mock stream doesn't have any more data
+			Expect(scfg.stkSource.(*mockStkSource).newTokenData.RTT).To(BeNumerically("~", 50*time.Millisecond, 10*time.Millisecond))
+			Expect(cs.ConnectionState().RTTHint).To(BeZero())
+		})
 	})
 })
@@ -9,14 +9,18 @@ import (
 	"github.com/lucas-clemente/quic-go/utils"
 )
 
+type ephermalKEX struct {
+	kex     crypto.KeyExchange
+	created time.Time
+}
+
 var (
-	kexLifetime    = protocol.EphermalKeyLifetime
-	kexCurrent     crypto.KeyExchange
-	kexCurrentTime time.Time
-	kexMutex       sync.RWMutex
+	kexLifetime = protocol.EphermalKeyLifetime
+	kexCurrent  = make(map[Tag]ephermalKEX)
+	kexMutex    sync.RWMutex
 )
 
-// getEphermalKEX returns the currently active KEX, which changes every protocol.EphermalKeyLifetime
+// getEphermalKEX returns the currently active KEX for an algorithm, which changes every protocol.EphermalKeyLifetime
 // See the explanation from the QUIC crypto doc:
 //
 // A single connection is the usual scope for forward security, but the security
@@ -24,27 +28,26 @@ var (
 // used for all connections for 60 seconds is negligible. Thus we can amortise
 // the Diffie-Hellman key generation at the server over all the connections in a
 // small time span.
-func getEphermalKEX() (res crypto.KeyExchange) {
+func getEphermalKEX(algorithm Tag) crypto.KeyExchange {
 	kexMutex.RLock()
-	res = kexCurrent
-	t := kexCurrentTime
+	current := kexCurrent[algorithm]
 	kexMutex.RUnlock()
-	if res != nil && time.Since(t) < kexLifetime {
-		return res
+	if current.kex != nil && time.Since(current.created) < kexLifetime {
+		return current.kex
 	}
 
 	kexMutex.Lock()
 	defer kexMutex.Unlock()
 	// Check if still unfulfilled
-	if kexCurrent == nil || time.Since(kexCurrentTime) > kexLifetime {
-		kex, err := crypto.NewCurve25519KEX()
+	current = kexCurrent[algorithm]
+	if current.kex == nil || time.Since(current.created) > kexLifetime {
+		kex, err := newKeyExchange(algorithm)
 		if err != nil {
 			utils.Errorf("could not set KEX: %s", err.Error())
-			return kexCurrent
+			return current.kex
 		}
-		kexCurrent = kex
-		kexCurrentTime = time.Now()
-		return kexCurrent
+		kexCurrent[algorithm] = ephermalKEX{kex: kex, created: time.Now()}
+		return kex
 	}
-	return kexCurrent
+	return current.kex
 }
@@ -11,20 +11,32 @@ import (
 
 var _ = Describe("Ephermal KEX", func() {
 	It("has a consistent KEX", func() {
-		kex1 := getEphermalKEX()
+		kex1 := getEphermalKEX(TagC255)
 		Expect(kex1).ToNot(BeNil())
-		kex2 := getEphermalKEX()
+		kex2 := getEphermalKEX(TagC255)
 		Expect(kex2).ToNot(BeNil())
 		Expect(kex1).To(Equal(kex2))
 	})
 
+	It("has a KEX for every algorithm", func() {
+		c255 := getEphermalKEX(TagC255)
+		Expect(c255.PublicKey()).To(HaveLen(32))
+		p256 := getEphermalKEX(TagP256)
+		Expect(p256.PublicKey()).To(HaveLen(65))
+		Expect(getEphermalKEX(TagP256)).To(Equal(p256))
+	})
+
+	It("returns nil for unsupported algorithms", func() {
+		Expect(getEphermalKEX(TagSCFG)).To(BeNil())
+	})
+
 	It("changes KEX", func() {
 		kexLifetime = time.Millisecond
 		defer func() {
 			kexLifetime = protocol.EphermalKeyLifetime
 		}()
-		kex := getEphermalKEX()
+		kex := getEphermalKEX(TagC255)
 		Expect(kex).ToNot(BeNil())
-		Eventually(func() crypto.KeyExchange { return getEphermalKEX() }).ShouldNot(Equal(kex))
+		Eventually(func() crypto.KeyExchange { return getEphermalKEX(TagC255) }).ShouldNot(Equal(kex))
 	})
 })
@@ -1,19 +1,63 @@
 package handshake
 
-import "github.com/lucas-clemente/quic-go/protocol"
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/protocol"
+)
 
 // Sealer seals a packet
 type Sealer func(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte
 
+// VerifyPeerCertificateFunc is called by the client after the server's certificate chain and proof were verified
+// rawCerts is the certificate chain presented by the server, verifiedChains are the chains built during verification.
+// verifiedChains is nil if certificate verification is disabled using tls.Config.InsecureSkipVerify.
+// Returning an error aborts the handshake. A *qerr.QuicError is used as is, all other errors are sent as a ProofInvalid error.
+type VerifyPeerCertificateFunc func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
 // CryptoSetup is a crypto setup
 type CryptoSetup interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error)
 	HandleCryptoStream() error
 	HandshakeComplete() bool
+	ConnectionState() ConnectionState
 	// TODO: clean up this interface
 	DiversificationNonce() []byte         // only needed for cryptoSetupServer
 	SetDiversificationNonce([]byte) error // only needed for cryptoSetupClient
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
+	// GetSealerForCryptoStream returns the sealer for packets containing crypto stream data
+	// The crypto stream might have to be sent at a lower encryption level than other data.
+	GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer)
+}
+
+// ConnectionState records basic details about the QUIC connection
+type ConnectionState struct {
+	// HandshakeComplete is true once forward-secure keys have been established
+	HandshakeComplete bool
+	// Version is the QUIC version used
+	Version protocol.VersionNumber
+	// AEAD is the negotiated AEAD, e.g. "AESG"
+	AEAD string
+	// KeyExchange is the negotiated key exchange algorithm, e.g. "C255"
+	KeyExchange string
+	// ServerName is the server name sent by the client (SNI)
+	ServerName string
+	// ClientUAID is the user agent ID sent by the client
+	ClientUAID string
+	// PeerCertificates is the certificate chain presented by the server, starting with the leaf certificate
+	// It is only set for clients, since QUIC crypto doesn't support client certificates
+	PeerCertificates []*x509.Certificate
+	// PeerSCTs are the signed certificate timestamps (RFC 6962) of the leaf certificate presented by the server
+	// It is only set for clients. The SCTs are not authenticated by the handshake, unless a Config.SCTPolicy verified their signatures.
+	PeerSCTs [][]byte
+	// ZeroRTT is true if the handshake completed without a round trip, i.e. the first CHLO was accepted by the server
+	ZeroRTT bool
+	// TruncatedConnectionID is true if the client requested the server to omit the connection ID
+	TruncatedConnectionID bool
+	// RTTHint is the RTT carried in the source address token presented by the client, as measured by the server during a previous handshake
+	// It is only set for servers, and zero if unknown.
+	RTTHint time.Duration
 }
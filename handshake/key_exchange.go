@@ -0,0 +1,88 @@
+package handshake
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/crypto"
+	"github.com/lucas-clemente/quic-go/utils"
+)
+
+// SupportedKeyExchanges are the key exchange algorithms supported by quic-go, in the default order of preference
+var SupportedKeyExchanges = []Tag{TagC255, TagP256}
+
+var (
+	errUnsupportedKeyExchange = errors.New("unsupported key exchange algorithm")
+	errInvalidPublicValues    = errors.New("invalid public values")
+)
+
+// newKeyExchange creates a new key exchange with a random private key
+func newKeyExchange(algorithm Tag) (crypto.KeyExchange, error) {
+	switch algorithm {
+	case TagC255:
+		return crypto.NewCurve25519KEX()
+	case TagP256:
+		return crypto.NewP256KEX()
+	default:
+		return nil, errUnsupportedKeyExchange
+	}
+}
+
+// writeTagList writes a list of tags, as used in the KEXS and AEAD
+func writeTagList(tags []Tag) []byte {
+	b := &bytes.Buffer{}
+	for _, tag := range tags {
+		utils.WriteUint32(b, uint32(tag))
+	}
+	return b.Bytes()
+}
+
+// parseTagList parses a list of tags, as used in the KEXS and AEAD
+func parseTagList(data []byte) ([]Tag, bool) {
+	if len(data)%4 != 0 {
+		return nil, false
+	}
+	tags := make([]Tag, len(data)/4)
+	for i := range tags {
+		tags[i] = Tag(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return tags, true
+}
+
+// containsTag says if a list of tags contains a tag
+func containsTag(tags []Tag, tag Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// writePublicValues writes the public values of a server config
+// Every public value is prefixed by its 24 bit length.
+func writePublicValues(values [][]byte) []byte {
+	b := &bytes.Buffer{}
+	for _, v := range values {
+		utils.WriteUint24(b, uint32(len(v)))
+		b.Write(v)
+	}
+	return b.Bytes()
+}
+
+// parsePublicValues parses the public values of a server config
+func parsePublicValues(data []byte) ([][]byte, error) {
+	var values [][]byte
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		l, err := utils.ReadUintN(r, 3)
+		if err != nil || l == 0 || l > uint64(r.Len()) {
+			return nil, errInvalidPublicValues
+		}
+		v := make([]byte, l)
+		r.Read(v)
+		values = append(values, v)
+	}
+	return values, nil
+}
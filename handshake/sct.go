@@ -0,0 +1,218 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// An SCTPolicy decides if the signed certificate timestamps (RFC 6962) presented by the server are sufficient
+// scts contains one entry per SignedCertificateTimestamp, it is empty if the server didn't send any.
+// leaf is the certificate the SCTs were issued for, and issuer the certificate that signed it. issuer is nil if the server only sent the leaf certificate.
+// Returning an error aborts the handshake. A *qerr.QuicError is used as is, all other errors are sent as a ProofInvalid error.
+//
+// The SCTs are sent in the unencrypted REJ, and they are not covered by the server proof.
+// An attacker on the path can therefore add, remove or modify SCTs. Policies must verify the signatures of the SCTs, as VerifiedSCTs does.
+type SCTPolicy func(scts [][]byte, leaf, issuer *x509.Certificate) error
+
+// VerifiedSCTs returns an SCTPolicy that requires the server to present valid signed certificate timestamps from at least n different logs
+// Only SCTs with a valid signature are counted, so an attacker on the path can't satisfy the policy by adding SCTs.
+// logKeys are the public keys of the trusted logs. SCTs issued by other logs, and SCTs that can't be parsed, are ignored.
+func VerifiedSCTs(n int, logKeys []crypto.PublicKey) (SCTPolicy, error) {
+	logs := make(map[[32]byte]crypto.PublicKey, len(logKeys))
+	for _, key := range logKeys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		// the log ID is the SHA-256 hash of the log's public key, see RFC 6962, section 3.2
+		logs[sha256.Sum256(der)] = key
+	}
+	return func(scts [][]byte, leaf, _ *x509.Certificate) error {
+		if leaf == nil {
+			return errors.New("no certificate to verify the signed certificate timestamps for")
+		}
+		verifiedLogs := make(map[[32]byte]bool)
+		for _, data := range scts {
+			sct, err := ParseSCT(data)
+			if err != nil {
+				continue
+			}
+			key, ok := logs[sct.LogID]
+			if !ok {
+				continue
+			}
+			if err := sct.Verify(key, leaf); err != nil {
+				continue
+			}
+			verifiedLogs[sct.LogID] = true
+		}
+		if len(verifiedLogs) < n {
+			return fmt.Errorf("expected valid signed certificate timestamps from at least %d logs, got %d", n, len(verifiedLogs))
+		}
+		return nil
+	}, nil
+}
+
+const (
+	sctVersionV1                = 0
+	sctSignatureTypeCertificate = 0
+	sctLogEntryTypeX509         = 0
+
+	sctHashAlgorithmSHA256     = 4
+	sctSignatureAlgorithmRSA   = 1
+	sctSignatureAlgorithmECDSA = 3
+
+	// version, log ID, timestamp, length of the extensions, hash and signature algorithm, length of the signature
+	sctMinimumLength = 1 + 32 + 8 + 2 + 2 + 2
+)
+
+var (
+	errInvalidSCTList          = errors.New("invalid signed certificate timestamp list")
+	errInvalidSCT              = errors.New("invalid signed certificate timestamp")
+	errUnsupportedSCTVersion   = errors.New("unsupported signed certificate timestamp version")
+	errUnsupportedSCTSignature = errors.New("unsupported signed certificate timestamp signature algorithm")
+	errInvalidSCTSignature     = errors.New("invalid signed certificate timestamp signature")
+)
+
+// A SignedCertificateTimestamp is a v1 SignedCertificateTimestamp, as defined in RFC 6962, section 3.2
+type SignedCertificateTimestamp struct {
+	// LogID is the SHA-256 hash of the public key of the log
+	LogID [32]byte
+	// Timestamp is the time the SCT was issued, in milliseconds since the epoch
+	Timestamp  uint64
+	Extensions []byte
+
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// ParseSCT parses a v1 SignedCertificateTimestamp
+func ParseSCT(data []byte) (*SignedCertificateTimestamp, error) {
+	if len(data) < sctMinimumLength {
+		return nil, errInvalidSCT
+	}
+	if data[0] != sctVersionV1 {
+		return nil, errUnsupportedSCTVersion
+	}
+	data = data[1:]
+	sct := &SignedCertificateTimestamp{}
+	copy(sct.LogID[:], data)
+	sct.Timestamp = binary.BigEndian.Uint64(data[32:])
+	data = data[32+8:]
+
+	extLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < extLen+2+2 {
+		return nil, errInvalidSCT
+	}
+	sct.Extensions = data[:extLen]
+	data = data[extLen:]
+
+	sct.HashAlgorithm = data[0]
+	sct.SignatureAlgorithm = data[1]
+	sigLen := int(binary.BigEndian.Uint16(data[2:]))
+	data = data[4:]
+	if len(data) != sigLen {
+		return nil, errInvalidSCT
+	}
+	sct.Signature = data
+	return sct, nil
+}
+
+// Verify verifies the signature of an SCT that was issued for cert, using the public key of the log
+// Only SCTs for X.509 certificates are supported, as they are sent in the TLS extension or in the CSCT tag.
+// SCTs embedded in the certificate are issued for the precertificate, and can't be verified this way.
+func (sct *SignedCertificateTimestamp) Verify(logKey crypto.PublicKey, cert *x509.Certificate) error {
+	if sct.HashAlgorithm != sctHashAlgorithmSHA256 {
+		return errUnsupportedSCTSignature
+	}
+	hash := sha256.Sum256(sct.signedData(cert))
+
+	switch key := logKey.(type) {
+	case *ecdsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSignatureAlgorithmECDSA {
+			return errUnsupportedSCTSignature
+		}
+		var sig struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(sct.Signature, &sig)
+		if err != nil || len(rest) != 0 {
+			return errInvalidSCTSignature
+		}
+		if !ecdsa.Verify(key, hash[:], sig.R, sig.S) {
+			return errInvalidSCTSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if sct.SignatureAlgorithm != sctSignatureAlgorithmRSA {
+			return errUnsupportedSCTSignature
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sct.Signature); err != nil {
+			return errInvalidSCTSignature
+		}
+		return nil
+	default:
+		return errUnsupportedSCTSignature
+	}
+}
+
+// signedData returns the data covered by the signature of the SCT, see RFC 6962, section 3.2
+func (sct *SignedCertificateTimestamp) signedData(cert *x509.Certificate) []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(sctVersionV1)
+	b.WriteByte(sctSignatureTypeCertificate)
+	binary.Write(b, binary.BigEndian, sct.Timestamp)
+	binary.Write(b, binary.BigEndian, uint16(sctLogEntryTypeX509))
+	// the certificate is prefixed by its 24 bit big endian length
+	b.Write([]byte{byte(len(cert.Raw) >> 16), byte(len(cert.Raw) >> 8), byte(len(cert.Raw))})
+	b.Write(cert.Raw)
+	binary.Write(b, binary.BigEndian, uint16(len(sct.Extensions)))
+	b.Write(sct.Extensions)
+	return b.Bytes()
+}
+
+// writeSCTList writes a SignedCertificateTimestampList, as defined in RFC 6962, section 3.3
+// Both the list and every SCT are prefixed by their 16 bit big endian length.
+func writeSCTList(scts [][]byte) []byte {
+	var length int
+	for _, sct := range scts {
+		length += 2 + len(sct)
+	}
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.BigEndian, uint16(length))
+	for _, sct := range scts {
+		binary.Write(b, binary.BigEndian, uint16(len(sct)))
+		b.Write(sct)
+	}
+	return b.Bytes()
+}
+
+// parseSCTList parses a SignedCertificateTimestampList, as defined in RFC 6962, section 3.3
+func parseSCTList(data []byte) ([][]byte, error) {
+	if len(data) < 2 || int(binary.BigEndian.Uint16(data)) != len(data)-2 {
+		return nil, errInvalidSCTList
+	}
+	data = data[2:]
+	var scts [][]byte
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errInvalidSCTList
+		}
+		l := int(binary.BigEndian.Uint16(data))
+		if l == 0 || l > len(data)-2 {
+			return nil, errInvalidSCTList
+		}
+		scts = append(scts, data[2:2+l])
+		data = data[2+l:]
+	}
+	return scts, nil
+}
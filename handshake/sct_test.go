@@ -0,0 +1,227 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/lucas-clemente/quic-go/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// signSCT creates an SCT for cert, signed by the log key
+func signSCT(logKey crypto.Signer, cert *x509.Certificate, timestamp uint64) []byte {
+	der, err := x509.MarshalPKIXPublicKey(logKey.Public())
+	Expect(err).ToNot(HaveOccurred())
+	sct := &SignedCertificateTimestamp{
+		LogID:         sha256.Sum256(der),
+		Timestamp:     timestamp,
+		HashAlgorithm: sctHashAlgorithmSHA256,
+	}
+	switch logKey.(type) {
+	case *ecdsa.PrivateKey:
+		sct.SignatureAlgorithm = sctSignatureAlgorithmECDSA
+	case *rsa.PrivateKey:
+		sct.SignatureAlgorithm = sctSignatureAlgorithmRSA
+	}
+	hash := sha256.Sum256(sct.signedData(cert))
+	sct.Signature, err = logKey.Sign(rand.Reader, hash[:], crypto.SHA256)
+	Expect(err).ToNot(HaveOccurred())
+
+	b := &bytes.Buffer{}
+	b.WriteByte(sctVersionV1)
+	b.Write(sct.LogID[:])
+	binary.Write(b, binary.BigEndian, sct.Timestamp)
+	binary.Write(b, binary.BigEndian, uint16(0)) // extensions
+	b.WriteByte(sct.HashAlgorithm)
+	b.WriteByte(sct.SignatureAlgorithm)
+	binary.Write(b, binary.BigEndian, uint16(len(sct.Signature)))
+	b.Write(sct.Signature)
+	return b.Bytes()
+}
+
+var _ = Describe("Signed certificate timestamps", func() {
+	var (
+		cert   *x509.Certificate
+		logKey *ecdsa.PrivateKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		cert, err = x509.ParseCertificate(testdata.GetCertificate().Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		logKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("SCT lists", func() {
+		It("writes an SCT list", func() {
+			data := writeSCTList([][]byte{[]byte("foo"), []byte("foobar")})
+			Expect(data).To(Equal([]byte{
+				0x0, 0xd, // length of the list
+				0x0, 0x3, 'f', 'o', 'o',
+				0x0, 0x6, 'f', 'o', 'o', 'b', 'a', 'r',
+			}))
+		})
+
+		It("parses an SCT list", func() {
+			scts, err := parseSCTList(writeSCTList([][]byte{[]byte("foo"), []byte("foobar")}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scts).To(Equal([][]byte{[]byte("foo"), []byte("foobar")}))
+		})
+
+		It("errors if the length of the list is wrong", func() {
+			data := writeSCTList([][]byte{[]byte("foo")})
+			_, err := parseSCTList(data[:len(data)-1])
+			Expect(err).To(MatchError(errInvalidSCTList))
+			_, err = parseSCTList(append(data, 0))
+			Expect(err).To(MatchError(errInvalidSCTList))
+			_, err = parseSCTList([]byte{0})
+			Expect(err).To(MatchError(errInvalidSCTList))
+		})
+
+		It("errors if the length of an SCT is wrong", func() {
+			_, err := parseSCTList([]byte{0x0, 0x4, 0x0, 0x3, 'f', 'o'})
+			Expect(err).To(MatchError(errInvalidSCTList))
+		})
+
+		It("errors on empty SCTs", func() {
+			_, err := parseSCTList([]byte{0x0, 0x2, 0x0, 0x0})
+			Expect(err).To(MatchError(errInvalidSCTList))
+		})
+	})
+
+	Context("parsing SCTs", func() {
+		It("parses an SCT", func() {
+			data := signSCT(logKey, cert, 1337)
+			sct, err := ParseSCT(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sct.Timestamp).To(Equal(uint64(1337)))
+			Expect(sct.HashAlgorithm).To(Equal(uint8(sctHashAlgorithmSHA256)))
+			Expect(sct.SignatureAlgorithm).To(Equal(uint8(sctSignatureAlgorithmECDSA)))
+			Expect(sct.Extensions).To(BeEmpty())
+			Expect(sct.Signature).ToNot(BeEmpty())
+		})
+
+		It("errors on unsupported versions", func() {
+			data := signSCT(logKey, cert, 1337)
+			data[0] = 1
+			_, err := ParseSCT(data)
+			Expect(err).To(MatchError(errUnsupportedSCTVersion))
+		})
+
+		It("errors if the SCT is too short", func() {
+			data := signSCT(logKey, cert, 1337)
+			for i := 0; i < len(data); i++ {
+				_, err := ParseSCT(data[:i])
+				Expect(err).To(MatchError(errInvalidSCT))
+			}
+		})
+
+		It("errors if there's data after the signature", func() {
+			_, err := ParseSCT(append(signSCT(logKey, cert, 1337), 0))
+			Expect(err).To(MatchError(errInvalidSCT))
+		})
+	})
+
+	Context("verifying SCTs", func() {
+		It("verifies an SCT signed with ECDSA", func() {
+			sct, err := ParseSCT(signSCT(logKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sct.Verify(logKey.Public(), cert)).To(Succeed())
+		})
+
+		It("verifies an SCT signed with RSA", func() {
+			rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			sct, err := ParseSCT(signSCT(rsaKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sct.Verify(rsaKey.Public(), cert)).To(Succeed())
+		})
+
+		It("rejects an SCT that was modified", func() {
+			sct, err := ParseSCT(signSCT(logKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			sct.Timestamp++
+			Expect(sct.Verify(logKey.Public(), cert)).To(MatchError(errInvalidSCTSignature))
+		})
+
+		It("rejects an SCT issued for a different certificate", func() {
+			sct, err := ParseSCT(signSCT(logKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sct.Verify(logKey.Public(), &x509.Certificate{Raw: []byte("foobar")})).To(MatchError(errInvalidSCTSignature))
+		})
+
+		It("rejects an SCT signed by a different log", func() {
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			sct, err := ParseSCT(signSCT(logKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sct.Verify(otherKey.Public(), cert)).To(MatchError(errInvalidSCTSignature))
+		})
+
+		It("rejects unsupported hash algorithms", func() {
+			sct, err := ParseSCT(signSCT(logKey, cert, 1337))
+			Expect(err).ToNot(HaveOccurred())
+			sct.HashAlgorithm = 2 // SHA-1
+			Expect(sct.Verify(logKey.Public(), cert)).To(MatchError(errUnsupportedSCTSignature))
+		})
+	})
+
+	Context("verified SCTs policy", func() {
+		var otherLogKey *ecdsa.PrivateKey
+
+		BeforeEach(func() {
+			var err error
+			otherLogKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts valid SCTs from enough logs", func() {
+			policy, err := VerifiedSCTs(2, []crypto.PublicKey{logKey.Public(), otherLogKey.Public()})
+			Expect(err).ToNot(HaveOccurred())
+			scts := [][]byte{signSCT(logKey, cert, 1), signSCT(otherLogKey, cert, 2)}
+			Expect(policy(scts, cert, nil)).To(Succeed())
+		})
+
+		It("only counts one SCT per log", func() {
+			policy, err := VerifiedSCTs(2, []crypto.PublicKey{logKey.Public(), otherLogKey.Public()})
+			Expect(err).ToNot(HaveOccurred())
+			scts := [][]byte{signSCT(logKey, cert, 1), signSCT(logKey, cert, 2)}
+			Expect(policy(scts, cert, nil)).To(MatchError("expected valid signed certificate timestamps from at least 2 logs, got 1"))
+		})
+
+		It("ignores SCTs from unknown logs", func() {
+			policy, err := VerifiedSCTs(1, []crypto.PublicKey{logKey.Public()})
+			Expect(err).ToNot(HaveOccurred())
+			scts := [][]byte{signSCT(otherLogKey, cert, 1)}
+			Expect(policy(scts, cert, nil)).To(MatchError("expected valid signed certificate timestamps from at least 1 logs, got 0"))
+		})
+
+		It("ignores invalid SCTs", func() {
+			policy, err := VerifiedSCTs(1, []crypto.PublicKey{logKey.Public()})
+			Expect(err).ToNot(HaveOccurred())
+			scts := [][]byte{[]byte("padding"), signSCT(logKey, &x509.Certificate{Raw: []byte("foobar")}, 1)}
+			Expect(policy(scts, cert, nil)).To(MatchError("expected valid signed certificate timestamps from at least 1 logs, got 0"))
+		})
+
+		It("rejects the SCTs if there's no certificate", func() {
+			policy, err := VerifiedSCTs(1, []crypto.PublicKey{logKey.Public()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(policy([][]byte{signSCT(logKey, cert, 1)}, nil, nil)).To(MatchError("no certificate to verify the signed certificate timestamps for"))
+		})
+
+		It("errors on invalid log keys", func() {
+			_, err := VerifiedSCTs(1, []crypto.PublicKey{"foobar"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
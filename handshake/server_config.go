@@ -3,20 +3,166 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/crypto"
 )
 
 // ServerConfig is a server config
 type ServerConfig struct {
-	kex       crypto.KeyExchange
-	certChain crypto.CertChain
-	ID        []byte
-	obit      []byte
-	stkSource crypto.StkSource
+	kexs         []Tag // the key exchange algorithms, in the order they are advertised in the KEXS
+	keyExchanges map[Tag]crypto.KeyExchange
+	aeads        []Tag // the AEADs, in the order they are advertised in the AEAD
+	certChain    crypto.CertChain
+	ID           []byte
+	obit         []byte
+	expiry       time.Time // the zero value means that the server config never expires
+	stkSource    crypto.StkSource
 }
 
-// NewServerConfig creates a new server config
+// ServerConfigSource provides the server configs used by the server's crypto setup
+type ServerConfigSource interface {
+	// GetPrimary returns the server config sent to clients in a REJ
+	GetPrimary() *ServerConfig
+	// Lookup returns the server config with the given ID, if it is still accepted
+	// It returns nil if no such server config exists.
+	Lookup(id []byte) *ServerConfig
+}
+
+var _ ServerConfigSource = &ServerConfig{}
+
+// ServerConfigKeys contains the key material of a server config
+// Servers using the same keys present the same server config, and accept each other's source address tokens.
+type ServerConfigKeys struct {
+	// ID is the server config ID (SCID)
+	ID []byte
+	// Obit is the orbit value (OBIT)
+	Obit []byte
+	// KeyExchangeKey is the Curve25519 private key
+	KeyExchangeKey []byte
+	// P256KeyExchangeKey is the P-256 private key
+	// If it is empty, the server config only offers Curve25519.
+	P256KeyExchangeKey []byte
+	// STKSecret is the secret used to create and verify source address tokens
+	// It is not needed if a StkSource is used.
+	STKSecret []byte
+	// Expiry is the time when the server config expires (EXPY)
+	// If this value is zero, the server config never expires.
+	Expiry time.Time
+}
+
+var (
+	errInvalidServerConfigKeys = errors.New("invalid server config keys")
+	errNoSTKSecret             = errors.New("server config keys don't contain an STK secret")
+)
+
+// GenerateServerConfigKeys generates new random keys for a server config
+func GenerateServerConfigKeys() (*ServerConfigKeys, error) {
+	keys := &ServerConfigKeys{
+		ID:             make([]byte, 16),
+		Obit:           make([]byte, 8),
+		KeyExchangeKey: make([]byte, 32),
+		STKSecret:      make([]byte, 32),
+	}
+	for _, b := range [][]byte{keys.ID, keys.Obit, keys.KeyExchangeKey, keys.STKSecret} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	keys.P256KeyExchangeKey, err = crypto.GenerateP256PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ParseServerConfigKeys parses keys serialized by ServerConfigKeys.Marshal
+func ParseServerConfigKeys(data []byte) (*ServerConfigKeys, error) {
+	keys := &ServerConfigKeys{}
+	if err := json.Unmarshal(data, keys); err != nil {
+		return nil, err
+	}
+	if err := keys.validate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Marshal serializes the keys
+// The result contains secret key material and has to be stored accordingly.
+func (k *ServerConfigKeys) Marshal() ([]byte, error) {
+	return json.Marshal(k)
+}
+
+func (k *ServerConfigKeys) validate() error {
+	if len(k.ID) != 16 || len(k.Obit) != 8 || len(k.KeyExchangeKey) != 32 {
+		return errInvalidServerConfigKeys
+	}
+	if len(k.P256KeyExchangeKey) != 0 && len(k.P256KeyExchangeKey) != 32 {
+		return errInvalidServerConfigKeys
+	}
+	return nil
+}
+
+// NewServerConfigFromKeys creates a new server config using the given keys
+// If stkSource is nil, source address tokens are created and verified using the STK secret of the keys.
+// The AEADs are advertised in the given order. If aeads is empty, the order of preference depends on the CPU's AES hardware support.
+func NewServerConfigFromKeys(keys *ServerConfigKeys, stkSource crypto.StkSource, certChain crypto.CertChain, aeads []Tag) (*ServerConfig, error) {
+	if err := keys.validate(); err != nil {
+		return nil, err
+	}
+	aeads, err := checkAEADs(aeads)
+	if err != nil {
+		return nil, err
+	}
+
+	c255, err := crypto.NewCurve25519KEXFromPrivateKey(keys.KeyExchangeKey)
+	if err != nil {
+		return nil, err
+	}
+	kexs := []Tag{TagC255}
+	keyExchanges := map[Tag]crypto.KeyExchange{TagC255: c255}
+	if len(keys.P256KeyExchangeKey) > 0 {
+		p256, err := crypto.NewP256KEXFromPrivateKey(keys.P256KeyExchangeKey)
+		if err != nil {
+			return nil, err
+		}
+		kexs = append(kexs, TagP256)
+		keyExchanges[TagP256] = p256
+	}
+
+	if stkSource == nil {
+		stkSource, err = newStkSourceFromKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ServerConfig{
+		kexs:         kexs,
+		keyExchanges: keyExchanges,
+		aeads:        aeads,
+		certChain:    certChain,
+		ID:           keys.ID,
+		obit:         keys.Obit,
+		expiry:       keys.Expiry,
+		stkSource:    stkSource,
+	}, nil
+}
+
+func newStkSourceFromKeys(keys *ServerConfigKeys) (crypto.StkSource, error) {
+	if len(keys.STKSecret) == 0 {
+		return nil, errNoSTKSecret
+	}
+	return crypto.NewStkSource(keys.STKSecret)
+}
+
+// NewServerConfig creates a new server config, offering a Curve25519 key exchange
 func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*ServerConfig, error) {
 	id := make([]byte, 16)
 	_, err := rand.Read(id)
@@ -40,34 +186,79 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 	}
 
 	return &ServerConfig{
-		kex:       kex,
-		certChain: certChain,
-		ID:        id,
-		obit:      obit,
-		stkSource: stkSource,
+		kexs:         []Tag{TagC255},
+		keyExchanges: map[Tag]crypto.KeyExchange{TagC255: kex},
+		aeads:        preferredAEADs(),
+		certChain:    certChain,
+		ID:           id,
+		obit:         obit,
+		stkSource:    stkSource,
 	}, nil
 }
 
 // Get the server config binary representation
 func (s *ServerConfig) Get() []byte {
+	expy := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if !s.expiry.IsZero() {
+		binary.LittleEndian.PutUint64(expy, uint64(s.expiry.Unix()))
+	}
+
+	pubs := make([][]byte, len(s.kexs))
+	for i, kex := range s.kexs {
+		pubs[i] = s.keyExchanges[kex].PublicKey()
+	}
+
 	var serverConfig bytes.Buffer
 	WriteHandshakeMessage(&serverConfig, TagSCFG, map[Tag][]byte{
 		TagSCID: s.ID,
-		TagKEXS: []byte("C255"),
-		TagAEAD: []byte("AESG"),
-		TagPUBS: append([]byte{0x20, 0x00, 0x00}, s.kex.PublicKey()...),
+		TagKEXS: writeTagList(s.kexs),
+		TagAEAD: writeTagList(s.aeads),
+		TagPUBS: writePublicValues(pubs),
 		TagOBIT: s.obit,
-		TagEXPY: {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		TagEXPY: expy,
 	})
 	return serverConfig.Bytes()
 }
 
+// GetPrimary returns the server config itself
+func (s *ServerConfig) GetPrimary() *ServerConfig {
+	return s
+}
+
+// Lookup returns the server config if the ID matches and it isn't expired
+func (s *ServerConfig) Lookup(id []byte) *ServerConfig {
+	if !bytes.Equal(s.ID, id) || s.isExpired(time.Now()) {
+		return nil
+	}
+	return s
+}
+
+func (s *ServerConfig) isExpired(now time.Time) bool {
+	return !s.expiry.IsZero() && !now.Before(s.expiry)
+}
+
+// GetCertificate selects the certificate for the SNI
+// It must be called once per handshake message, and the certificate passed to the other methods.
+func (s *ServerConfig) GetCertificate(sni string) (*tls.Certificate, error) {
+	return s.certChain.GetCertificate(sni)
+}
+
 // Sign the server config and CHLO with the server's keyData
-func (s *ServerConfig) Sign(sni string, chlo []byte) ([]byte, error) {
-	return s.certChain.SignServerProof(sni, chlo, s.Get())
+func (s *ServerConfig) Sign(cert *tls.Certificate, chlo []byte) ([]byte, error) {
+	return s.certChain.SignServerProof(cert, chlo, s.Get())
 }
 
 // GetCertsCompressed returns the certificate data
-func (s *ServerConfig) GetCertsCompressed(sni string, commonSetHashes, compressedHashes []byte) ([]byte, error) {
-	return s.certChain.GetCertsCompressed(sni, commonSetHashes, compressedHashes)
+func (s *ServerConfig) GetCertsCompressed(cert *tls.Certificate, commonSetHashes, compressedHashes []byte) ([]byte, error) {
+	return s.certChain.GetCertsCompressed(cert, commonSetHashes, compressedHashes)
+}
+
+// GetLeafCert returns the leaf certificate
+func (s *ServerConfig) GetLeafCert(cert *tls.Certificate) ([]byte, error) {
+	return s.certChain.GetLeafCert(cert)
+}
+
+// GetSignedCertificateTimestamps returns the signed certificate timestamps of the leaf certificate
+func (s *ServerConfig) GetSignedCertificateTimestamps(cert *tls.Certificate) [][]byte {
+	return s.certChain.GetSignedCertificateTimestamps(cert)
 }
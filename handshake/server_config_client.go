@@ -18,6 +18,12 @@ type serverConfigClient struct {
 	obit   []byte
 	expiry time.Time
 
+	kexs         []Tag    // the key exchange algorithms offered by the server
+	publicValues [][]byte // the server's public value for every offered algorithm
+	aeads        []Tag    // the AEADs offered by the server, in the server's order of preference
+
+	aead         Tag // the AEAD chosen by the client
+	kexAlgorithm Tag // the key exchange algorithm chosen by the client
 	kex          crypto.KeyExchange
 	sharedSecret []byte
 }
@@ -57,59 +63,46 @@ func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
 	s.ID = scfgID
 
 	// KEXS
-	// TODO: allow for P256 in the list
-	// TODO: setup Key Exchange
 	kexs, ok := tagMap[TagKEXS]
 	if !ok {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "KEXS")
 	}
-	if len(kexs)%4 != 0 {
+	s.kexs, ok = parseTagList(kexs)
+	if !ok || len(s.kexs) == 0 {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "KEXS")
 	}
-	if !bytes.Equal(kexs, []byte("C255")) {
-		return qerr.Error(qerr.CryptoNoSupport, "KEXS")
-	}
 
 	// AEAD
 	aead, ok := tagMap[TagAEAD]
 	if !ok {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "AEAD")
 	}
-	if len(aead)%4 != 0 {
+	s.aeads, ok = parseTagList(aead)
+	if !ok {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "AEAD")
 	}
-	var aesgFound bool
-	for i := 0; i < len(aead)/4; i++ {
-		if bytes.Equal(aead[4*i:4*i+4], []byte("AESG")) {
-			aesgFound = true
+	var aeadFound bool
+	for _, a := range s.aeads {
+		if containsTag(SupportedAEADs, a) {
+			aeadFound = true
 			break
 		}
 	}
-	if !aesgFound {
+	if !aeadFound {
 		return qerr.Error(qerr.CryptoNoSupport, "AEAD")
 	}
 
 	// PUBS
-	// TODO: save this value
+	// it contains one public value for every algorithm in the KEXS
 	pubs, ok := tagMap[TagPUBS]
 	if !ok {
 		return qerr.Error(qerr.CryptoMessageParameterNotFound, "PUBS")
 	}
-	if len(pubs) != 35 {
+	publicValues, err := parsePublicValues(pubs)
+	if err != nil || len(publicValues) != len(s.kexs) {
 		return qerr.Error(qerr.CryptoInvalidValueLength, "PUBS")
 	}
-
-	var err error
-	s.kex, err = crypto.NewCurve25519KEX()
-	if err != nil {
-		return err
-	}
-
-	// the PUBS value is always prepended by []byte{0x20, 0x00, 0x00}
-	s.sharedSecret, err = s.kex.CalculateSharedKey(pubs[3:])
-	if err != nil {
-		return err
-	}
+	s.publicValues = publicValues
 
 	// OBIT
 	obit, ok := tagMap[TagOBIT]
@@ -139,6 +132,45 @@ func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
 	return nil
 }
 
+// setupKeyExchange chooses the first of the preferred key exchange algorithms that is offered by the server, and calculates the shared secret
+func (s *serverConfigClient) setupKeyExchange(preferences []Tag) error {
+	for _, algorithm := range preferences {
+		for i, offered := range s.kexs {
+			if algorithm != offered {
+				continue
+			}
+			kex, err := newKeyExchange(algorithm)
+			if err == errUnsupportedKeyExchange {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			sharedSecret, err := kex.CalculateSharedKey(s.publicValues[i])
+			if err != nil {
+				return err
+			}
+			s.kexAlgorithm = algorithm
+			s.kex = kex
+			s.sharedSecret = sharedSecret
+			return nil
+		}
+	}
+	return qerr.Error(qerr.CryptoNoSupport, "KEXS")
+}
+
+// setupAEAD chooses the first AEAD offered by the server that is also contained in supported
+// The server's order of preference is used, since the server knows which AEAD it can run most efficiently.
+func (s *serverConfigClient) setupAEAD(supported []Tag) error {
+	for _, aead := range s.aeads {
+		if containsTag(supported, aead) && containsTag(SupportedAEADs, aead) {
+			s.aead = aead
+			return nil
+		}
+	}
+	return qerr.Error(qerr.CryptoNoSupport, "AEAD")
+}
+
 func (s *serverConfigClient) IsExpired() bool {
 	return s.expiry.Before(time.Now())
 }
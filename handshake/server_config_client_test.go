@@ -15,7 +15,7 @@ func getDefaultServerConfigClient() map[Tag][]byte {
 		TagSCID: bytes.Repeat([]byte{'F'}, 16),
 		TagKEXS: []byte("C255"),
 		TagAEAD: []byte("AESG"),
-		TagPUBS: bytes.Repeat([]byte{0}, 35),
+		TagPUBS: append([]byte{0x20, 0x00, 0x00}, bytes.Repeat([]byte{0}, 32)...),
 		TagOBIT: bytes.Repeat([]byte{0}, 8),
 		TagEXPY: []byte{0x0, 0x6c, 0x57, 0x78, 0, 0, 0, 0}, // 2033-12-24
 	}
@@ -121,10 +121,19 @@ var _ = Describe("Server Config", func() {
 				Expect(err).To(MatchError("CryptoInvalidValueLength: KEXS"))
 			})
 
-			It("rejects KEXS values other than C255", func() {
-				tagMap[TagKEXS] = []byte("P256")
+			It("rejects empty KEXS values", func() {
+				tagMap[TagKEXS] = []byte{}
 				err := scfg.parseValues(tagMap)
-				Expect(err).To(MatchError("CryptoNoSupport: KEXS"))
+				Expect(err).To(MatchError("CryptoInvalidValueLength: KEXS"))
+			})
+
+			It("parses multiple key exchange algorithms", func() {
+				tagMap[TagKEXS] = []byte("C255P256")
+				tagMap[TagPUBS] = writePublicValues([][]byte{[]byte("c255"), []byte("p256")})
+				err := scfg.parseValues(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.kexs).To(Equal([]Tag{TagC255, TagP256}))
+				Expect(scfg.publicValues).To(Equal([][]byte{[]byte("c255"), []byte("p256")}))
 			})
 
 			It("errors if the KEXS is missing", func() {
@@ -141,7 +150,7 @@ var _ = Describe("Server Config", func() {
 				Expect(err).To(MatchError("CryptoInvalidValueLength: AEAD"))
 			})
 
-			It("rejects AEAD values other than AESG", func() {
+			It("rejects AEAD values without a supported AEAD", func() {
 				tagMap[TagAEAD] = []byte("S20P")
 				err := scfg.parseValues(tagMap)
 				Expect(err).To(MatchError("CryptoNoSupport: AEAD"))
@@ -159,6 +168,13 @@ var _ = Describe("Server Config", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("recognizes CC20 in the list of AEADs", func() {
+				tagMap[TagAEAD] = []byte("S20PCC20")
+				err := scfg.parseValues(tagMap)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.aeads).To(Equal([]Tag{Tag(0x50303253), TagCC20}))
+			})
+
 			It("errors if the AEAD is missing", func() {
 				delete(tagMap, TagAEAD)
 				err := scfg.parseValues(tagMap)
@@ -173,6 +189,9 @@ var _ = Describe("Server Config", func() {
 				tagMap[TagPUBS] = append([]byte{0x20, 0x00, 0x00}, serverKex.PublicKey()...)
 				err = scfg.parseValues(tagMap)
 				Expect(err).ToNot(HaveOccurred())
+				err = scfg.setupKeyExchange(SupportedKeyExchanges)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(scfg.kexAlgorithm).To(Equal(TagC255))
 				sharedSecret, err := serverKex.CalculateSharedKey(scfg.kex.PublicKey())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(scfg.sharedSecret).To(Equal(sharedSecret))
@@ -184,6 +203,12 @@ var _ = Describe("Server Config", func() {
 				Expect(err).To(MatchError("CryptoInvalidValueLength: PUBS"))
 			})
 
+			It("rejects PUBS values that don't contain a public value for every KEXS", func() {
+				tagMap[TagKEXS] = []byte("C255P256")
+				err := scfg.parseValues(tagMap)
+				Expect(err).To(MatchError("CryptoInvalidValueLength: PUBS"))
+			})
+
 			It("errors if the PUBS is missing", func() {
 				delete(tagMap, TagPUBS)
 				err := scfg.parseValues(tagMap)
@@ -244,4 +269,93 @@ var _ = Describe("Server Config", func() {
 			})
 		})
 	})
+
+	Context("choosing the key exchange", func() {
+		var (
+			scfg                   *serverConfigClient
+			serverC255, serverP256 crypto.KeyExchange
+		)
+
+		BeforeEach(func() {
+			var err error
+			serverC255, err = crypto.NewCurve25519KEX()
+			Expect(err).ToNot(HaveOccurred())
+			serverP256, err = crypto.NewP256KEX()
+			Expect(err).ToNot(HaveOccurred())
+			scfg = &serverConfigClient{
+				kexs:         []Tag{TagC255, TagP256},
+				publicValues: [][]byte{serverC255.PublicKey(), serverP256.PublicKey()},
+			}
+		})
+
+		It("uses the first preferred algorithm offered by the server", func() {
+			err := scfg.setupKeyExchange([]Tag{TagP256, TagC255})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.kexAlgorithm).To(Equal(TagP256))
+			sharedSecret, err := serverP256.CalculateSharedKey(scfg.kex.PublicKey())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.sharedSecret).To(Equal(sharedSecret))
+		})
+
+		It("skips algorithms that are not offered by the server", func() {
+			scfg.kexs = scfg.kexs[:1]
+			scfg.publicValues = scfg.publicValues[:1]
+			err := scfg.setupKeyExchange([]Tag{TagP256, TagC255})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.kexAlgorithm).To(Equal(TagC255))
+		})
+
+		It("skips algorithms that are not supported", func() {
+			scfg.kexs[1] = TagSCFG
+			err := scfg.setupKeyExchange([]Tag{TagSCFG, TagC255})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.kexAlgorithm).To(Equal(TagC255))
+		})
+
+		It("errors if no preferred algorithm is offered by the server", func() {
+			scfg.kexs = scfg.kexs[1:]
+			scfg.publicValues = scfg.publicValues[1:]
+			err := scfg.setupKeyExchange([]Tag{TagC255})
+			Expect(err).To(MatchError("CryptoNoSupport: KEXS"))
+		})
+
+		It("errors if the public value is invalid", func() {
+			scfg.publicValues[1] = []byte("invalid")
+			err := scfg.setupKeyExchange([]Tag{TagP256})
+			Expect(err).To(MatchError("P256: invalid public key"))
+		})
+	})
+
+	Context("choosing the AEAD", func() {
+		var scfg *serverConfigClient
+
+		BeforeEach(func() {
+			scfg = &serverConfigClient{aeads: []Tag{TagCC20, TagAESG}}
+		})
+
+		It("uses the first AEAD offered by the server", func() {
+			err := scfg.setupAEAD([]Tag{TagAESG, TagCC20})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.aead).To(Equal(TagCC20))
+		})
+
+		It("skips AEADs that the client doesn't accept", func() {
+			err := scfg.setupAEAD([]Tag{TagAESG})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.aead).To(Equal(TagAESG))
+		})
+
+		It("skips AEADs that are not supported", func() {
+			scfg.aeads = []Tag{TagSCFG, TagAESG}
+			err := scfg.setupAEAD([]Tag{TagSCFG, TagAESG})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.aead).To(Equal(TagAESG))
+		})
+
+		It("errors if no accepted AEAD is offered by the server", func() {
+			scfg.aeads = []Tag{TagAESG}
+			err := scfg.setupAEAD([]Tag{TagCC20})
+			Expect(err).To(MatchError("CryptoNoSupport: AEAD"))
+		})
+	})
 })
@@ -0,0 +1,122 @@
+package handshake
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/crypto"
+	"github.com/lucas-clemente/quic-go/utils"
+)
+
+// ServerConfigRotator is a ServerConfigSource that periodically replaces the primary server config
+// A new server config with a new ID, OBIT and key exchange key is generated every rotation interval.
+// The previous server configs are still accepted until they expire, which is one grace period after they were replaced.
+// Source address tokens remain valid across rotations.
+type ServerConfigRotator struct {
+	mutex sync.Mutex
+
+	certChain   crypto.CertChain
+	stkSource   crypto.StkSource
+	aeads       []Tag
+	interval    time.Duration
+	gracePeriod time.Duration
+
+	primary  *ServerConfig
+	rotateAt time.Time
+	previous []*ServerConfig
+}
+
+var _ ServerConfigSource = &ServerConfigRotator{}
+
+var errInvalidRotationInterval = errors.New("the server config rotation interval must be positive")
+
+// NewServerConfigRotator creates a new ServerConfigRotator
+// The first server config uses the given keys. Their expiry is replaced according to interval and gracePeriod.
+// All following server configs use randomly generated keys. Servers sharing the same keys therefore shouldn't use a ServerConfigRotator.
+// If stkSource is nil, source address tokens are created and verified using the STK secret of the keys.
+func NewServerConfigRotator(keys *ServerConfigKeys, stkSource crypto.StkSource, certChain crypto.CertChain, aeads []Tag, interval, gracePeriod time.Duration) (*ServerConfigRotator, error) {
+	if interval <= 0 {
+		return nil, errInvalidRotationInterval
+	}
+	if stkSource == nil {
+		var err error
+		stkSource, err = newStkSourceFromKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := &ServerConfigRotator{
+		certChain:   certChain,
+		stkSource:   stkSource,
+		aeads:       aeads,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+	}
+	k := *keys
+	now := time.Now()
+	k.Expiry = now.Add(interval + gracePeriod)
+	primary, err := NewServerConfigFromKeys(&k, stkSource, certChain, aeads)
+	if err != nil {
+		return nil, err
+	}
+	r.primary = primary
+	r.rotateAt = now.Add(interval)
+	return r, nil
+}
+
+// GetPrimary returns the current server config, rotating it if necessary
+func (r *ServerConfigRotator) GetPrimary() *ServerConfig {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.maybeRotate(time.Now())
+	return r.primary
+}
+
+// Lookup returns the current or a previous server config with the given ID, if it hasn't expired yet
+func (r *ServerConfigRotator) Lookup(id []byte) *ServerConfig {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.maybeRotate(now)
+	if r.primary.Lookup(id) != nil {
+		return r.primary
+	}
+	for _, scfg := range r.previous {
+		if scfg.Lookup(id) != nil {
+			return scfg
+		}
+	}
+	return nil
+}
+
+func (r *ServerConfigRotator) maybeRotate(now time.Time) {
+	// remove expired server configs
+	previous := r.previous[:0]
+	for _, scfg := range r.previous {
+		if !scfg.isExpired(now) {
+			previous = append(previous, scfg)
+		}
+	}
+	r.previous = previous
+
+	if now.Before(r.rotateAt) {
+		return
+	}
+	keys, err := GenerateServerConfigKeys()
+	if err == nil {
+		keys.Expiry = now.Add(r.interval + r.gracePeriod)
+		var scfg *ServerConfig
+		scfg, err = NewServerConfigFromKeys(keys, r.stkSource, r.certChain, r.aeads)
+		if err == nil {
+			r.previous = append(r.previous, r.primary)
+			r.primary = scfg
+			r.rotateAt = now.Add(r.interval)
+			return
+		}
+	}
+	// keep using the current server config, and try again on the next call
+	utils.Errorf("Rotating the server config failed: %s", err.Error())
+}
@@ -0,0 +1,107 @@
+package handshake
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server Config Rotator", func() {
+	var (
+		keys    *ServerConfigKeys
+		rotator *ServerConfigRotator
+	)
+
+	BeforeEach(func() {
+		var err error
+		keys, err = GenerateServerConfigKeys()
+		Expect(err).ToNot(HaveOccurred())
+		rotator, err = NewServerConfigRotator(keys, nil, nil, nil, time.Hour, 10*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	// rotate simulates that the rotation interval has passed
+	rotate := func() {
+		rotator.rotateAt = time.Now().Add(-time.Second)
+	}
+
+	It("uses the keys for the first server config", func() {
+		primary := rotator.GetPrimary()
+		Expect(primary.ID).To(Equal(keys.ID))
+		Expect(primary.obit).To(Equal(keys.Obit))
+	})
+
+	It("sets the expiry", func() {
+		expiry := rotator.GetPrimary().expiry
+		Expect(expiry).To(BeTemporally("~", time.Now().Add(70*time.Minute), time.Second))
+		parsed, err := parseServerConfig(rotator.GetPrimary().Get())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.expiry).To(BeTemporally("~", expiry, time.Second))
+	})
+
+	It("errors if the rotation interval is not positive", func() {
+		_, err := NewServerConfigRotator(keys, nil, nil, nil, 0, time.Minute)
+		Expect(err).To(MatchError(errInvalidRotationInterval))
+	})
+
+	It("doesn't rotate before the rotation interval has passed", func() {
+		primary := rotator.GetPrimary()
+		Expect(rotator.GetPrimary()).To(Equal(primary))
+	})
+
+	It("rotates the server config", func() {
+		old := rotator.GetPrimary()
+		rotate()
+		primary := rotator.GetPrimary()
+		Expect(primary.ID).ToNot(Equal(old.ID))
+		Expect(primary.obit).ToNot(Equal(old.obit))
+		Expect(primary.keyExchanges[TagC255].PublicKey()).ToNot(Equal(old.keyExchanges[TagC255].PublicKey()))
+		Expect(primary.expiry).To(BeTemporally("~", time.Now().Add(70*time.Minute), time.Second))
+		Expect(rotator.rotateAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+	})
+
+	It("keeps accepting source address tokens after a rotation", func() {
+		stk, err := rotator.GetPrimary().stkSource.NewToken([]byte{127, 0, 0, 1}, crypto.STKData{})
+		Expect(err).ToNot(HaveOccurred())
+		rotate()
+		_, err = rotator.GetPrimary().stkSource.VerifyToken([]byte{127, 0, 0, 1}, stk)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("uses the StkSource for all server configs", func() {
+		stkSource, err := crypto.NewStkSource([]byte("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		keys.STKSecret = nil
+		rotator, err = NewServerConfigRotator(keys, stkSource, nil, nil, time.Hour, 10*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rotator.GetPrimary().stkSource).To(Equal(stkSource))
+		rotate()
+		Expect(rotator.GetPrimary().stkSource).To(Equal(stkSource))
+	})
+
+	It("looks up the current server config", func() {
+		primary := rotator.GetPrimary()
+		Expect(rotator.Lookup(primary.ID)).To(Equal(primary))
+		Expect(rotator.Lookup([]byte("unknown"))).To(BeNil())
+	})
+
+	It("accepts the previous server config during the grace period", func() {
+		old := rotator.GetPrimary()
+		rotate()
+		Expect(rotator.GetPrimary()).ToNot(Equal(old))
+		Expect(rotator.Lookup(old.ID)).To(Equal(old))
+	})
+
+	It("doesn't accept the previous server config after it expired", func() {
+		old := rotator.GetPrimary()
+		rotate()
+		primary := rotator.GetPrimary()
+		old.expiry = time.Now().Add(-time.Second)
+		Expect(rotator.Lookup(old.ID)).To(BeNil())
+		Expect(rotator.previous).To(BeEmpty())
+		Expect(rotator.Lookup(primary.ID)).To(Equal(primary))
+	})
+})
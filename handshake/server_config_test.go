@@ -2,6 +2,7 @@ package handshake
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/crypto"
 
@@ -32,6 +33,7 @@ var _ = Describe("ServerConfig", func() {
 	It("gets the proper binary representation", func() {
 		scfg, err := NewServerConfig(kex, nil)
 		Expect(err).NotTo(HaveOccurred())
+		scfg.aeads = []Tag{TagAESG}
 		expected := bytes.NewBuffer([]byte{0x53, 0x43, 0x46, 0x47, 0x6, 0x0, 0x0, 0x0, 0x41, 0x45, 0x41, 0x44, 0x4, 0x0, 0x0, 0x0, 0x53, 0x43, 0x49, 0x44, 0x14, 0x0, 0x0, 0x0, 0x50, 0x55, 0x42, 0x53, 0x37, 0x0, 0x0, 0x0, 0x4b, 0x45, 0x58, 0x53, 0x3b, 0x0, 0x0, 0x0, 0x4f, 0x42, 0x49, 0x54, 0x43, 0x0, 0x0, 0x0, 0x45, 0x58, 0x50, 0x59, 0x4b, 0x0, 0x0, 0x0, 0x41, 0x45, 0x53, 0x47})
 		expected.Write(scfg.ID)
 		expected.Write([]byte{0x20, 0x0, 0x0})
@@ -41,4 +43,172 @@ var _ = Describe("ServerConfig", func() {
 		expected.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
 		Expect(scfg.Get()).To(Equal(expected.Bytes()))
 	})
+
+	It("advertises the preferred AEADs", func() {
+		scfg, err := NewServerConfig(kex, nil)
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := parseServerConfig(scfg.Get())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.aeads).To(Equal(preferredAEADs()))
+	})
+
+	It("prefers AES-GCM if the CPU has AES hardware support, and ChaCha20-Poly1305 otherwise", func() {
+		if crypto.HasAESHardwareSupport() {
+			Expect(preferredAEADs()).To(Equal([]Tag{TagAESG, TagCC20}))
+		} else {
+			Expect(preferredAEADs()).To(Equal([]Tag{TagCC20, TagAESG}))
+		}
+	})
+
+	Context("keys", func() {
+		var keys *ServerConfigKeys
+
+		BeforeEach(func() {
+			var err error
+			keys, err = GenerateServerConfigKeys()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("generates random keys", func() {
+			keys2, err := GenerateServerConfigKeys()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys.ID).To(HaveLen(16))
+			Expect(keys.Obit).To(HaveLen(8))
+			Expect(keys.KeyExchangeKey).To(HaveLen(32))
+			Expect(keys.P256KeyExchangeKey).To(HaveLen(32))
+			Expect(keys.STKSecret).To(HaveLen(32))
+			Expect(keys.ID).ToNot(Equal(keys2.ID))
+			Expect(keys.KeyExchangeKey).ToNot(Equal(keys2.KeyExchangeKey))
+		})
+
+		It("serializes and parses the keys", func() {
+			keys.Expiry = time.Unix(1893456000, 0).UTC()
+			data, err := keys.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := ParseServerConfigKeys(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(keys))
+		})
+
+		It("errors when parsing invalid data", func() {
+			_, err := ParseServerConfigKeys([]byte("foobar"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors when parsing keys with invalid lengths", func() {
+			keys.ID = keys.ID[:15]
+			data, err := keys.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ParseServerConfigKeys(data)
+			Expect(err).To(MatchError(errInvalidServerConfigKeys))
+		})
+
+		It("errors when parsing keys with an invalid P-256 key", func() {
+			keys.P256KeyExchangeKey = keys.P256KeyExchangeKey[:31]
+			data, err := keys.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ParseServerConfigKeys(data)
+			Expect(err).To(MatchError(errInvalidServerConfigKeys))
+		})
+
+		It("offers Curve25519 and P-256", func() {
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := parseServerConfig(scfg.Get())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.kexs).To(Equal([]Tag{TagC255, TagP256}))
+			Expect(parsed.publicValues).To(Equal([][]byte{
+				scfg.keyExchanges[TagC255].PublicKey(),
+				scfg.keyExchanges[TagP256].PublicKey(),
+			}))
+		})
+
+		It("only offers Curve25519 if the keys don't contain a P-256 key", func() {
+			keys.P256KeyExchangeKey = nil
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := parseServerConfig(scfg.Get())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.kexs).To(Equal([]Tag{TagC255}))
+		})
+
+		It("advertises the AEADs in the given order", func() {
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, []Tag{TagCC20, TagAESG})
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := parseServerConfig(scfg.Get())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.aeads).To(Equal([]Tag{TagCC20, TagAESG}))
+		})
+
+		It("rejects unsupported AEADs", func() {
+			_, err := NewServerConfigFromKeys(keys, nil, nil, []Tag{TagSCFG})
+			Expect(err).To(MatchError(errUnsupportedAEAD))
+		})
+
+		It("creates identical server configs from the same keys", func() {
+			scfg1, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			scfg2, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg1.Get()).To(Equal(scfg2.Get()))
+		})
+
+		It("accepts source address tokens issued by another server config using the same keys", func() {
+			scfg1, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			scfg2, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			stk, err := scfg1.stkSource.NewToken([]byte{127, 0, 0, 1}, crypto.STKData{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = scfg2.stkSource.VerifyToken([]byte{127, 0, 0, 1}, stk)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("uses the StkSource", func() {
+			stkSource, err := crypto.NewStkSource([]byte("secret"))
+			Expect(err).ToNot(HaveOccurred())
+			keys.STKSecret = nil
+			scfg, err := NewServerConfigFromKeys(keys, stkSource, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.stkSource).To(Equal(stkSource))
+		})
+
+		It("errors if neither a StkSource nor an STK secret is given", func() {
+			keys.STKSecret = nil
+			_, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).To(MatchError(errNoSTKSecret))
+		})
+
+		It("encodes the expiry", func() {
+			keys.Expiry = time.Unix(1893456000, 0)
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := parseServerConfig(scfg.Get())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.expiry).To(Equal(keys.Expiry))
+		})
+
+		It("is accepted until it expires", func() {
+			keys.Expiry = time.Now().Add(time.Hour)
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.GetPrimary()).To(Equal(scfg))
+			Expect(scfg.Lookup(keys.ID)).To(Equal(scfg))
+			Expect(scfg.Lookup(bytes.Repeat([]byte{0}, 16))).To(BeNil())
+			scfg.expiry = time.Now().Add(-time.Second)
+			Expect(scfg.Lookup(keys.ID)).To(BeNil())
+		})
+
+		It("never expires if no expiry is set", func() {
+			scfg, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scfg.Lookup(keys.ID)).To(Equal(scfg))
+		})
+
+		It("errors if the keys are invalid", func() {
+			keys.KeyExchangeKey = nil
+			_, err := NewServerConfigFromKeys(keys, nil, nil, nil)
+			Expect(err).To(MatchError(errInvalidServerConfigKeys))
+		})
+	})
 })
@@ -29,6 +29,8 @@ const (
 	TagUAID Tag = 'U' + 'A'<<8 + 'I'<<16 + 'D'<<24
 	// TagSVID is the server ID (unofficial tag by us :)
 	TagSVID Tag = 'S' + 'V'<<8 + 'I'<<16 + 'D'<<24
+	// TagAPEC signals support for application error codes (unofficial tag by us :)
+	TagAPEC Tag = 'A' + 'P'<<8 + 'E'<<16 + 'C'<<24
 	// TagTCID is truncation of the connection ID
 	TagTCID Tag = 'T' + 'C'<<8 + 'I'<<16 + 'D'<<24
 	// TagPDMD is the proof demand
@@ -50,6 +52,19 @@ const (
 	// TagSFCW is the initial stream flow control receive window.
 	TagSFCW Tag = 'S' + 'F'<<8 + 'C'<<16 + 'W'<<24
 
+	// TagTBBR is the connection option requesting BBR congestion control
+	TagTBBR Tag = 'T' + 'B'<<8 + 'B'<<16 + 'R'<<24
+	// TagRENO is the connection option requesting Reno congestion control
+	TagRENO Tag = 'R' + 'E'<<8 + 'N'<<16 + 'O'<<24
+	// TagIW03 is the connection option requesting an initial congestion window of 3 packets
+	TagIW03 Tag = 'I' + 'W'<<8 + '0'<<16 + '3'<<24
+	// TagIW10 is the connection option requesting an initial congestion window of 10 packets
+	TagIW10 Tag = 'I' + 'W'<<8 + '1'<<16 + '0'<<24
+	// TagIW20 is the connection option requesting an initial congestion window of 20 packets
+	TagIW20 Tag = 'I' + 'W'<<8 + '2'<<16 + '0'<<24
+	// TagIW50 is the connection option requesting an initial congestion window of 50 packets
+	TagIW50 Tag = 'I' + 'W'<<8 + '5'<<16 + '0'<<24
+
 	// TagFHL2 forces head of line blocking.
 	// Chrome experiment (see https://codereview.chromium.org/2115033002)
 	// unsupported by quic-go
@@ -79,6 +94,14 @@ const (
 	TagOBIT Tag = 'O' + 'B'<<8 + 'I'<<16 + 'T'<<24
 	// TagEXPY is the server config expiry
 	TagEXPY Tag = 'E' + 'X'<<8 + 'P'<<16 + 'Y'<<24
+	// TagC255 is the Curve25519 key exchange
+	TagC255 Tag = 'C' + '2'<<8 + '5'<<16 + '5'<<24
+	// TagP256 is the P-256 key exchange
+	TagP256 Tag = 'P' + '2'<<8 + '5'<<16 + '6'<<24
+	// TagAESG is the AES-GCM AEAD
+	TagAESG Tag = 'A' + 'E'<<8 + 'S'<<16 + 'G'<<24
+	// TagCC20 is the ChaCha20-Poly1305 AEAD
+	TagCC20 Tag = 'C' + 'C'<<8 + '2'<<16 + '0'<<24
 	// TagCERT is the CERT data
 	TagCERT Tag = 0xff545243
 
@@ -1,11 +1,17 @@
 package quic
 
 import (
+	"context"
 	"crypto/tls"
 	"io"
 	"net"
+	"time"
 
+	"github.com/lucas-clemente/quic-go/congestion"
+	"github.com/lucas-clemente/quic-go/crypto"
+	"github.com/lucas-clemente/quic-go/handshake"
 	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
 )
 
 // Stream is the interface implemented by QUIC streams
@@ -16,6 +22,23 @@ type Stream interface {
 	StreamID() protocol.StreamID
 	// Reset closes the stream with an error.
 	Reset(error)
+	// ResetWithCode closes the stream, sending an application error code to the peer.
+	// The peer's Read and Write calls return an ApplicationError with this code.
+	// The code is only sent if the peer supports application error codes, which is negotiated in the handshake. Otherwise, the stream is reset without an error code.
+	// The code must not be larger than MaxApplicationErrorCode.
+	ResetWithCode(code uint32) error
+	// SetReadDeadline sets the deadline for future Read calls and any currently-blocked Read call.
+	// If the deadline is exceeded, Read returns an error with Timeout() == true. The stream can still be used afterwards.
+	// A zero value for t means Read will not time out.
+	SetReadDeadline(t time.Time) error
+	// SetWriteDeadline sets the deadline for future Write calls and any currently-blocked Write call.
+	// If the deadline is exceeded, Write returns an error with Timeout() == true. The stream can still be used afterwards.
+	// Even if a Write times out, it may return n > 0, indicating that some of the data was sent.
+	// A zero value for t means Write will not time out.
+	SetWriteDeadline(t time.Time) error
+	// SetDeadline sets the read and write deadlines associated with the stream.
+	// It is equivalent to calling both SetReadDeadline and SetWriteDeadline.
+	SetDeadline(t time.Time) error
 }
 
 // A Session is a QUIC connection between two peers.
@@ -23,6 +46,8 @@ type Session interface {
 	// AcceptStream returns the next stream opened by the peer, blocking until one is available.
 	// Since stream 1 is reserved for the crypto stream, the first stream is either 2 (for a client) or 3 (for a server).
 	AcceptStream() (Stream, error)
+	// AcceptStreamContext is like AcceptStream, but returns the context's error when the context is cancelled before a stream is available.
+	AcceptStreamContext(context.Context) (Stream, error)
 	// OpenStream opens a new QUIC stream, returning a special error when the peeer's concurrent stream limit is reached.
 	// New streams always have the smallest possible stream ID.
 	// TODO: Enable testing for the special error
@@ -30,12 +55,64 @@ type Session interface {
 	// OpenStreamSync opens a new QUIC stream, blocking until the peer's concurrent stream limit allows a new stream to be opened.
 	// It always picks the smallest possible stream ID.
 	OpenStreamSync() (Stream, error)
+	// OpenStreamSyncContext is like OpenStreamSync, but returns the context's error when the context is cancelled before a new stream can be opened.
+	OpenStreamSyncContext(context.Context) (Stream, error)
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
 	RemoteAddr() net.Addr
+	// ConnectionState returns basic details about the QUIC connection, such as the negotiated parameters of the handshake.
+	ConnectionState() ConnectionState
+	// Stats returns a snapshot of the transport statistics of the connection.
+	// It is safe to call Stats concurrently with all other methods.
+	Stats() SessionStats
+	// GoAway sends a GOAWAY to the peer. No new streams can be opened by either side after that,
+	// but streams that are already open can be used until they are finished.
+	// The peer closes the session once all streams are finished, since only the peer knows when it has read all the data we sent.
+	// Likewise, after receiving a GOAWAY, the session is closed once all streams are finished.
+	GoAway(code qerr.ErrorCode, reason string) error
 	// Close closes the connection. The error will be sent to the remote peer in a CONNECTION_CLOSE frame. An error value of nil is allowed and will cause a normal PeerGoingAway to be sent.
 	Close(error) error
+	// CloseWithError closes the connection, sending an application error code and message to the peer.
+	// All operations on the peer's session and streams return an ApplicationError with this code and message.
+	// If the peer doesn't support application error codes, which is negotiated in the handshake, the code and message are only sent in the reason phrase of a PeerGoingAway.
+	// The code must not be larger than MaxApplicationErrorCode.
+	CloseWithError(code uint32, msg string) error
+}
+
+// ConnectionState records basic details about the QUIC connection.
+type ConnectionState handshake.ConnectionState
+
+// SessionStats is a snapshot of the transport statistics of a session.
+type SessionStats struct {
+	PacketsSent          uint64
+	PacketsReceived      uint64
+	PacketsRetransmitted uint64
+	PacketsLost          uint64
+	// PacketsSpuriouslyLost is the number of packets that were declared lost, but were acked later
+	PacketsSpuriouslyLost uint64
+	// UndecryptablePackets is the number of received packets that could not be decrypted
+	UndecryptablePackets uint64
+
+	BytesSent          protocol.ByteCount
+	BytesReceived      protocol.ByteCount
+	BytesRetransmitted protocol.ByteCount
+	BytesLost          protocol.ByteCount
+
+	SmoothedRTT time.Duration
+	MinRTT      time.Duration
+	LatestRTT   time.Duration
+
+	CongestionWindow protocol.ByteCount
+	BytesInFlight    protocol.ByteCount
+	InSlowStart      bool
+	// BandwidthEstimate is the estimated bandwidth in bits per second
+	BandwidthEstimate uint64
+
+	// OpenIncomingStreams is the number of open streams opened by the peer, OpenOutgoingStreams the number of open streams opened by us.
+	// The crypto stream is not counted.
+	OpenIncomingStreams int
+	OpenOutgoingStreams int
 }
 
 // ConnState is the status of the connection
@@ -55,14 +132,114 @@ const (
 // ConnStateCallback is called every time the connection moves to another connection state.
 type ConnStateCallback func(Session, ConnState)
 
+// A CongestionControlFactory creates the congestion controller of a session.
+// It receives the RTTStats of the session, which have to be used by the congestion controller,
+// and the connection options (such as handshake.TagTBBR) sent by the client.
+type CongestionControlFactory func(rttStats *congestion.RTTStats, connectionOptions []handshake.Tag) congestion.SendAlgorithm
+
 // Config contains all configuration data needed for a QUIC server or client.
-// More config parameters (such as timeouts) will be added soon, see e.g. https://github.com/lucas-clemente/quic-go/issues/441.
 type Config struct {
+	// TLSConfig contains the certificates of the server, and the settings for verifying the certificate of the server on the client side.
+	// Servers send the SignedCertificateTimestamps of the certificate to the client. OCSP staples (tls.Certificate.OCSPStaple) are not sent, since QUIC crypto has no tag for them.
 	TLSConfig *tls.Config
 	// ConnStateCallback will be called when the QUIC version is successfully negotiated or when the encryption level changes.
 	// If this field is not set, the Dial functions will return only when the connection is forward secure.
 	// Callbacks have to be thread-safe, since they might be called in separate goroutines.
 	ConnState ConnStateCallback
+	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
+	// If the timeout is exceeded, the connection is closed with a HandshakeTimeout error.
+	// If this value is zero, the timeout is set to 10 seconds.
+	HandshakeTimeout time.Duration
+	// IdleTimeout is the maximum duration that may pass without any incoming network activity.
+	// This value only applies after the handshake has completed. It is negotiated with the peer, and the smaller value is used.
+	// If the timeout is exceeded, the connection is closed with a NetworkIdleTimeout error.
+	// If this value is zero, the timeout is set to 30 seconds.
+	IdleTimeout time.Duration
+	// ReceiveStreamFlowControlWindow is the stream-level flow control window for receiving data.
+	// It is advertised to the peer during the handshake.
+	// If this value is zero, it will default to 32 kB.
+	ReceiveStreamFlowControlWindow protocol.ByteCount
+	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
+	// The window is increased up to this value by the auto-tuning if the application reads data fast enough.
+	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
+	MaxReceiveStreamFlowControlWindow protocol.ByteCount
+	// ReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
+	// It is advertised to the peer during the handshake.
+	// If this value is zero, it will default to 48 kB.
+	ReceiveConnectionFlowControlWindow protocol.ByteCount
+	// MaxReceiveConnectionFlowControlWindow is the maximum connection-level flow control window for receiving data.
+	// The window is increased up to this value by the auto-tuning if the application reads data fast enough.
+	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
+	MaxReceiveConnectionFlowControlWindow protocol.ByteCount
+	// AcceptConnState is the connection state a session has to reach before it is returned by Listener.Accept.
+	// It only applies to the server.
+	// If this value is ConnStateInitial, sessions are returned once they are forward secure.
+	AcceptConnState ConnState
+	// AcceptQueueLength is the maximum number of sessions that the server keeps in the handshake or in the accept queue.
+	// New connections exceeding this limit are rejected with a Public Reset.
+	// It only applies to the server.
+	// If this value is zero, it will default to 32.
+	AcceptQueueLength int
+	// ClientSessionCache is used by the client to cache the server config, the source address token and the certificate chain.
+	// When connecting to a server again, the client can then immediately send a full CHLO and establish the connection in 0-RTT.
+	// It only applies to the client.
+	// If this value is nil, no sessions are cached.
+	ClientSessionCache handshake.ClientSessionCache
+	// VerifyPeerCertificate is called after the server's certificate chain and proof were verified.
+	// It receives the raw certificate chain and the chains built during verification, and can abort the handshake by returning an error.
+	// It only applies to the client.
+	// If this value is nil, only the standard certificate verification is performed.
+	VerifyPeerCertificate handshake.VerifyPeerCertificateFunc
+	// SCTPolicy is called with the signed certificate timestamps (RFC 6962) sent by the server, after the server's certificate chain and proof were verified.
+	// It receives the leaf certificate and its issuer along with the SCTs.
+	// IMPORTANT: The SCTs are not authenticated. They are sent in the unencrypted REJ and are not covered by the server proof, so an attacker can add or modify them.
+	// A policy must therefore verify the signatures of the SCTs against the keys of trusted logs, as handshake.VerifiedSCTs does.
+	// It only applies to the client.
+	// If this value is nil, signed certificate timestamps are not checked.
+	SCTPolicy handshake.SCTPolicy
+	// KeyExchanges are the key exchange algorithms (handshake.TagC255 and handshake.TagP256) the client offers, in order of preference.
+	// The client uses the first one that is supported by the server.
+	// It only applies to the client.
+	// If this value is empty, Curve25519 is preferred over P-256.
+	KeyExchanges []handshake.Tag
+	// CongestionControl creates the congestion controller of every session.
+	// The server first calls it without connection options, and calls it again once the CHLO was received if the client sent connection options.
+	// If this value is nil, DefaultCongestionControl is used.
+	CongestionControl CongestionControlFactory
+	// ConnectionOptions are sent to the server in the COPT tag, e.g. handshake.TagTBBR to request BBR congestion control.
+	// They are passed to the CongestionControl of the client as well as of the server.
+	// It only applies to the client.
+	ConnectionOptions []handshake.Tag
+	// AEADs are the AEADs (handshake.TagAESG and handshake.TagCC20) that may be used.
+	// The server advertises them in this order. The client uses the first AEAD advertised by the server that is contained in this list.
+	// If this value is empty, the server prefers AES-GCM on CPUs with AES hardware support and ChaCha20-Poly1305 otherwise,
+	// and the client accepts both.
+	AEADs []handshake.Tag
+	// ServerConfigKeys are the keys used for the server config.
+	// Servers sharing the same keys present the same server config and accept each other's source address tokens,
+	// such that clients can establish 0-RTT connections across restarts and to different servers behind a load balancer.
+	// It only applies to the server.
+	// If this value is nil, random keys are generated when calling Listen.
+	ServerConfigKeys *handshake.ServerConfigKeys
+	// ServerConfigRotationInterval is the interval after which the server config is replaced by a newly generated one.
+	// Rotated server configs use randomly generated keys, so it can't be used together with ServerConfigKeys: servers sharing the keys would present different server configs after the first rotation.
+	// It only applies to the server.
+	// If this value is zero, it will default to 24 hours, unless ServerConfigKeys are set. In that case, the server config is never rotated.
+	ServerConfigRotationInterval time.Duration
+	// ServerConfigGracePeriod is the duration for which the previous server config is still accepted after a rotation.
+	// It only applies to the server.
+	// If this value is zero, it will default to 1 hour.
+	ServerConfigGracePeriod time.Duration
+	// StkSource is used to create and verify source address tokens.
+	// crypto.NewRotatingStkSource creates a StkSource that allows rotating the secrets.
+	// It only applies to the server.
+	// If this value is nil, the STK secret of the ServerConfigKeys is used.
+	StkSource crypto.StkSource
+	// StrikeRegister records the client nonces of CHLOs, such that replayed CHLOs are rejected.
+	// Servers sharing the same ServerConfigKeys should share a StrikeRegister.
+	// It only applies to the server.
+	// If this value is nil, an in-memory StrikeRegister is used.
+	StrikeRegister crypto.StrikeRegister
 }
 
 // A Listener for incoming QUIC connections
@@ -71,6 +248,19 @@ type Listener interface {
 	Close() error
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
-	// Serve starts the main server loop, and blocks until a network error occurs or the server is closed.
+	// Accept returns new sessions. It should be called in a loop.
+	// A session is returned once it has reached the connection state specified by Config.AcceptConnState.
+	Accept() (Session, error)
+	// Serve accepts sessions in a loop, and blocks until a network error occurs or the server is closed.
+	// Sessions are only reported via Config.ConnState.
+	//
+	// Deprecated: call Accept in a loop instead.
 	Serve() error
+	// Drain gracefully shuts down the server. It stops accepting new connections and sends a GOAWAY on all sessions.
+	// It then waits until all sessions are closed, and closes the server.
+	// If the context expires before that, the server is closed immediately and the context's error is returned.
+	Drain(ctx context.Context) error
+	// SetTLSConfig replaces the TLS config used for the server proof and the certificate chain.
+	// It allows using a renewed certificate without restarting the server. Established sessions are not affected.
+	SetTLSConfig(*tls.Config) error
 }
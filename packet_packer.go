@@ -79,8 +79,17 @@ func (p *packetPacker) packPacket(stopWaitingFrame *frames.StopWaitingFrame, lea
 	// handshakePacketToRetransmit is only set for handshake retransmissions
 	isHandshakeRetransmission := (handshakePacketToRetransmit != nil)
 
+	// we're packing a ConnectionClose, don't add any StreamFrames
+	var isConnectionClose bool
+	if len(p.controlFrames) == 1 {
+		_, isConnectionClose = p.controlFrames[0].(*frames.ConnectionCloseFrame)
+	}
+
 	var sealFunc handshake.Sealer
 	var encLevel protocol.EncryptionLevel
+	// isCryptoPacket is set if the crypto stream data has to be sent at a different encryption level than the other data
+	// This is the case for the client, which sends its CHLOs unencrypted, but data in 0-RTT.
+	var isCryptoPacket bool
 
 	if isHandshakeRetransmission {
 		var err error
@@ -91,6 +100,12 @@ func (p *packetPacker) packPacket(stopWaitingFrame *frames.StopWaitingFrame, lea
 		}
 	} else {
 		encLevel, sealFunc = p.cryptoSetup.GetSealer()
+		if !isConnectionClose && p.streamFramer.HasCryptoStreamFrame() {
+			if cryptoEncLevel, cryptoSealFunc := p.cryptoSetup.GetSealerForCryptoStream(); cryptoEncLevel != encLevel {
+				isCryptoPacket = true
+				encLevel, sealFunc = cryptoEncLevel, cryptoSealFunc
+			}
+		}
 	}
 
 	currentPacketNumber := p.packetNumberGenerator.Peek()
@@ -121,12 +136,6 @@ func (p *packetPacker) packPacket(stopWaitingFrame *frames.StopWaitingFrame, lea
 		stopWaitingFrame.PacketNumberLen = packetNumberLen
 	}
 
-	// we're packing a ConnectionClose, don't add any StreamFrames
-	var isConnectionClose bool
-	if len(p.controlFrames) == 1 {
-		_, isConnectionClose = p.controlFrames[0].(*frames.ConnectionCloseFrame)
-	}
-
 	var payloadFrames []frames.Frame
 	if isHandshakeRetransmission {
 		payloadFrames = append(payloadFrames, stopWaitingFrame)
@@ -142,6 +151,21 @@ func (p *packetPacker) packPacket(stopWaitingFrame *frames.StopWaitingFrame, lea
 		}
 	} else if isConnectionClose {
 		payloadFrames = []frames.Frame{p.controlFrames[0]}
+	} else if isCryptoPacket {
+		// only the StopWaitingFrame is sent along with the crypto stream data, all other frames are sent in the next packet
+		maxSize := protocol.MaxFrameAndPublicHeaderSize - publicHeaderLength - protocol.NonForwardSecurePacketSizeReduction
+		if stopWaitingFrame != nil {
+			payloadFrames = append(payloadFrames, stopWaitingFrame)
+			minLength, err := stopWaitingFrame.MinLength(p.version)
+			if err != nil {
+				return nil, err
+			}
+			maxSize -= minLength
+		}
+		if f := p.streamFramer.PopCryptoStreamFrame(maxSize); f != nil {
+			f.DataLenPresent = false
+			payloadFrames = append(payloadFrames, f)
+		}
 	} else {
 		maxSize := protocol.MaxFrameAndPublicHeaderSize - publicHeaderLength
 		if !p.isForwardSecure {
@@ -13,9 +13,10 @@ import (
 )
 
 type mockCryptoSetup struct {
-	divNonce          []byte
-	handshakeComplete bool
-	encLevelSeal      protocol.EncryptionLevel
+	divNonce           []byte
+	handshakeComplete  bool
+	encLevelSeal       protocol.EncryptionLevel
+	encLevelSealCrypto protocol.EncryptionLevel
 }
 
 func (m *mockCryptoSetup) HandleCryptoStream() error { return nil }
@@ -28,6 +29,13 @@ func (m *mockCryptoSetup) GetSealer() (protocol.EncryptionLevel, handshake.Seale
 		return append(src, bytes.Repeat([]byte{0}, 12)...)
 	}
 }
+func (m *mockCryptoSetup) GetSealerForCryptoStream() (protocol.EncryptionLevel, handshake.Sealer) {
+	encLevel, sealer := m.GetSealer()
+	if m.encLevelSealCrypto != protocol.EncryptionUnspecified {
+		encLevel = m.encLevelSealCrypto
+	}
+	return encLevel, sealer
+}
 func (m *mockCryptoSetup) GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (handshake.Sealer, error) {
 	return func(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte {
 		return append(src, bytes.Repeat([]byte{0}, 12)...)
@@ -38,6 +46,9 @@ func (m *mockCryptoSetup) DiversificationNonce() []byte {
 	return m.divNonce
 }
 func (m *mockCryptoSetup) SetDiversificationNonce([]byte) error { panic("not implemented") }
+func (m *mockCryptoSetup) ConnectionState() handshake.ConnectionState {
+	return handshake.ConnectionState{HandshakeComplete: m.handshakeComplete, ServerName: "quic.clemente.io"}
+}
 
 var _ handshake.CryptoSetup = &mockCryptoSetup{}
 
@@ -195,7 +206,7 @@ var _ = Describe("Packet packer", func() {
 
 	It("packs a StopWaitingFrame first", func() {
 		packer.packetNumberGenerator.next = 15
-		swf := &frames.StopWaitingFrame{LeastUnacked: 10}
+		swf := &frames.StopWaitingFrame{LeastUnacked: 1}
 		p, err := packer.PackPacket(swf, []frames.Frame{&frames.RstStreamFrame{}}, 0)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(p).ToNot(BeNil())
@@ -213,7 +224,7 @@ var _ = Describe("Packet packer", func() {
 	})
 
 	It("does not pack a packet containing only a StopWaitingFrame", func() {
-		swf := &frames.StopWaitingFrame{LeastUnacked: 10}
+		swf := &frames.StopWaitingFrame{LeastUnacked: 1}
 		p, err := packer.PackPacket(swf, []frames.Frame{}, 0)
 		Expect(p).To(BeNil())
 		Expect(err).ToNot(HaveOccurred())
@@ -537,6 +548,55 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 			Expect(p.frames[0]).To(Equal(f))
 		})
+
+		Context("crypto stream data sent at a lower encryption level", func() {
+			var cryptoStream *stream
+
+			BeforeEach(func() {
+				packer.perspective = protocol.PerspectiveClient
+				packer.isForwardSecure = false
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionUnencrypted
+				cryptoStream = &stream{streamID: 1}
+				streamFramer.streamsMap.putStream(cryptoStream)
+				streamFramer.flowControlManager.(*mockFlowControlHandler).sendWindowSizes[1] = protocol.MaxByteCount
+			})
+
+			It("packs the crypto stream data in a separate packet", func() {
+				cryptoStream.dataForWriting = []byte("CHLO")
+				streamFramer.AddFrameForRetransmission(&frames.StreamFrame{StreamID: 5, Data: []byte("foobar")})
+				p, err := packer.PackPacket(nil, []frames.Frame{&frames.RstStreamFrame{StreamID: 3}}, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+				Expect(p.frames).To(HaveLen(1))
+				Expect(p.frames[0].(*frames.StreamFrame).StreamID).To(Equal(protocol.StreamID(1)))
+				Expect(p.frames[0].(*frames.StreamFrame).Data).To(Equal([]byte("CHLO")))
+				p, err = packer.PackPacket(nil, nil, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
+				Expect(p.frames).To(HaveLen(2))
+			})
+
+			It("includes the StopWaitingFrame", func() {
+				cryptoStream.dataForWriting = []byte("CHLO")
+				swf := &frames.StopWaitingFrame{LeastUnacked: 1}
+				p, err := packer.PackPacket(swf, nil, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+				Expect(p.frames).To(HaveLen(2))
+				Expect(p.frames[0]).To(Equal(swf))
+			})
+
+			It("doesn't pack a separate packet if the encryption levels are the same", func() {
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+				cryptoStream.dataForWriting = []byte("CHLO")
+				streamFramer.AddFrameForRetransmission(&frames.StreamFrame{StreamID: 5, Data: []byte("foobar")})
+				p, err := packer.PackPacket(nil, nil, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
+				Expect(p.frames).To(HaveLen(2))
+			})
+		})
 	})
 
 	Context("Blocked frames", func() {
@@ -84,6 +84,9 @@ const SkipPacketAveragePeriodLength PacketNumber = 500
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
+// MaxTrackedLostPackets is the maximum number of lost packet numbers the SentPacketHandler keeps track of for detecting spurious losses
+const MaxTrackedLostPackets = 100
+
 // STKExpiryTimeSec is the valid time of a source address token in seconds
 const STKExpiryTimeSec = 24 * 60 * 60
 
@@ -119,17 +122,21 @@ const EphermalKeyLifetime = time.Minute
 // InitialIdleTimeout is the timeout before the handshake succeeds.
 const InitialIdleTimeout = 5 * time.Second
 
-// DefaultIdleTimeout is the default idle timeout, for the server
+// DefaultIdleTimeout is the default idle timeout, used if the Config doesn't specify one.
+// It is the maximum idle timeout that is negotiated with the peer.
 const DefaultIdleTimeout = 30 * time.Second
 
-// MaxIdleTimeoutServer is the maximum idle timeout that can be negotiated, for the server
-const MaxIdleTimeoutServer = 1 * time.Minute
+// DefaultHandshakeTimeout is the default timeout for a connection until the crypto handshake succeeds.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// DefaultAcceptQueueLength is the default number of sessions that the server keeps in the handshake or in the accept queue
+const DefaultAcceptQueueLength = 32
 
-// MaxIdleTimeoutClient is the idle timeout that the client suggests to the server
-const MaxIdleTimeoutClient = 2 * time.Minute
+// DefaultServerConfigRotationInterval is the default interval after which the server config is rotated
+const DefaultServerConfigRotationInterval = 24 * time.Hour
 
-// MaxTimeForCryptoHandshake is the default timeout for a connection until the crypto handshake succeeds.
-const MaxTimeForCryptoHandshake = 10 * time.Second
+// DefaultServerConfigGracePeriod is the default duration for which a server config is still accepted after it was rotated
+const DefaultServerConfigGracePeriod = time.Hour
 
 // ClosedSessionDeleteTimeout the server ignores packets arriving on a connection that is already closed
 // after this time all information about the old connection will be deleted
@@ -137,3 +144,9 @@ const ClosedSessionDeleteTimeout = time.Minute
 
 // NumCachedCertificates is the number of cached compressed certificate chains, each taking ~1K space
 const NumCachedCertificates = 128
+
+// StrikeRegisterWindow is the maximum deviation of the timestamp of a client nonce from the current time
+const StrikeRegisterWindow = 10 * time.Minute
+
+// MaxStrikeRegisterEntries is the maximum number of client nonces that the in-memory strike register keeps track of
+const MaxStrikeRegisterEntries = 1 << 16
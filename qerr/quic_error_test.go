@@ -13,6 +13,12 @@ var _ = Describe("Quic error", func() {
 			err := Error(DecryptionFailure, "foobar")
 			Expect(err.Error()).To(Equal("DecryptionFailure: foobar"))
 		})
+
+		It("says if an error is a timeout", func() {
+			Expect(Error(NetworkIdleTimeout, "").Timeout()).To(BeTrue())
+			Expect(Error(HandshakeTimeout, "").Timeout()).To(BeTrue())
+			Expect(Error(DecryptionFailure, "").Timeout()).To(BeFalse())
+		})
 	})
 
 	Context("ErrorCode", func() {
@@ -0,0 +1,101 @@
+// Package quicnet provides net.Conn and net.Listener adapters for QUIC streams.
+//
+// This allows running protocols written for TCP over QUIC, with every stream being used as a separate connection.
+package quicnet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+var errConnClosed = errors.New("use of closed connection")
+
+type conn struct {
+	quic.Stream
+
+	session quic.Session
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+var _ net.Conn = &conn{}
+
+// NewConn returns a net.Conn that reads from and writes to the stream.
+// The addresses are taken from the session, and deadlines are set on the stream.
+// Closing the net.Conn closes the stream, but not the session.
+func NewConn(sess quic.Session, str quic.Stream) net.Conn {
+	return &conn{
+		Stream:  str,
+		session: sess,
+	}
+}
+
+// Read reads from the stream.
+// After Close was called, it returns an error.
+func (c *conn) Read(p []byte) (int, error) {
+	if c.isClosed() {
+		return 0, errConnClosed
+	}
+	n, err := c.Stream.Read(p)
+	if err != nil && c.isClosed() {
+		return n, errConnClosed
+	}
+	return n, err
+}
+
+// Close closes the write direction of the stream, and unblocks any pending Read.
+// Data that was already written is still delivered to the peer.
+func (c *conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return errConnClosed
+	}
+	c.closed = true
+	err := c.Stream.Close()
+	// quic.Stream.Close only sends a FIN, it doesn't affect reading from the stream.
+	// Expire the read deadline to unblock Read calls.
+	_ = c.Stream.SetReadDeadline(time.Now())
+	return err
+}
+
+// SetDeadline sets the read and write deadlines on the stream
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return errConnClosed
+	}
+	return c.Stream.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline on the stream
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return errConnClosed
+	}
+	return c.Stream.SetReadDeadline(t)
+}
+
+// LocalAddr returns the local address of the session
+func (c *conn) LocalAddr() net.Addr {
+	return c.session.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (c *conn) RemoteAddr() net.Addr {
+	return c.session.RemoteAddr()
+}
+
+func (c *conn) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
@@ -0,0 +1,194 @@
+package quicnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockStream struct {
+	mutex         sync.Mutex
+	dataToRead    bytes.Buffer
+	dataWritten   bytes.Buffer
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// if set, Read blocks until the read deadline has passed
+	blockRead bool
+}
+
+func (s *mockStream) Read(p []byte) (int, error) {
+	if !s.blockRead {
+		return s.dataToRead.Read(p)
+	}
+	for {
+		s.mutex.Lock()
+		deadline := s.readDeadline
+		s.mutex.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, errors.New("deadline exceeded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+func (s *mockStream) Close() error                { s.closed = true; return nil }
+func (s *mockStream) Reset(error)                 { panic("not implemented") }
+func (s *mockStream) ResetWithCode(uint32) error  { panic("not implemented") }
+func (s *mockStream) StreamID() protocol.StreamID { return 3 }
+func (s *mockStream) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.readDeadline = t
+	s.mutex.Unlock()
+	return nil
+}
+func (s *mockStream) SetWriteDeadline(t time.Time) error { s.writeDeadline = t; return nil }
+func (s *mockStream) SetDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.readDeadline = t
+	s.mutex.Unlock()
+	s.writeDeadline = t
+	return nil
+}
+
+type mockSession struct {
+	streamsToAccept chan quic.Stream
+	closed          bool
+}
+
+func newMockSession() *mockSession {
+	return &mockSession{streamsToAccept: make(chan quic.Stream, 10)}
+}
+
+func (s *mockSession) AcceptStream() (quic.Stream, error) {
+	str, ok := <-s.streamsToAccept
+	if !ok {
+		return nil, errors.New("session closed")
+	}
+	return str, nil
+}
+func (s *mockSession) AcceptStreamContext(context.Context) (quic.Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenStream() (quic.Stream, error)     { panic("not implemented") }
+func (s *mockSession) OpenStreamSync() (quic.Stream, error) { panic("not implemented") }
+func (s *mockSession) OpenStreamSyncContext(context.Context) (quic.Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) ConnectionState() quic.ConnectionState {
+	panic("not implemented")
+}
+func (s *mockSession) Stats() quic.SessionStats {
+	panic("not implemented")
+}
+func (s *mockSession) CloseWithError(code uint32, msg string) error {
+	panic("not implemented")
+}
+func (s *mockSession) GoAway(code qerr.ErrorCode, reason string) error {
+	panic("not implemented")
+}
+func (s *mockSession) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}
+}
+func (s *mockSession) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+}
+func (s *mockSession) Close(error) error {
+	if !s.closed {
+		close(s.streamsToAccept)
+	}
+	s.closed = true
+	return nil
+}
+
+var _ quic.Session = &mockSession{}
+
+var _ = Describe("Conn", func() {
+	var (
+		c    net.Conn
+		sess *mockSession
+		str  *mockStream
+	)
+
+	BeforeEach(func() {
+		sess = newMockSession()
+		str = &mockStream{}
+		c = NewConn(sess, str)
+	})
+
+	It("reads from the stream", func() {
+		str.dataToRead.Write([]byte("foobar"))
+		b := make([]byte, 6)
+		n, err := c.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		Expect(b).To(Equal([]byte("foobar")))
+	})
+
+	It("writes to the stream", func() {
+		n, err := c.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		Expect(str.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
+	It("closes the stream, but not the session", func() {
+		err := c.Close()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.closed).To(BeTrue())
+		Expect(sess.closed).To(BeFalse())
+	})
+
+	It("unblocks a pending Read when closed", func() {
+		str.blockRead = true
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := c.Read(make([]byte, 6))
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(c.Close()).To(Succeed())
+		var err error
+		Eventually(errChan).Should(Receive(&err))
+		Expect(err).To(MatchError(errConnClosed))
+	})
+
+	It("doesn't read or set deadlines after Close", func() {
+		str.dataToRead.Write([]byte("foobar"))
+		Expect(c.Close()).To(Succeed())
+		_, err := c.Read(make([]byte, 6))
+		Expect(err).To(MatchError(errConnClosed))
+		Expect(str.dataToRead.Len()).To(Equal(6))
+		Expect(c.SetReadDeadline(time.Now().Add(time.Hour))).To(MatchError(errConnClosed))
+		Expect(c.SetDeadline(time.Now().Add(time.Hour))).To(MatchError(errConnClosed))
+		Expect(c.Close()).To(MatchError(errConnClosed))
+	})
+
+	It("returns the addresses of the session", func() {
+		Expect(c.LocalAddr()).To(Equal(sess.LocalAddr()))
+		Expect(c.RemoteAddr()).To(Equal(sess.RemoteAddr()))
+	})
+
+	It("sets deadlines on the stream", func() {
+		t1 := time.Now().Add(time.Second)
+		t2 := time.Now().Add(time.Minute)
+		Expect(c.SetDeadline(t1)).To(Succeed())
+		Expect(str.readDeadline).To(Equal(t1))
+		Expect(str.writeDeadline).To(Equal(t1))
+		Expect(c.SetReadDeadline(t2)).To(Succeed())
+		Expect(str.readDeadline).To(Equal(t2))
+		Expect(c.SetWriteDeadline(t2)).To(Succeed())
+		Expect(str.writeDeadline).To(Equal(t2))
+	})
+})
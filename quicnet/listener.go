@@ -0,0 +1,102 @@
+package quicnet
+
+import (
+	"net"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+type listener struct {
+	ln quic.Listener
+
+	conns     chan net.Conn
+	closeChan chan struct{}
+	closeOnce sync.Once
+
+	err       error
+	errorChan chan struct{}
+}
+
+var _ net.Listener = &listener{}
+
+// Listen creates a QUIC server listening on the given net.PacketConn.
+// Every stream opened by the peer is returned as a separate net.Conn.
+func Listen(pconn net.PacketConn, config *quic.Config) (net.Listener, error) {
+	ln, err := quic.Listen(pconn, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(ln), nil
+}
+
+// ListenAddr creates a QUIC server listening on a given address.
+// Every stream opened by the peer is returned as a separate net.Conn.
+func ListenAddr(addr string, config *quic.Config) (net.Listener, error) {
+	ln, err := quic.ListenAddr(addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(ln), nil
+}
+
+// NewListener returns a net.Listener that accepts all sessions from the quic.Listener,
+// and returns every stream opened by the peer in any of these sessions as a separate net.Conn.
+// The quic.Listener must not be used by the caller afterwards.
+func NewListener(ln quic.Listener) net.Listener {
+	l := &listener{
+		ln:        ln,
+		conns:     make(chan net.Conn),
+		closeChan: make(chan struct{}),
+		errorChan: make(chan struct{}),
+	}
+	go l.acceptSessions()
+	return l
+}
+
+func (l *listener) acceptSessions() {
+	for {
+		sess, err := l.ln.Accept()
+		if err != nil {
+			l.err = err
+			close(l.errorChan)
+			return
+		}
+		go l.acceptStreams(sess)
+	}
+}
+
+func (l *listener) acceptStreams(sess quic.Session) {
+	for {
+		str, err := sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		select {
+		case l.conns <- NewConn(sess, str):
+		case <-l.closeChan:
+			return
+		}
+	}
+}
+
+// Accept waits for and returns the next stream opened by a peer
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.errorChan:
+		return nil, l.err
+	}
+}
+
+// Close closes the listener, and all sessions accepted by it
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closeChan) })
+	return l.ln.Close()
+}
+
+// Addr returns the listener's network address
+func (l *listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
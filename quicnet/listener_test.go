@@ -0,0 +1,154 @@
+package quicnet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockListener struct {
+	sessionsToAccept chan quic.Session
+	acceptErr        error
+	closed           bool
+}
+
+func (l *mockListener) Accept() (quic.Session, error) {
+	sess, ok := <-l.sessionsToAccept
+	if !ok {
+		return nil, l.acceptErr
+	}
+	return sess, nil
+}
+func (l *mockListener) Close() error {
+	if !l.closed {
+		close(l.sessionsToAccept)
+	}
+	l.closed = true
+	return nil
+}
+func (l *mockListener) Addr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}
+}
+
+func (l *mockListener) Serve() error {
+	panic("not implemented")
+}
+
+func (l *mockListener) Drain(context.Context) error {
+	panic("not implemented")
+}
+
+func (l *mockListener) SetTLSConfig(*tls.Config) error {
+	panic("not implemented")
+}
+
+var _ quic.Listener = &mockListener{}
+
+var _ = Describe("Listener", func() {
+	var (
+		ln     net.Listener
+		quicLn *mockListener
+	)
+
+	BeforeEach(func() {
+		quicLn = &mockListener{
+			sessionsToAccept: make(chan quic.Session, 10),
+			acceptErr:        errors.New("listener closed"),
+		}
+		ln = NewListener(quicLn)
+	})
+
+	AfterEach(func() {
+		ln.Close()
+	})
+
+	It("returns the address of the QUIC listener", func() {
+		Expect(ln.Addr()).To(Equal(quicLn.Addr()))
+	})
+
+	It("returns accepted streams as net.Conns", func() {
+		sess := newMockSession()
+		str := &mockStream{}
+		quicLn.sessionsToAccept <- sess
+		sess.streamsToAccept <- str
+		c, err := ln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.(*conn).Stream).To(Equal(str))
+		Expect(c.(*conn).session).To(Equal(sess))
+	})
+
+	It("accepts streams from multiple sessions", func() {
+		sess1 := newMockSession()
+		sess2 := newMockSession()
+		quicLn.sessionsToAccept <- sess1
+		quicLn.sessionsToAccept <- sess2
+		str1 := &mockStream{}
+		str2 := &mockStream{}
+		str3 := &mockStream{}
+		sess1.streamsToAccept <- str1
+		sess2.streamsToAccept <- str2
+		sess1.streamsToAccept <- str3
+		streams := make(map[quic.Stream]quic.Session)
+		for i := 0; i < 3; i++ {
+			c, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			streams[c.(*conn).Stream] = c.(*conn).session
+		}
+		Expect(streams).To(HaveLen(3))
+		Expect(streams[str1]).To(Equal(sess1))
+		Expect(streams[str2]).To(Equal(sess2))
+		Expect(streams[str3]).To(Equal(sess1))
+	})
+
+	It("blocks until a stream is accepted", func() {
+		var returned bool
+		go func() {
+			_, _ = ln.Accept()
+			returned = true
+		}()
+		quicLn.sessionsToAccept <- newMockSession()
+		Consistently(func() bool { return returned }).Should(BeFalse())
+	})
+
+	It("returns the error from the QUIC listener", func() {
+		testErr := errors.New("test error")
+		quicLn.acceptErr = testErr
+		close(quicLn.sessionsToAccept)
+		quicLn.closed = true
+		_, err := ln.Accept()
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("closes the QUIC listener", func() {
+		var err error
+		var returned bool
+		go func() {
+			_, err = ln.Accept()
+			returned = true
+		}()
+		Consistently(func() bool { return returned }).Should(BeFalse())
+		Expect(ln.Close()).To(Succeed())
+		Expect(quicLn.closed).To(BeTrue())
+		Eventually(func() bool { return returned }).Should(BeTrue())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("stops accepting streams when closed", func() {
+		sess := newMockSession()
+		quicLn.sessionsToAccept <- sess
+		sess.streamsToAccept <- &mockStream{}
+		// wait until the stream was accepted from the session
+		Eventually(func() int { return len(sess.streamsToAccept) }).Should(BeZero())
+		Expect(ln.Close()).To(Succeed())
+		time.Sleep(10 * time.Millisecond) // give the stream accepting goroutine time to return
+		_, err := ln.Accept()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,13 @@
+package quicnet
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestQuicnet(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Quicnet Suite")
+}
@@ -2,6 +2,8 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"sync"
@@ -14,10 +16,14 @@ import (
 	"github.com/lucas-clemente/quic-go/utils"
 )
 
+// drainPollInterval is the interval in which Drain checks if all sessions were closed
+const drainPollInterval = 10 * time.Millisecond
+
 // packetHandler handles packets
 type packetHandler interface {
 	Session
 	handlePacket(*receivedPacket)
+	closeRemote(error)
 	run()
 }
 
@@ -28,19 +34,37 @@ type server struct {
 	conn net.PacketConn
 
 	certChain crypto.CertChain
-	scfg      *handshake.ServerConfig
+	scfg      handshake.ServerConfigSource
 
 	sessions                  map[protocol.ConnectionID]packetHandler
 	sessionsMutex             sync.RWMutex
 	deleteClosedSessionsAfter time.Duration
+	closed                    bool
+	draining                  bool
+
+	// pendingSessions are sessions that were created, but didn't reach the AcceptConnState yet
+	// together with the sessions in the sessionQueue, their number is limited by the AcceptQueueLength
+	pendingSessions map[Session]struct{}
+	// sessionQueue holds the sessions that can be returned by Accept
+	// sessions that are closed before being accepted are removed from the queue
+	sessionQueue []Session
+	// sessionQueued is used to wake up Accept when a session is added to the sessionQueue
+	sessionQueued chan struct{}
 
-	newSession func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error)
+	serverError error
+	errorChan   chan struct{}
+
+	newSession func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg handshake.ServerConfigSource, config *Config, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error)
 }
 
 var _ Listener = &server{}
 
+var (
+	errNoTLSConfig                  = errors.New("quic: TLS config must not be nil")
+	errRotationWithServerConfigKeys = errors.New("quic: ServerConfigRotationInterval can't be used together with ServerConfigKeys")
+)
+
 // ListenAddr creates a QUIC server listening on a given address.
-// The listener is not active until Serve() is called.
 func ListenAddr(addr string, config *Config) (Listener, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
@@ -54,19 +78,32 @@ func ListenAddr(addr string, config *Config) (Listener, error) {
 }
 
 // Listen listens for QUIC connections on a given net.PacketConn.
-// The listener is not active until Serve() is called.
 func Listen(conn net.PacketConn, config *Config) (Listener, error) {
+	if config.ServerConfigKeys != nil && config.ServerConfigRotationInterval > 0 {
+		return nil, errRotationWithServerConfigKeys
+	}
+	config = populateServerConfig(config)
 	certChain := crypto.NewCertChain(config.TLSConfig)
-	kex, err := crypto.NewCurve25519KEX()
-	if err != nil {
-		return nil, err
+	keys := config.ServerConfigKeys
+	if keys == nil {
+		var err error
+		keys, err = handshake.GenerateServerConfigKeys()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var scfg handshake.ServerConfigSource
+	var err error
+	if config.ServerConfigRotationInterval > 0 {
+		scfg, err = handshake.NewServerConfigRotator(keys, config.StkSource, certChain, config.AEADs, config.ServerConfigRotationInterval, config.ServerConfigGracePeriod)
+	} else {
+		scfg, err = handshake.NewServerConfigFromKeys(keys, config.StkSource, certChain, config.AEADs)
 	}
-	scfg, err := handshake.NewServerConfig(kex, certChain)
 	if err != nil {
 		return nil, err
 	}
 
-	return &server{
+	s := &server{
 		conn:                      conn,
 		config:                    config,
 		certChain:                 certChain,
@@ -74,11 +111,91 @@ func Listen(conn net.PacketConn, config *Config) (Listener, error) {
 		sessions:                  map[protocol.ConnectionID]packetHandler{},
 		newSession:                newSession,
 		deleteClosedSessionsAfter: protocol.ClosedSessionDeleteTimeout,
-	}, nil
+		pendingSessions:           make(map[Session]struct{}),
+		sessionQueued:             make(chan struct{}, 1),
+		errorChan:                 make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
 }
 
-// Listen listens on an existing PacketConn
-func (s *server) Serve() error {
+// populateServerConfig populates fields in the quic.Config with their default values, if none are set
+func populateServerConfig(config *Config) *Config {
+	handshakeTimeout := protocol.DefaultHandshakeTimeout
+	if config.HandshakeTimeout != 0 {
+		handshakeTimeout = config.HandshakeTimeout
+	}
+	congestionControl := config.CongestionControl
+	if congestionControl == nil {
+		congestionControl = DefaultCongestionControl
+	}
+	idleTimeout := protocol.DefaultIdleTimeout
+	if config.IdleTimeout != 0 {
+		idleTimeout = config.IdleTimeout
+	}
+	acceptConnState := ConnStateForwardSecure
+	if config.AcceptConnState != ConnStateInitial {
+		acceptConnState = config.AcceptConnState
+	}
+	acceptQueueLength := protocol.DefaultAcceptQueueLength
+	if config.AcceptQueueLength != 0 {
+		acceptQueueLength = config.AcceptQueueLength
+	}
+
+	// servers sharing the same keys would present different server configs after the first rotation
+	serverConfigRotationInterval := config.ServerConfigRotationInterval
+	if serverConfigRotationInterval == 0 && config.ServerConfigKeys == nil {
+		serverConfigRotationInterval = protocol.DefaultServerConfigRotationInterval
+	}
+	serverConfigGracePeriod := protocol.DefaultServerConfigGracePeriod
+	if config.ServerConfigGracePeriod != 0 {
+		serverConfigGracePeriod = config.ServerConfigGracePeriod
+	}
+	strikeRegister := config.StrikeRegister
+	if strikeRegister == nil {
+		strikeRegister = crypto.NewStrikeRegister(protocol.StrikeRegisterWindow, protocol.MaxStrikeRegisterEntries)
+	}
+
+	receiveStreamFlowControlWindow := protocol.ReceiveStreamFlowControlWindow
+	if config.ReceiveStreamFlowControlWindow != 0 {
+		receiveStreamFlowControlWindow = config.ReceiveStreamFlowControlWindow
+	}
+	maxReceiveStreamFlowControlWindow := protocol.MaxReceiveStreamFlowControlWindowServer
+	if config.MaxReceiveStreamFlowControlWindow != 0 {
+		maxReceiveStreamFlowControlWindow = config.MaxReceiveStreamFlowControlWindow
+	}
+	receiveConnectionFlowControlWindow := protocol.ReceiveConnectionFlowControlWindow
+	if config.ReceiveConnectionFlowControlWindow != 0 {
+		receiveConnectionFlowControlWindow = config.ReceiveConnectionFlowControlWindow
+	}
+	maxReceiveConnectionFlowControlWindow := protocol.MaxReceiveConnectionFlowControlWindowServer
+	if config.MaxReceiveConnectionFlowControlWindow != 0 {
+		maxReceiveConnectionFlowControlWindow = config.MaxReceiveConnectionFlowControlWindow
+	}
+
+	return &Config{
+		TLSConfig:                             config.TLSConfig,
+		ConnState:                             config.ConnState,
+		HandshakeTimeout:                      handshakeTimeout,
+		IdleTimeout:                           idleTimeout,
+		ReceiveStreamFlowControlWindow:        receiveStreamFlowControlWindow,
+		MaxReceiveStreamFlowControlWindow:     utils.MaxByteCount(maxReceiveStreamFlowControlWindow, receiveStreamFlowControlWindow),
+		ReceiveConnectionFlowControlWindow:    receiveConnectionFlowControlWindow,
+		MaxReceiveConnectionFlowControlWindow: utils.MaxByteCount(maxReceiveConnectionFlowControlWindow, receiveConnectionFlowControlWindow),
+		AcceptConnState:                       acceptConnState,
+		AcceptQueueLength:                     acceptQueueLength,
+		ServerConfigKeys:                      config.ServerConfigKeys,
+		ServerConfigRotationInterval:          serverConfigRotationInterval,
+		ServerConfigGracePeriod:               serverConfigGracePeriod,
+		StkSource:                             config.StkSource,
+		StrikeRegister:                        strikeRegister,
+		AEADs:                                 config.AEADs,
+		CongestionControl:                     congestionControl,
+	}
+}
+
+// serve listens on an existing PacketConn
+func (s *server) serve() {
 	for {
 		data := getPacketBuffer()
 		data = data[:protocol.MaxReceivePacketSize]
@@ -86,7 +203,10 @@ func (s *server) Serve() error {
 		// If it does, we only read a truncated packet, which will then end up undecryptable
 		n, remoteAddr, err := s.conn.ReadFrom(data)
 		if err != nil {
-			return err
+			s.serverError = err
+			close(s.errorChan)
+			_ = s.Close()
+			return
 		}
 		data = data[:n]
 		if err := s.handlePacket(s.conn, remoteAddr, data); err != nil {
@@ -95,9 +215,64 @@ func (s *server) Serve() error {
 	}
 }
 
+// Serve accepts sessions until the server is closed
+//
+// Deprecated: use Accept
+func (s *server) Serve() error {
+	for {
+		if _, err := s.Accept(); err != nil {
+			return err
+		}
+	}
+}
+
+// Accept returns newly opened sessions
+func (s *server) Accept() (Session, error) {
+	for {
+		s.sessionsMutex.Lock()
+		if len(s.sessionQueue) > 0 {
+			sess := s.sessionQueue[0]
+			s.sessionQueue = s.sessionQueue[1:]
+			// wake up the next call to Accept, if there are more sessions in the queue
+			if len(s.sessionQueue) > 0 {
+				s.signalSessionQueued()
+			}
+			s.sessionsMutex.Unlock()
+			return sess, nil
+		}
+		s.sessionsMutex.Unlock()
+
+		select {
+		case <-s.sessionQueued:
+		case <-s.errorChan:
+			return nil, s.serverError
+		}
+	}
+}
+
+// queueSession adds a session to the sessionQueue
+// it must be called with the sessionsMutex locked
+func (s *server) queueSession(sess Session) {
+	s.sessionQueue = append(s.sessionQueue, sess)
+	s.signalSessionQueued()
+}
+
+func (s *server) signalSessionQueued() {
+	select {
+	case s.sessionQueued <- struct{}{}:
+	default:
+	}
+}
+
 // Close the server
 func (s *server) Close() error {
 	s.sessionsMutex.Lock()
+	if s.closed {
+		s.sessionsMutex.Unlock()
+		return nil
+	}
+	s.closed = true
+
 	for _, session := range s.sessions {
 		if session != nil {
 			s.sessionsMutex.Unlock()
@@ -113,6 +288,57 @@ func (s *server) Close() error {
 	return s.conn.Close()
 }
 
+// SetTLSConfig replaces the TLS config used for new handshakes
+func (s *server) SetTLSConfig(tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return errNoTLSConfig
+	}
+	s.certChain.SetTLSConfig(tlsConfig)
+	return nil
+}
+
+// Drain gracefully shuts down the server
+func (s *server) Drain(ctx context.Context) error {
+	s.sessionsMutex.Lock()
+	s.draining = true
+	sessions := make([]packetHandler, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	s.sessionsMutex.Unlock()
+
+	for _, session := range sessions {
+		_ = session.GoAway(qerr.PeerGoingAway, "server shutting down")
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for s.numOpenSessions() > 0 {
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return s.Close()
+}
+
+func (s *server) numOpenSessions() int {
+	s.sessionsMutex.RLock()
+	defer s.sessionsMutex.RUnlock()
+
+	var n int
+	for _, session := range s.sessions {
+		if session != nil {
+			n++
+		}
+	}
+	return n
+}
+
 // Addr returns the server's network address
 func (s *server) Addr() net.Addr {
 	return s.conn.LocalAddr()
@@ -176,22 +402,45 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 			return errors.New("Server BUG: negotiated version not supported")
 		}
 
+		// New sessions are only created here, so the number of queued sessions can't grow while we're creating the new session.
+		// It's therefore safe to release the lock after checking the limit.
+		s.sessionsMutex.RLock()
+		numQueuedSessions := len(s.pendingSessions) + len(s.sessionQueue)
+		draining := s.draining
+		s.sessionsMutex.RUnlock()
+		if draining {
+			utils.Infof("Refusing new connection %x from %v: server is draining", hdr.ConnectionID, remoteAddr)
+			_, err = pconn.WriteTo(writePublicReset(hdr.ConnectionID, hdr.PacketNumber, 0), remoteAddr)
+			return err
+		}
+		if numQueuedSessions >= s.config.AcceptQueueLength {
+			utils.Infof("Refusing new connection %x from %v: accept queue full", hdr.ConnectionID, remoteAddr)
+			_, err = pconn.WriteTo(writePublicReset(hdr.ConnectionID, hdr.PacketNumber, 0), remoteAddr)
+			return err
+		}
+
 		utils.Infof("Serving new connection: %x, version %d from %v", hdr.ConnectionID, version, remoteAddr)
 		session, err = s.newSession(
 			&conn{pconn: pconn, currentAddr: remoteAddr},
 			version,
 			hdr.ConnectionID,
 			s.scfg,
+			s.config,
 			s.closeCallback,
 			s.cryptoChangeCallback,
 		)
 		if err != nil {
 			return err
 		}
-		go session.run()
 		s.sessionsMutex.Lock()
 		s.sessions[hdr.ConnectionID] = session
+		if s.config.AcceptConnState == ConnStateVersionNegotiated {
+			s.queueSession(session)
+		} else {
+			s.pendingSessions[session] = struct{}{}
+		}
 		s.sessionsMutex.Unlock()
+		go session.run()
 		if s.config.ConnState != nil {
 			go s.config.ConnState(session, ConnStateVersionNegotiated)
 		}
@@ -216,6 +465,14 @@ func (s *server) cryptoChangeCallback(session Session, isForwardSecure bool) {
 	} else {
 		state = ConnStateSecure
 	}
+	if state == s.config.AcceptConnState {
+		s.sessionsMutex.Lock()
+		if _, ok := s.pendingSessions[session]; ok {
+			delete(s.pendingSessions, session)
+			s.queueSession(session)
+		}
+		s.sessionsMutex.Unlock()
+	}
 	if s.config.ConnState != nil {
 		go s.config.ConnState(session, state)
 	}
@@ -223,6 +480,15 @@ func (s *server) cryptoChangeCallback(session Session, isForwardSecure bool) {
 
 func (s *server) closeCallback(id protocol.ConnectionID) {
 	s.sessionsMutex.Lock()
+	if session, ok := s.sessions[id]; ok && session != nil {
+		delete(s.pendingSessions, session)
+		for i, sess := range s.sessionQueue {
+			if sess == session {
+				s.sessionQueue = append(s.sessionQueue[:i], s.sessionQueue[i+1:]...)
+				break
+			}
+		}
+	}
 	s.sessions[id] = nil
 	s.sessionsMutex.Unlock()
 
@@ -2,6 +2,8 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"time"
@@ -21,6 +23,8 @@ type mockSession struct {
 	packetCount  int
 	closed       bool
 	closeReason  error
+	goAwayCode   qerr.ErrorCode
+	goAwayCalled bool
 }
 
 func (s *mockSession) handlePacket(*receivedPacket) {
@@ -33,6 +37,10 @@ func (s *mockSession) Close(e error) error {
 	s.closed = true
 	return nil
 }
+func (s *mockSession) closeRemote(e error) {
+	s.closeReason = e
+	s.closed = true
+}
 func (s *mockSession) AcceptStream() (Stream, error) {
 	panic("not implemented")
 }
@@ -42,6 +50,26 @@ func (s *mockSession) OpenStream() (Stream, error) {
 func (s *mockSession) OpenStreamSync() (Stream, error) {
 	panic("not implemented")
 }
+func (s *mockSession) AcceptStreamContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenStreamSyncContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) ConnectionState() ConnectionState {
+	panic("not implemented")
+}
+func (s *mockSession) Stats() SessionStats {
+	panic("not implemented")
+}
+func (s *mockSession) CloseWithError(code uint32, msg string) error {
+	panic("not implemented")
+}
+func (s *mockSession) GoAway(code qerr.ErrorCode, reason string) error {
+	s.goAwayCode = code
+	s.goAwayCalled = true
+	return nil
+}
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
@@ -51,7 +79,7 @@ func (s *mockSession) RemoteAddr() net.Addr {
 
 var _ Session = &mockSession{}
 
-func newMockSession(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error) {
+func newMockSession(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg handshake.ServerConfigSource, config *Config, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error) {
 	return &mockSession{
 		connectionID: connectionID,
 	}, nil
@@ -77,11 +105,15 @@ var _ = Describe("Server", func() {
 		)
 
 		BeforeEach(func() {
+			config = populateServerConfig(config)
 			serv = &server{
-				sessions:   make(map[protocol.ConnectionID]packetHandler),
-				newSession: newMockSession,
-				conn:       conn,
-				config:     config,
+				sessions:        make(map[protocol.ConnectionID]packetHandler),
+				newSession:      newMockSession,
+				conn:            conn,
+				config:          config,
+				pendingSessions: make(map[Session]struct{}),
+				sessionQueued:   make(chan struct{}, 1),
+				errorChan:       make(chan struct{}),
 			}
 			b := &bytes.Buffer{}
 			utils.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]))
@@ -218,7 +250,7 @@ var _ = Describe("Server", func() {
 			var returned bool
 			go func() {
 				defer GinkgoRecover()
-				err := ln.Serve()
+				_, err := ln.Accept()
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("use of closed network connection"))
 				returned = true
@@ -230,10 +262,196 @@ var _ = Describe("Server", func() {
 		It("errors when encountering a connection error", func() {
 			testErr := errors.New("connection error")
 			conn.readErr = testErr
+			go serv.serve()
+			_, err := serv.Accept()
+			Expect(err).To(MatchError(testErr))
+			Expect(conn.closed).To(BeTrue())
+		})
+
+		It("returns from Serve when encountering a connection error", func() {
+			testErr := errors.New("connection error")
+			conn.readErr = testErr
+			go serv.serve()
 			err := serv.Serve()
 			Expect(err).To(MatchError(testErr))
 		})
 
+		It("only closes once", func() {
+			session := &mockSession{}
+			serv.sessions[1] = session
+			Expect(serv.Close()).To(Succeed())
+			session.closed = false
+			Expect(serv.Close()).To(Succeed())
+			Expect(session.closed).To(BeFalse())
+		})
+
+		Context("draining", func() {
+			It("sends a GOAWAY on all sessions, and closes once all sessions are closed", func() {
+				session := &mockSession{}
+				serv.sessions[1] = session
+				var returned bool
+				go func() {
+					defer GinkgoRecover()
+					err := serv.Drain(context.Background())
+					Expect(err).ToNot(HaveOccurred())
+					returned = true
+				}()
+				Eventually(func() bool { return session.goAwayCalled }).Should(BeTrue())
+				Expect(session.goAwayCode).To(Equal(qerr.PeerGoingAway))
+				Consistently(func() bool { return returned }).Should(BeFalse())
+				Expect(conn.closed).To(BeFalse())
+				serv.closeCallback(1)
+				Eventually(func() bool { return returned }).Should(BeTrue())
+				Expect(conn.closed).To(BeTrue())
+			})
+
+			It("closes the server when the context expires", func() {
+				session := &mockSession{}
+				serv.sessions[1] = session
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				err := serv.Drain(ctx)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+				Expect(session.closed).To(BeTrue())
+				Expect(conn.closed).To(BeTrue())
+			})
+
+			It("rejects new connections with a Public Reset", func() {
+				serv.draining = true
+				err := serv.handlePacket(conn, udpAddr, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions).To(BeEmpty())
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
+			})
+		})
+
+		Context("accepting sessions", func() {
+			It("returns sessions once they are forward-secure", func() {
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess := serv.sessions[connID]
+				var acceptedSess Session
+				go func() {
+					defer GinkgoRecover()
+					acceptedSess, err = serv.Accept()
+					Expect(err).ToNot(HaveOccurred())
+				}()
+				serv.cryptoChangeCallback(sess, false)
+				Consistently(func() Session { return acceptedSess }).Should(BeNil())
+				serv.cryptoChangeCallback(sess, true)
+				Eventually(func() Session { return acceptedSess }).Should(Equal(sess))
+			})
+
+			It("returns sessions once the version is negotiated, if configured", func() {
+				serv.config.AcceptConnState = ConnStateVersionNegotiated
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess, err := serv.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(Equal(serv.sessions[connID]))
+			})
+
+			It("returns sessions once they are secure, if configured", func() {
+				serv.config.AcceptConnState = ConnStateSecure
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessionQueue).To(BeEmpty())
+				serv.cryptoChangeCallback(serv.sessions[connID], false)
+				Expect(serv.sessionQueue).To(HaveLen(1))
+				// make sure the session is only queued once
+				serv.cryptoChangeCallback(serv.sessions[connID], true)
+				Expect(serv.sessionQueue).To(HaveLen(1))
+			})
+
+			It("rejects new connections with a Public Reset when the accept queue is full", func() {
+				serv.config.AcceptQueueLength = 1
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions).To(HaveLen(1))
+				b := &bytes.Buffer{}
+				utils.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]))
+				secondPacket := []byte{0x09, 0x37, 0x13, 0, 0, 0, 0, 0, 0}
+				secondPacket = append(append(secondPacket, b.Bytes()...), 0x01)
+				err = serv.handlePacket(conn, udpAddr, secondPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions).To(HaveLen(1))
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
+			})
+
+			It("counts queued sessions until they are accepted", func() {
+				serv.config.AcceptQueueLength = 1
+				serv.config.AcceptConnState = ConnStateVersionNegotiated
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessionQueue).To(HaveLen(1))
+				b := &bytes.Buffer{}
+				utils.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]))
+				secondPacket := []byte{0x09, 0x37, 0x13, 0, 0, 0, 0, 0, 0}
+				secondPacket = append(append(secondPacket, b.Bytes()...), 0x01)
+				err = serv.handlePacket(conn, udpAddr, secondPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions).To(HaveLen(1))
+				_, err = serv.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				err = serv.handlePacket(conn, udpAddr, secondPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions).To(HaveLen(2))
+			})
+
+			It("doesn't count sessions that were closed before they were accepted", func() {
+				serv.config.AcceptQueueLength = 1
+				serv.deleteClosedSessionsAfter = time.Hour
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.pendingSessions).To(HaveLen(1))
+				serv.closeCallback(connID)
+				Expect(serv.pendingSessions).To(BeEmpty())
+			})
+
+			It("doesn't return sessions that were closed while in the accept queue", func() {
+				serv.config.AcceptConnState = ConnStateVersionNegotiated
+				serv.deleteClosedSessionsAfter = time.Hour
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessionQueue).To(HaveLen(1))
+				serv.closeCallback(connID)
+				Expect(serv.sessionQueue).To(BeEmpty())
+				b := &bytes.Buffer{}
+				utils.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]))
+				secondPacket := []byte{0x09, 0x37, 0x13, 0, 0, 0, 0, 0, 0}
+				secondPacket = append(append(secondPacket, b.Bytes()...), 0x01)
+				err = serv.handlePacket(conn, udpAddr, secondPacket)
+				Expect(err).ToNot(HaveOccurred())
+				sess, err := serv.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(Equal(serv.sessions[0x1337]))
+			})
+
+			It("returns multiple queued sessions to concurrent calls to Accept", func() {
+				serv.config.AcceptConnState = ConnStateVersionNegotiated
+				sessChan := make(chan Session, 2)
+				for i := 0; i < 2; i++ {
+					go func() {
+						defer GinkgoRecover()
+						sess, err := serv.Accept()
+						Expect(err).ToNot(HaveOccurred())
+						sessChan <- sess
+					}()
+				}
+				err := serv.handlePacket(nil, nil, firstPacket)
+				Expect(err).ToNot(HaveOccurred())
+				b := &bytes.Buffer{}
+				utils.WriteUint32(b, protocol.VersionNumberToTag(protocol.SupportedVersions[0]))
+				secondPacket := []byte{0x09, 0x37, 0x13, 0, 0, 0, 0, 0, 0}
+				secondPacket = append(append(secondPacket, b.Bytes()...), 0x01)
+				err = serv.handlePacket(conn, udpAddr, secondPacket)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(sessChan).Should(HaveLen(2))
+			})
+		})
+
 		It("ignores delayed packets with mismatching versions", func() {
 			err := serv.handlePacket(nil, nil, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
@@ -301,7 +519,10 @@ var _ = Describe("Server", func() {
 
 	It("setups with the right values", func() {
 		config := Config{
-			ConnState: func(_ Session, _ ConnState) {},
+			ConnState:                         func(_ Session, _ ConnState) {},
+			HandshakeTimeout:                  1337 * time.Hour,
+			IdleTimeout:                       42 * time.Minute,
+			MaxReceiveStreamFlowControlWindow: 16 << 20,
 		}
 		ln, err := Listen(conn, &config)
 		server := ln.(*server)
@@ -309,7 +530,96 @@ var _ = Describe("Server", func() {
 		Expect(server.deleteClosedSessionsAfter).To(Equal(protocol.ClosedSessionDeleteTimeout))
 		Expect(server.sessions).ToNot(BeNil())
 		Expect(server.scfg).ToNot(BeNil())
-		Expect(server.config).To(Equal(&config))
+		Expect(server.config.ConnState).ToNot(BeNil())
+		Expect(server.config.HandshakeTimeout).To(Equal(1337 * time.Hour))
+		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
+		Expect(server.config.MaxReceiveStreamFlowControlWindow).To(Equal(protocol.ByteCount(16 << 20)))
+	})
+
+	It("fills in default values if options are not set in the Config", func() {
+		ln, err := Listen(conn, &Config{})
+		Expect(err).ToNot(HaveOccurred())
+		server := ln.(*server)
+		Expect(server.config.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
+		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+		Expect(server.config.ReceiveStreamFlowControlWindow).To(Equal(protocol.ReceiveStreamFlowControlWindow))
+		Expect(server.config.MaxReceiveStreamFlowControlWindow).To(Equal(protocol.MaxReceiveStreamFlowControlWindowServer))
+		Expect(server.config.ReceiveConnectionFlowControlWindow).To(Equal(protocol.ReceiveConnectionFlowControlWindow))
+		Expect(server.config.MaxReceiveConnectionFlowControlWindow).To(Equal(protocol.MaxReceiveConnectionFlowControlWindowServer))
+		Expect(server.config.AcceptConnState).To(Equal(ConnStateForwardSecure))
+		Expect(server.config.CongestionControl).ToNot(BeNil())
+		Expect(server.config.AcceptQueueLength).To(Equal(protocol.DefaultAcceptQueueLength))
+	})
+
+	It("uses the server config keys", func() {
+		keys, err := handshake.GenerateServerConfigKeys()
+		Expect(err).ToNot(HaveOccurred())
+		ln1, err := Listen(conn, &Config{ServerConfigKeys: keys})
+		Expect(err).ToNot(HaveOccurred())
+		ln2, err := Listen(&mockPacketConn{}, &Config{ServerConfigKeys: keys})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln1.(*server).scfg.GetPrimary().ID).To(Equal(keys.ID))
+		Expect(ln1.(*server).scfg.GetPrimary().Get()).To(Equal(ln2.(*server).scfg.GetPrimary().Get()))
+		// servers sharing keys don't rotate the server config by default
+		Expect(ln1.(*server).scfg).To(BeAssignableToTypeOf(&handshake.ServerConfig{}))
+	})
+
+	It("uses the StkSource", func() {
+		stkSource, err := crypto.NewStkSource([]byte("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		ln, err := Listen(conn, &Config{StkSource: stkSource})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.(*server).config.StkSource).To(Equal(stkSource))
+		// the server config keys don't need an STK secret when using a StkSource
+		keys, err := handshake.GenerateServerConfigKeys()
+		Expect(err).ToNot(HaveOccurred())
+		keys.STKSecret = nil
+		_, err = Listen(conn, &Config{StkSource: stkSource, ServerConfigKeys: keys})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = Listen(conn, &Config{ServerConfigKeys: keys})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rotates the server config by default", func() {
+		ln, err := Listen(conn, &Config{})
+		Expect(err).ToNot(HaveOccurred())
+		server := ln.(*server)
+		Expect(server.scfg).To(BeAssignableToTypeOf(&handshake.ServerConfigRotator{}))
+		Expect(server.config.ServerConfigRotationInterval).To(Equal(protocol.DefaultServerConfigRotationInterval))
+		Expect(server.config.ServerConfigGracePeriod).To(Equal(protocol.DefaultServerConfigGracePeriod))
+	})
+
+	It("refuses to rotate the server config when using server config keys", func() {
+		keys, err := handshake.GenerateServerConfigKeys()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = Listen(conn, &Config{ServerConfigKeys: keys, ServerConfigRotationInterval: time.Hour})
+		Expect(err).To(MatchError(errRotationWithServerConfigKeys))
+	})
+
+	It("replaces the TLS config", func() {
+		leafCert := func(ln Listener) []byte {
+			cert, err := ln.(*server).certChain.GetCertificate("")
+			Expect(err).ToNot(HaveOccurred())
+			return cert.Certificate[0]
+		}
+		tlsConf := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("old leaf")}}}}
+		ln, err := Listen(conn, &Config{TLSConfig: tlsConf})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leafCert(ln)).To(Equal([]byte("old leaf")))
+		err = ln.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("new leaf")}}}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leafCert(ln)).To(Equal([]byte("new leaf")))
+	})
+
+	It("doesn't accept a nil TLS config", func() {
+		ln, err := Listen(conn, &Config{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.SetTLSConfig(nil)).To(MatchError(errNoTLSConfig))
+	})
+
+	It("errors if the server config keys are invalid", func() {
+		_, err := Listen(conn, &Config{ServerConfigKeys: &handshake.ServerConfigKeys{}})
+		Expect(err).To(HaveOccurred())
 	})
 
 	It("listens on a given address", func() {
@@ -318,6 +628,7 @@ var _ = Describe("Server", func() {
 		Expect(err).ToNot(HaveOccurred())
 		serv := ln.(*server)
 		Expect(serv.Addr().String()).To(Equal(addr))
+		ln.Close()
 	})
 
 	It("errors if given an invalid address", func() {
@@ -344,15 +655,9 @@ var _ = Describe("Server", func() {
 		b.Write(bytes.Repeat([]byte{0}, protocol.ClientHelloMinimumSize)) // add a fake CHLO
 		conn.dataToRead = b.Bytes()
 		conn.dataReadFrom = udpAddr
-		ln, err := Listen(conn, config)
+		_, err := Listen(conn, config)
 		Expect(err).ToNot(HaveOccurred())
 
-		var returned bool
-		go func() {
-			ln.Serve()
-			returned = true
-		}()
-
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		expected := append(
@@ -360,7 +665,6 @@ var _ = Describe("Server", func() {
 			protocol.SupportedVersionsAsTags...,
 		)
 		Expect(conn.dataWritten.Bytes()).To(Equal(expected))
-		Expect(returned).To(BeFalse())
 	})
 
 	It("sends a PublicReset for new connections that don't have the VersionFlag set", func() {
@@ -368,11 +672,6 @@ var _ = Describe("Server", func() {
 		conn.dataToRead = []byte{0x08, 0xf6, 0x19, 0x86, 0x66, 0x9b, 0x9f, 0xfa, 0x4c, 0x01}
 		ln, err := Listen(conn, config)
 		Expect(err).ToNot(HaveOccurred())
-		go func() {
-			defer GinkgoRecover()
-			err := ln.Serve()
-			Expect(err).ToNot(HaveOccurred())
-		}()
 
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
@@ -1,10 +1,11 @@
 package quic
 
 import (
-	"crypto/tls"
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +36,58 @@ var (
 	errSessionAlreadyClosed       = errors.New("cannot close session; it was already closed before")
 )
 
+// A GoAwayError is returned when opening a stream on a session that sent or received a GOAWAY.
+// Streams that were opened by us, but not processed by the peer before it sent the GOAWAY, are cancelled with a GoAwayError.
+// It is safe to retry the operation on a new session.
+type GoAwayError struct {
+	ErrorCode    qerr.ErrorCode
+	ReasonPhrase string
+	// Remote is true if the GOAWAY was sent by the peer
+	Remote bool
+}
+
+func (e *GoAwayError) Error() string {
+	if e.Remote {
+		return fmt.Sprintf("received GOAWAY: %s: %s", e.ErrorCode.String(), e.ReasonPhrase)
+	}
+	return fmt.Sprintf("sent GOAWAY: %s: %s", e.ErrorCode.String(), e.ReasonPhrase)
+}
+
+// MaxApplicationErrorCode is the largest error code that can be used with CloseWithError and ResetWithCode
+const MaxApplicationErrorCode = 1<<31 - 1
+
+// applicationErrorFlag is set on the error codes of CONNECTION_CLOSE and RST_STREAM frames carrying an application error code.
+// It distinguishes them from the error codes defined by QUIC.
+// It is only used if both endpoints sent the APEC tag in the handshake. Otherwise, the error codes keep their meaning defined by QUIC.
+const applicationErrorFlag = 1 << 31
+
+var errInvalidApplicationErrorCode = errors.New("application error code too large")
+
+// An ApplicationError is an error defined by the application.
+// It is sent to the peer by Session.CloseWithError and Stream.ResetWithCode, and returned by all operations on the session, or the stream, respectively.
+type ApplicationError struct {
+	ErrorCode uint32
+	// ReasonPhrase is only sent when closing the session
+	ReasonPhrase string
+	// Remote is true if the error was sent by the peer
+	Remote bool
+}
+
+func (e *ApplicationError) Error() string {
+	if len(e.ReasonPhrase) == 0 {
+		return fmt.Sprintf("application error %d", e.ErrorCode)
+	}
+	return fmt.Sprintf("application error %d: %s", e.ErrorCode, e.ReasonPhrase)
+}
+
+func (e *ApplicationError) wireErrorCode() uint32 {
+	return applicationErrorFlag | e.ErrorCode
+}
+
+func isApplicationErrorCode(code uint32) bool {
+	return code&applicationErrorFlag != 0
+}
+
 // cryptoChangeCallback is called every time the encryption level changes
 // Once the callback has been called with isForwardSecure = true, it is guarantueed to not be called with isForwardSecure = false after that
 type cryptoChangeCallback func(session Session, isForwardSecure bool)
@@ -51,7 +104,8 @@ type session struct {
 	closeCallback        closeCallback
 	cryptoChangeCallback cryptoChangeCallback
 
-	conn connection
+	conn   connection
+	config *Config
 
 	streamsMap *streamsMap
 
@@ -82,6 +136,7 @@ type session struct {
 	receivedTooManyUndecrytablePacketsTime time.Time
 
 	aeadChanged chan protocol.EncryptionLevel
+	goAwayChan  chan *frames.GoawayFrame
 
 	nextAckScheduledTime time.Time
 
@@ -98,21 +153,39 @@ type session struct {
 	timer           *time.Timer
 	currentDeadline time.Time
 	timerRead       bool
+
+	// only accessed by the run loop
+	packetsReceived         uint64
+	bytesReceived           protocol.ByteCount
+	numUndecryptablePackets uint64
+	// stats is a snapshot of the statistics, updated by the run loop
+	stats      SessionStats
+	statsMutex sync.Mutex
 }
 
 var _ Session = &session{}
 
 // newSession makes a new session
-func newSession(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error) {
+func newSession(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg handshake.ServerConfigSource, config *Config, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback) (packetHandler, error) {
 	s := &session{
 		conn:         conn,
+		config:       config,
 		connectionID: connectionID,
 		perspective:  protocol.PerspectiveServer,
 		version:      v,
 
 		closeCallback:        closeCallback,
 		cryptoChangeCallback: cryptoChangeCallback,
-		connectionParameters: handshake.NewConnectionParamatersManager(protocol.PerspectiveServer, v),
+		connectionParameters: handshake.NewConnectionParamatersManager(
+			protocol.PerspectiveServer,
+			v,
+			config.ReceiveStreamFlowControlWindow,
+			config.MaxReceiveStreamFlowControlWindow,
+			config.ReceiveConnectionFlowControlWindow,
+			config.MaxReceiveConnectionFlowControlWindow,
+			config.IdleTimeout,
+			nil,
+		),
 	}
 
 	s.setup()
@@ -125,7 +198,7 @@ func newSession(conn connection, v protocol.VersionNumber, connectionID protocol
 		sourceAddr = []byte(conn.RemoteAddr().String())
 	}
 	var err error
-	s.cryptoSetup, err = handshake.NewCryptoSetup(connectionID, sourceAddr, v, sCfg, cryptoStream, s.connectionParameters, s.aeadChanged)
+	s.cryptoSetup, err = handshake.NewCryptoSetup(connectionID, sourceAddr, v, sCfg, s.config.StrikeRegister, cryptoStream, s.connectionParameters, s.aeadChanged)
 	if err != nil {
 		return nil, err
 	}
@@ -136,16 +209,26 @@ func newSession(conn connection, v protocol.VersionNumber, connectionID protocol
 	return s, err
 }
 
-func newClientSession(conn connection, hostname string, v protocol.VersionNumber, connectionID protocol.ConnectionID, tlsConfig *tls.Config, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback, negotiatedVersions []protocol.VersionNumber) (*session, error) {
+func newClientSession(conn connection, hostname string, v protocol.VersionNumber, connectionID protocol.ConnectionID, config *Config, closeCallback closeCallback, cryptoChangeCallback cryptoChangeCallback, negotiatedVersions []protocol.VersionNumber) (*session, error) {
 	s := &session{
 		conn:         conn,
+		config:       config,
 		connectionID: connectionID,
 		perspective:  protocol.PerspectiveClient,
 		version:      v,
 
 		closeCallback:        closeCallback,
 		cryptoChangeCallback: cryptoChangeCallback,
-		connectionParameters: handshake.NewConnectionParamatersManager(protocol.PerspectiveClient, v),
+		connectionParameters: handshake.NewConnectionParamatersManager(
+			protocol.PerspectiveClient,
+			v,
+			config.ReceiveStreamFlowControlWindow,
+			config.MaxReceiveStreamFlowControlWindow,
+			config.ReceiveConnectionFlowControlWindow,
+			config.MaxReceiveConnectionFlowControlWindow,
+			config.IdleTimeout,
+			config.ConnectionOptions,
+		),
 	}
 
 	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.ackAlarmChanged)
@@ -153,7 +236,7 @@ func newClientSession(conn connection, hostname string, v protocol.VersionNumber
 
 	cryptoStream, _ := s.OpenStream()
 	var err error
-	s.cryptoSetup, err = handshake.NewCryptoSetupClient(hostname, connectionID, v, cryptoStream, tlsConfig, s.connectionParameters, s.aeadChanged, negotiatedVersions)
+	s.cryptoSetup, err = handshake.NewCryptoSetupClient(hostname, connectionID, v, cryptoStream, config.TLSConfig, s.connectionParameters, s.aeadChanged, negotiatedVersions, config.ClientSessionCache, config.KeyExchanges, config.AEADs, config.VerifyPeerCertificate, config.SCTPolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +252,8 @@ func (s *session) setup() {
 	s.rttStats = &congestion.RTTStats{}
 	flowControlManager := flowcontrol.NewFlowControlManager(s.connectionParameters, s.rttStats)
 
-	sentPacketHandler := ackhandler.NewSentPacketHandler(s.rttStats)
+	// for the server, the connection options are not known until the CHLO is received
+	sentPacketHandler := ackhandler.NewSentPacketHandler(s.rttStats, s.newCongestionControl(s.connectionParameters.GetConnectionOptions()))
 
 	now := time.Now()
 
@@ -182,6 +266,7 @@ func (s *session) setup() {
 	s.sendingScheduled = make(chan struct{}, 1)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
 	s.aeadChanged = make(chan protocol.EncryptionLevel, 2)
+	s.goAwayChan = make(chan *frames.GoawayFrame, 1)
 	s.runClosed = make(chan struct{}, 1)
 
 	s.timer = time.NewTimer(0)
@@ -190,6 +275,26 @@ func (s *session) setup() {
 
 	s.streamsMap = newStreamsMap(s.newStream, s.perspective, s.connectionParameters)
 	s.streamFramer = newStreamFramer(s.streamsMap, s.flowControlManager)
+
+	s.updateStats()
+}
+
+// maybeUpdateCongestionControl replaces the congestion controller of the server,
+// if the client sent connection options in the CHLO
+func (s *session) maybeUpdateCongestionControl() {
+	if s.perspective != protocol.PerspectiveServer {
+		return
+	}
+	connectionOptions := s.connectionParameters.GetConnectionOptions()
+	if len(connectionOptions) == 0 {
+		return
+	}
+	s.sentPacketHandler.SetCongestionControl(s.newCongestionControl(connectionOptions))
+}
+
+// newCongestionControl creates the congestion controller, and paces the packets it allows to be sent
+func (s *session) newCongestionControl(connectionOptions []handshake.Tag) congestion.SendAlgorithm {
+	return congestion.NewPacingSender(s.config.CongestionControl(s.rttStats, connectionOptions), s.rttStats)
 }
 
 // run the session main loop
@@ -232,7 +337,9 @@ runLoop:
 		case p := <-s.receivedPackets:
 			err = s.handlePacketImpl(p)
 			if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
+				s.numUndecryptablePackets++
 				s.tryQueueingUndecryptablePacket(p)
+				s.updateStats()
 				continue
 			}
 			// This is a bit unclean, but works properly, since the packet always
@@ -241,9 +348,12 @@ runLoop:
 		case l := <-s.aeadChanged:
 			if l == protocol.EncryptionForwardSecure {
 				s.packer.SetForwardSecure()
+				s.maybeUpdateCongestionControl()
 			}
 			s.tryDecryptingQueuedPackets()
 			s.cryptoChangeCallback(s, l == protocol.EncryptionForwardSecure)
+		case f := <-s.goAwayChan:
+			s.packer.QueueControlFrameForNextPacket(f)
 		}
 
 		if err != nil {
@@ -251,7 +361,7 @@ runLoop:
 		}
 
 		now := time.Now()
-		if s.sentPacketHandler.GetAlarmTimeout().Before(now) {
+		if alarm := s.sentPacketHandler.GetAlarmTimeout(); !alarm.IsZero() && alarm.Before(now) {
 			// This could cause packets to be retransmitted, so check it before trying
 			// to send packets.
 			s.sentPacketHandler.OnAlarm()
@@ -266,12 +376,17 @@ runLoop:
 		if now.Sub(s.lastNetworkActivityTime) >= s.idleTimeout() {
 			s.close(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
 		}
-		if !s.cryptoSetup.HandshakeComplete() && now.Sub(s.sessionCreationTime) >= protocol.MaxTimeForCryptoHandshake {
-			s.close(qerr.Error(qerr.NetworkIdleTimeout, "Crypto handshake did not complete in time."))
+		if !s.cryptoSetup.HandshakeComplete() && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
+			s.close(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
 		}
 		s.garbageCollectStreams()
+		if s.isDrained() {
+			s.close(nil)
+		}
+		s.updateStats()
 	}
 
+	s.updateStats()
 	s.closeCallback(s.connectionID)
 	s.runClosed <- struct{}{}
 }
@@ -285,8 +400,11 @@ func (s *session) maybeResetTimer() {
 	if lossTime := s.sentPacketHandler.GetAlarmTimeout(); !lossTime.IsZero() {
 		nextDeadline = utils.MinTime(nextDeadline, lossTime)
 	}
+	if pacingTime := s.sentPacketHandler.GetPacingTimeout(); !pacingTime.IsZero() {
+		nextDeadline = utils.MinTime(nextDeadline, pacingTime)
+	}
 	if !s.cryptoSetup.HandshakeComplete() {
-		handshakeDeadline := s.sessionCreationTime.Add(protocol.MaxTimeForCryptoHandshake)
+		handshakeDeadline := s.sessionCreationTime.Add(s.config.HandshakeTimeout)
 		nextDeadline = utils.MinTime(nextDeadline, handshakeDeadline)
 	}
 	if !s.receivedTooManyUndecrytablePacketsTime.IsZero() {
@@ -361,6 +479,8 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 		return err
 	}
 
+	s.packetsReceived++
+	s.bytesReceived += protocol.ByteCount(len(data) + len(hdr.Raw))
 	s.lastRcvdPacketNumber = hdr.PacketNumber
 	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
 	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
@@ -394,9 +514,9 @@ func (s *session) handleFrames(fs []frames.Frame) error {
 		case *frames.AckFrame:
 			err = s.handleAckFrame(frame)
 		case *frames.ConnectionCloseFrame:
-			s.closeImpl(qerr.Error(frame.ErrorCode, frame.ReasonPhrase), true)
+			s.handleConnectionCloseFrame(frame)
 		case *frames.GoawayFrame:
-			err = errors.New("unimplemented: handling GOAWAY frames")
+			s.handleGoawayFrame(frame)
 		case *frames.StopWaitingFrame:
 			err = s.receivedPacketHandler.ReceivedStopWaiting(frame)
 		case *frames.RstStreamFrame:
@@ -438,6 +558,10 @@ func (s *session) handlePacket(p *receivedPacket) {
 
 func (s *session) handleStreamFrame(frame *frames.StreamFrame) error {
 	str, err := s.streamsMap.GetOrOpenStream(frame.StreamID)
+	if err == errStreamRefused {
+		s.queueResetStreamFrame(frame.StreamID, 0, 0)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -449,6 +573,27 @@ func (s *session) handleStreamFrame(frame *frames.StreamFrame) error {
 	return str.AddStreamFrame(frame)
 }
 
+func (s *session) handleConnectionCloseFrame(frame *frames.ConnectionCloseFrame) {
+	if s.connectionParameters.ApplicationErrorCodesNegotiated() && isApplicationErrorCode(uint32(frame.ErrorCode)) {
+		s.closeImpl(&ApplicationError{
+			ErrorCode:    uint32(frame.ErrorCode) &^ applicationErrorFlag,
+			ReasonPhrase: frame.ReasonPhrase,
+			Remote:       true,
+		}, true)
+		return
+	}
+	s.closeImpl(qerr.Error(frame.ErrorCode, frame.ReasonPhrase), true)
+}
+
+func (s *session) handleGoawayFrame(frame *frames.GoawayFrame) {
+	utils.Infof("Received GOAWAY for connection %x: %s (last good stream: %d)", s.connectionID, frame.ReasonPhrase, frame.LastGoodStream)
+	s.streamsMap.ReceivedGoAway(frame.LastGoodStream, &GoAwayError{
+		ErrorCode:    frame.ErrorCode,
+		ReasonPhrase: frame.ReasonPhrase,
+		Remote:       true,
+	})
+}
+
 func (s *session) handleWindowUpdateFrame(frame *frames.WindowUpdateFrame) error {
 	if frame.StreamID != 0 {
 		str, err := s.streamsMap.GetOrOpenStream(frame.StreamID)
@@ -472,7 +617,14 @@ func (s *session) handleRstStreamFrame(frame *frames.RstStreamFrame) error {
 		return errRstStreamOnInvalidStream
 	}
 
-	str.RegisterRemoteError(fmt.Errorf("RST_STREAM received with code %d", frame.ErrorCode))
+	if s.connectionParameters.ApplicationErrorCodesNegotiated() && isApplicationErrorCode(frame.ErrorCode) {
+		str.RegisterRemoteError(&ApplicationError{
+			ErrorCode: frame.ErrorCode &^ applicationErrorFlag,
+			Remote:    true,
+		})
+	} else {
+		str.RegisterRemoteError(fmt.Errorf("RST_STREAM received with code %d", frame.ErrorCode))
+	}
 	return s.flowControlManager.ResetStream(frame.StreamID, frame.ByteOffset)
 }
 
@@ -493,6 +645,14 @@ func (s *session) Close(e error) error {
 	return err
 }
 
+// CloseWithError closes the connection, sending an application error code and message to the peer
+func (s *session) CloseWithError(code uint32, msg string) error {
+	if code > MaxApplicationErrorCode {
+		return errInvalidApplicationErrorCode
+	}
+	return s.Close(&ApplicationError{ErrorCode: code, ReasonPhrase: msg})
+}
+
 // close the connection. Use this when called from the run loop
 func (s *session) close(e error) error {
 	err := s.closeImpl(e, false)
@@ -502,6 +662,11 @@ func (s *session) close(e error) error {
 	return err
 }
 
+// closeRemote is used when the peer closed the connection, e.g. by sending a Public Reset
+func (s *session) closeRemote(e error) {
+	s.closeImpl(e, true)
+}
+
 func (s *session) closeImpl(e error, remoteClose bool) error {
 	// Only close once
 	if !atomic.CompareAndSwapUint32(&s.closed, 0, 1) {
@@ -522,17 +687,30 @@ func (s *session) closeImpl(e error, remoteClose bool) error {
 		e = qerr.PeerGoingAway
 	}
 
-	quicErr := qerr.ToQuicError(e)
-
-	// Don't log 'normal' reasons
-	if quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout {
-		utils.Infof("Closing connection %x", s.connectionID)
+	var quicErr *qerr.QuicError
+	// streams are closed with the application error, such that it can be retrieved by the application
+	streamErr := e
+	if appErr, ok := e.(*ApplicationError); ok {
+		utils.Infof("Closing connection %x with %s", s.connectionID, appErr.Error())
+		if s.connectionParameters.ApplicationErrorCodesNegotiated() {
+			quicErr = qerr.Error(qerr.ErrorCode(appErr.wireErrorCode()), appErr.ReasonPhrase)
+		} else {
+			// the peer doesn't support application error codes, so we can only send the code in the reason phrase
+			quicErr = qerr.Error(qerr.PeerGoingAway, appErr.Error())
+		}
 	} else {
-		utils.Errorf("Closing session with error: %s", e.Error())
+		quicErr = qerr.ToQuicError(e)
+		streamErr = quicErr
+		// Don't log 'normal' reasons
+		if quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout {
+			utils.Infof("Closing connection %x", s.connectionID)
+		} else {
+			utils.Errorf("Closing session with error: %s", e.Error())
+		}
 	}
 
-	s.streamsMap.CloseWithError(quicErr)
-	s.closeStreamsWithError(quicErr)
+	s.streamsMap.CloseWithError(streamErr)
+	s.closeStreamsWithError(streamErr)
 
 	if remoteClose {
 		// If this is a remote close we don't need to send a CONNECTION_CLOSE
@@ -634,6 +812,8 @@ func (s *session) sendPacket() error {
 			return err
 		}
 		if packet == nil {
+			// we were allowed to send, but didn't have any data
+			s.sentPacketHandler.OnApplicationLimited()
 			return nil
 		}
 		// send every window update twice
@@ -703,11 +883,93 @@ func (s *session) GetOrOpenStream(id protocol.StreamID) (Stream, error) {
 	return nil, err
 }
 
+// ConnectionState returns details about the QUIC connection
+func (s *session) ConnectionState() ConnectionState {
+	return ConnectionState(s.cryptoSetup.ConnectionState())
+}
+
+// Stats returns a snapshot of the transport statistics of the session
+func (s *session) Stats() SessionStats {
+	s.statsMutex.Lock()
+	stats := s.stats
+	s.statsMutex.Unlock()
+	stats.OpenIncomingStreams, stats.OpenOutgoingStreams = s.streamsMap.NumOpenStreams()
+	return stats
+}
+
+// updateStats takes a snapshot of the statistics
+// it must only be called from the run loop
+func (s *session) updateStats() {
+	sphStats := s.sentPacketHandler.GetStatistics()
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	s.stats = SessionStats{
+		PacketsSent:           sphStats.PacketsSent,
+		PacketsReceived:       s.packetsReceived,
+		PacketsRetransmitted:  sphStats.PacketsRetransmitted,
+		PacketsLost:           sphStats.PacketsLost,
+		PacketsSpuriouslyLost: sphStats.PacketsSpuriouslyLost,
+		UndecryptablePackets:  s.numUndecryptablePackets,
+		BytesSent:             sphStats.BytesSent,
+		BytesReceived:         s.bytesReceived,
+		BytesRetransmitted:    sphStats.BytesRetransmitted,
+		BytesLost:             sphStats.BytesLost,
+		SmoothedRTT:           s.rttStats.SmoothedRTT(),
+		MinRTT:                s.rttStats.MinRTT(),
+		LatestRTT:             s.rttStats.LatestRTT(),
+		CongestionWindow:      sphStats.CongestionWindow,
+		BytesInFlight:         sphStats.BytesInFlight,
+		InSlowStart:           sphStats.InSlowStart,
+		BandwidthEstimate:     uint64(sphStats.BandwidthEstimate),
+	}
+}
+
 // AcceptStream returns the next stream openend by the peer
 func (s *session) AcceptStream() (Stream, error) {
 	return s.streamsMap.AcceptStream()
 }
 
+// AcceptStreamContext returns the next stream opened by the peer, or the context's error when it is cancelled
+func (s *session) AcceptStreamContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.AcceptStreamContext(ctx)
+}
+
+// GoAway sends a GOAWAY to the peer
+// Streams that are already open can be used until they are finished. The session is closed once all streams are finished.
+func (s *session) GoAway(code qerr.ErrorCode, reason string) error {
+	if atomic.LoadUint32(&s.closed) == 1 {
+		return errSessionAlreadyClosed
+	}
+	lastGoodStream, err := s.streamsMap.SentGoAway(&GoAwayError{
+		ErrorCode:    code,
+		ReasonPhrase: reason,
+	})
+	if err == errGoAwayAlreadySent {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.goAwayChan <- &frames.GoawayFrame{
+		ErrorCode:      code,
+		LastGoodStream: lastGoodStream,
+		ReasonPhrase:   reason,
+	}
+	return nil
+}
+
+// isDrained returns true if a GOAWAY was received, and all streams are finished
+func (s *session) isDrained() bool {
+	return s.streamsMap.IsDrained()
+}
+
+// ExcludeStreamFromDraining marks a stream that doesn't keep the session open after a GOAWAY
+// It is meant for control streams that stay open for the lifetime of the session, like the headers stream of HTTP/2.
+// It is not part of the Session interface, h2quic uses it via a type assertion.
+func (s *session) ExcludeStreamFromDraining(id protocol.StreamID) {
+	s.streamsMap.ExcludeFromDraining(id)
+}
+
 // OpenStream opens a stream
 func (s *session) OpenStream() (Stream, error) {
 	return s.streamsMap.OpenStream()
@@ -717,9 +979,18 @@ func (s *session) OpenStreamSync() (Stream, error) {
 	return s.streamsMap.OpenStreamSync()
 }
 
-func (s *session) queueResetStreamFrame(id protocol.StreamID, offset protocol.ByteCount) {
+// OpenStreamSyncContext opens a stream, or returns the context's error when it is cancelled
+func (s *session) OpenStreamSyncContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.OpenStreamSyncContext(ctx)
+}
+
+func (s *session) queueResetStreamFrame(id protocol.StreamID, offset protocol.ByteCount, errorCode uint32) {
+	if isApplicationErrorCode(errorCode) && !s.connectionParameters.ApplicationErrorCodesNegotiated() {
+		errorCode = 0
+	}
 	s.packer.QueueControlFrameForNextPacket(&frames.RstStreamFrame{
 		StreamID:   id,
+		ErrorCode:  errorCode,
 		ByteOffset: offset,
 	})
 	s.scheduleSending()
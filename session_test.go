@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net"
@@ -16,6 +17,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/lucas-clemente/quic-go/ackhandler"
+	"github.com/lucas-clemente/quic-go/congestion"
 	"github.com/lucas-clemente/quic-go/crypto"
 	"github.com/lucas-clemente/quic-go/frames"
 	"github.com/lucas-clemente/quic-go/handshake"
@@ -62,7 +64,10 @@ type mockSentPacketHandler struct {
 	retransmissionQueue  []*ackhandler.Packet
 	sentPackets          []*ackhandler.Packet
 	congestionLimited    bool
+	sendingAllowedAt     time.Time
 	requestedStopWaiting bool
+	applicationLimited   bool
+	congestion           congestion.SendAlgorithm
 }
 
 func (h *mockSentPacketHandler) SentPacket(packet *ackhandler.Packet) error {
@@ -75,9 +80,29 @@ func (h *mockSentPacketHandler) ReceivedAck(ackFrame *frames.AckFrame, withPacke
 }
 
 func (h *mockSentPacketHandler) GetLeastUnacked() protocol.PacketNumber { return 1 }
-func (h *mockSentPacketHandler) GetAlarmTimeout() time.Time             { panic("not implemented") }
-func (h *mockSentPacketHandler) OnAlarm()                               { panic("not implemented") }
-func (h *mockSentPacketHandler) SendingAllowed() bool                   { return !h.congestionLimited }
+func (h *mockSentPacketHandler) GetAlarmTimeout() time.Time             { return time.Time{} }
+func (h *mockSentPacketHandler) OnAlarm()                               {}
+
+func (h *mockSentPacketHandler) SendingAllowed() bool {
+	return !h.congestionLimited && !time.Now().Before(h.sendingAllowedAt)
+}
+
+func (h *mockSentPacketHandler) OnApplicationLimited() { h.applicationLimited = true }
+
+func (h *mockSentPacketHandler) GetPacingTimeout() time.Time {
+	if time.Now().Before(h.sendingAllowedAt) {
+		return h.sendingAllowedAt
+	}
+	return time.Time{}
+}
+
+func (h *mockSentPacketHandler) GetStatistics() ackhandler.SentPacketStatistics {
+	return ackhandler.SentPacketStatistics{}
+}
+
+func (h *mockSentPacketHandler) SetCongestionControl(congestion congestion.SendAlgorithm) {
+	h.congestion = congestion
+}
 
 func (h *mockSentPacketHandler) GetStopWaitingFrame(force bool) *frames.StopWaitingFrame {
 	h.requestedStopWaiting = true
@@ -147,6 +172,7 @@ var _ = Describe("Session", func() {
 			protocol.Version35,
 			0,
 			scfg,
+			populateServerConfig(&Config{}),
 			func(protocol.ConnectionID) { closeCallbackCalled = true },
 			func(Session, bool) {},
 		)
@@ -162,7 +188,7 @@ var _ = Describe("Session", func() {
 			"hostname",
 			protocol.Version35,
 			0,
-			nil,
+			populateClientConfig(&Config{}),
 			func(protocol.ConnectionID) { closeCallbackCalled = true },
 			func(Session, bool) {},
 			nil,
@@ -183,6 +209,7 @@ var _ = Describe("Session", func() {
 				protocol.VersionWhatever,
 				0,
 				scfg,
+				populateServerConfig(&Config{}),
 				func(protocol.ConnectionID) { closeCallbackCalled = true },
 				func(Session, bool) {},
 			)
@@ -199,6 +226,7 @@ var _ = Describe("Session", func() {
 				protocol.VersionWhatever,
 				0,
 				scfg,
+				populateServerConfig(&Config{}),
 				func(protocol.ConnectionID) { closeCallbackCalled = true },
 				func(Session, bool) {},
 			)
@@ -568,9 +596,10 @@ var _ = Describe("Session", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
-	It("errors on GOAWAY frames", func() {
+	It("handles GOAWAY frames", func() {
 		err := sess.handleFrames([]frames.Frame{&frames.GoawayFrame{}})
-		Expect(err).To(MatchError("unimplemented: handling GOAWAY frames"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sess.streamsMap.IsGoingAway()).To(BeTrue())
 	})
 
 	It("handles STOP_WAITING frames", func() {
@@ -586,6 +615,114 @@ var _ = Describe("Session", func() {
 		Expect(err).To(MatchError(qerr.Error(42, "foobar")))
 	})
 
+	Context("application errors", func() {
+		BeforeEach(func() {
+			cpm.applicationErrorCodes = true
+		})
+
+		It("handles CONNECTION_CLOSE frames with an application error code", func() {
+			str, _ := sess.GetOrOpenStream(5)
+			err := sess.handleFrames([]frames.Frame{&frames.ConnectionCloseFrame{ErrorCode: qerr.ErrorCode(applicationErrorFlag | 42), ReasonPhrase: "overloaded"}})
+			Expect(err).NotTo(HaveOccurred())
+			expectedErr := &ApplicationError{ErrorCode: 42, ReasonPhrase: "overloaded", Remote: true}
+			_, err = str.Read([]byte{0})
+			Expect(err).To(Equal(expectedErr))
+			_, err = sess.AcceptStream()
+			Expect(err).To(Equal(expectedErr))
+		})
+
+		It("handles RST_STREAM frames with an application error code", func() {
+			str, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			err = sess.handleRstStreamFrame(&frames.RstStreamFrame{
+				StreamID:  5,
+				ErrorCode: applicationErrorFlag | 42,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte{0})
+			Expect(err).To(Equal(&ApplicationError{ErrorCode: 42, Remote: true}))
+		})
+
+		It("sends the application error code when resetting a stream", func() {
+			str, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			err = str.ResetWithCode(42)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.packer.controlFrames).To(Equal([]frames.Frame{&frames.RstStreamFrame{
+				StreamID:  5,
+				ErrorCode: applicationErrorFlag | 42,
+			}}))
+		})
+
+		It("closes with an application error code", func() {
+			str, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			go sess.run()
+			err = sess.CloseWithError(42, "cancelled")
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(mconn.written).To(HaveLen(1))
+			Expect(mconn.written[0]).To(ContainSubstring(string([]byte{0x02, 42, 0, 0, 0x80, 9, 0, 'c', 'a', 'n', 'c', 'e', 'l', 'l', 'e', 'd'})))
+			_, err = str.Read([]byte{0})
+			Expect(err).To(Equal(&ApplicationError{ErrorCode: 42, ReasonPhrase: "cancelled"}))
+		})
+
+		It("refuses too large application error codes", func() {
+			err := sess.CloseWithError(MaxApplicationErrorCode+1, "foobar")
+			Expect(err).To(MatchError(errInvalidApplicationErrorCode))
+			Expect(atomic.LoadUint32(&sess.closed)).To(BeZero())
+		})
+
+		It("formats the error message", func() {
+			Expect((&ApplicationError{ErrorCode: 42}).Error()).To(Equal("application error 42"))
+			Expect((&ApplicationError{ErrorCode: 42, ReasonPhrase: "foobar"}).Error()).To(Equal("application error 42: foobar"))
+		})
+
+		Context("if the peer doesn't support application error codes", func() {
+			BeforeEach(func() {
+				cpm.applicationErrorCodes = false
+			})
+
+			It("doesn't interpret the error code of CONNECTION_CLOSE frames", func() {
+				str, _ := sess.GetOrOpenStream(5)
+				err := sess.handleFrames([]frames.Frame{&frames.ConnectionCloseFrame{ErrorCode: qerr.ErrorCode(applicationErrorFlag | 42), ReasonPhrase: "overloaded"}})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = str.Read([]byte{0})
+				Expect(err).To(MatchError(qerr.Error(qerr.ErrorCode(applicationErrorFlag|42), "overloaded")))
+			})
+
+			It("doesn't interpret the error code of RST_STREAM frames", func() {
+				str, err := sess.GetOrOpenStream(5)
+				Expect(err).ToNot(HaveOccurred())
+				err = sess.handleRstStreamFrame(&frames.RstStreamFrame{
+					StreamID:  5,
+					ErrorCode: applicationErrorFlag | 42,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte{0})
+				Expect(err).ToNot(BeAssignableToTypeOf(&ApplicationError{}))
+			})
+
+			It("resets a stream without an error code", func() {
+				str, err := sess.GetOrOpenStream(5)
+				Expect(err).ToNot(HaveOccurred())
+				err = str.ResetWithCode(42)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.packer.controlFrames).To(Equal([]frames.Frame{&frames.RstStreamFrame{StreamID: 5}}))
+			})
+
+			It("sends the application error in the reason phrase of a PeerGoingAway", func() {
+				go sess.run()
+				err := sess.CloseWithError(42, "cancelled")
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(areSessionsRunning).Should(BeFalse())
+				Expect(mconn.written).To(HaveLen(1))
+				Expect(mconn.written[0]).To(ContainSubstring(string([]byte{0x02, byte(qerr.PeerGoingAway), 0, 0, 0})))
+				Expect(mconn.written[0]).To(ContainSubstring("application error 42: cancelled"))
+			})
+		})
+	})
+
 	Context("accepting streams", func() {
 		It("waits for new streams", func() {
 			var str Stream
@@ -628,6 +765,17 @@ var _ = Describe("Session", func() {
 			Eventually(func() error { return err }).Should(HaveOccurred())
 			Expect(err).To(MatchError(testErr))
 		})
+
+		It("stops accepting when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			var err error
+			go func() {
+				_, err = sess.AcceptStreamContext(ctx)
+			}()
+			Consistently(func() error { return err }).ShouldNot(HaveOccurred())
+			cancel()
+			Eventually(func() error { return err }).Should(MatchError(context.Canceled))
+		})
 	})
 
 	Context("closing", func() {
@@ -687,6 +835,99 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("GOAWAY", func() {
+		It("sends a GOAWAY and waits for the peer to close the session", func() {
+			str, err := sess.GetOrOpenStream(3)
+			Expect(err).ToNot(HaveOccurred())
+			go sess.run()
+			err = sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).ToNot(HaveOccurred())
+			goaway := []byte{0x03, byte(qerr.PeerGoingAway), 0, 0, 0, 3, 0, 0, 0, 3, 0, 'b', 'y', 'e'}
+			Eventually(func() [][]byte { return mconn.written }).Should(HaveLen(1))
+			Expect(mconn.written[0]).To(ContainSubstring(string(goaway)))
+			str.(*stream).Cancel(errors.New("done"))
+			sess.scheduleSending()
+			Consistently(areSessionsRunning).Should(BeTrue())
+			sess.handleConnectionCloseFrame(&frames.ConnectionCloseFrame{ErrorCode: qerr.PeerGoingAway})
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(closeCallbackCalled).To(BeTrue())
+		})
+
+		It("closes the session once all streams are finished after receiving a GOAWAY", func() {
+			clientSess.conn = &mockConnection{remoteAddr: &net.UDPAddr{}}
+			go clientSess.run()
+			str, err := clientSess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			str.(*stream).Cancel(errors.New("done"))
+			err = clientSess.handleFrames([]frames.Frame{&frames.GoawayFrame{ErrorCode: qerr.PeerGoingAway, LastGoodStream: 3}})
+			Expect(err).ToNot(HaveOccurred())
+			clientSess.scheduleSending()
+			Eventually(clientSess.runClosed).Should(Receive())
+		})
+
+		It("doesn't wait for streams excluded from draining", func() {
+			clientSess.conn = &mockConnection{remoteAddr: &net.UDPAddr{}}
+			go clientSess.run()
+			headerStream, err := clientSess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			clientSess.ExcludeStreamFromDraining(headerStream.StreamID())
+			err = clientSess.handleFrames([]frames.Frame{&frames.GoawayFrame{ErrorCode: qerr.PeerGoingAway, LastGoodStream: 3}})
+			Expect(err).ToNot(HaveOccurred())
+			clientSess.scheduleSending()
+			Eventually(clientSess.runClosed).Should(Receive())
+		})
+
+		It("doesn't open new streams after sending a GOAWAY", func() {
+			err := sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.OpenStream()
+			Expect(err).To(MatchError(&GoAwayError{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "bye"}))
+		})
+
+		It("only sends one GOAWAY", func() {
+			err := sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).ToNot(HaveOccurred())
+			err = sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.goAwayChan).To(HaveLen(1))
+		})
+
+		It("errors when sending a GOAWAY on a closed session", func() {
+			go sess.run()
+			sess.Close(nil)
+			err := sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).To(MatchError(errSessionAlreadyClosed))
+		})
+
+		It("refuses streams opened by the peer after sending a GOAWAY", func() {
+			err := sess.GoAway(qerr.PeerGoingAway, "bye")
+			Expect(err).ToNot(HaveOccurred())
+			err = sess.handleStreamFrame(&frames.StreamFrame{StreamID: 5, Data: []byte("foobar")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.streamsMap.streams).ToNot(HaveKey(protocol.StreamID(5)))
+			Expect(sess.packer.controlFrames).To(Equal([]frames.Frame{&frames.RstStreamFrame{StreamID: 5}}))
+		})
+
+		It("handles a received GOAWAY", func() {
+			str3, err := clientSess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			str5, err := clientSess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			err = clientSess.handleFrames([]frames.Frame{&frames.GoawayFrame{
+				ErrorCode:      qerr.PeerGoingAway,
+				LastGoodStream: 3,
+				ReasonPhrase:   "bye",
+			}})
+			Expect(err).ToNot(HaveOccurred())
+			expectedErr := &GoAwayError{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "bye", Remote: true}
+			_, err = clientSess.OpenStream()
+			Expect(err).To(MatchError(expectedErr))
+			_, err = str5.Write([]byte("foobar"))
+			Expect(err).To(MatchError(expectedErr))
+			Expect(str3.(*stream).cancelled.Get()).To(BeFalse())
+		})
+	})
+
 	Context("receiving packets", func() {
 		var hdr *PublicHeader
 
@@ -1097,6 +1338,42 @@ var _ = Describe("Session", func() {
 			Expect(mconn.written[0]).To(ContainSubstring(string([]byte{0x37, 0x13})))
 		})
 
+		It("sets the timer to the pacing timer", func() {
+			sph := newMockSentPacketHandler().(*mockSentPacketHandler)
+			sph.sendingAllowedAt = time.Now().Add(20 * time.Millisecond)
+			sess.sentPacketHandler = sph
+			s, err := sess.GetOrOpenStream(5)
+			Expect(err).NotTo(HaveOccurred())
+			s.(*stream).dataForWriting = []byte("foobar")
+			sess.scheduleSending()
+			go sess.run()
+			defer sess.Close(nil)
+			Consistently(func() int { return len(mconn.written) }, 10*time.Millisecond).Should(BeZero())
+			Eventually(func() [][]byte { return mconn.written }).Should(HaveLen(1))
+			Expect(mconn.written[0]).To(ContainSubstring("foobar"))
+		})
+
+		It("tells the sent packet handler when it has no more data to send", func() {
+			sph := newMockSentPacketHandler().(*mockSentPacketHandler)
+			sess.sentPacketHandler = sph
+			s, err := sess.GetOrOpenStream(5)
+			Expect(err).NotTo(HaveOccurred())
+			s.(*stream).dataForWriting = []byte("foobar")
+			err = sess.sendPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sph.sentPackets).To(HaveLen(1))
+			Expect(sph.applicationLimited).To(BeTrue())
+		})
+
+		It("isn't application limited when it's blocked by the congestion controller", func() {
+			sph := newMockSentPacketHandler().(*mockSentPacketHandler)
+			sph.congestionLimited = true
+			sess.sentPacketHandler = sph
+			err := sess.sendPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sph.applicationLimited).To(BeFalse())
+		})
+
 		Context("bundling of small packets", func() {
 			It("bundles two small frames of different streams into one packet", func() {
 				s1, err := sess.GetOrOpenStream(5)
@@ -1321,7 +1598,7 @@ var _ = Describe("Session", func() {
 		})
 
 		It("times out due to non-completed crypto handshake", func(done Done) {
-			sess.sessionCreationTime = time.Now().Add(-time.Hour)
+			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
 			sess.run() // Would normally not return
 			Expect(mconn.written[0]).To(ContainSubstring("Crypto handshake did not complete in time."))
 			Expect(closeCallbackCalled).To(BeTrue())
@@ -1329,6 +1606,26 @@ var _ = Describe("Session", func() {
 			close(done)
 		})
 
+		It("uses the handshake timeout from the config", func(done Done) {
+			str, err := sess.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			errChan := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				_, err := str.Read([]byte{0})
+				errChan <- err
+			}()
+			sess.config.HandshakeTimeout = 50 * time.Millisecond
+			sess.run() // Would normally not return
+			Expect(mconn.written[0]).To(ContainSubstring("Crypto handshake did not complete in time."))
+			var streamErr error
+			Eventually(errChan).Should(Receive(&streamErr))
+			Expect(streamErr).To(HaveOccurred())
+			Expect(streamErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
+			Expect(streamErr.(*qerr.QuicError).Timeout()).To(BeTrue())
+			close(done)
+		})
+
 		It("does not use ICSL before handshake", func(done Done) {
 			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
 			cpm.idleTime = 99999 * time.Second
@@ -1390,6 +1687,70 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).ToNot(BeNil())
 		})
+
+		It("opens streams synchronously, with a context", func() {
+			str, err := sess.OpenStreamSyncContext(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).ToNot(BeNil())
+		})
+	})
+
+	It("returns the ConnectionState of the crypto setup", func() {
+		sess.cryptoSetup = &mockCryptoSetup{handshakeComplete: true}
+		state := sess.ConnectionState()
+		Expect(state.HandshakeComplete).To(BeTrue())
+		Expect(state.ServerName).To(Equal("quic.clemente.io"))
+	})
+
+	Context("statistics", func() {
+		It("counts received packets", func() {
+			sess.unpacker = &mockUnpacker{}
+			hdr := &PublicHeader{PacketNumber: 5, PacketNumberLen: protocol.PacketNumberLen6, Raw: []byte("raw")}
+			err := sess.handlePacketImpl(&receivedPacket{publicHeader: hdr, data: []byte("foobar")})
+			Expect(err).ToNot(HaveOccurred())
+			sess.updateStats()
+			stats := sess.Stats()
+			Expect(stats.PacketsReceived).To(Equal(uint64(1)))
+			Expect(stats.BytesReceived).To(Equal(protocol.ByteCount(9)))
+		})
+
+		It("reports the RTT", func() {
+			sess.rttStats.UpdateRTT(50*time.Millisecond, 0, time.Now())
+			sess.updateStats()
+			stats := sess.Stats()
+			Expect(stats.SmoothedRTT).To(Equal(50 * time.Millisecond))
+			Expect(stats.MinRTT).To(Equal(50 * time.Millisecond))
+			Expect(stats.LatestRTT).To(Equal(50 * time.Millisecond))
+		})
+
+		It("reports the congestion controller state", func() {
+			stats := sess.Stats()
+			Expect(stats.CongestionWindow).To(Equal(protocol.InitialCongestionWindow * protocol.DefaultTCPMSS))
+			Expect(stats.InSlowStart).To(BeTrue())
+		})
+
+		It("counts open streams, without the crypto stream", func() {
+			_, err := sess.GetOrOpenStream(3)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			stats := sess.Stats()
+			Expect(stats.OpenIncomingStreams).To(Equal(1))
+			Expect(stats.OpenOutgoingStreams).To(Equal(2))
+		})
+
+		It("counts undecryptable packets, while the run loop is running", func() {
+			sess.unpacker = &mockUnpacker{unpackErr: qerr.Error(qerr.DecryptionFailure, "")}
+			sess.cryptoSetup = &mockCryptoSetup{}
+			go sess.run()
+			sess.handlePacket(&receivedPacket{publicHeader: &PublicHeader{PacketNumber: 1}})
+			sess.handlePacket(&receivedPacket{publicHeader: &PublicHeader{PacketNumber: 2}})
+			Eventually(func() uint64 { return sess.Stats().UndecryptablePackets }).Should(Equal(uint64(2)))
+			Expect(sess.Stats().PacketsReceived).To(BeZero())
+			sess.Close(nil)
+		})
 	})
 
 	Context("counting streams", func() {
@@ -1458,6 +1819,99 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("congestion control", func() {
+		var (
+			congestionControlOptions [][]handshake.Tag
+			config                   *Config
+		)
+
+		BeforeEach(func() {
+			congestionControlOptions = nil
+			config = &Config{
+				CongestionControl: func(rttStats *congestion.RTTStats, connectionOptions []handshake.Tag) congestion.SendAlgorithm {
+					congestionControlOptions = append(congestionControlOptions, connectionOptions)
+					return DefaultCongestionControl(rttStats, connectionOptions)
+				},
+			}
+		})
+
+		It("creates the congestion controller of the server without connection options", func() {
+			_, err := newSession(mconn, protocol.Version35, 0, scfg, populateServerConfig(config), func(protocol.ConnectionID) {}, func(Session, bool) {})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(congestionControlOptions).To(HaveLen(1))
+			Expect(congestionControlOptions[0]).To(BeEmpty())
+		})
+
+		It("creates the congestion controller of the client with its connection options", func() {
+			config.ConnectionOptions = []handshake.Tag{handshake.TagTBBR}
+			_, err := newClientSession(nil, "hostname", protocol.Version35, 0, populateClientConfig(config), func(protocol.ConnectionID) {}, func(Session, bool) {}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(congestionControlOptions).To(Equal([][]handshake.Tag{{handshake.TagTBBR}}))
+		})
+
+		It("sends the connection options in the CHLO", func() {
+			config.ConnectionOptions = []handshake.Tag{handshake.TagTBBR}
+			s, err := newClientSession(nil, "hostname", protocol.Version35, 0, populateClientConfig(config), func(protocol.ConnectionID) {}, func(Session, bool) {}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			tags, err := s.connectionParameters.GetHelloMap()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).To(HaveKeyWithValue(handshake.TagCOPT, []byte("TBBR")))
+		})
+
+		Context("updating the congestion controller of the server", func() {
+			var (
+				s   *session
+				sph *mockSentPacketHandler
+			)
+
+			BeforeEach(func() {
+				pSess, err := newSession(mconn, protocol.Version35, 0, scfg, populateServerConfig(config), func(protocol.ConnectionID) {}, func(Session, bool) {})
+				Expect(err).ToNot(HaveOccurred())
+				s = pSess.(*session)
+				sph = newMockSentPacketHandler().(*mockSentPacketHandler)
+				s.sentPacketHandler = sph
+			})
+
+			It("replaces the congestion controller if the client sent connection options", func() {
+				err := s.connectionParameters.SetFromMap(map[handshake.Tag][]byte{handshake.TagCOPT: []byte("TBBRIW10")})
+				Expect(err).ToNot(HaveOccurred())
+				s.maybeUpdateCongestionControl()
+				Expect(sph.congestion).To(BeAssignableToTypeOf(congestion.NewPacingSender(nil, nil)))
+				Expect(congestionControlOptions).To(HaveLen(2))
+				Expect(congestionControlOptions[1]).To(Equal([]handshake.Tag{handshake.TagTBBR, handshake.TagIW10}))
+			})
+
+			It("keeps the congestion controller if the client didn't send connection options", func() {
+				s.maybeUpdateCongestionControl()
+				Expect(sph.congestion).To(BeNil())
+				Expect(congestionControlOptions).To(HaveLen(1))
+			})
+		})
+	})
+
+	It("uses the flow control windows from the config", func() {
+		s, err := newSession(
+			mconn,
+			protocol.Version35,
+			0,
+			scfg,
+			populateServerConfig(&Config{
+				ReceiveStreamFlowControlWindow:        1 << 20,
+				MaxReceiveStreamFlowControlWindow:     16 << 20,
+				ReceiveConnectionFlowControlWindow:    2 << 20,
+				MaxReceiveConnectionFlowControlWindow: 24 << 20,
+			}),
+			func(protocol.ConnectionID) {},
+			func(Session, bool) {},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		cp := s.(*session).connectionParameters
+		Expect(cp.GetReceiveStreamFlowControlWindow()).To(Equal(protocol.ByteCount(1 << 20)))
+		Expect(cp.GetMaxReceiveStreamFlowControlWindow()).To(Equal(protocol.ByteCount(16 << 20)))
+		Expect(cp.GetReceiveConnectionFlowControlWindow()).To(Equal(protocol.ByteCount(2 << 20)))
+		Expect(cp.GetMaxReceiveConnectionFlowControlWindow()).To(Equal(protocol.ByteCount(24 << 20)))
+	})
+
 	It("returns the local address", func() {
 		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 		mconn.localAddr = addr
@@ -3,7 +3,9 @@ package quic
 import (
 	"fmt"
 	"io"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/flowcontrol"
 	"github.com/lucas-clemente/quic-go/frames"
@@ -20,7 +22,7 @@ type stream struct {
 	streamID protocol.StreamID
 	onData   func()
 	// onReset is a callback that should send a RST_STREAM
-	onReset func(protocol.StreamID, protocol.ByteCount)
+	onReset func(id protocol.StreamID, offset protocol.ByteCount, errorCode uint32)
 
 	readPosInFrame int
 	writeOffset    protocol.ByteCount
@@ -42,17 +44,29 @@ type stream struct {
 
 	frameQueue        *streamFrameSorter
 	newFrameOrErrCond sync.Cond
+	readDeadline      time.Time
+	readDeadlineTimer *time.Timer
 
 	dataForWriting       []byte
 	finSent              utils.AtomicBool
 	rstSent              utils.AtomicBool
 	doneWritingOrErrCond sync.Cond
+	writeDeadline        time.Time
+	writeDeadlineTimer   *time.Timer
 
 	flowControlManager flowcontrol.FlowControlManager
 }
 
+type deadlineError struct{}
+
+func (deadlineError) Error() string   { return "deadline exceeded" }
+func (deadlineError) Temporary() bool { return true }
+func (deadlineError) Timeout() bool   { return true }
+
+var errDeadline net.Error = &deadlineError{}
+
 // newStream creates a new Stream
-func newStream(StreamID protocol.StreamID, onData func(), onReset func(protocol.StreamID, protocol.ByteCount), flowControlManager flowcontrol.FlowControlManager) (*stream, error) {
+func newStream(StreamID protocol.StreamID, onData func(), onReset func(protocol.StreamID, protocol.ByteCount, uint32), flowControlManager flowcontrol.FlowControlManager) (*stream, error) {
 	s := &stream{
 		onData:             onData,
 		onReset:            onReset,
@@ -93,6 +107,10 @@ func (s *stream) Read(p []byte) (int, error) {
 				err = s.err
 				break
 			}
+			if deadlinePassed(s.readDeadline) {
+				err = errDeadline
+				break
+			}
 			if frame != nil {
 				s.readPosInFrame = int(s.readOffset - frame.Offset)
 				break
@@ -156,6 +174,9 @@ func (s *stream) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if deadlinePassed(s.writeDeadline) {
+		return 0, errDeadline
+	}
 
 	s.dataForWriting = make([]byte, len(p))
 	copy(s.dataForWriting, p)
@@ -163,6 +184,13 @@ func (s *stream) Write(p []byte) (int, error) {
 	s.onData()
 
 	for s.dataForWriting != nil && s.err == nil {
+		if deadlinePassed(s.writeDeadline) {
+			// parts of the data might already have been sent
+			// drop the rest, so that the stream can be used for subsequent writes
+			n := len(p) - len(s.dataForWriting)
+			s.dataForWriting = nil
+			return n, errDeadline
+		}
 		s.doneWritingOrErrCond.Wait()
 	}
 
@@ -269,6 +297,15 @@ func (s *stream) Cancel(err error) {
 	s.mutex.Unlock()
 }
 
+// ResetWithCode resets the stream locally, sending an application error code to the peer
+func (s *stream) ResetWithCode(code uint32) error {
+	if code > MaxApplicationErrorCode {
+		return errInvalidApplicationErrorCode
+	}
+	s.Reset(&ApplicationError{ErrorCode: code})
+	return nil
+}
+
 // resets the stream locally
 func (s *stream) Reset(err error) {
 	if s.resetLocally.Get() {
@@ -283,7 +320,11 @@ func (s *stream) Reset(err error) {
 		s.doneWritingOrErrCond.Signal()
 	}
 	if s.shouldSendReset() {
-		s.onReset(s.streamID, s.writeOffset)
+		var errorCode uint32
+		if appErr, ok := err.(*ApplicationError); ok {
+			errorCode = appErr.wireErrorCode()
+		}
+		s.onReset(s.streamID, s.writeOffset, errorCode)
 		s.rstSent.Set(true)
 	}
 	s.mutex.Unlock()
@@ -302,7 +343,7 @@ func (s *stream) RegisterRemoteError(err error) {
 		s.doneWritingOrErrCond.Signal()
 	}
 	if s.shouldSendReset() {
-		s.onReset(s.streamID, s.writeOffset)
+		s.onReset(s.streamID, s.writeOffset, 0)
 		s.rstSent.Set(true)
 	}
 	s.mutex.Unlock()
@@ -323,3 +364,54 @@ func (s *stream) finished() bool {
 func (s *stream) StreamID() protocol.StreamID {
 	return s.streamID
 }
+
+// SetReadDeadline sets the deadline for future Read calls and any currently-blocked Read call.
+// A zero value for t means Read will not time out.
+func (s *stream) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.readDeadline = t
+	s.readDeadlineTimer = s.resetDeadlineTimer(s.readDeadlineTimer, t, &s.newFrameOrErrCond)
+	s.mutex.Unlock()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls and any currently-blocked Write call.
+// Even if a Write times out, it may return n > 0, indicating that some of the data was sent.
+// A zero value for t means Write will not time out.
+func (s *stream) SetWriteDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.writeDeadline = t
+	s.writeDeadlineTimer = s.resetDeadlineTimer(s.writeDeadlineTimer, t, &s.doneWritingOrErrCond)
+	s.mutex.Unlock()
+	return nil
+}
+
+// SetDeadline sets the read and write deadlines.
+// It is equivalent to calling both SetReadDeadline and SetWriteDeadline.
+func (s *stream) SetDeadline(t time.Time) error {
+	_ = s.SetReadDeadline(t)
+	_ = s.SetWriteDeadline(t)
+	return nil
+}
+
+// resetDeadlineTimer stops the old timer, and starts a new one that wakes up a blocked Read or Write once the deadline passes.
+// It must be called with the mutex held.
+func (s *stream) resetDeadlineTimer(timer *time.Timer, t time.Time, cond *sync.Cond) *time.Timer {
+	if timer != nil {
+		timer.Stop()
+	}
+	// wake up a blocked call, so that it takes the new deadline into account
+	cond.Signal()
+	if t.IsZero() {
+		return nil
+	}
+	return time.AfterFunc(t.Sub(time.Now()), func() {
+		s.mutex.Lock()
+		cond.Signal()
+		s.mutex.Unlock()
+	})
+}
+
+func deadlinePassed(t time.Time) bool {
+	return !t.IsZero() && !time.Now().Before(t)
+}
@@ -45,6 +45,38 @@ func (f *streamFramer) HasFramesForRetransmission() bool {
 	return len(f.retransmissionQueue) > 0
 }
 
+// HasCryptoStreamFrame says if there's data to send on the crypto stream
+func (f *streamFramer) HasCryptoStreamFrame() bool {
+	s := f.streamsMap.CryptoStream()
+	return s != nil && s.lenOfDataForWriting() > 0
+}
+
+// PopCryptoStreamFrame pops a StreamFrame that only contains crypto stream data
+// It returns nil if there's no crypto stream data to send.
+func (f *streamFramer) PopCryptoStreamFrame(maxLen protocol.ByteCount) *frames.StreamFrame {
+	s := f.streamsMap.CryptoStream()
+	if s == nil {
+		return nil
+	}
+	frame := &frames.StreamFrame{
+		StreamID:       s.streamID,
+		Offset:         s.writeOffset,
+		DataLenPresent: true,
+	}
+	frameHeaderBytes, _ := frame.MinLength(protocol.VersionWhatever) // can never error
+	if frameHeaderBytes >= maxLen {
+		return nil
+	}
+	sendWindowSize, _ := f.flowControlManager.SendWindowSize(s.streamID)
+	data := s.getDataForWriting(utils.MinByteCount(maxLen-frameHeaderBytes, sendWindowSize))
+	if data == nil {
+		return nil
+	}
+	frame.Data = data
+	f.flowControlManager.AddBytesSent(s.streamID, protocol.ByteCount(len(data)))
+	return frame
+}
+
 func (f *streamFramer) maybePopFramesForRetransmission(maxLen protocol.ByteCount) (res []*frames.StreamFrame, currentLen protocol.ByteCount) {
 	for len(f.retransmissionQueue) > 0 {
 		frame := f.retransmissionQueue[0]
@@ -272,6 +272,42 @@ var _ = Describe("Stream Framer", func() {
 		})
 	})
 
+	Context("crypto stream", func() {
+		var cryptoStream *stream
+
+		BeforeEach(func() {
+			cryptoStream = &stream{streamID: 1}
+			streamsMap.putStream(cryptoStream)
+			fcm.sendWindowSizes[1] = protocol.MaxByteCount
+		})
+
+		It("says if it has crypto stream data", func() {
+			Expect(framer.HasCryptoStreamFrame()).To(BeFalse())
+			cryptoStream.dataForWriting = []byte("foobar")
+			Expect(framer.HasCryptoStreamFrame()).To(BeTrue())
+		})
+
+		It("pops only crypto stream data", func() {
+			cryptoStream.dataForWriting = []byte("foobar")
+			stream1.dataForWriting = []byte("foobaz")
+			f := framer.PopCryptoStreamFrame(1000)
+			Expect(f.StreamID).To(Equal(protocol.StreamID(1)))
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			Expect(fcm.bytesSent).To(Equal(protocol.ByteCount(6)))
+			Expect(framer.HasCryptoStreamFrame()).To(BeFalse())
+			Expect(framer.PopCryptoStreamFrame(1000)).To(BeNil())
+		})
+
+		It("splits crypto stream data", func() {
+			cryptoStream.dataForWriting = []byte("foobar")
+			f := framer.PopCryptoStreamFrame(1 + 1 + 2 + 3) // type byte, stream ID, data length, and 3 bytes of data
+			Expect(f.Data).To(Equal([]byte("foo")))
+			f = framer.PopCryptoStreamFrame(1000)
+			Expect(f.Offset).To(Equal(protocol.ByteCount(3)))
+			Expect(f.Data).To(Equal([]byte("bar")))
+		})
+	})
+
 	Context("flow control", func() {
 		It("tells the FlowControlManager how many bytes it sent", func() {
 			stream1.dataForWriting = []byte("foobar")
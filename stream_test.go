@@ -3,6 +3,7 @@ package quic
 import (
 	"errors"
 	"io"
+	"net"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/congestion"
@@ -120,16 +121,18 @@ var _ = Describe("Stream", func() {
 		resetCalled          bool
 		resetCalledForStream protocol.StreamID
 		resetCalledAtOffset  protocol.ByteCount
+		resetCalledWithCode  uint32
 	)
 
 	onData := func() {
 		onDataCalled = true
 	}
 
-	onReset := func(id protocol.StreamID, offset protocol.ByteCount) {
+	onReset := func(id protocol.StreamID, offset protocol.ByteCount, code uint32) {
 		resetCalled = true
 		resetCalledForStream = id
 		resetCalledAtOffset = offset
+		resetCalledWithCode = code
 	}
 
 	BeforeEach(func() {
@@ -633,6 +636,22 @@ var _ = Describe("Stream", func() {
 				Expect(resetCalled).To(BeTrue())
 				Expect(resetCalledForStream).To(Equal(protocol.StreamID(1337)))
 				Expect(resetCalledAtOffset).To(Equal(protocol.ByteCount(0x1000)))
+				Expect(resetCalledWithCode).To(BeZero())
+			})
+
+			It("resets with an application error code", func() {
+				err := str.ResetWithCode(42)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resetCalled).To(BeTrue())
+				Expect(resetCalledWithCode).To(Equal(uint32(applicationErrorFlag | 42)))
+				_, err = str.Write([]byte("foobar"))
+				Expect(err).To(MatchError(&ApplicationError{ErrorCode: 42}))
+			})
+
+			It("refuses too large application error codes", func() {
+				err := str.ResetWithCode(MaxApplicationErrorCode + 1)
+				Expect(err).To(MatchError(errInvalidApplicationErrorCode))
+				Expect(resetCalled).To(BeFalse())
 			})
 
 			It("doesn't call onReset if it already sent a FIN", func() {
@@ -660,6 +679,130 @@ var _ = Describe("Stream", func() {
 		})
 	})
 
+	Context("deadlines", func() {
+		Context("reading", func() {
+			It("returns an error when Read is called after the deadline", func() {
+				err := str.AddStreamFrame(&frames.StreamFrame{Data: []byte("foobar")})
+				Expect(err).ToNot(HaveOccurred())
+				str.SetReadDeadline(time.Now().Add(-time.Second))
+				b := make([]byte, 6)
+				n, err := str.Read(b)
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+			})
+
+			It("unblocks Read when the deadline is reached", func() {
+				deadline := time.Now().Add(50 * time.Millisecond)
+				str.SetReadDeadline(deadline)
+				b := make([]byte, 6)
+				n, err := str.Read(b)
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+				Expect(time.Now()).To(BeTemporally("~", deadline, 20*time.Millisecond))
+			})
+
+			It("unblocks Read when the deadline is changed", func() {
+				str.SetReadDeadline(time.Now().Add(time.Hour))
+				var err error
+				var returned bool
+				go func() {
+					_, err = str.Read(make([]byte, 6))
+					returned = true
+				}()
+				Consistently(func() bool { return returned }).Should(BeFalse())
+				str.SetReadDeadline(time.Now().Add(-time.Second))
+				Eventually(func() bool { return returned }).Should(BeTrue())
+				Expect(err).To(MatchError(errDeadline))
+			})
+
+			It("returns a net.Error with Timeout() == true", func() {
+				str.SetReadDeadline(time.Now().Add(-time.Second))
+				_, err := str.Read(make([]byte, 6))
+				Expect(err).To(HaveOccurred())
+				nerr, ok := err.(net.Error)
+				Expect(ok).To(BeTrue())
+				Expect(nerr.Timeout()).To(BeTrue())
+			})
+
+			It("continues reading after the deadline was reset", func() {
+				str.SetReadDeadline(time.Now().Add(-time.Second))
+				_, err := str.Read(make([]byte, 6))
+				Expect(err).To(MatchError(errDeadline))
+				str.SetReadDeadline(time.Time{})
+				err = str.AddStreamFrame(&frames.StreamFrame{Data: []byte("foobar")})
+				Expect(err).ToNot(HaveOccurred())
+				b := make([]byte, 6)
+				n, err := str.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(6))
+				Expect(b).To(Equal([]byte("foobar")))
+			})
+		})
+
+		Context("writing", func() {
+			It("returns an error when Write is called after the deadline", func() {
+				str.SetWriteDeadline(time.Now().Add(-time.Second))
+				n, err := str.Write([]byte("foobar"))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+				Expect(str.lenOfDataForWriting()).To(BeZero())
+			})
+
+			It("unblocks Write when the deadline is reached", func() {
+				deadline := time.Now().Add(50 * time.Millisecond)
+				str.SetWriteDeadline(deadline)
+				n, err := str.Write([]byte("foobar"))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+				Expect(time.Now()).To(BeTemporally("~", deadline, 20*time.Millisecond))
+				Expect(str.getDataForWriting(1000)).To(BeNil())
+			})
+
+			It("returns the number of bytes sent when the deadline is reached", func() {
+				str.SetWriteDeadline(time.Now().Add(time.Hour))
+				var n int
+				var err error
+				var returned bool
+				go func() {
+					n, err = str.Write([]byte("foobar"))
+					returned = true
+				}()
+				Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).ShouldNot(BeZero())
+				Expect(str.getDataForWriting(2)).To(Equal([]byte("fo")))
+				str.SetWriteDeadline(time.Now().Add(-time.Second))
+				Eventually(func() bool { return returned }).Should(BeTrue())
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(Equal(2))
+				Expect(str.lenOfDataForWriting()).To(BeZero())
+			})
+
+			It("continues writing after the deadline was reset", func() {
+				str.SetWriteDeadline(time.Now().Add(-time.Second))
+				_, err := str.Write([]byte("foo"))
+				Expect(err).To(MatchError(errDeadline))
+				str.SetWriteDeadline(time.Time{})
+				var returned bool
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.Write([]byte("bar"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(3))
+					returned = true
+				}()
+				Eventually(func() protocol.ByteCount { return str.lenOfDataForWriting() }).ShouldNot(BeZero())
+				Expect(str.getDataForWriting(1000)).To(Equal([]byte("bar")))
+				Eventually(func() bool { return returned }).Should(BeTrue())
+			})
+		})
+
+		It("sets both read and write deadlines", func() {
+			deadline := time.Now().Add(time.Hour)
+			str.SetDeadline(deadline)
+			Expect(str.readDeadline).To(Equal(deadline))
+			Expect(str.writeDeadline).To(Equal(deadline))
+		})
+	})
+
 	Context("writing", func() {
 		It("writes and gets all data at once", func(done Done) {
 			var writeReturned bool
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -29,6 +30,16 @@ type streamsMap struct {
 	closeErr           error
 	nextStreamToAccept protocol.StreamID
 
+	// goAwayErr is set when a GOAWAY was sent or received. No new streams can be opened after that.
+	goAwayErr error
+	// sentGoAway is true if we sent a GOAWAY. The peer may not open streams with IDs larger than lastGoodStream after that.
+	sentGoAway     bool
+	lastGoodStream protocol.StreamID
+	// receivedGoAway is true if the peer sent a GOAWAY. We close the session once all streams are finished then.
+	receivedGoAway bool
+	// streams that don't keep the session open after a GOAWAY, e.g. control streams that are never closed
+	drainExemptStreams map[protocol.StreamID]bool
+
 	newStream newStreamLambda
 
 	numOutgoingStreams uint32
@@ -39,7 +50,9 @@ type streamLambda func(*stream) (bool, error)
 type newStreamLambda func(protocol.StreamID) (*stream, error)
 
 var (
-	errMapAccess = errors.New("streamsMap: Error accessing the streams map")
+	errMapAccess         = errors.New("streamsMap: Error accessing the streams map")
+	errStreamRefused     = errors.New("streamsMap: refused stream opened by the peer after sending a GOAWAY")
+	errGoAwayAlreadySent = errors.New("streamsMap: GOAWAY already sent")
 )
 
 func newStreamsMap(newStream newStreamLambda, pers protocol.Perspective, connectionParameters handshake.ConnectionParametersManager) *streamsMap {
@@ -113,6 +126,9 @@ func (m *streamsMap) GetOrOpenStream(id protocol.StreamID) (*stream, error) {
 }
 
 func (m *streamsMap) openRemoteStream(id protocol.StreamID) (*stream, error) {
+	if m.sentGoAway && id > m.lastGoodStream {
+		return nil, errStreamRefused
+	}
 	if m.numIncomingStreams >= m.connectionParameters.GetMaxIncomingStreams() {
 		return nil, qerr.TooManyOpenStreams
 	}
@@ -140,6 +156,9 @@ func (m *streamsMap) openRemoteStream(id protocol.StreamID) (*stream, error) {
 }
 
 func (m *streamsMap) openStreamImpl() (*stream, error) {
+	if m.goAwayErr != nil {
+		return nil, m.goAwayErr
+	}
 	id := m.nextStream
 	if m.numOutgoingStreams >= m.connectionParameters.GetMaxOutgoingStreams() {
 		return nil, qerr.TooManyOpenStreams
@@ -169,12 +188,23 @@ func (m *streamsMap) OpenStream() (*stream, error) {
 	return m.openStreamImpl()
 }
 
+// OpenStreamSync opens the next available stream
+// it blocks until the peer's concurrent stream limit allows a new stream to be opened
 func (m *streamsMap) OpenStreamSync() (*stream, error) {
+	return m.OpenStreamSyncContext(context.Background())
+}
+
+// OpenStreamSyncContext is like OpenStreamSync, but returns when the context is cancelled
+func (m *streamsMap) OpenStreamSyncContext(ctx context.Context) (*stream, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	stopWaking := m.wakeOnCancel(ctx, &m.openStreamOrErrCond)
+	defer stopWaking()
+
 	for {
-		if m.closeErr != nil {
+		// after a GOAWAY, the session is closed once it is drained. Opening a stream still returns the GOAWAY error then.
+		if m.closeErr != nil && m.goAwayErr == nil {
 			return nil, m.closeErr
 		}
 		str, err := m.openStreamImpl()
@@ -184,6 +214,12 @@ func (m *streamsMap) OpenStreamSync() (*stream, error) {
 		if err != nil && err != qerr.TooManyOpenStreams {
 			return nil, err
 		}
+		if err := ctx.Err(); err != nil {
+			// RemoveStream only wakes up a single waiter
+			// pass the wake-up on, in case it was meant for us
+			m.openStreamOrErrCond.Signal()
+			return nil, err
+		}
 		m.openStreamOrErrCond.Wait()
 	}
 }
@@ -191,8 +227,17 @@ func (m *streamsMap) OpenStreamSync() (*stream, error) {
 // AcceptStream returns the next stream opened by the peer
 // it blocks until a new stream is opened
 func (m *streamsMap) AcceptStream() (*stream, error) {
+	return m.AcceptStreamContext(context.Background())
+}
+
+// AcceptStreamContext is like AcceptStream, but returns when the context is cancelled
+func (m *streamsMap) AcceptStreamContext(ctx context.Context) (*stream, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+
+	stopWaking := m.wakeOnCancel(ctx, &m.nextStreamOrErrCond)
+	defer stopWaking()
+
 	var str *stream
 	for {
 		var ok bool
@@ -203,12 +248,34 @@ func (m *streamsMap) AcceptStream() (*stream, error) {
 		if ok {
 			break
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		m.nextStreamOrErrCond.Wait()
 	}
 	m.nextStreamToAccept += 2
 	return str, nil
 }
 
+// wakeOnCancel wakes up all goroutines waiting on cond when the context is cancelled
+// the returned function must be called once the caller stops waiting
+func (m *streamsMap) wakeOnCancel(ctx context.Context, cond *sync.Cond) func() {
+	if ctx.Done() == nil { // the context can never be cancelled
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.mutex.Lock()
+			cond.Broadcast()
+			m.mutex.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 func (m *streamsMap) Iterate(fn streamLambda) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -273,6 +340,13 @@ func (m *streamsMap) iterateFunc(streamID protocol.StreamID, fn streamLambda) (b
 	return fn(str)
 }
 
+// CryptoStream returns the crypto stream, or nil if it wasn't opened yet
+func (m *streamsMap) CryptoStream() *stream {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.streams[1]
+}
+
 func (m *streamsMap) putStream(s *stream) error {
 	id := s.StreamID()
 	if _, ok := m.streams[id]; ok {
@@ -284,6 +358,24 @@ func (m *streamsMap) putStream(s *stream) error {
 	return nil
 }
 
+// NumOpenStreams returns the number of open streams opened by the peer and by us, not counting the crypto stream
+func (m *streamsMap) NumOpenStreams() (incoming int, outgoing int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, id := range m.openStreams {
+		if id == 1 {
+			continue
+		}
+		if m.streamInitiatedLocally(id) {
+			outgoing++
+		} else {
+			incoming++
+		}
+	}
+	return
+}
+
 // Attention: this function must only be called if a mutex has been acquired previously
 func (m *streamsMap) RemoveStream(id protocol.StreamID) error {
 	s, ok := m.streams[id]
@@ -314,6 +406,84 @@ func (m *streamsMap) RemoveStream(id protocol.StreamID) error {
 	return nil
 }
 
+// SentGoAway is called when we send a GOAWAY
+// It returns the ID of the last stream opened by the peer. Streams opened by the peer after that are refused.
+func (m *streamsMap) SentGoAway(err error) (protocol.StreamID, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closeErr != nil {
+		return 0, m.closeErr
+	}
+	if m.sentGoAway {
+		return 0, errGoAwayAlreadySent
+	}
+	if m.goAwayErr == nil {
+		m.goAwayErr = err
+	}
+	m.sentGoAway = true
+	m.lastGoodStream = m.highestStreamOpenedByPeer
+	m.openStreamOrErrCond.Broadcast()
+	return m.lastGoodStream, nil
+}
+
+// ReceivedGoAway is called when the peer sends a GOAWAY
+// Streams opened by us with IDs larger than lastGoodStream were not processed by the peer, and are cancelled with err.
+func (m *streamsMap) ReceivedGoAway(lastGoodStream protocol.StreamID, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.goAwayErr == nil {
+		m.goAwayErr = err
+	}
+	m.receivedGoAway = true
+	for _, id := range m.openStreams {
+		if id > lastGoodStream && id != 1 && m.streamInitiatedLocally(id) {
+			m.streams[id].Cancel(err)
+		}
+	}
+	m.openStreamOrErrCond.Broadcast()
+}
+
+// ExcludeFromDraining marks a stream that doesn't keep the session open after a GOAWAY
+func (m *streamsMap) ExcludeFromDraining(id protocol.StreamID) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.drainExemptStreams == nil {
+		m.drainExemptStreams = make(map[protocol.StreamID]bool)
+	}
+	m.drainExemptStreams[id] = true
+}
+
+// IsDrained returns true if the peer sent a GOAWAY, and all streams are finished
+// The crypto stream and streams excluded from draining are not taken into account.
+// After sending a GOAWAY, we wait for the peer to close the session, since only the peer knows when it has read all data from its streams.
+func (m *streamsMap) IsDrained() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if !m.receivedGoAway {
+		return false
+	}
+	for _, id := range m.openStreams {
+		if id != 1 && !m.drainExemptStreams[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsGoingAway returns true if a GOAWAY was sent or received
+func (m *streamsMap) IsGoingAway() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.goAwayErr != nil
+}
+
+func (m *streamsMap) streamInitiatedLocally(id protocol.StreamID) bool {
+	return (id%2 == 0) == (m.perspective == protocol.PerspectiveServer)
+}
+
 func (m *streamsMap) CloseWithError(err error) {
 	m.mutex.Lock()
 	m.closeErr = err
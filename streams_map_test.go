@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"math"
 	"time"
@@ -13,9 +14,10 @@ import (
 )
 
 type mockConnectionParametersManager struct {
-	maxIncomingStreams uint32
-	maxOutgoingStreams uint32
-	idleTime           time.Duration
+	maxIncomingStreams    uint32
+	maxOutgoingStreams    uint32
+	idleTime              time.Duration
+	applicationErrorCodes bool
 }
 
 func (m *mockConnectionParametersManager) SetFromMap(map[handshake.Tag][]byte) error {
@@ -47,7 +49,11 @@ func (m *mockConnectionParametersManager) GetMaxIncomingStreams() uint32 { retur
 func (m *mockConnectionParametersManager) GetIdleConnectionStateLifetime() time.Duration {
 	return m.idleTime
 }
-func (m *mockConnectionParametersManager) TruncateConnectionID() bool { return false }
+func (m *mockConnectionParametersManager) GetConnectionOptions() []handshake.Tag { return nil }
+func (m *mockConnectionParametersManager) TruncateConnectionID() bool            { return false }
+func (m *mockConnectionParametersManager) ApplicationErrorCodesNegotiated() bool {
+	return m.applicationErrorCodes
+}
 
 var _ handshake.ConnectionParametersManager = &mockConnectionParametersManager{}
 
@@ -281,6 +287,52 @@ var _ = Describe("Streams Map", func() {
 						_, err := m.OpenStreamSync()
 						Expect(err).To(MatchError(testErr))
 					})
+
+					It("stops waiting when the context is cancelled", func() {
+						openMaxNumStreams()
+						ctx, cancel := context.WithCancel(context.Background())
+						var err error
+						var returned bool
+						go func() {
+							_, err = m.OpenStreamSyncContext(ctx)
+							returned = true
+						}()
+
+						Consistently(func() bool { return returned }).Should(BeFalse())
+						cancel()
+						Eventually(func() bool { return returned }).Should(BeTrue())
+						Expect(err).To(MatchError(context.Canceled))
+					})
+
+					It("opens a stream with a context that was already cancelled, if the stream limit allows it", func() {
+						ctx, cancel := context.WithCancel(context.Background())
+						cancel()
+						str, err := m.OpenStreamSyncContext(ctx)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(str).ToNot(BeNil())
+					})
+
+					It("wakes up another waiter when a cancelled waiter was woken up", func() {
+						openMaxNumStreams()
+						ctx, cancel := context.WithCancel(context.Background())
+						var cancelledReturned, returned bool
+						go func() {
+							_, _ = m.OpenStreamSyncContext(ctx)
+							cancelledReturned = true
+						}()
+						go func() {
+							defer GinkgoRecover()
+							_, err := m.OpenStreamSync()
+							Expect(err).ToNot(HaveOccurred())
+							returned = true
+						}()
+						Consistently(func() bool { return returned }).Should(BeFalse())
+						cancel()
+						Eventually(func() bool { return cancelledReturned }).Should(BeTrue())
+						err := m.RemoveStream(6)
+						Expect(err).ToNot(HaveOccurred())
+						Eventually(func() bool { return returned }).Should(BeTrue())
+					})
 				})
 			})
 
@@ -408,6 +460,34 @@ var _ = Describe("Streams Map", func() {
 					_, err := m.AcceptStream()
 					Expect(err).To(MatchError(testErr))
 				})
+
+				It("stops waiting when the context is cancelled", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					var acceptErr error
+					go func() {
+						_, acceptErr = m.AcceptStreamContext(ctx)
+					}()
+					Consistently(func() error { return acceptErr }).ShouldNot(HaveOccurred())
+					cancel()
+					Eventually(func() error { return acceptErr }).Should(MatchError(context.Canceled))
+				})
+
+				It("returns the context's error when the deadline is exceeded", func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+					defer cancel()
+					_, err := m.AcceptStreamContext(ctx)
+					Expect(err).To(MatchError(context.DeadlineExceeded))
+				})
+
+				It("accepts a stream that is already available, even if the context was cancelled", func() {
+					_, err := m.GetOrOpenStream(1)
+					Expect(err).ToNot(HaveOccurred())
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+					str, err := m.AcceptStreamContext(ctx)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.StreamID()).To(Equal(protocol.StreamID(1)))
+				})
 			})
 		})
 
@@ -476,6 +556,180 @@ var _ = Describe("Streams Map", func() {
 		})
 	})
 
+	Context("counting open streams", func() {
+		It("counts streams opened by the peer and by us, as a server", func() {
+			setNewStreamsMap(protocol.PerspectiveServer)
+			_, err := m.GetOrOpenStream(1) // crypto stream
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			incoming, outgoing := m.NumOpenStreams()
+			Expect(incoming).To(Equal(2))
+			Expect(outgoing).To(Equal(1))
+			err = m.RemoveStream(3)
+			Expect(err).ToNot(HaveOccurred())
+			incoming, outgoing = m.NumOpenStreams()
+			Expect(incoming).To(Equal(1))
+			Expect(outgoing).To(Equal(1))
+		})
+
+		It("counts streams opened by the peer and by us, as a client", func() {
+			setNewStreamsMap(protocol.PerspectiveClient)
+			_, err := m.OpenStream() // crypto stream
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.GetOrOpenStream(2)
+			Expect(err).ToNot(HaveOccurred())
+			incoming, outgoing := m.NumOpenStreams()
+			Expect(incoming).To(Equal(1))
+			Expect(outgoing).To(Equal(1))
+		})
+	})
+
+	Context("GOAWAY", func() {
+		goAwayErr := errors.New("going away")
+
+		Context("sending a GOAWAY", func() {
+			BeforeEach(func() {
+				setNewStreamsMap(protocol.PerspectiveServer)
+			})
+
+			It("returns the highest stream opened by the peer", func() {
+				_, err := m.GetOrOpenStream(5)
+				Expect(err).ToNot(HaveOccurred())
+				lastGoodStream, err := m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lastGoodStream).To(Equal(protocol.StreamID(5)))
+				Expect(m.IsGoingAway()).To(BeTrue())
+			})
+
+			It("only sends a GOAWAY once", func() {
+				_, err := m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.SentGoAway(goAwayErr)
+				Expect(err).To(MatchError(errGoAwayAlreadySent))
+			})
+
+			It("doesn't send a GOAWAY after the streams map was closed", func() {
+				testErr := errors.New("closed")
+				m.CloseWithError(testErr)
+				_, err := m.SentGoAway(goAwayErr)
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("refuses new streams opened by the peer", func() {
+				_, err := m.GetOrOpenStream(5)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				str, err := m.GetOrOpenStream(3)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str).ToNot(BeNil())
+				_, err = m.GetOrOpenStream(7)
+				Expect(err).To(MatchError(errStreamRefused))
+				Expect(m.streams).ToNot(HaveKey(protocol.StreamID(7)))
+			})
+
+			It("doesn't open new streams", func() {
+				_, err := m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStream()
+				Expect(err).To(MatchError(goAwayErr))
+			})
+
+			It("unblocks OpenStreamSync", func() {
+				cpm.(*mockConnectionParametersManager).maxOutgoingStreams = 0
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := m.OpenStreamSync()
+					Expect(err).To(MatchError(goAwayErr))
+					close(done)
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				_, err := m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("is not drained, since the peer closes the session", func() {
+				_, err := m.GetOrOpenStream(1) // crypto stream
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.SentGoAway(goAwayErr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m.IsDrained()).To(BeFalse())
+			})
+		})
+
+		Context("receiving a GOAWAY", func() {
+			BeforeEach(func() {
+				setNewStreamsMap(protocol.PerspectiveClient)
+			})
+
+			It("cancels streams that were not processed by the peer", func() {
+				_, err := m.OpenStream() // crypto stream
+				Expect(err).ToNot(HaveOccurred())
+				str3, err := m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				str5, err := m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				str2, err := m.GetOrOpenStream(2)
+				Expect(err).ToNot(HaveOccurred())
+				m.ReceivedGoAway(3, goAwayErr)
+				Expect(str3.cancelled.Get()).To(BeFalse())
+				Expect(str5.cancelled.Get()).To(BeTrue())
+				Expect(str2.cancelled.Get()).To(BeFalse())
+				Expect(str5.err).To(MatchError(goAwayErr))
+			})
+
+			It("doesn't open new streams", func() {
+				m.ReceivedGoAway(0, goAwayErr)
+				Expect(m.IsGoingAway()).To(BeTrue())
+				_, err := m.OpenStream()
+				Expect(err).To(MatchError(goAwayErr))
+			})
+
+			It("is drained once all streams are finished", func() {
+				_, err := m.OpenStream() // crypto stream
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m.IsDrained()).To(BeFalse())
+				m.ReceivedGoAway(3, goAwayErr)
+				Expect(m.IsDrained()).To(BeFalse())
+				err = m.RemoveStream(3)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m.IsDrained()).To(BeTrue())
+			})
+
+			It("doesn't wait for streams excluded from draining", func() {
+				_, err := m.OpenStream() // crypto stream
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				m.ExcludeFromDraining(3)
+				m.ReceivedGoAway(5, goAwayErr)
+				Expect(m.IsDrained()).To(BeFalse())
+				err = m.RemoveStream(5)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(m.IsDrained()).To(BeTrue())
+			})
+
+			It("still sends a GOAWAY after receiving one", func() {
+				m.ReceivedGoAway(0, goAwayErr)
+				_, err := m.SentGoAway(errors.New("sent"))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStream()
+				Expect(err).To(MatchError(goAwayErr))
+			})
+		})
+	})
+
 	Context("DoS mitigation, iterating and deleting", func() {
 		BeforeEach(func() {
 			setNewStreamsMap(protocol.PerspectiveServer)